@@ -25,6 +25,7 @@ import (
 	"github.com/pinpt/agent/pkg/expsessions"
 	"github.com/pinpt/agent/pkg/fsconf"
 	"github.com/pinpt/agent/pkg/jsonstore"
+	"github.com/pinpt/agent/pkg/kvstore"
 
 	"github.com/pinpt/agent/pkg/gitclone"
 	"github.com/pinpt/agent/slimrippy/exportrepo"
@@ -116,7 +117,11 @@ var cmdExportRepo = &cobra.Command{
 		}
 		locs := fsconf.New(pinpointRoot)
 
-		lastProcessed, err := jsonstore.New(locs.LastProcessedFile)
+		state, err := kvstore.OpenState(logger, locs)
+		if err != nil {
+			panic(err)
+		}
+		lastProcessed, err := jsonstore.New(state)
 		if err != nil {
 			panic(err)
 		}
@@ -153,6 +158,7 @@ var cmdExportRepo = &cobra.Command{
 			UniqueName:        dummyRepo.GetReadableID(),
 			CustomerID:        customerID,
 			LastProcessed:     lastProcessed,
+			State:             state,
 			CommitURLTemplate: commiturl.CommitURLTemplate(dummyRepo, url),
 			BranchURLTemplate: commiturl.BranchURLTemplate(dummyRepo, url),
 			RefType:           reftype,
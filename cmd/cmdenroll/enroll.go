@@ -19,6 +19,7 @@ import (
 
 	"github.com/pinpt/agent/pkg/agentconf"
 	"github.com/pinpt/agent/pkg/fsconf"
+	"github.com/pinpt/agent/pkg/secrets"
 
 	"github.com/pinpt/agent/pkg/deviceinfo"
 
@@ -251,7 +252,11 @@ func (s *enroller) ProcessResult(res agent.EnrollResponse) error {
 	}
 	conf.LogLevel = s.opts.LogLevel
 
-	err = agentconf.Save(conf, s.fsconf.Config2)
+	ring, err := secrets.LoadKeyring(s.fsconf)
+	if err != nil {
+		return err
+	}
+	err = agentconf.Save(conf, s.fsconf.Config2, ring)
 	if err != nil {
 		return fmt.Errorf("could not save config, err: %v", err)
 	}
@@ -0,0 +1,186 @@
+package cmdexport
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/pkg/expin"
+	"github.com/pinpt/agent/pkg/fs"
+	"github.com/pinpt/agent/pkg/jsonstore"
+	"github.com/pinpt/agent/pkg/secrets"
+	"github.com/pinpt/agent/rpcdef"
+)
+
+// checkpoints stores repos/projects completed in the current export job, see rpcdef.CheckpointSessionName. Allows resuming the export of the same job after the service is restarted, without exporting completed projects again.
+//
+// Last processed is saved together with every checkpoint, so that it matches the closed session files kept in uploads dir. Dedup store is not saved, since it also contains objects from sessions that were not completed.
+//
+// Integrations only queue git repos of the project, git processing runs later. Queued repos are saved together with checkpoints until processed and are queued again when export is resumed, see GitQueued and GitDone.
+type checkpoints struct {
+	loc           string
+	lastProcessed *jsonstore.Store
+	ring          *secrets.Keyring
+
+	mu   sync.Mutex
+	data checkpointsData
+}
+
+type checkpointsData struct {
+	JobID string                 `json:"job_id"`
+	Done  map[string]interface{} `json:"done"`
+	// Git contains queued git repos that were not processed yet, key is integration@repo_id
+	Git map[string]checkpointGitRepo `json:"git"`
+}
+
+type checkpointGitRepo struct {
+	// Integration is expin.Export.String() of the integration that queued the repo
+	Integration string `json:"integration"`
+	// Fetch contains repo url with sealed credentials
+	Fetch rpcdef.GitRepoFetch `json:"fetch"`
+}
+
+// CheckpointJobID returns the id of the export job that created the checkpoints file. Returns empty string if the file does not exist.
+func CheckpointJobID(loc string) (string, error) {
+	data, err := loadCheckpoints(loc)
+	return data.JobID, err
+}
+
+func loadCheckpoints(loc string) (res checkpointsData, _ error) {
+	b, err := ioutil.ReadFile(loc)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return res, nil
+		}
+		return res, err
+	}
+	err = json.Unmarshal(b, &res)
+	return res, err
+}
+
+// newCheckpoints loads checkpoints saved by the previous run of the same job, checkpoints of other jobs are discarded. When jobID is empty, checkpoints are only kept in memory.
+func newCheckpoints(logger hclog.Logger, loc string, jobID string, lastProcessed *jsonstore.Store, ring *secrets.Keyring) (*checkpoints, error) {
+	s := &checkpoints{}
+	s.lastProcessed = lastProcessed
+	s.ring = ring
+	s.data.JobID = jobID
+	s.data.Done = map[string]interface{}{}
+	s.data.Git = map[string]checkpointGitRepo{}
+	if jobID == "" {
+		return s, nil
+	}
+	s.loc = loc
+	data, err := loadCheckpoints(loc)
+	if err != nil {
+		return nil, err
+	}
+	if data.JobID == jobID && data.Done != nil {
+		if data.Git == nil {
+			data.Git = map[string]checkpointGitRepo{}
+		}
+		if err := s.unsealGit(data); err != nil {
+			// key was rotated, projects are exported again so that their git repos are queued
+			logger.Warn("could not unseal git repos queued by interrupted export, discarding export checkpoints", "err", err)
+		} else {
+			s.data = data
+		}
+	}
+	// saved on start, so that exporter knows that state was modified by this job
+	err = s.save()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *checkpoints) save() error {
+	b, err := json.Marshal(s.data)
+	if err != nil {
+		return err
+	}
+	return fs.WriteToTempAndRename(bytes.NewReader(b), s.loc)
+}
+
+func (s *checkpoints) Get(key ...string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.Done[strings.Join(key, "@")]
+}
+
+func (s *checkpoints) Set(value interface{}, key ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Done[strings.Join(key, "@")] = value
+	if s.loc == "" {
+		return nil
+	}
+	err := s.lastProcessed.Save()
+	if err != nil {
+		return err
+	}
+	return s.save()
+}
+
+func gitKey(exp expin.Export, repoID string) string {
+	return exp.String() + "@" + repoID
+}
+
+// GitQueued records git repo queued by the integration. It is saved with the next checkpoint, which is always after the repo was queued.
+func (s *checkpoints) GitQueued(exp expin.Export, fetch rpcdef.GitRepoFetch) error {
+	if s.loc == "" {
+		return nil
+	}
+	var err error
+	fetch.URL, err = s.ring.Seal(fetch.URL)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Git[gitKey(exp, fetch.RepoID)] = checkpointGitRepo{Integration: exp.String(), Fetch: fetch}
+	return nil
+}
+
+// GitDone removes git repo after it was processed
+func (s *checkpoints) GitDone(exp expin.Export, repoID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := gitKey(exp, repoID)
+	if _, ok := s.data.Git[k]; !ok {
+		return nil
+	}
+	delete(s.data.Git, k)
+	if s.loc == "" {
+		return nil
+	}
+	return s.save()
+}
+
+// GitPending returns git repos queued by the interrupted run of the same job, that were not processed
+func (s *checkpoints) GitPending() (res []checkpointGitRepo, _ error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, repo := range s.data.Git {
+		var err error
+		repo.Fetch.URL, err = s.ring.Unseal(repo.Fetch.URL)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, repo)
+	}
+	return
+}
+
+func (s *checkpoints) unsealGit(data checkpointsData) error {
+	for _, repo := range data.Git {
+		_, err := s.ring.Unseal(repo.Fetch.URL)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
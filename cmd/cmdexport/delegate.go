@@ -48,6 +48,10 @@ func (s agentDelegate) ExportGitRepo(fetch rpcdef.GitRepoFetch) error {
 	fetch2 := gitRepoFetch{}
 	fetch2.GitRepoFetch = fetch
 	fetch2.exp = s.expin
+	err := s.export.checkpoints.GitQueued(s.expin, fetch)
+	if err != nil {
+		return err
+	}
 	s.export.gitProcessingRepos <- fetch2
 	return nil
 }
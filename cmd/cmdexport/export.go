@@ -19,12 +19,16 @@ import (
 	"github.com/pinpt/agent/pkg/expin"
 	"github.com/pinpt/agent/pkg/expsessions"
 	"github.com/pinpt/agent/pkg/fs"
+	"github.com/pinpt/agent/pkg/githubapp"
 	"github.com/pinpt/agent/pkg/memorylogs"
+	"github.com/pinpt/agent/pkg/metrics"
 	"github.com/pinpt/go-common/api"
 
 	plugin "github.com/hashicorp/go-plugin"
 	"github.com/pinpt/agent/cmd/cmdintegration"
 	"github.com/pinpt/agent/pkg/jsonstore"
+	"github.com/pinpt/agent/pkg/kvstore"
+	"github.com/pinpt/agent/pkg/secrets"
 	"github.com/pinpt/agent/rpcdef"
 	pjson "github.com/pinpt/go-common/json"
 )
@@ -78,7 +82,9 @@ type export struct {
 
 	stderr *bytes.Buffer
 
+	state         *kvstore.Store
 	lastProcessed *jsonstore.Store
+	checkpoints   *checkpoints
 
 	gitProcessingRepos chan gitRepoFetch
 	deviceInfo         deviceinfo.CommonInfo
@@ -90,6 +96,9 @@ type export struct {
 	gitResults map[expin.Export]map[string]error
 
 	isIncremental map[expin.Export]bool
+
+	// githubAppTokens refreshes clone credentials of github integrations using app auth, nil for other integrations
+	githubAppTokens map[expin.Export]*githubapp.Tokens
 }
 
 type gitRepoFetch struct {
@@ -137,7 +146,24 @@ func (s *export) Run() (_ Result, rerr error) {
 
 	s.Command.Deviceinfo = s.deviceInfo
 
-	if opts.ReprocessHistorical {
+	jobID := opts.AgentConfig.Backend.ExportJobID
+	checkpointJobID, err := CheckpointJobID(s.Locs.ExportCheckpointFile)
+	if err != nil {
+		rerr = err
+		return
+	}
+	resumed := jobID != "" && checkpointJobID == jobID
+
+	s.state, err = kvstore.OpenState(s.Logger, s.Locs)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	if resumed {
+		// incremental data was already discarded by the interrupted run if needed
+		s.Logger.Info("Resuming interrupted export of the same job, skipping completed repos/projects", "job_id", jobID)
+	} else if opts.ReprocessHistorical {
 		s.Logger.Info("Starting export. ReprocessHistorical is true, discarding incremental checkpoints")
 		err := s.discardIncrementalData()
 		if err != nil {
@@ -148,13 +174,23 @@ func (s *export) Run() (_ Result, rerr error) {
 		s.Logger.Info("Starting export. ReprocessHistorical is false, will use incremental checkpoints if available.")
 	}
 
-	var err error
-	s.lastProcessed, err = jsonstore.New(s.Locs.LastProcessedFile)
+	s.lastProcessed, err = jsonstore.New(s.state)
 	if err != nil {
 		rerr = err
 		return
 	}
 
+	ring, err := secrets.LoadKeyring(s.Locs)
+	if err != nil {
+		rerr = err
+		return
+	}
+	s.checkpoints, err = newCheckpoints(s.Logger, s.Locs.ExportCheckpointFile, jobID, s.lastProcessed, ring)
+	if err != nil {
+		rerr = fmt.Errorf("could not load export checkpoints: %v", err)
+		return
+	}
+
 	err = s.checkIfIncremental()
 	if err != nil {
 		rerr = err
@@ -189,8 +225,23 @@ func (s *export) Run() (_ Result, rerr error) {
 		return
 	}
 
+	err = s.requeueGitRepos()
+	if err != nil {
+		rerr = err
+		return
+	}
+
 	memorylogs.Start(ctx, s.Logger, 5*time.Second)
 
+	// served by run service together with metrics of integration processes
+	metrics.StartWriter(ctx, s.Logger, s.Locs.Metrics, 10*time.Second)
+	defer func() {
+		err := metrics.WriteFile(s.Locs.Metrics)
+		if err != nil {
+			s.Logger.Warn("could not write metrics", "err", err)
+		}
+	}()
+
 	runResult := s.runExports()
 	close(s.gitProcessingRepos)
 
@@ -241,6 +292,32 @@ func (s *export) Run() (_ Result, rerr error) {
 	return s.formatResults(runResult, startTime), nil
 }
 
+// requeueGitRepos queues git repos of projects completed by the interrupted run of the same job, that were not processed before the export was stopped. Completed projects are skipped, so integrations do not queue them again.
+func (s *export) requeueGitRepos() error {
+	pending, err := s.checkpoints.GitPending()
+	if err != nil {
+		return err
+	}
+	for _, repo := range pending {
+		found := false
+		for exp := range s.Integrations {
+			if exp.String() != repo.Integration {
+				continue
+			}
+			found = true
+			s.Logger.Info("Queueing git repo from checkpoint", "integration", repo.Integration, "repo", repo.Fetch.UniqueName)
+			fetch := gitRepoFetch{}
+			fetch.exp = exp
+			fetch.GitRepoFetch = repo.Fetch
+			s.gitProcessingRepos <- fetch
+		}
+		if !found {
+			s.Logger.Warn("Integration of git repo queued in checkpoint is not exported, skipping", "integration", repo.Integration, "repo", repo.Fetch.UniqueName)
+		}
+	}
+	return nil
+}
+
 func (s *export) tempFilesInUploads() ([]string, error) {
 	uploadsExist, err := fs.Exists(s.Locs.Uploads)
 	if err != nil {
@@ -268,7 +345,7 @@ func (s *export) tempFilesInUploads() ([]string, error) {
 				res = append(res, sr...)
 				continue
 			}
-			if !strings.HasSuffix(n, ".temp.gz") {
+			if !strings.HasSuffix(n, ".temp.gz") && !strings.HasSuffix(n, ".ndjson.temp") {
 				continue
 			}
 			res = append(res, n)
@@ -279,11 +356,13 @@ func (s *export) tempFilesInUploads() ([]string, error) {
 }
 
 func (s *export) discardIncrementalData() error {
-	err := os.RemoveAll(s.Locs.LastProcessedFile)
-	if err != nil {
-		return err
-	}
-	return os.RemoveAll(s.Locs.RipsrcCheckpoints)
+	return s.state.Update(func(tx *kvstore.Tx) error {
+		err := tx.Clear(kvstore.BucketLastProcessed)
+		if err != nil {
+			return err
+		}
+		return tx.Clear(kvstore.BucketRipsrcCheckpoints)
+	})
 }
 
 func (s *export) checkIfIncremental() error {
@@ -3,12 +3,15 @@ package cmdexport
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"time"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/pinpt/agent/pkg/expin"
 	"github.com/pinpt/agent/pkg/expsessions"
 	"github.com/pinpt/agent/pkg/gitclone"
+	"github.com/pinpt/agent/pkg/githubapp"
+	"github.com/pinpt/agent/pkg/reqstats"
 	"github.com/pinpt/agent/slimrippy/exportrepo"
 )
 
@@ -53,6 +56,75 @@ func (s *export) gitSetResult(exp expin.Export, repoID string, err error) {
 	s.gitResults[exp][repoID] = err
 }
 
+// gitAccessURL returns url used for cloning the repo. Github app installation tokens are valid for 1 hour and repos could be queued for longer, so token in url is replaced with a fresh one.
+func (s *export) gitAccessURL(logger hclog.Logger, fetch gitRepoFetch) (string, error) {
+	u, err := url.Parse(fetch.URL)
+	if err != nil {
+		return "", err
+	}
+	if u.User == nil || u.User.Username() != githubapp.CloneUser("").Username() {
+		return fetch.URL, nil
+	}
+	tokens, err := s.githubApp(logger, fetch.exp)
+	if err != nil {
+		return "", err
+	}
+	if tokens == nil {
+		return fetch.URL, nil
+	}
+	token, err := tokens.Token()
+	if err != nil {
+		return "", err
+	}
+	u.User = githubapp.CloneUser(token)
+	return u.String(), nil
+}
+
+func (s *export) githubApp(logger hclog.Logger, exp expin.Export) (*githubapp.Tokens, error) {
+	if s.githubAppTokens == nil {
+		s.githubAppTokens = map[expin.Export]*githubapp.Tokens{}
+	}
+	if tokens, ok := s.githubAppTokens[exp]; ok {
+		return tokens, nil
+	}
+	config := s.Integrations[exp].ExportConfig.Integration.Config
+	conf, ok, err := githubapp.ConfigFromMap(config)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		s.githubAppTokens[exp] = nil
+		return nil, nil
+	}
+	githubURL, _ := config["url"].(string)
+	if githubURL == "" {
+		githubURL = "https://github.com"
+	}
+	apiURL, err := githubapp.APIURL(githubURL)
+	if err != nil {
+		return nil, err
+	}
+	clientManager, err := reqstats.New(reqstats.Opts{
+		Logger: logger,
+		// same as github integration, enterprise installs could use self-signed certs
+		TLSInsecureSkipVerify: apiURL != "https://api.github.com",
+	})
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := githubapp.New(githubapp.Opts{
+		Logger: logger,
+		Client: clientManager.Clients.TLSInsecure,
+		APIURL: apiURL,
+		Config: conf,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.githubAppTokens[exp] = tokens
+	return tokens, nil
+}
+
 func (s *export) gitProcessing() (hadErrors bool, fatalError error) {
 	logger := s.Logger.Named("git")
 
@@ -87,15 +159,21 @@ func (s *export) gitProcessing() (hadErrors bool, fatalError error) {
 			start = time.Now()
 		}
 		i++
-		access := gitclone.AccessDetails{}
-		access.URL = fetch.URL
-
 		sessionID, err := s.gitSession(logger, fetch.exp)
 		if err != nil {
 			fatalError = err
 			return
 		}
 
+		access := gitclone.AccessDetails{}
+		access.URL, err = s.gitAccessURL(logger, fetch)
+		if err != nil {
+			logger.Error("could not get git access url", "repo", fetch.UniqueName, "err", err)
+			s.gitSetResult(fetch.exp, fetch.RepoID, err)
+			resErrors[fetch.UniqueName] = err
+			continue
+		}
+
 		opts := exportrepo.Opts{
 			Logger:     s.Logger.With("c", i),
 			CustomerID: s.Opts.AgentConfig.CustomerID,
@@ -104,6 +182,7 @@ func (s *export) gitProcessing() (hadErrors bool, fatalError error) {
 			RefType:    fetch.RefType,
 
 			LastProcessed: s.lastProcessed,
+			State:         s.state,
 			RepoAccess:    access,
 
 			CommitURLTemplate: fetch.CommitURLTemplate,
@@ -133,6 +212,13 @@ func (s *export) gitProcessing() (hadErrors bool, fatalError error) {
 		err = runResult.OtherErr
 		s.gitSetResult(fetch.exp, fetch.RepoID, err)
 		s.sessions.expsession.Progress(sessionID, i, 0)
+		if err == nil || err == exportrepo.ErrRevParseFailed {
+			// failed repos are kept in checkpoint and retried if export is resumed
+			if err := s.checkpoints.GitDone(fetch.exp, fetch.RepoID); err != nil {
+				fatalError = err
+				return
+			}
+		}
 		if err == exportrepo.ErrRevParseFailed {
 			reposFailedRevParse++
 			continue
@@ -1,9 +1,11 @@
 package cmdexport
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -13,6 +15,8 @@ import (
 	"github.com/pinpt/agent/pkg/commitusers"
 	"github.com/pinpt/agent/pkg/expin"
 	"github.com/pinpt/agent/pkg/expsessions"
+	"github.com/pinpt/agent/pkg/expsink"
+	"github.com/pinpt/agent/pkg/fs"
 	"github.com/pinpt/agent/rpcdef"
 )
 
@@ -41,17 +45,14 @@ func newSessions(logger hclog.Logger, export *export, trackProgress bool) (_ *se
 		s.progressTracker = expsessions.NewProgressTracker()
 	}
 
-	newWriter := func(modelName string, id expsessions.ID) expsessions.Writer {
-		return expsessions.NewFileWriter(modelName, export.Locs.Uploads, id)
+	newWriter, err := expsink.NewWriterFunc(export.Opts.AgentConfig.Output, export.Locs.Uploads)
+	if err != nil {
+		rerr = err
+		return
 	}
 
 	if os.Getenv("PP_AGENT_DISABLE_DEDUP") == "" {
-		var err error
-		s.dedupStore, err = expsessions.NewDedupStore(export.Locs.DedupFile)
-		if err != nil {
-			rerr = err
-			return
-		}
+		s.dedupStore = expsessions.NewDedupStore(export.state)
 		newWriterPrev := newWriter
 		newWriter = func(modelName string, id expsessions.ID) expsessions.Writer {
 			wr := newWriterPrev(modelName, id)
@@ -73,6 +74,8 @@ func newSessions(logger hclog.Logger, export *export, trackProgress bool) (_ *se
 				s.progressTracker.Done(progressPath.StringsWithObjectNames())
 			}
 		},
+		Checkpoints:    export.checkpoints,
+		CheckpointName: rpcdef.CheckpointSessionName,
 	})
 
 	if s.trackProgress {
@@ -97,6 +100,12 @@ func (s *sessions) sendProgress() {
 		s.logger.Debug("progress", "data", "\n\n"+res+"\n\n")
 	}
 
+	// served by status api of run service
+	err := s.saveProgress()
+	if err != nil {
+		s.logger.Error("could not save progress file", "err", err)
+	}
+
 	if s.export.Opts.AgentConfig.Backend.Enable {
 		skipDone := false
 		if os.Getenv("PP_AGENT_NO_PROGRESS_ALL") != "" {
@@ -122,6 +131,18 @@ func (s *sessions) sendProgress() {
 	}
 }
 
+func (s *sessions) saveProgress() error {
+	b, err := json.Marshal(s.progressTracker.ProgressLinesNestedMap(false))
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(s.export.Locs.ExportProgressFile), 0777)
+	if err != nil {
+		return err
+	}
+	return fs.WriteToTempAndRename(bytes.NewReader(b), s.export.Locs.ExportProgressFile)
+}
+
 func (s *sessions) Close() error {
 
 	if s.trackProgress {
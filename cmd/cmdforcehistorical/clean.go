@@ -1,45 +1,26 @@
 package cmdforcehistorical
 
 import (
-	"encoding/json"
-	"io/ioutil"
-	"strings"
+	"errors"
 
 	hclog "github.com/hashicorp/go-hclog"
-	pjson "github.com/pinpt/go-common/json"
+	"github.com/pinpt/agent/pkg/fsconf"
+	"github.com/pinpt/agent/pkg/kvstore"
 )
 
-func Run(logger hclog.Logger, integrationName string, lastProcessed string, dedup string) error {
-
-	var lastProcessedMap map[string]string
-	if err := pjson.ReadFile(lastProcessed, &lastProcessedMap); err != nil {
-		return err
-	}
-	newLastProcessedMap := map[string]string{}
-	for key, value := range lastProcessedMap {
-		if !strings.HasPrefix(key, integrationName) {
-			newLastProcessedMap[key] = value
-		}
+func Run(logger hclog.Logger, integrationName string, locs fsconf.Locs) error {
+	if integrationName == "" {
+		return errors.New("provide integration name")
 	}
-	data, err := json.Marshal(newLastProcessedMap)
+	state, err := kvstore.OpenState(logger, locs)
 	if err != nil {
 		return err
 	}
-	if err := ioutil.WriteFile(lastProcessed, data, 0755); err != nil {
-		return err
-	}
-
-	var dedupMap map[string]interface{}
-	if err := pjson.ReadFile(dedup, &dedupMap); err != nil {
-		return err
-	}
-	delete(dedupMap, integrationName)
-	data, err = json.Marshal(dedupMap)
-	if err != nil {
-		return err
-	}
-	if err := ioutil.WriteFile(dedup, data, 0755); err != nil {
-		return err
-	}
-	return nil
+	return state.Update(func(tx *kvstore.Tx) error {
+		if err := tx.DeletePrefix(kvstore.BucketLastProcessed, integrationName); err != nil {
+			return err
+		}
+		// dedup keys start with ref_type, which is the same as integration name, see kvstore.DedupKey
+		return tx.DeletePrefix(kvstore.BucketDedup, integrationName+"@")
+	})
 }
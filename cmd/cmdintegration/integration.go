@@ -22,6 +22,8 @@ import (
 	"github.com/pinpt/agent/pkg/deviceinfo"
 	"github.com/pinpt/agent/pkg/fsconf"
 	"github.com/pinpt/agent/pkg/iloader"
+	"github.com/pinpt/agent/pkg/metrics"
+	"github.com/pinpt/agent/pkg/secrets"
 	"github.com/pinpt/agent/rpcdef"
 	"github.com/pinpt/go-common/datamodel"
 	"github.com/pinpt/go-common/event"
@@ -54,6 +56,12 @@ type AgentConfig struct {
 		// ExportJobID is passed to backend in progress event
 		ExportJobID string `json:"export_job_id"`
 	} `json:"backend"`
+
+	// Output defines where export writes data. Pinpoint output writes gzip files for cmdupload, other outputs write ndjson files which are published by expsink.
+	Output agentconf.Output `json:"output"`
+
+	// IntegrationStateKey is set when exports run concurrently. Export uses separate uploads, last processed and dedup state for the key, see fsconf.Locs.ForIntegration.
+	IntegrationStateKey string `json:"integration_state_key"`
 }
 
 func (s AgentConfig) Locs() (res fsconf.Locs, _ error) {
@@ -65,7 +73,11 @@ func (s AgentConfig) Locs() (res fsconf.Locs, _ error) {
 		}
 		root = v
 	}
-	return fsconf.New(root), nil
+	res = fsconf.New(root)
+	if s.IntegrationStateKey != "" {
+		res = res.ForIntegration(s.IntegrationStateKey)
+	}
+	return res, nil
 }
 
 type Integration struct {
@@ -138,8 +150,11 @@ func NewCommand(opts Opts) (*Command, error) {
 	}
 
 	if opts.AgentConfig.Backend.Enable {
-		var err error
-		s.EnrollConf, err = agentconf.Load(s.Locs.Config2)
+		ring, err := secrets.LoadKeyring(s.Locs)
+		if err != nil {
+			return nil, err
+		}
+		s.EnrollConf, err = agentconf.Load(s.Locs.Config2, ring)
 		if err != nil {
 			return nil, err
 		}
@@ -237,9 +252,28 @@ func (s *Command) SetupIntegrations(
 	return nil
 }
 
+// NewIntegrationPlugin starts the plugin for passed integration without setting up shutdown handling. Used when the plugin is kept running in the service, where the caller is responsible for closing it.
+func (s *Command) NewIntegrationPlugin(exp expin.Export, agent rpcdef.Agent) (*iloader.Integration, error) {
+	opts := iloader.IntegrationOpts{}
+	opts.Logger = s.Logger
+	opts.Agent = agent
+	opts.Export = exp
+	opts.Locs = s.Locs
+	opts.IntegrationsDir = s.integrationsDir
+	opts.DevUseCompiledIntegrations = s.devUseCompiledIntegrations
+	return iloader.NewIntegration(opts)
+}
+
 func (s *Command) CloseOnlyIntegrationAndHandlePanic(integration *iloader.Integration) error {
+	_, err := s.CloseOnlyIntegrationAndDetectPanic(integration)
+	return err
+}
+
+// CloseOnlyIntegrationAndDetectPanic is the same as CloseOnlyIntegrationAndHandlePanic, but also returns true if the plugin panicked
+func (s *Command) CloseOnlyIntegrationAndDetectPanic(integration *iloader.Integration) (panicked bool, _ error) {
 	panicOut, err := integration.CloseAndDetectPanic()
 	if panicOut != "" {
+		metrics.Add(metrics.PluginCrashes, 1, "integration", integration.Export.IntegrationDef.Name)
 		// This is already printed in integration logs, but easier to debug if it's repeated in stdout.
 		fmt.Println("Panic in integration")
 		fmt.Println(panicOut)
@@ -255,10 +289,7 @@ func (s *Command) CloseOnlyIntegrationAndHandlePanic(integration *iloader.Integr
 			}
 		}
 	}
-	if err != nil {
-		return err
-	}
-	return nil
+	return panicOut != "", err
 }
 
 func (s *Command) CaptureShutdown() {
@@ -272,6 +303,9 @@ func (s *Command) CaptureShutdown() {
 func (s *Command) SendPauseEvent(export expin.Export, msg string, resumeDate time.Time) error {
 	s.Logger.Info("pausing integration due to throttling", "msg", msg, "integration", export.String(), "duration", resumeDate.Sub(time.Now()).String())
 
+	metrics.Add(metrics.RateLimitWaits, 1, "integration", export.IntegrationDef.Name)
+	metrics.Add(metrics.RateLimitWaitSeconds, time.Until(resumeDate).Seconds(), "integration", export.IntegrationDef.Name)
+
 	data := &agent.Pause{
 		Data:        &msg,
 		Type:        agent.PauseTypePause,
@@ -0,0 +1,313 @@
+package exporter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pinpt/agent/cmd/cmdexport"
+	"github.com/pinpt/agent/cmd/cmdrunnorestarts/inconfig"
+	"github.com/pinpt/agent/pkg/expsink"
+	"github.com/pinpt/agent/pkg/fsconf"
+	"github.com/pinpt/agent/pkg/metrics"
+	"github.com/pinpt/agent/pkg/sysinfo"
+	"github.com/pinpt/integration-sdk/agent"
+)
+
+// memoryPerExport is the estimated memory needed for one export, including git processing
+const memoryPerExport = 2 * 1024 * 1024 * 1024
+
+// maxConcurrentExports returns the number of integrations that can be exported at the same time. Uses half of the CPUs and memoryPerExport for every export. Configured value is used if it is lower.
+func maxConcurrentExports(configured int, info sysinfo.SystemInfo) int {
+	res := info.NumCPU / 2
+	if info.TotalMemory != 0 {
+		byMemory := int(info.TotalMemory / memoryPerExport)
+		if byMemory < res {
+			res = byMemory
+		}
+	}
+	if configured > 0 && configured < res {
+		res = configured
+	}
+	if res < 1 {
+		res = 1
+	}
+	return res
+}
+
+// integrationStateKey returns the key used for state dir and locking of the integration, based on integration name, type and id. Integrations passed from backend always have ID. For integrations in config without ID the hash of auth config is used instead, integrations with the same auth config are merged into one, see dedupInclusionsAndMergeUsers.
+func integrationStateKey(in inconfig.IntegrationAgent) string {
+	id := in.ID
+	if id == "" {
+		h := sha256.Sum256([]byte(authToString(in.Config)))
+		id = hex.EncodeToString(h[:4])
+	}
+	return sanitizeStateKey(in.IntegrationDef().String() + "-" + id)
+}
+
+func sanitizeStateKey(v string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, v)
+}
+
+// integrationLocks allows only one export of the same integration at a time
+type integrationLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func newIntegrationLocks() *integrationLocks {
+	return &integrationLocks{locks: map[string]*sync.Mutex{}}
+}
+
+// lockAll locks all passed keys. Keys are locked in sorted order to avoid deadlocks between requests containing the same integrations.
+func (s *integrationLocks) lockAll(keys []string) (unlock func()) {
+	keys = uniqueSorted(keys)
+	var locked []*sync.Mutex
+	for _, key := range keys {
+		s.mu.Lock()
+		l := s.locks[key]
+		if l == nil {
+			l = &sync.Mutex{}
+			s.locks[key] = l
+		}
+		s.mu.Unlock()
+		l.Lock()
+		locked = append(locked, l)
+	}
+	return func() {
+		for _, l := range locked {
+			l.Unlock()
+		}
+	}
+}
+
+func uniqueSorted(keys []string) (res []string) {
+	m := map[string]bool{}
+	for _, k := range keys {
+		if m[k] {
+			continue
+		}
+		m[k] = true
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return
+}
+
+func (s *Exporter) setIntegrationsRunning(keys []string, integrations []inconfig.IntegrationAgent, running bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update := func(m map[string]int, key string) {
+		if running {
+			m[key]++
+			return
+		}
+		m[key]--
+		if m[key] <= 0 {
+			delete(m, key)
+		}
+	}
+	for i, key := range keys {
+		update(s.runningIntegrations, key)
+		if id := integrations[i].ID; id != "" {
+			update(s.runningIntegrationIDs, id)
+		}
+	}
+}
+
+// IsIntegrationRunning returns true if there is an export in progress or waiting for the integration with passed id
+func (s *Exporter) IsIntegrationRunning(integrationID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.runningIntegrationIDs[integrationID] != 0
+}
+
+// integrationExport is the result of exporting one integration
+type integrationExport struct {
+	Key     string
+	Locs    fsconf.Locs
+	Result  cmdexport.Result
+	LogFile string
+	Err     error
+	// UploadParts and UploadSize are set when export is uploaded to pinpoint
+	UploadParts int
+	UploadSize  int64
+}
+
+// integrationStateKeys returns state keys for all integrations in the request
+func integrationStateKeys(integrations []inconfig.IntegrationAgent) (res []string) {
+	for _, in := range integrations {
+		res = append(res, integrationStateKey(in))
+	}
+	return
+}
+
+// IntegrationLocs returns the state key and locations of the integration, the same as used by exports. State shared by all integrations is copied into integration state if it does not exist yet. Used to process webhooks with the same state as exports.
+func (s *Exporter) IntegrationLocs(in inconfig.IntegrationAgent) (stateKey string, _ fsconf.Locs, _ error) {
+	stateKey = integrationStateKey(in)
+	locs := s.opts.FSConf.ForIntegration(stateKey)
+	err := migrateIntegrationState(s.logger, s.opts.FSConf, locs)
+	if err != nil {
+		return "", locs, err
+	}
+	return stateKey, locs, nil
+}
+
+// lockIntegrations marks integrations as running and waits for other exports of the same integrations to finish.
+//
+// Integrations are locked until the whole request is processed, including upload, so that exports of the same integration from different requests run one after another. Backup dir of an integration is deleted only after successful upload, next export of the same integration must not start before that.
+func (s *Exporter) lockIntegrations(keys []string, integrations []inconfig.IntegrationAgent) (unlock func()) {
+	s.setIntegrationsRunning(keys, integrations, true)
+	unlockKeys := s.integrationLocks.lockAll(keys)
+	return func() {
+		unlockKeys()
+		s.setIntegrationsRunning(keys, integrations, false)
+	}
+}
+
+// exportIntegrations exports passed integrations concurrently. The number of integrations exported at once is limited by s.slots. Integrations must be locked using lockIntegrations.
+func (s *Exporter) exportIntegrations(ctx context.Context, keys []string, integrations []inconfig.IntegrationAgent, data *agent.ExportRequest, messageID string) (res []integrationExport) {
+	res = make([]integrationExport, len(integrations))
+	var wg sync.WaitGroup
+	for i, in := range integrations {
+		wg.Add(1)
+		go func(i int, in inconfig.IntegrationAgent) {
+			defer wg.Done()
+			res[i] = s.exportIntegration(ctx, keys[i], in, data, messageID)
+		}(i, in)
+	}
+	wg.Wait()
+	return
+}
+
+func (s *Exporter) exportIntegration(ctx context.Context, key string, in inconfig.IntegrationAgent, data *agent.ExportRequest, messageID string) (res integrationExport) {
+	res.Key = key
+	res.Locs = s.opts.FSConf.ForIntegration(res.Key)
+	logger := s.logger.With("integration", in.Name, "state_key", res.Key)
+
+	s.slots <- struct{}{}
+	defer func() {
+		<-s.slots
+	}()
+
+	logger.Info("starting integration export")
+
+	started := time.Now()
+	defer func() {
+		recordExportMetrics(in.Name, time.Since(started), res.Err)
+		s.setLastExport(in.Name, data.JobID, started, res)
+	}()
+
+	err := migrateIntegrationState(logger, s.opts.FSConf, res.Locs)
+	if err != nil {
+		res.Err = fmt.Errorf("could not migrate state for integration: %v", err)
+		return
+	}
+
+	var stream *uploadStream
+	if s.conf.Output.IsPinpoint() && s.conf.Channel != "dev" {
+		stream, err = s.newUploadStream(data, res.Key, res.Locs)
+		if err != nil {
+			res.Err = fmt.Errorf("could not create upload stream: %v", err)
+			return
+		}
+		if stream.ExportDone() {
+			logger.Info("export finished before restart, resuming upload")
+			res.Result, err = stream.LoadResult()
+			if err != nil {
+				res.Err = err
+				return
+			}
+			res.UploadParts, res.UploadSize, res.Err = s.finishUpload(stream, res.Locs, "")
+			return
+		}
+	}
+
+	resumed, err := isResumedExport(res.Locs, data.JobID)
+	if err != nil {
+		res.Err = fmt.Errorf("could not check export checkpoint: %v", err)
+		return
+	}
+	err = s.backupRestoreState(res.Locs, resumed)
+	if err != nil {
+		res.Err = fmt.Errorf("could not manage backup dir for export: %v", err)
+		return
+	}
+
+	// progress of the previous export
+	err = os.Remove(res.Locs.ExportProgressFile)
+	if err != nil && !os.IsNotExist(err) {
+		res.Err = err
+		return
+	}
+
+	if stream != nil {
+		stream.Start()
+	}
+
+	res.Result, res.LogFile, err = s.execExport(ctx, res.Key, []inconfig.IntegrationAgent{in}, data.ReprocessHistorical, messageID, data.JobID)
+	if err != nil {
+		if stream != nil {
+			// session files are kept, re-issued export of the same job resumes from checkpoints and uploads them
+			stream.Stop()
+		}
+		res.Err = err
+		return
+	}
+
+	logger.Info("integration export finished")
+
+	if s.conf.Output.IsPinpoint() {
+		if stream == nil {
+			logger.Info("skipped upload")
+			res.Err = s.deleteStateBackup(res.Locs)
+			return
+		}
+		err = stream.SaveResult(res.Result)
+		if err != nil {
+			res.Err = err
+			return
+		}
+		res.UploadParts, res.UploadSize, res.Err = s.finishUpload(stream, res.Locs, res.LogFile)
+		return
+	}
+
+	logger.Info("publishing export to output", "type", s.conf.Output.Type)
+	_, err = expsink.Publish(context.Background(), expsink.PublishOpts{
+		Logger:     logger,
+		Output:     s.conf.Output,
+		UploadsDir: res.Locs.Uploads,
+		ExportName: expsink.ExportName(time.Now(), data.JobID) + "-" + res.Key,
+		LogFile:    res.LogFile,
+	})
+	if err != nil {
+		if err != expsink.ErrNoFilesFound {
+			res.Err = err
+			return
+		}
+		logger.Info("skipping publish, no files generated")
+	}
+	res.Err = s.deleteStateBackup(res.Locs)
+	return
+}
+
+func recordExportMetrics(integration string, duration time.Duration, err error) {
+	if err != nil {
+		metrics.Observe(metrics.ExportDuration, duration.Seconds(), "integration", integration, "result", "error")
+		return
+	}
+	metrics.Observe(metrics.ExportDuration, duration.Seconds(), "integration", integration, "result", "success")
+	metrics.Set(metrics.ExportLastSuccess, float64(time.Now().Unix()), "integration", integration)
+}
@@ -0,0 +1,133 @@
+package exporter
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/cmd/cmdrunnorestarts/inconfig"
+	"github.com/pinpt/agent/pkg/fsconf"
+	"github.com/pinpt/agent/pkg/kvstore"
+	"github.com/pinpt/agent/pkg/sysinfo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxConcurrentExports(t *testing.T) {
+	gb := uint64(1024 * 1024 * 1024)
+	cases := []struct {
+		label      string
+		configured int
+		cpu        int
+		memory     uint64
+		want       int
+	}{
+		{"cpu", 0, 8, 64 * gb, 4},
+		{"memory", 0, 16, 6 * gb, 3},
+		{"unknown memory", 0, 8, 0, 4},
+		{"configured", 2, 8, 64 * gb, 2},
+		{"configured higher than system", 10, 8, 64 * gb, 4},
+		{"min", 0, 1, gb, 1},
+	}
+	for _, c := range cases {
+		info := sysinfo.SystemInfo{NumCPU: c.cpu, TotalMemory: c.memory}
+		assert.Equal(t, c.want, maxConcurrentExports(c.configured, info), c.label)
+	}
+}
+
+func TestIntegrationStateKey(t *testing.T) {
+	in := inconfig.IntegrationAgent{}
+	in.ID = "abc-123"
+	in.Name = "github"
+	in.Type = inconfig.IntegrationTypeSourcecode
+	assert.Equal(t, "github_SOURCECODE-abc-123", integrationStateKey(in))
+
+	// integrations without id use auth, so the key does not depend on position in request
+	in1 := inconfig.IntegrationAgent{}
+	in1.Name = "github"
+	in1.Config.APIKey = "k1"
+	in2 := in1
+	in2.Config.APIKey = "k2"
+	keys1 := integrationStateKeys([]inconfig.IntegrationAgent{in1, in2})
+	keys2 := integrationStateKeys([]inconfig.IntegrationAgent{in2, in1})
+	assert.NotEqual(t, keys1[0], keys1[1])
+	assert.Equal(t, keys1[0], keys2[1])
+	assert.Equal(t, keys1[1], keys2[0])
+
+	assert.Equal(t, "a_b_c_.d", sanitizeStateKey("a/b c:.d"))
+}
+
+func TestLockAll(t *testing.T) {
+	locks := newIntegrationLocks()
+	assert.Equal(t, []string{"a", "b"}, uniqueSorted([]string{"b", "a", "b"}))
+
+	unlock := locks.lockAll([]string{"b", "a"})
+
+	done := make(chan bool)
+	go func() {
+		unlock2 := locks.lockAll([]string{"a", "c"})
+		unlock2()
+		done <- true
+	}()
+	select {
+	case <-done:
+		t.Fatal("lock acquired while held by other export")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("lock not released")
+	}
+
+	// no deadlock with duplicate keys
+	unlock = locks.lockAll([]string{"c", "c"})
+	unlock()
+}
+
+func TestMigrateIntegrationState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exporter-migrate")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	logger := hclog.New(&hclog.LoggerOptions{Name: "test"})
+	shared := fsconf.New(dir)
+	sharedState, err := kvstore.OpenState(logger, shared)
+	assert.NoError(t, err)
+	assert.NoError(t, sharedState.Update(func(tx *kvstore.Tx) error {
+		return tx.Put(kvstore.BucketLastProcessed, "k1", []byte(`"lp"`))
+	}))
+
+	get := func(state *kvstore.Store) (res string) {
+		assert.NoError(t, state.View(func(tx *kvstore.Tx) error {
+			b, err := tx.Get(kvstore.BucketLastProcessed, "k1")
+			res = string(b)
+			return err
+		}))
+		return
+	}
+
+	locs := shared.ForIntegration("i1")
+	assert.NoError(t, migrateIntegrationState(logger, shared, locs))
+	state, err := kvstore.OpenState(logger, locs)
+	assert.NoError(t, err)
+	assert.Equal(t, `"lp"`, get(state))
+
+	// not copied again once integration has its own state
+	assert.NoError(t, state.Update(func(tx *kvstore.Tx) error {
+		return tx.Put(kvstore.BucketLastProcessed, "k1", []byte(`"lp2"`))
+	}))
+	assert.NoError(t, migrateIntegrationState(logger, shared, locs))
+	assert.Equal(t, `"lp2"`, get(state))
+
+	// interrupted migration left state dir without marker, runs again
+	locs2 := shared.ForIntegration("i2")
+	assert.NoError(t, os.MkdirAll(locs2.State, 0755))
+	state2, err := kvstore.OpenState(logger, locs2)
+	assert.NoError(t, err)
+	assert.Equal(t, "", get(state2))
+	assert.NoError(t, migrateIntegrationState(logger, shared, locs2))
+	assert.Equal(t, `"lp"`, get(state2))
+}
@@ -19,7 +19,9 @@ import (
 	"github.com/pinpt/agent/pkg/agentconf"
 	"github.com/pinpt/agent/pkg/deviceinfo"
 	"github.com/pinpt/agent/pkg/fsconf"
+	"github.com/pinpt/agent/pkg/kvstore"
 	"github.com/pinpt/agent/pkg/logutils"
+	"github.com/pinpt/agent/pkg/sysinfo"
 
 	hclog "github.com/hashicorp/go-hclog"
 	"github.com/pinpt/integration-sdk/agent"
@@ -44,7 +46,6 @@ type Opts struct {
 // Exporter schedules and executes exports
 type Exporter struct {
 	// ExportQueue for queuing the exports
-	// Exports happen serially, with only one happening at once
 	ExportQueue chan Request
 
 	conf agentconf.Config
@@ -52,11 +53,28 @@ type Exporter struct {
 	logger     hclog.Logger
 	opts       Opts
 	mu         sync.Mutex
-	exporting  bool
+	exporting  int
 	deviceInfo deviceinfo.CommonInfo
 
 	queue                 *fsqueue.Queue
 	queueRequestForwarder chan fsqueue.Request
+
+	scheduler *scheduler
+
+	// slots limits the number of integrations exported at the same time
+	slots               chan struct{}
+	integrationLocks    *integrationLocks
+	runningIntegrations map[string]int
+	// runningIntegrationIDs is the same as runningIntegrations, but by integration id
+	runningIntegrationIDs map[string]int
+
+	// lastExports contains the result of the last export by integration state key
+	lastExports map[string]LastExport
+
+	// jobCancels cancels the context of export requests in progress by job id
+	jobCancels map[string]context.CancelFunc
+	// cancelledJobs contains job ids of requests cancelled while queued, these are cancelled in registerJob
+	cancelledJobs map[string]bool
 }
 
 // Request is the export request to put into the ExportQueue
@@ -65,6 +83,17 @@ type Request struct {
 	Data *agent.ExportRequest
 	// MessageID is the message id received from the server in headers
 	MessageID string
+
+	// Scheduled is set for requests created by local scheduler or status api instead of the server
+	Scheduled *ScheduledRequest
+}
+
+// ScheduledRequest contains additional options for exports started by local scheduler or status api
+type ScheduledRequest struct {
+	// IntegrationIDs are ids of integrations from ExtraIntegrations to export
+	IntegrationIDs []string
+	// MaxRuntime is the maximum duration of the export, export is cancelled when exceeded
+	MaxRuntime time.Duration
 }
 
 // New creates exporter
@@ -83,29 +112,66 @@ func New(opts Opts) (*Exporter, error) {
 	}
 	s.logger = opts.Logger
 	s.ExportQueue = make(chan Request)
-	var err error
-	s.queue, s.queueRequestForwarder, err = fsqueue.New(opts.Logger, s.opts.FSConf.ExportQueueFile)
+
+	maxConcurrent := maxConcurrentExports(s.conf.MaxConcurrentExports, sysinfo.GetSystemInfo(s.opts.PinpointRoot))
+	s.logger.Info("max concurrent exports", "v", maxConcurrent, "configured", s.conf.MaxConcurrentExports)
+	s.slots = make(chan struct{}, maxConcurrent)
+	s.integrationLocks = newIntegrationLocks()
+	s.runningIntegrations = map[string]int{}
+	s.runningIntegrationIDs = map[string]int{}
+	s.lastExports = map[string]LastExport{}
+	s.jobCancels = map[string]context.CancelFunc{}
+	s.cancelledJobs = map[string]bool{}
+
+	// integrations use separate uploads dirs, delete data left by previous versions
+	err := os.RemoveAll(s.opts.FSConf.Uploads)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := kvstore.OpenState(opts.Logger, s.opts.FSConf)
+	if err != nil {
+		return nil, err
+	}
+	s.queue, s.queueRequestForwarder, err = fsqueue.New(opts.Logger, state, s.opts.FSConf)
 	if err != nil {
 		return nil, fmt.Errorf("could not create fsqueue: %v", err)
 	}
+	if len(s.conf.Schedules) != 0 {
+		s.scheduler, err = newScheduler(schedulerOpts{
+			Logger:    s.logger,
+			Conf:      s.conf,
+			StateFile: s.opts.FSConf.ExportScheduleFile,
+			IsRunning: s.IsIntegrationRunning,
+			Enqueue:   s.enqueue,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not create export scheduler: %v", err)
+		}
+	}
 	return s, nil
 }
 
 func (s *Exporter) setRunning(ex bool) {
 	s.mu.Lock()
-	s.exporting = ex
+	if ex {
+		s.exporting++
+	} else {
+		s.exporting--
+	}
 	s.mu.Unlock()
 }
 
 // IsRunning returns true if there is an export in progress
 func (s *Exporter) IsRunning() bool {
 	s.mu.Lock()
-	ex := s.exporting
+	ex := s.exporting != 0
 	s.mu.Unlock()
 	return ex
 }
 
-func (s *Exporter) export(data *agent.ExportRequest, messageID string) {
+// export runs the export request and sends export events to the backend. Scheduled is set for local exports with pinpoint output, these export integrations from ExtraIntegrations instead of the ones in the request.
+func (s *Exporter) export(data *agent.ExportRequest, messageID string, scheduled *ScheduledRequest) {
 	started := time.Now()
 
 	handleError := func(err error) {
@@ -116,34 +182,40 @@ func (s *Exporter) export(data *agent.ExportRequest, messageID string) {
 		}
 	}
 
-	var in2 []agent.ExportRequestIntegrations
-	hasIntegrationsWithNoInclusions := false
-	for _, in := range data.Integrations {
-		if len(in.Inclusions) == 0 {
-			hasIntegrationsWithNoInclusions = true
-			s.logger.Warn("export request contains an integration with no inclusions, ignoring it")
-			continue
+	requested := data.Integrations
+	if scheduled != nil {
+		requested = requestedIntegrations(scheduledIntegrations(s.conf.ExtraIntegrations, scheduled.IntegrationIDs))
+	} else {
+		var in2 []agent.ExportRequestIntegrations
+		hasIntegrationsWithNoInclusions := false
+		for _, in := range data.Integrations {
+			if len(in.Inclusions) == 0 {
+				hasIntegrationsWithNoInclusions = true
+				s.logger.Warn("export request contains an integration with no inclusions, ignoring it")
+				continue
+			}
+			in2 = append(in2, in)
 		}
-		in2 = append(in2, in)
-	}
-	data.Integrations = in2
+		data.Integrations = in2
+		requested = in2
 
-	if len(data.Integrations) == 0 {
-		if hasIntegrationsWithNoInclusions {
-			handleError(errors.New("all integrations in passed export request have no inclusions, ignoring this export request"))
+		if len(data.Integrations) == 0 {
+			if hasIntegrationsWithNoInclusions {
+				handleError(errors.New("all integrations in passed export request have no inclusions, ignoring this export request"))
 
-		} else {
-			handleError(errors.New("passed export request has no integrations, ignoring it"))
+			} else {
+				handleError(errors.New("passed export request has no integrations, ignoring it"))
+			}
+			return
 		}
-		return
 	}
 
-	if err := s.sendStartExportEvent(data.JobID, data.Integrations); err != nil {
+	if err := s.sendStartExportEvent(data.JobID, requested); err != nil {
 		handleError(fmt.Errorf("error sending export response start event: %v", err))
 		return
 	}
 
-	exportResult, err := s.doExport(data, messageID)
+	exportResult, err := s.doExport(data, messageID, scheduled)
 	if err != nil {
 		if _, o := err.(*subcommand.Cancelled); o {
 			handleError(errors.New("export cancelled"))
@@ -154,12 +226,16 @@ func (s *Exporter) export(data *agent.ExportRequest, messageID string) {
 	}
 	s.logger.Info("sending back export event")
 
-	if data.UploadURL == nil || *data.UploadURL == "" {
+	uploadURL := ""
+	if data.UploadURL != nil {
+		uploadURL = *data.UploadURL
+	}
+	if uploadURL == "" && s.conf.Output.IsPinpoint() {
 		handleError(errors.New("No UploadURL provided in ExportRequest"))
 		return
 	}
 
-	err = s.sendSuccessEvent(data.JobID, started, exportResult, *data.UploadURL, data.Integrations)
+	err = s.sendSuccessEvent(data.JobID, started, exportResult, uploadURL, requested)
 	if err != nil {
 		s.logger.Error("error sending back export completed event", "err", err)
 	}
@@ -179,8 +255,8 @@ type exportResultIntegration struct {
 	EntityErrors []agent.ExportResponseIntegrationsEntityErrors
 }
 
-func (s *Exporter) doExport(data *agent.ExportRequest, messageID string) (res exportResult, rerr error) {
-	partsCount, fileSize, res0, err := s.doExport2(data, messageID)
+func (s *Exporter) doExport(data *agent.ExportRequest, messageID string, scheduled *ScheduledRequest) (res exportResult, rerr error) {
+	partsCount, fileSize, res0, err := s.doExport2(data, messageID, scheduled)
 	if err != nil {
 		rerr = err
 		return
@@ -211,16 +287,13 @@ func (s *Exporter) doExport(data *agent.ExportRequest, messageID string) (res ex
 	return
 }
 
-func (s *Exporter) doExport2(data *agent.ExportRequest, messageID string) (partsCount int, fileSize int64, res cmdexport.Result, rerr error) {
+func (s *Exporter) doExport2(data *agent.ExportRequest, messageID string, scheduled *ScheduledRequest) (partsCount int, fileSize int64, res cmdexport.Result, rerr error) {
 	s.logger.Info("processing export request", "job_id", data.JobID, "request_date", data.RequestDate.Rfc3339, "reprocess_historical", data.ReprocessHistorical)
 
-	err := s.backupRestoreStateDir()
-	if err != nil {
-		rerr = fmt.Errorf("could not manage backup dir for export: %v", err)
-		return
-	}
-
 	integrations := s.conf.ExtraIntegrations
+	if scheduled != nil {
+		integrations = scheduledIntegrations(s.conf.ExtraIntegrations, scheduled.IntegrationIDs)
+	}
 
 	for _, integration := range data.Integrations {
 		s.logger.Info("exporting integration", "name", integration.Name, "len(exclusions)", len(integration.Exclusions), "len(inclusions)", len(integration.Inclusions))
@@ -239,51 +312,104 @@ func (s *Exporter) doExport2(data *agent.ExportRequest, messageID string) (parts
 		integrations = append(integrations, conf)
 	}
 
-	fsconf := s.opts.FSConf
-	// delete existing uploads
-	if err = os.RemoveAll(fsconf.Uploads); err != nil {
-		rerr = err
+	integrations = dedupInclusionsAndMergeUsers(s.logger, integrations)
+
+	ctx := context.Background()
+	if scheduled != nil && scheduled.MaxRuntime != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, scheduled.MaxRuntime)
+		defer cancel()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	unregister := s.registerJob(data.JobID, cancel)
+	defer unregister()
+
+	keys := integrationStateKeys(integrations)
+	unlock := s.lockIntegrations(keys, integrations)
+	defer unlock()
+
+	if ctx.Err() == context.Canceled {
+		rerr = errExportCancelled
 		return
 	}
 
-	integrations = dedupInclusionsAndMergeUsers(s.logger, integrations)
+	for _, key := range keys {
+		// delete existing uploads, before upload stream could pick them up
+		err := s.cleanupUploads(s.opts.FSConf.ForIntegration(key), data.JobID)
+		if err != nil {
+			rerr = err
+			return
+		}
+	}
 
-	logFile := ""
-	res, logFile, err = s.execExport(integrations, data.ReprocessHistorical, messageID, data.JobID)
-	if logFile != "" {
-		defer os.Remove(logFile)
+	if err := s.removeStaleUploadStreams(s.logger); err != nil {
+		s.logger.Warn("could not remove upload streams of previous jobs", "err", err)
 	}
-	if err != nil {
-		rerr = err
+
+	started := time.Now()
+	exports := s.exportIntegrations(ctx, keys, integrations, data, messageID)
+	for _, exp := range exports {
+		if exp.LogFile != "" {
+			defer os.Remove(exp.LogFile)
+		}
+	}
+	for _, exp := range exports {
+		if exp.Err == nil {
+			continue
+		}
+		err := exp.Err
+		switch ctx.Err() {
+		case context.DeadlineExceeded:
+			err = fmt.Errorf("export exceeded max runtime of %v: %v", scheduled.MaxRuntime, err)
+		case context.Canceled:
+			err = fmt.Errorf("%v: %v", errExportCancelled, err)
+		}
+		rerr = fmt.Errorf("export of integration %v failed: %v", exp.Key, err)
 		return
 	}
+	res.Duration = time.Since(started)
+	for _, exp := range exports {
+		res.Integrations = append(res.Integrations, exp.Result.Integrations...)
+		partsCount += exp.UploadParts
+		fileSize += exp.UploadSize
+	}
+	s.removeJobUploadStreamsDir(data.JobID)
 
 	s.logger.Info("export finished")
+	return
+}
 
-	if s.conf.Channel != "dev" {
-
-		s.logger.Info("running upload")
+// cleanupUploads deletes files left in uploads dir by previous exports. When resuming an interrupted export of the same job, closed session files are kept.
+func (s *Exporter) cleanupUploads(locs fsconf.Locs, jobID string) error {
+	resumed, err := isResumedExport(locs, jobID)
+	if err != nil {
+		return err
+	}
+	if resumed {
+		return removeTempSessionFiles(locs.Uploads)
+	}
+	return os.RemoveAll(locs.Uploads)
+}
 
-		partsCount, fileSize, err = cmdupload.Run(context.Background(), s.logger, s.opts.PinpointRoot, *data.UploadURL, data.JobID, s.conf.APIKey, logFile)
-		if err != nil {
-			if err == cmdupload.ErrNoFilesFound {
-				s.logger.Info("skipping upload, no files generated")
-				// do not return errors when no files to upload, which is ok for incremental
-			} else {
-				rerr = err
-				return
-			}
+// finishUpload uploads the remaining export data of the integration and deletes its backup dir after successful upload. On error upload stream and session files are kept, so the upload is retried when the same job is re-issued.
+func (s *Exporter) finishUpload(stream *uploadStream, locs fsconf.Locs, logFile string) (partsCount int, fileSize int64, rerr error) {
+	var err error
+	partsCount, fileSize, err = stream.Finish(context.Background(), logFile)
+	if err != nil {
+		if err != cmdupload.ErrNoFilesFound {
+			rerr = err
+			return
 		}
-	} else {
-		s.logger.Info("skipped upload")
+		s.logger.Info("skipping upload, no files generated")
 	}
 
-	err = s.deleteBackupStateDir()
+	err = stream.Remove()
 	if err != nil {
-		rerr = err
-		return
+		s.logger.Error("could not remove upload stream", "err", err)
 	}
 
+	rerr = s.deleteStateBackup(locs)
 	return
 }
 
@@ -366,10 +492,11 @@ func mergeUsers(logger hclog.Logger, integrations []inconfig.IntegrationAgent) (
 	return
 }
 
-func (s *Exporter) execExport(integrations []inconfig.IntegrationAgent, reprocessHistorical bool, messageID string, jobID string) (res cmdexport.Result, logFile string, rerr error) {
+func (s *Exporter) execExport(ctx context.Context, stateKey string, integrations []inconfig.IntegrationAgent, reprocessHistorical bool, messageID string, jobID string) (res cmdexport.Result, logFile string, rerr error) {
 
 	agentConfig := s.opts.AgentConfig
 	agentConfig.Backend.ExportJobID = jobID
+	agentConfig.IntegrationStateKey = stateKey
 
 	c, err := subcommand.New(subcommand.Opts{
 		Logger:            s.logger,
@@ -389,7 +516,7 @@ func (s *Exporter) execExport(integrations []inconfig.IntegrationAgent, reproces
 	if reprocessHistorical {
 		args = append(args, "--reprocess-historical=true")
 	}
-	logFile, rerr = c.RunKeepLogFile(context.Background(), "export", messageID, &res, args...)
+	logFile, rerr = c.RunKeepLogFile(ctx, "export", messageID, &res, args...)
 	//s.logger.Debug("executed export command, got res", "v", fmt.Sprintf("%v", res))
 
 	return
@@ -1,16 +1,18 @@
 package fsqueue
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"io/ioutil"
-	"os"
-	"path/filepath"
+	"fmt"
+	"sort"
+	"strconv"
 	"sync"
 
 	hclog "github.com/hashicorp/go-hclog"
-	"github.com/pinpt/agent/pkg/fs"
+	"github.com/pinpt/agent/pkg/fsconf"
+	"github.com/pinpt/agent/pkg/kvstore"
+	"github.com/pinpt/agent/pkg/metrics"
+	"github.com/pinpt/agent/pkg/secrets"
 )
 
 type Request struct {
@@ -25,20 +27,22 @@ type Queue struct {
 	forwardRequests chan Request
 
 	logger hclog.Logger
-	file   string
+	db     *kvstore.Store
+	locs   fsconf.Locs
 
-	pending map[int]Data
-	idgen   int
+	pending map[uint64]Data
 	mu      sync.Mutex
 }
 
-func New(logger hclog.Logger, file string) (_ *Queue, forwardRequests chan Request, rerr error) {
+// New creates the queue with requests stored in kvstore.BucketExportQueue of db. Requests contain credentials, so they are sealed with the secrets key from locs.
+func New(logger hclog.Logger, db *kvstore.Store, locs fsconf.Locs) (_ *Queue, forwardRequests chan Request, rerr error) {
 	s := &Queue{}
 	s.logger = logger
-	s.file = file
+	s.db = db
+	s.locs = locs
 	s.Input = make(chan Data)
 	s.forwardRequests = make(chan Request, 10000)
-	s.pending = map[int]Data{}
+	s.pending = map[uint64]Data{}
 
 	err := s.readData()
 	if err != nil {
@@ -49,58 +53,186 @@ func New(logger hclog.Logger, file string) (_ *Queue, forwardRequests chan Reque
 	return s, s.forwardRequests, nil
 }
 
-func (s *Queue) readData() error {
-	b, err := ioutil.ReadFile(s.file)
+// unseal returns request json, requests saved by previous versions are not sealed
+func unseal(ring *secrets.Keyring, value []byte) ([]byte, error) {
+	res, err := ring.Unseal(string(value))
 	if err != nil {
-		if !os.IsNotExist(err) {
-			return err
-		}
-		return nil
+		return nil, err
+	}
+	return []byte(res), nil
+}
+
+func seal(ring *secrets.Keyring, data Data) ([]byte, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
 	}
-	err = json.Unmarshal(b, &s.pending)
+	res, err := ring.Seal(string(b))
 	if err != nil {
-		return err
+		return nil, err
 	}
-	for id := range s.pending {
-		if id > s.idgen {
-			s.idgen = id
+	return []byte(res), nil
+}
+
+func (s *Queue) readData() error {
+	err := s.db.View(func(tx *kvstore.Tx) error {
+		ring, err := secrets.LoadKeyring(s.locs)
+		if err != nil {
+			return err
 		}
+		return tx.ForEach(kvstore.BucketExportQueue, "", func(key string, value []byte) error {
+			id, err := strconv.ParseUint(key, 10, 64)
+			if err != nil {
+				return err
+			}
+			b, err := unseal(ring, value)
+			if err != nil {
+				return fmt.Errorf("could not unseal export request %v: %v", key, err)
+			}
+			var data Data
+			err = json.Unmarshal(b, &data)
+			if err != nil {
+				return err
+			}
+			s.pending[id] = data
+			return nil
+		})
+	})
+	if err != nil {
+		return err
 	}
+	metrics.Set(metrics.ExportQueueDepth, float64(len(s.pending)))
 	return nil
 }
 
-func (s *Queue) addData(data Data) (id int, _ error) {
+func (s *Queue) addData(data Data) (id uint64, rerr error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.idgen++
-	id = s.idgen
+	err := s.db.Update(func(tx *kvstore.Tx) error {
+		// loaded in transaction, so that the current key is used if it was rotated while running
+		ring, err := secrets.LoadKeyring(s.locs)
+		if err != nil {
+			return err
+		}
+		b, err := seal(ring, data)
+		if err != nil {
+			return err
+		}
+		id, err = tx.NextSequence(kvstore.BucketExportQueue)
+		if err != nil {
+			return err
+		}
+		return tx.Put(kvstore.BucketExportQueue, kvstore.ExportQueueKey(id), b)
+	})
+	if err != nil {
+		rerr = err
+		return
+	}
 	s.pending[id] = data
-	return id, s.save()
+	metrics.Set(metrics.ExportQueueDepth, float64(len(s.pending)))
+	return id, nil
+}
+
+// Reseal seals all queued requests again with the current key of ring. Used when the secrets key is rotated.
+func Reseal(db *kvstore.Store, ring *secrets.Keyring) error {
+	return db.Update(func(tx *kvstore.Tx) error {
+		res := map[string][]byte{}
+		err := tx.ForEach(kvstore.BucketExportQueue, "", func(key string, value []byte) error {
+			v, err := ring.Unseal(string(value))
+			if err != nil {
+				return fmt.Errorf("could not unseal export request %v: %v", key, err)
+			}
+			v, err = ring.Seal(v)
+			if err != nil {
+				return err
+			}
+			res[key] = []byte(v)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for key, value := range res {
+			err := tx.Put(kvstore.BucketExportQueue, key, value)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func (s *Queue) dataDone(id int) error {
+func (s *Queue) dataDone(id uint64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	err := s.db.Update(func(tx *kvstore.Tx) error {
+		return tx.Delete(kvstore.BucketExportQueue, kvstore.ExportQueueKey(id))
+	})
+	if err != nil {
+		return err
+	}
 	delete(s.pending, id)
-	return s.save()
+	metrics.Set(metrics.ExportQueueDepth, float64(len(s.pending)))
+	return nil
 }
 
-func (s *Queue) save() error {
-	b, err := json.Marshal(s.pending)
-	if err != nil {
-		return err
+func (s *Queue) sortedIDs() (res []uint64) {
+	for id := range s.pending {
+		res = append(res, id)
 	}
-	err = os.MkdirAll(filepath.Dir(s.file), 0777)
+	sort.Slice(res, func(i, j int) bool {
+		return res[i] < res[j]
+	})
+	return
+}
+
+// Remove deletes the queued requests for which match returns true. Returns true if any were removed. Removed requests that were already forwarded for processing are not stopped.
+func (s *Queue) Remove(match func(Data) bool) (removed bool, rerr error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []uint64
+	for _, id := range s.sortedIDs() {
+		if match(s.pending[id]) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return false, nil
+	}
+	err := s.db.Update(func(tx *kvstore.Tx) error {
+		for _, id := range ids {
+			err := tx.Delete(kvstore.BucketExportQueue, kvstore.ExportQueueKey(id))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return err
+		rerr = err
+		return
+	}
+	for _, id := range ids {
+		delete(s.pending, id)
+	}
+	metrics.Set(metrics.ExportQueueDepth, float64(len(s.pending)))
+	return true, nil
+}
+
+// Pending returns requests that are queued or in progress, in the order they were added
+func (s *Queue) Pending() (res []Data) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range s.sortedIDs() {
+		res = append(res, s.pending[id])
 	}
-	return fs.WriteToTempAndRename(bytes.NewReader(b), s.file)
+	return
 }
 
 func (s *Queue) Run(ctx context.Context) error {
 
-	send := func(ctx context.Context, id int, data Data) {
+	send := func(ctx context.Context, id uint64, data Data) {
 		done := make(chan struct{})
 		s.forwardRequests <- Request{Done: done, Data: data}
 		go func() {
@@ -109,15 +241,15 @@ func (s *Queue) Run(ctx context.Context) error {
 			case <-done:
 				err := s.dataDone(id)
 				if err != nil {
-					s.logger.Error("could not mark export as done in fs", "err", err)
+					s.logger.Error("could not mark export as done in state store", "err", err)
 				}
 			}
 		}()
 	}
 
 	s.mu.Lock()
-	for id, data := range s.pending {
-		send(ctx, id, data)
+	for _, id := range s.sortedIDs() {
+		send(ctx, id, s.pending[id])
 	}
 	s.mu.Unlock()
 
@@ -9,15 +9,31 @@ import (
 	"testing"
 	"time"
 
-	"github.com/stretchr/testify/assert"
 	"github.com/hashicorp/go-hclog"
-
+	"github.com/pinpt/agent/pkg/fsconf"
+	"github.com/pinpt/agent/pkg/kvstore"
+	"github.com/pinpt/agent/pkg/secrets"
+	"github.com/stretchr/testify/assert"
 )
 
-
 func testLogger() hclog.Logger {
 	return hclog.New(hclog.DefaultOptions)
 }
+
+// testLocs returns locs with secrets key in the same dir as db file
+func testLocs(file string) fsconf.Locs {
+	os.Setenv("PP_AGENT_ID", "host1")
+	return fsconf.New(filepath.Dir(file))
+}
+
+func testDB(t *testing.T, file string) *kvstore.Store {
+	db, err := kvstore.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
 func TestQueueRunCancel(t *testing.T) {
 	dir, err := ioutil.TempDir("", "test-")
 	if err != nil {
@@ -25,7 +41,7 @@ func TestQueueRunCancel(t *testing.T) {
 	}
 	defer os.RemoveAll(dir)
 	file := filepath.Join(dir, "db")
-	q, _, err := New(testLogger(), file)
+	q, _, err := New(testLogger(), testDB(t, file), testLocs(file))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -52,7 +68,7 @@ func TestQueuePassData(t *testing.T) {
 	}
 	defer os.RemoveAll(dir)
 	file := filepath.Join(dir, "db")
-	q, forward, err := New(testLogger(), file)
+	q, forward, err := New(testLogger(), testDB(t, file), testLocs(file))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -98,7 +114,7 @@ func TestQueueStoreOnFS(t *testing.T) {
 	assert := assert.New(t)
 
 	runQueue := func(cb func(q *Queue, f chan Request)) {
-		q, forward, err := New(testLogger(), file)
+		q, forward, err := New(testLogger(), testDB(t, file), testLocs(file))
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -145,3 +161,84 @@ func TestQueueStoreOnFS(t *testing.T) {
 		req.Done <- struct{}{}
 	})
 }
+
+func TestQueueSealsRequests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "db")
+	db := testDB(t, file)
+	locs := testLocs(file)
+	assert := assert.New(t)
+
+	// request saved by previous version
+	err = db.Update(func(tx *kvstore.Tx) error {
+		err := tx.Put(kvstore.BucketExportQueue, kvstore.ExportQueueKey(1), []byte(`{"k1":"v1"}`))
+		if err != nil {
+			return err
+		}
+		return tx.SetSequence(kvstore.BucketExportQueue, 1)
+	})
+	assert.NoError(err)
+	q, _, err := New(testLogger(), db, locs)
+	assert.NoError(err)
+	assert.Equal([]Data{{"k1": "v1"}}, q.Pending())
+
+	id, err := q.addData(Data{"token": "secret1"})
+	assert.NoError(err)
+	var v1 []byte
+	err = db.View(func(tx *kvstore.Tx) error {
+		var err error
+		v1, err = tx.Get(kvstore.BucketExportQueue, kvstore.ExportQueueKey(id))
+		return err
+	})
+	assert.NoError(err)
+	assert.True(secrets.IsSealed(string(v1)))
+	assert.NotContains(string(v1), "secret1")
+
+	err = secrets.Rotate(locs, func(ring *secrets.Keyring) error {
+		return Reseal(db, ring)
+	})
+	assert.NoError(err)
+	q, _, err = New(testLogger(), db, locs)
+	assert.NoError(err)
+	assert.Equal([]Data{{"k1": "v1"}, {"token": "secret1"}}, q.Pending())
+}
+
+func TestQueueRemove(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "db")
+	db := testDB(t, file)
+	locs := testLocs(file)
+	assert := assert.New(t)
+
+	q, _, err := New(testLogger(), db, locs)
+	assert.NoError(err)
+	_, err = q.addData(Data{"k1": "v1"})
+	assert.NoError(err)
+	_, err = q.addData(Data{"k2": "v2"})
+	assert.NoError(err)
+
+	match := func(data Data) bool {
+		return data["k1"] == "v1"
+	}
+	removed, err := q.Remove(match)
+	assert.NoError(err)
+	assert.True(removed)
+	assert.Equal([]Data{{"k2": "v2"}}, q.Pending())
+
+	removed, err = q.Remove(match)
+	assert.NoError(err)
+	assert.False(removed)
+
+	// removed requests are not loaded again after restart
+	q, _, err = New(testLogger(), db, locs)
+	assert.NoError(err)
+	assert.Equal([]Data{{"k2": "v2"}}, q.Pending())
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/pinpt/agent/cmd/cmdrunnorestarts/exporter/fsqueue"
 	"github.com/pinpt/agent/pkg/structmarshal"
 	"github.com/pinpt/go-common/datetime"
 )
@@ -13,15 +14,23 @@ import (
 func (s *Exporter) Run() {
 	go func() {
 		for req := range s.queueRequestForwarder {
-			req2 := Request{}
-			err := structmarshal.MapToStruct(req.Data, &req2)
-			if err != nil {
-				s.logger.Error("could not unmarshal export request from map", "err", err)
-			}
-			s.setRunning(true)
-			s.export(req2.Data, req2.MessageID)
-			s.setRunning(false)
-			req.Done <- struct{}{}
+			// requests run concurrently, exports of the same integration are serialized in exportIntegrations
+			go func(req fsqueue.Request) {
+				req2 := Request{}
+				err := structmarshal.MapToStruct(req.Data, &req2)
+				if err != nil {
+					s.logger.Error("could not unmarshal export request from map", "err", err)
+				}
+				s.setRunning(true)
+				if req2.Scheduled != nil && !s.conf.Output.IsPinpoint() {
+					s.exportScheduled(req2.Data, req2.Scheduled)
+				} else {
+					// local exports with pinpoint output send export events the same as requests from the backend
+					s.export(req2.Data, req2.MessageID, req2.Scheduled)
+				}
+				s.setRunning(false)
+				req.Done <- struct{}{}
+			}(req)
 		}
 	}()
 
@@ -32,6 +41,10 @@ func (s *Exporter) Run() {
 		}
 	}()
 
+	if s.scheduler != nil {
+		go s.scheduler.Run()
+	}
+
 	for req := range s.ExportQueue {
 		data := req.Data
 
@@ -0,0 +1,262 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/cmd/cmdrunnorestarts/inconfig"
+	"github.com/pinpt/agent/pkg/agentconf"
+	"github.com/pinpt/agent/pkg/cronexpr"
+	"github.com/pinpt/agent/pkg/date"
+	"github.com/pinpt/agent/pkg/fs"
+	"github.com/pinpt/agent/pkg/structmarshal"
+	"github.com/pinpt/integration-sdk/agent"
+)
+
+// minScheduleInterval is the minimum time between two scheduled exports of the same integration. Activations happening sooner are skipped.
+const minScheduleInterval = 15 * time.Minute
+
+// defaultScheduleMaxRuntime is used when schedule does not set max_runtime
+const defaultScheduleMaxRuntime = 12 * time.Hour
+
+// scheduleCheckInterval is how often schedules are checked, cron expressions have minute precision
+const scheduleCheckInterval = 30 * time.Second
+
+type schedule struct {
+	integrationID string
+	expr          *cronexpr.Expr
+	maxRuntime    time.Duration
+}
+
+type scheduleState struct {
+	// LastActivation is the last time the schedule was due, no matter if the export was queued or skipped
+	LastActivation time.Time `json:"last_activation"`
+	// LastRun is the last time the export was queued
+	LastRun time.Time `json:"last_run"`
+}
+
+type schedulerOpts struct {
+	Logger hclog.Logger
+	Conf   agentconf.Config
+	// StateFile stores scheduleState for every integration, so that missed activations are run after restart
+	StateFile string
+	// IsRunning returns true if there is an export of the integration in progress
+	IsRunning func(integrationID string) bool
+	// Enqueue adds the request to export queue
+	Enqueue func(req Request) error
+}
+
+// scheduler starts exports based on cron schedules from agent config. Used for deployments without pinpoint backend.
+//
+// When the agent was not running at the time of an activation, one export is started on the next start, no matter how many activations were missed.
+type scheduler struct {
+	opts      schedulerOpts
+	logger    hclog.Logger
+	schedules []schedule
+	state     map[string]scheduleState
+	now       func() time.Time
+}
+
+func newScheduler(opts schedulerOpts) (*scheduler, error) {
+	s := &scheduler{}
+	s.opts = opts
+	s.logger = opts.Logger.Named("scheduler")
+	s.now = time.Now
+	s.state = map[string]scheduleState{}
+
+	var err error
+	s.schedules, err = parseSchedules(opts.Conf)
+	if err != nil {
+		return nil, err
+	}
+	err = s.load()
+	if err != nil {
+		return nil, fmt.Errorf("could not load schedule state: %v", err)
+	}
+	return s, nil
+}
+
+func parseSchedules(conf agentconf.Config) (res []schedule, _ error) {
+	if len(conf.Schedules) != 0 && conf.Output.IsPinpoint() {
+		return nil, errors.New("schedules require local or s3 output, exports for pinpoint are requested by the backend")
+	}
+	integrations := map[string]bool{}
+	for _, in := range conf.ExtraIntegrations {
+		integrations[in.ID] = true
+	}
+	seen := map[string]bool{}
+	for _, sc := range conf.Schedules {
+		if sc.IntegrationID == "" {
+			return nil, errors.New("schedule integration_id is required")
+		}
+		if !integrations[sc.IntegrationID] {
+			return nil, fmt.Errorf("schedule integration_id %v not found in extra_integrations", sc.IntegrationID)
+		}
+		if seen[sc.IntegrationID] {
+			return nil, fmt.Errorf("multiple schedules for integration_id %v", sc.IntegrationID)
+		}
+		seen[sc.IntegrationID] = true
+		expr, err := cronexpr.Parse(sc.Cron)
+		if err != nil {
+			return nil, err
+		}
+		maxRuntime := defaultScheduleMaxRuntime
+		if sc.MaxRuntime != "" {
+			maxRuntime, err = time.ParseDuration(sc.MaxRuntime)
+			if err != nil {
+				return nil, fmt.Errorf("invalid max_runtime for integration_id %v: %v", sc.IntegrationID, err)
+			}
+			if maxRuntime <= 0 {
+				return nil, fmt.Errorf("invalid max_runtime for integration_id %v: must be positive", sc.IntegrationID)
+			}
+		}
+		res = append(res, schedule{
+			integrationID: sc.IntegrationID,
+			expr:          expr,
+			maxRuntime:    maxRuntime,
+		})
+	}
+	return
+}
+
+func (s *scheduler) load() error {
+	b, err := ioutil.ReadFile(s.opts.StateFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(b, &s.state)
+}
+
+func (s *scheduler) save() error {
+	b, err := json.Marshal(s.state)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(s.opts.StateFile), 0777)
+	if err != nil {
+		return err
+	}
+	return fs.WriteToTempAndRename(bytes.NewReader(b), s.opts.StateFile)
+}
+
+// Run checks schedules periodically. This is a blocking call.
+func (s *scheduler) Run() {
+	s.logger.Info("starting export scheduler", "schedules", len(s.schedules))
+	for {
+		err := s.check()
+		if err != nil {
+			s.logger.Error("could not check export schedules", "err", err)
+		}
+		time.Sleep(scheduleCheckInterval)
+	}
+}
+
+// check queues exports for all schedules that are due
+func (s *scheduler) check() error {
+	now := s.now()
+	for _, sc := range s.schedules {
+		st := s.state[sc.integrationID]
+		if st.LastActivation.IsZero() {
+			// first time we see this schedule, wait for next activation
+			st.LastActivation = now
+			s.state[sc.integrationID] = st
+			continue
+		}
+		next := sc.expr.Next(st.LastActivation)
+		if next.IsZero() || next.After(now) {
+			continue
+		}
+		st.LastActivation = now
+		s.state[sc.integrationID] = st
+
+		logger := s.logger.With("integration_id", sc.integrationID, "cron", sc.expr.String(), "activation", next)
+		if s.opts.IsRunning(sc.integrationID) {
+			logger.Warn("skipping scheduled export, previous export of the integration is still running")
+			continue
+		}
+		if !st.LastRun.IsZero() && now.Sub(st.LastRun) < minScheduleInterval {
+			logger.Warn("skipping scheduled export, previous export was started less than min interval ago", "last_run", st.LastRun, "min_interval", minScheduleInterval)
+			continue
+		}
+
+		logger.Info("queuing scheduled export")
+		err := s.opts.Enqueue(s.newRequest(sc, now))
+		if err != nil {
+			return err
+		}
+		st.LastRun = now
+		s.state[sc.integrationID] = st
+	}
+	return s.save()
+}
+
+func (s *scheduler) newRequest(sc schedule, now time.Time) Request {
+	data := &agent.ExportRequest{}
+	data.JobID = "scheduled-" + sc.integrationID + "-" + strconv.FormatInt(now.Unix(), 10)
+	date.ConvertToModel(now, &data.RequestDate)
+	return Request{
+		Data: data,
+		Scheduled: &ScheduledRequest{
+			IntegrationIDs: []string{sc.integrationID},
+			MaxRuntime:     sc.maxRuntime,
+		},
+	}
+}
+
+// enqueue saves request to fsqueue, requests are processed in Run
+func (s *Exporter) enqueue(req Request) error {
+	m, err := structmarshal.StructToMap(req)
+	if err != nil {
+		return fmt.Errorf("could not marshal export request to map: %v", err)
+	}
+	s.queue.Input <- m
+	return nil
+}
+
+// exportScheduled runs export requested by local scheduler. Unlike export, it does not send any events to the backend.
+func (s *Exporter) exportScheduled(data *agent.ExportRequest, scheduled *ScheduledRequest) {
+	started := time.Now()
+	s.logger.Info("starting scheduled export", "job_id", data.JobID, "integrations", scheduled.IntegrationIDs, "max_runtime", scheduled.MaxRuntime)
+	_, _, _, err := s.doExport2(data, "", scheduled)
+	if err != nil {
+		s.logger.Error("scheduled export finished with error", "job_id", data.JobID, "err", err, "duration", time.Since(started))
+		return
+	}
+	s.logger.Info("scheduled export finished", "job_id", data.JobID, "duration", time.Since(started))
+}
+
+// requestedIntegrations converts local integrations to the format of export requests, used in export events for local exports
+func requestedIntegrations(integrations []inconfig.IntegrationAgent) (res []agent.ExportRequestIntegrations) {
+	for _, in := range integrations {
+		v := agent.ExportRequestIntegrations{}
+		v.ID = in.ID
+		v.Name = in.Name
+		v.SystemType = agent.ExportRequestIntegrationsSystemType(in.Type)
+		res = append(res, v)
+	}
+	return
+}
+
+func scheduledIntegrations(all []inconfig.IntegrationAgent, ids []string) (res []inconfig.IntegrationAgent) {
+	m := map[string]bool{}
+	for _, id := range ids {
+		m[id] = true
+	}
+	for _, in := range all {
+		if m[in.ID] {
+			res = append(res, in)
+		}
+	}
+	return
+}
@@ -0,0 +1,204 @@
+package exporter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/cmd/cmdrunnorestarts/inconfig"
+	"github.com/pinpt/agent/pkg/agentconf"
+	"github.com/pinpt/agent/pkg/cronexpr"
+	"github.com/stretchr/testify/assert"
+)
+
+func testScheduleConf() agentconf.Config {
+	conf := agentconf.Config{}
+	conf.Output.Type = agentconf.OutputTypeLocal
+	conf.Output.Dir = "/tmp/out"
+	in := inconfig.IntegrationAgent{}
+	in.ID = "id1"
+	in.Name = "github"
+	conf.ExtraIntegrations = []inconfig.IntegrationAgent{in}
+	conf.Schedules = []agentconf.Schedule{
+		{IntegrationID: "id1", Cron: "0 * * * *", MaxRuntime: "1h"},
+	}
+	return conf
+}
+
+func TestParseSchedulesErrors(t *testing.T) {
+	conf := testScheduleConf()
+	conf.Output = agentconf.Output{}
+	_, err := parseSchedules(conf)
+	assert.Error(t, err)
+
+	conf = testScheduleConf()
+	conf.Schedules[0].IntegrationID = "id2"
+	_, err = parseSchedules(conf)
+	assert.Error(t, err)
+
+	conf = testScheduleConf()
+	conf.Schedules = append(conf.Schedules, conf.Schedules[0])
+	_, err = parseSchedules(conf)
+	assert.Error(t, err)
+
+	conf = testScheduleConf()
+	conf.Schedules[0].Cron = "* *"
+	_, err = parseSchedules(conf)
+	assert.Error(t, err)
+
+	conf = testScheduleConf()
+	conf.Schedules[0].MaxRuntime = "1x"
+	_, err = parseSchedules(conf)
+	assert.Error(t, err)
+
+	conf = testScheduleConf()
+	conf.Schedules[0].MaxRuntime = ""
+	res, err := parseSchedules(conf)
+	assert.NoError(t, err)
+	assert.Equal(t, defaultScheduleMaxRuntime, res[0].maxRuntime)
+}
+
+type testSchedulerEnv struct {
+	now       time.Time
+	running   bool
+	requests  []Request
+	stateFile string
+}
+
+func (s *testSchedulerEnv) newScheduler(t *testing.T) *scheduler {
+	sc, err := newScheduler(schedulerOpts{
+		Logger:    hclog.New(&hclog.LoggerOptions{Name: "test"}),
+		Conf:      testScheduleConf(),
+		StateFile: s.stateFile,
+		IsRunning: func(string) bool {
+			return s.running
+		},
+		Enqueue: func(req Request) error {
+			s.requests = append(s.requests, req)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc.now = func() time.Time {
+		return s.now
+	}
+	return sc
+}
+
+func TestSchedulerCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exporter-schedule")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	env := &testSchedulerEnv{}
+	env.stateFile = filepath.Join(dir, "export_schedule.json")
+	env.now = time.Date(2020, 1, 1, 10, 30, 0, 0, time.UTC)
+	sc := env.newScheduler(t)
+
+	// first check only records the schedule
+	assert.NoError(t, sc.check())
+	assert.Len(t, env.requests, 0)
+
+	env.now = time.Date(2020, 1, 1, 10, 59, 0, 0, time.UTC)
+	assert.NoError(t, sc.check())
+	assert.Len(t, env.requests, 0)
+
+	env.now = time.Date(2020, 1, 1, 11, 0, 10, 0, time.UTC)
+	assert.NoError(t, sc.check())
+	if !assert.Len(t, env.requests, 1) {
+		return
+	}
+	req := env.requests[0]
+	assert.Equal(t, []string{"id1"}, req.Scheduled.IntegrationIDs)
+	assert.Equal(t, time.Hour, req.Scheduled.MaxRuntime)
+	assert.Equal(t, "scheduled-id1-1577876410", req.Data.JobID)
+
+	// same activation is not queued twice
+	env.now = time.Date(2020, 1, 1, 11, 0, 40, 0, time.UTC)
+	assert.NoError(t, sc.check())
+	assert.Len(t, env.requests, 1)
+
+	// skipped when export is running
+	env.running = true
+	env.now = time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, sc.check())
+	assert.Len(t, env.requests, 1)
+	env.running = false
+	env.now = time.Date(2020, 1, 1, 12, 30, 0, 0, time.UTC)
+	assert.NoError(t, sc.check())
+	assert.Len(t, env.requests, 1)
+
+	env.now = time.Date(2020, 1, 1, 13, 0, 0, 0, time.UTC)
+	assert.NoError(t, sc.check())
+	assert.Len(t, env.requests, 2)
+}
+
+func mustParseCron(t *testing.T, v string) *cronexpr.Expr {
+	res, err := cronexpr.Parse(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestSchedulerMinInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exporter-schedule")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	env := &testSchedulerEnv{}
+	env.stateFile = filepath.Join(dir, "export_schedule.json")
+	env.now = time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	sc := env.newScheduler(t)
+	sc.schedules[0].expr = mustParseCron(t, "*/5 * * * *")
+
+	assert.NoError(t, sc.check())
+	env.now = time.Date(2020, 1, 1, 10, 5, 0, 0, time.UTC)
+	assert.NoError(t, sc.check())
+	assert.Len(t, env.requests, 1)
+
+	env.now = time.Date(2020, 1, 1, 10, 10, 0, 0, time.UTC)
+	assert.NoError(t, sc.check())
+	assert.Len(t, env.requests, 1)
+
+	env.now = time.Date(2020, 1, 1, 10, 20, 0, 0, time.UTC)
+	assert.NoError(t, sc.check())
+	assert.Len(t, env.requests, 2)
+}
+
+func TestSchedulerCatchUpAfterRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exporter-schedule")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	env := &testSchedulerEnv{}
+	env.stateFile = filepath.Join(dir, "export_schedule.json")
+	env.now = time.Date(2020, 1, 1, 10, 30, 0, 0, time.UTC)
+	sc := env.newScheduler(t)
+	assert.NoError(t, sc.check())
+	assert.Len(t, env.requests, 0)
+
+	// agent was not running for a few activations, only one export is queued on start
+	env.now = time.Date(2020, 1, 1, 15, 30, 0, 0, time.UTC)
+	sc = env.newScheduler(t)
+	assert.NoError(t, sc.check())
+	assert.Len(t, env.requests, 1)
+
+	env.now = time.Date(2020, 1, 1, 15, 31, 0, 0, time.UTC)
+	assert.NoError(t, sc.check())
+	assert.Len(t, env.requests, 1)
+}
+
+func TestScheduledIntegrations(t *testing.T) {
+	in1 := inconfig.IntegrationAgent{}
+	in1.ID = "id1"
+	in2 := inconfig.IntegrationAgent{}
+	in2.ID = "id2"
+	got := scheduledIntegrations([]inconfig.IntegrationAgent{in1, in2}, []string{"id2"})
+	assert.Equal(t, []inconfig.IntegrationAgent{in2}, got)
+}
@@ -3,89 +3,124 @@ package exporter
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/cmd/cmdexport"
 	"github.com/pinpt/agent/pkg/fs"
+	"github.com/pinpt/agent/pkg/fsconf"
+	"github.com/pinpt/agent/pkg/kvstore"
 )
 
-func (s *Exporter) backupRestoreStateDir() error {
-	locs := s.opts.FSConf
-
-	stateExists, err := fs.Exists(locs.State)
+// backupRestoreState saves the state before export or restores it if the previous export did not finish. When resumed is set the state is kept, since it matches the files exported by the interrupted run of the same job.
+func (s *Exporter) backupRestoreState(locs fsconf.Locs, resumed bool) error {
+	err := os.MkdirAll(locs.State, 0755)
 	if err != nil {
-		return err
+		return fmt.Errorf("could not create dir to save state, err: %v", err)
 	}
-	if !stateExists {
-		err = os.MkdirAll(locs.State, 0755)
-		if err != nil {
-			return fmt.Errorf("could not create dir to save state, err: %v", err)
-		}
-		return nil
+	state, err := kvstore.OpenState(s.logger, locs)
+	if err != nil {
+		return err
 	}
 
-	backupExists, err := fs.Exists(locs.Backup)
+	backupExists, err := state.HasBackup()
 	if err != nil {
 		return err
 	}
 
+	if backupExists && resumed {
+		s.logger.Info("previous export of the same job did not finish, keeping state to resume it")
+		return nil
+	}
+
 	if backupExists {
+		s.logger.Info("previous export/upload did not finish since we found a backup, restoring previous state and trying again")
+		// restore the backup, but also keep backup, so we could restore to it again
+		return state.RestoreBackup()
+	}
 
-		s.logger.Info("previous export/upload did not finish since we found a backup dir, restoring previous state and trying again")
+	return state.Backup(kvstore.BucketLastProcessed, kvstore.BucketRipsrcCheckpoints)
+}
 
-		// restore the backup, but also keep backup, so we could restore to it again
+func (s *Exporter) deleteStateBackup(locs fsconf.Locs) error {
+	state, err := kvstore.OpenState(s.logger, locs)
+	if err != nil {
+		return err
+	}
+	if err := state.DeleteBackup(); err != nil {
+		return fmt.Errorf("error deleting export state backup: %v", err)
+	}
+	// export finished, same job must not be resumed
+	if err := os.RemoveAll(locs.ExportCheckpointFile); err != nil {
+		return fmt.Errorf("error deleting export checkpoint file: %v", err)
+	}
+	return nil
+}
 
-		if err := os.RemoveAll(locs.LastProcessedFile); err != nil {
-			return err
-		}
+// isResumedExport returns true if the export of the same job was interrupted and can be resumed
+func isResumedExport(locs fsconf.Locs, jobID string) (bool, error) {
+	if jobID == "" {
+		return false, nil
+	}
+	checkpointJobID, err := cmdexport.CheckpointJobID(locs.ExportCheckpointFile)
+	if err != nil {
+		return false, err
+	}
+	return checkpointJobID == jobID, nil
+}
 
-		if err := fs.CopyFile(locs.LastProcessedFileBackup, locs.LastProcessedFile); err != nil {
-			// would happen when running first historical because backup does not have any state yet, but we should be able to recover to that in case of error
-			if !os.IsNotExist(err) {
-				return err
+// removeTempSessionFiles deletes session files that were not closed by the interrupted export. Closed session files are kept.
+func removeTempSessionFiles(dir string) error {
+	return filepath.Walk(dir, func(loc string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && loc == dir {
+				return nil
 			}
-		}
-
-		if err := os.RemoveAll(locs.RipsrcCheckpoints); err != nil {
 			return err
 		}
-
-		if err := fs.CopyDir(locs.RipsrcCheckpointsBackup, locs.RipsrcCheckpoints); err != nil {
-			// would happen when running first historical because backup does not have any state yet, but we should be able to recover to that in case of error
-			if !os.IsNotExist(err) {
-				return err
-			}
+		if info.IsDir() || (!strings.HasSuffix(loc, ".temp") && !strings.HasSuffix(loc, ".temp.gz")) {
+			return nil
 		}
+		return os.Remove(loc)
+	})
+}
 
-		return nil
-	}
+// migrateMu serializes state migration of exports and webhooks of the same integration
+var migrateMu sync.Mutex
 
-	// save backup
+// migratedMarkerFile is created in integration state dir after the shared state is copied
+const migratedMarkerFile = "migrated"
 
-	err = os.MkdirAll(locs.Backup, 0755)
+// migrateIntegrationState copies the state shared by all integrations, used before exports of different integrations could run concurrently, into the state store of the integration. This way the first export after upgrade is incremental. Marker file is written as the last step, if the copy fails or the process crashes the migration runs again. Does nothing if the marker exists.
+func migrateIntegrationState(logger hclog.Logger, shared fsconf.Locs, locs fsconf.Locs) error {
+	migrateMu.Lock()
+	defer migrateMu.Unlock()
+	marker := filepath.Join(locs.State, migratedMarkerFile)
+	exists, err := fs.Exists(marker)
 	if err != nil {
 		return err
 	}
-
-	if err := fs.CopyFile(locs.LastProcessedFile, locs.LastProcessedFileBackup); err != nil {
-		// would happen if export did not create last processed file, which is very unlikely
-		if !os.IsNotExist(err) {
-			return err
-		}
+	if exists {
+		return nil
 	}
-
-	if err := fs.CopyDir(locs.RipsrcCheckpoints, locs.RipsrcCheckpointsBackup); err != nil {
-		// would happen if export did not have any ripsrc data
-		if !os.IsNotExist(err) {
-			return err
-		}
+	err = os.MkdirAll(locs.State, 0755)
+	if err != nil {
+		return err
 	}
-
-	return nil
-}
-
-func (s *Exporter) deleteBackupStateDir() error {
-	locs := s.opts.FSConf
-	if err := os.RemoveAll(locs.Backup); err != nil {
-		return fmt.Errorf("error deleting export backup file: %v", err)
+	sharedState, err := kvstore.OpenState(logger, shared)
+	if err != nil {
+		return err
 	}
-	return nil
+	state, err := kvstore.OpenState(logger, locs)
+	if err != nil {
+		return err
+	}
+	// last processed and dedup keys contain integration id, so copying all data is fine. Copy replaces the buckets, so partial state of interrupted migration is overwritten.
+	err = kvstore.CopyBuckets(sharedState, state, kvstore.BucketLastProcessed, kvstore.BucketDedup, kvstore.BucketRipsrcCheckpoints)
+	if err != nil {
+		return err
+	}
+	return fs.WriteToTempAndRename(strings.NewReader(""), marker)
 }
@@ -0,0 +1,234 @@
+package exporter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pinpt/agent/cmd/cmdexport"
+	"github.com/pinpt/agent/cmd/cmdrunnorestarts/exporter/fsqueue"
+	"github.com/pinpt/agent/pkg/date"
+	"github.com/pinpt/agent/pkg/structmarshal"
+	"github.com/pinpt/go-common/datetime"
+	"github.com/pinpt/integration-sdk/agent"
+)
+
+// LastExport is the result of the last export of an integration since the service started
+type LastExport struct {
+	Name     string                        `json:"name"`
+	JobID    string                        `json:"job_id"`
+	Started  time.Time                     `json:"started"`
+	Duration time.Duration                 `json:"duration"`
+	Error    string                        `json:"error"`
+	Result   []cmdexport.ResultIntegration `json:"result"`
+}
+
+func (s *Exporter) setLastExport(name string, jobID string, started time.Time, res integrationExport) {
+	v := LastExport{}
+	v.Name = name
+	v.JobID = jobID
+	v.Started = started
+	v.Duration = time.Since(started)
+	if res.Err != nil {
+		v.Error = res.Err.Error()
+	}
+	v.Result = res.Result.Integrations
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastExports[res.Key] = v
+}
+
+// LastExports returns the last export of every integration by state key
+func (s *Exporter) LastExports() map[string]LastExport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := map[string]LastExport{}
+	for k, v := range s.lastExports {
+		res[k] = v
+	}
+	return res
+}
+
+// RunningIntegrations returns state keys of integrations that are being exported or waiting for the previous export of the same integration
+func (s *Exporter) RunningIntegrations() (res []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k := range s.runningIntegrations {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return
+}
+
+// Progress returns the progress tree of running integrations by state key, as saved by export process every 10s
+func (s *Exporter) Progress() (map[string]interface{}, error) {
+	res := map[string]interface{}{}
+	for _, key := range s.RunningIntegrations() {
+		b, err := ioutil.ReadFile(s.opts.FSConf.ForIntegration(key).ExportProgressFile)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// not started yet
+				continue
+			}
+			return nil, err
+		}
+		var v interface{}
+		err = json.Unmarshal(b, &v)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse export progress of %v: %v", key, err)
+		}
+		res[key] = v
+	}
+	return res, nil
+}
+
+// QueuedRequest describes export request in the queue
+type QueuedRequest struct {
+	JobID       string    `json:"job_id"`
+	RequestDate time.Time `json:"request_date"`
+	// Integrations contains integration names for requests from the backend and integration ids for local requests
+	Integrations []string `json:"integrations"`
+	Local        bool     `json:"local"`
+}
+
+// QueuedRequests returns export requests that are queued or in progress
+func (s *Exporter) QueuedRequests() (res []QueuedRequest, _ error) {
+	for _, data := range s.queue.Pending() {
+		req := Request{}
+		err := structmarshal.MapToStruct(data, &req)
+		if err != nil {
+			return nil, fmt.Errorf("could not unmarshal export request from map: %v", err)
+		}
+		v := QueuedRequest{}
+		if req.Data != nil {
+			v.JobID = req.Data.JobID
+			v.RequestDate = datetime.DateFromEpoch(req.Data.RequestDate.Epoch)
+			for _, in := range req.Data.Integrations {
+				v.Integrations = append(v.Integrations, in.Name)
+			}
+		}
+		if req.Scheduled != nil {
+			v.Local = true
+			v.Integrations = req.Scheduled.IntegrationIDs
+		}
+		res = append(res, v)
+	}
+	return
+}
+
+// ExportLocal queues export of integrations from ExtraIntegrations in config. Exports all of them when integrationIDs is empty. For local and s3 output it runs the same way as scheduled exports. For pinpoint output uploadURL is required, the export is uploaded and reported to the backend the same way as export requests from the backend.
+func (s *Exporter) ExportLocal(integrationIDs []string, uploadURL string) (jobID string, _ error) {
+	if s.conf.Output.IsPinpoint() {
+		if uploadURL == "" {
+			return "", errors.New("upload_url is required for local exports with pinpoint output")
+		}
+	} else if uploadURL != "" {
+		return "", errors.New("upload_url is only used with pinpoint output")
+	}
+	configured := map[string]bool{}
+	var all []string
+	for _, in := range s.conf.ExtraIntegrations {
+		if in.ID == "" {
+			continue
+		}
+		configured[in.ID] = true
+		all = append(all, in.ID)
+	}
+	if len(integrationIDs) == 0 {
+		integrationIDs = all
+	}
+	if len(integrationIDs) == 0 {
+		return "", errors.New("no integrations with id in extra_integrations")
+	}
+	for _, id := range integrationIDs {
+		if !configured[id] {
+			return "", fmt.Errorf("integration id %v not found in extra_integrations", id)
+		}
+	}
+
+	jobID, err := newLocalJobID()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	data := &agent.ExportRequest{}
+	data.JobID = jobID
+	date.ConvertToModel(now, &data.RequestDate)
+	if uploadURL != "" {
+		data.UploadURL = &uploadURL
+	}
+	s.ExportQueue <- Request{
+		Data: data,
+		Scheduled: &ScheduledRequest{
+			IntegrationIDs: integrationIDs,
+			MaxRuntime:     defaultScheduleMaxRuntime,
+		},
+	}
+	return data.JobID, nil
+}
+
+// newLocalJobID returns a unique job id for local exports. Random suffix is needed since more than one export can be requested in the same second.
+func newLocalJobID() (string, error) {
+	b := make([]byte, 4)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("could not generate job id: %v", err)
+	}
+	return "local-" + time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(b), nil
+}
+
+var errExportCancelled = errors.New("export cancelled")
+
+// ErrJobNotRunning is returned from CancelJob when there is no export request queued or in progress with passed job id
+var ErrJobNotRunning = errors.New("no export queued or in progress with passed job id")
+
+// registerJob allows cancelling export request in progress using CancelJob. If the request was cancelled while queued, cancel is called immediately.
+func (s *Exporter) registerJob(jobID string, cancel context.CancelFunc) (unregister func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobCancels[jobID] = cancel
+	if s.cancelledJobs[jobID] {
+		delete(s.cancelledJobs, jobID)
+		cancel()
+	}
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.jobCancels, jobID)
+	}
+}
+
+// CancelJob cancels export request in progress with passed job id, including requests waiting for exports of the same integrations. Export processes of other jobs keep running. Queued requests are removed from the queue, so these are not run again after restart. Returns ErrJobNotRunning if the job is not queued or in progress.
+func (s *Exporter) CancelJob(jobID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cancel := s.jobCancels[jobID]; cancel != nil {
+		cancel()
+		return nil
+	}
+	removed, err := s.queue.Remove(func(data fsqueue.Data) bool {
+		req := Request{}
+		err := structmarshal.MapToStruct(data, &req)
+		if err != nil {
+			s.logger.Error("could not unmarshal export request from map", "err", err)
+			return false
+		}
+		return req.Data != nil && req.Data.JobID == jobID
+	})
+	if err != nil {
+		return fmt.Errorf("could not remove export request from queue: %v", err)
+	}
+	if !removed {
+		return ErrJobNotRunning
+	}
+	// request could already be forwarded for processing, it is cancelled when registered
+	s.cancelledJobs[jobID] = true
+	return nil
+}
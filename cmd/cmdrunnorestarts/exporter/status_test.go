@@ -0,0 +1,116 @@
+package exporter
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/cmd/cmdrunnorestarts/exporter/fsqueue"
+	"github.com/pinpt/agent/pkg/fsconf"
+	"github.com/pinpt/agent/pkg/kvstore"
+	"github.com/pinpt/agent/pkg/structmarshal"
+	"github.com/pinpt/integration-sdk/agent"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLocalJobIDUnique(t *testing.T) {
+	ids := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		id, err := newLocalJobID()
+		assert.NoError(t, err)
+		assert.False(t, ids[id], "duplicate job id %v", id)
+		ids[id] = true
+	}
+}
+
+// testCancelExporter returns exporter with only the fields used by CancelJob set
+func testCancelExporter(t *testing.T) (_ *Exporter, remove func()) {
+	dir, err := ioutil.TempDir("", "exporter-cancel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := hclog.New(&hclog.LoggerOptions{Name: "test"})
+	// queued requests are sealed with secrets key derived from host id
+	os.Setenv("PP_AGENT_ID", "host1")
+	locs := fsconf.New(dir)
+	state, err := kvstore.OpenState(logger, locs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Exporter{}
+	s.logger = logger
+	s.jobCancels = map[string]context.CancelFunc{}
+	s.cancelledJobs = map[string]bool{}
+	s.queue, _, err = fsqueue.New(logger, state, locs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	assert := assert.New(t)
+	s, remove := testCancelExporter(t)
+	defer remove()
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	defer cancel1()
+	unregister1 := s.registerJob("j1", cancel1)
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	unregister2 := s.registerJob("j2", cancel2)
+	defer unregister2()
+
+	assert.Equal(ErrJobNotRunning, s.CancelJob("j3"))
+	assert.NoError(s.CancelJob("j1"))
+	assert.Equal(context.Canceled, ctx1.Err())
+	assert.NoError(ctx2.Err(), "other jobs keep running")
+
+	unregister1()
+	assert.Equal(ErrJobNotRunning, s.CancelJob("j1"))
+}
+
+func TestCancelQueuedJob(t *testing.T) {
+	assert := assert.New(t)
+	s, remove := testCancelExporter(t)
+	defer remove()
+
+	queue := func(jobID string) {
+		data := &agent.ExportRequest{}
+		data.JobID = jobID
+		m, err := structmarshal.StructToMap(Request{Data: data})
+		assert.NoError(err)
+		go func() {
+			s.queue.Input <- m
+		}()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.queue.Run(ctx)
+	queue("j1")
+	queue("j2")
+	for len(s.queue.Pending()) != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	assert.NoError(s.CancelJob("j1"))
+	reqs, err := s.QueuedRequests()
+	assert.NoError(err)
+	if assert.Len(reqs, 1) {
+		assert.Equal("j2", reqs[0].JobID)
+	}
+
+	// request was already forwarded for processing, it is cancelled when it starts
+	jobCtx, jobCancel := context.WithCancel(context.Background())
+	defer jobCancel()
+	unregister := s.registerJob("j1", jobCancel)
+	assert.Equal(context.Canceled, jobCtx.Err())
+	unregister()
+
+	assert.Equal(ErrJobNotRunning, s.CancelJob("j1"), "removed from queue")
+}
@@ -0,0 +1,134 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/cmd/cmdexport"
+	"github.com/pinpt/agent/cmd/cmdupload"
+	"github.com/pinpt/agent/pkg/fs"
+	"github.com/pinpt/agent/pkg/fsconf"
+	"github.com/pinpt/integration-sdk/agent"
+)
+
+// uploadStream uploads export data of one integration to pinpoint while the export is running. See cmdupload.Stream for details.
+//
+// Export result is stored next to upload progress, so that it can be sent to the backend when the upload is retried after restart.
+type uploadStream struct {
+	*cmdupload.Stream
+	dir string
+}
+
+// jobUploadStreamsDir contains upload streams of all integrations in the job
+func (s *Exporter) jobUploadStreamsDir(jobID string) string {
+	return filepath.Join(s.opts.FSConf.UploadZips, sanitizeStateKey(jobID))
+}
+
+func (s *Exporter) newUploadStream(data *agent.ExportRequest, key string, locs fsconf.Locs) (*uploadStream, error) {
+	if data.UploadURL == nil || *data.UploadURL == "" {
+		return nil, errors.New("No UploadURL provided in ExportRequest")
+	}
+	res := &uploadStream{}
+	res.dir = filepath.Join(s.jobUploadStreamsDir(data.JobID), key)
+	var err error
+	res.Stream, err = cmdupload.NewStream(cmdupload.StreamOpts{
+		Logger:    s.logger.With("job_id", data.JobID, "state_key", key),
+		Dirs:      map[string]string{key: locs.Uploads},
+		StateDir:  filepath.Join(res.dir, "upload"),
+		UploadURL: *data.UploadURL,
+		APIKey:    s.conf.APIKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *uploadStream) resultFile() string {
+	return filepath.Join(s.dir, "result.json")
+}
+
+// SaveResult stores export result, call before Finish
+func (s *uploadStream) SaveResult(res cmdexport.Result) error {
+	b, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	return fs.WriteToTempAndRename(bytes.NewReader(b), s.resultFile())
+}
+
+// LoadResult returns export result saved before restart
+func (s *uploadStream) LoadResult() (res cmdexport.Result, _ error) {
+	b, err := ioutil.ReadFile(s.resultFile())
+	if err != nil {
+		return res, err
+	}
+	err = json.Unmarshal(b, &res)
+	return res, err
+}
+
+// Remove deletes upload progress and saved result
+func (s *uploadStream) Remove() error {
+	err := s.Stream.Remove()
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(s.dir)
+}
+
+// removeJobUploadStreamsDir removes the dir of job upload streams if all integrations were uploaded
+func (s *Exporter) removeJobUploadStreamsDir(jobID string) {
+	err := os.Remove(s.jobUploadStreamsDir(jobID))
+	if err != nil && !os.IsNotExist(err) {
+		s.logger.Debug("upload streams dir of job not removed", "err", err)
+	}
+}
+
+// removeStaleUploadStreams deletes upload streams of jobs that can not be resumed. A job can be resumed if it is in progress or if export checkpoint of any integration belongs to it. Streams of failed jobs that are not re-issued are removed once exports of other jobs replace their checkpoints.
+func (s *Exporter) removeStaleUploadStreams(logger hclog.Logger) error {
+	dirs, err := ioutil.ReadDir(s.opts.FSConf.UploadZips)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	keep := map[string]bool{}
+	s.mu.Lock()
+	for jobID := range s.jobCancels {
+		keep[sanitizeStateKey(jobID)] = true
+	}
+	s.mu.Unlock()
+	integrations, err := ioutil.ReadDir(s.opts.FSConf.IntegrationsState)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, in := range integrations {
+		if !in.IsDir() {
+			continue
+		}
+		jobID, err := cmdexport.CheckpointJobID(s.opts.FSConf.ForIntegration(in.Name()).ExportCheckpointFile)
+		if err != nil {
+			return err
+		}
+		if jobID != "" {
+			keep[sanitizeStateKey(jobID)] = true
+		}
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || keep[dir.Name()] {
+			continue
+		}
+		logger.Info("removing upload stream of job that can not be resumed", "dir", dir.Name())
+		err := os.RemoveAll(s.jobUploadStreamsDir(dir.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -69,6 +69,18 @@ type IntegrationConfigAgent struct {
 	AccessToken string `json:"access_token"`
 	// RefreshToken Refresh token
 	RefreshToken string `json:"refresh_token"`
+
+	// AppID GitHub app id, used with InstallationID and PrivateKey instead of APIKey
+	AppID string `json:"app_id"`
+	// InstallationID GitHub app installation id
+	InstallationID string `json:"installation_id"`
+	// PrivateKey PEM encoded GitHub app private key
+	PrivateKey string `json:"private_key"`
+}
+
+// Secrets returns pointers to fields with credentials, these are sealed when config is written to disk
+func (s *IntegrationConfigAgent) Secrets() []*string {
+	return []*string{&s.Password, &s.APIKey, &s.AccessToken, &s.RefreshToken, &s.PrivateKey}
 }
 
 // IntegrationDef defines a unique integration.
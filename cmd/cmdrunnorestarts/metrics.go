@@ -0,0 +1,53 @@
+package cmdrunnorestarts
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pinpt/agent/pkg/metrics"
+)
+
+// mergeMetricsPeriod is how often metrics files of exited processes are merged when /metrics is not requested
+const mergeMetricsPeriod = time.Minute
+
+// serveMetrics starts http server with prometheus metrics at /metrics if metrics_addr is set in config. Metrics of export and integration processes are read from fsconf.Metrics dir. Only localhost addresses are allowed, since the endpoint has no authentication.
+func (s *runner) serveMetrics() (closefunc, error) {
+	if s.conf.MetricsAddr == "" {
+		return func() {}, nil
+	}
+	if !isLoopbackHost(s.conf.MetricsAddr) {
+		return nil, fmt.Errorf("metrics_addr must be a localhost address, got: %v", s.conf.MetricsAddr)
+	}
+	logger := s.logger.Named("metrics")
+	collector := metrics.NewCollector(logger, s.fsconf.Metrics, metrics.Default)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", collector)
+	server := &http.Server{Handler: mux}
+
+	// listen before returning to report invalid address or port in use
+	l, err := net.Listen("tcp", s.conf.MetricsAddr)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("serving metrics", "addr", "http://"+l.Addr().String()+"/metrics")
+	mergeCtx, stopMerge := context.WithCancel(context.Background())
+	collector.StartMerger(mergeCtx, mergeMetricsPeriod)
+	go func() {
+		err := server.Serve(l)
+		if err != nil && err != http.ErrServerClosed {
+			logger.Error("metrics server failed", "err", err)
+		}
+	}()
+	return func() {
+		stopMerge()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		err := server.Shutdown(ctx)
+		if err != nil {
+			logger.Error("could not stop metrics server", "err", err)
+		}
+	}, nil
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/pinpt/go-common/datetime"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/pinpt/agent/cmd/cmdmutate"
 	"github.com/pinpt/agent/cmd/cmdrunnorestarts/inconfig"
+	"github.com/pinpt/agent/cmd/cmdrunnorestarts/pluginpool"
 	"github.com/pinpt/agent/cmd/cmdrunnorestarts/subcommand"
 	"github.com/pinpt/agent/pkg/date"
 	"github.com/pinpt/integration-sdk/agent"
@@ -153,6 +155,51 @@ func (s *runner) handleMutationEvents(ctx context.Context) (closefunc, error) {
 }
 
 func (s *runner) execMutate(ctx context.Context, config inconfig.IntegrationAgent, messageID string, mutation cmdmutate.Mutation) (res cmdmutate.Result, _ error) {
+	res, err := s.execMutatePool(ctx, config, mutation)
+	if err == nil {
+		return res, nil
+	}
+	if _, ok := err.(*pluginpool.UnavailableError); !ok {
+		return res, err
+	}
+	s.logger.Warn("could not use running plugin for mutation, starting separate process", "integration", config.Name, "err", err)
+	return s.execMutateSubcommand(ctx, config, messageID, mutation)
+}
+
+// execMutatePool runs the mutation using the plugin kept in the pool, the result is the same as for mutate subcommand
+func (s *runner) execMutatePool(ctx context.Context, config inconfig.IntegrationAgent, mutation cmdmutate.Mutation) (res cmdmutate.Result, _ error) {
+	data, err := json.Marshal(mutation.Data)
+	if err != nil {
+		return res, err
+	}
+	s.logger.Debug("executing mutation using plugin pool", "integration", config.Name, "fn", mutation.Fn)
+
+	res0, err := s.pluginPool.Mutate(ctx, config, mutation.Fn, string(data))
+	if err != nil {
+		return res, err
+	}
+	if res0.ErrorCode != "" {
+		res.ErrorCode = res0.ErrorCode
+		res.Error = res0.Error
+		if res.Error == "" {
+			res.Error = "Full error message not provided for status code: " + res.ErrorCode + ". This is a bug, we should always provide full error message."
+		}
+	} else if res0.Error != "" {
+		res.Error = res0.Error
+	} else {
+		res.Success = true
+		res.MutatedObjects = res0.MutatedObjects
+		res.WebappResponse = res0.WebappResponse
+	}
+	// add more context
+	if res.Error != "" {
+		res.Error = fmt.Sprintf("%v (%v/%v)", res.Error, config.Name, strings.ToLower(mutation.Fn))
+	}
+	s.logger.Debug("executing mutation", "success", res.Success, "err", res.Error)
+	return res, nil
+}
+
+func (s *runner) execMutateSubcommand(ctx context.Context, config inconfig.IntegrationAgent, messageID string, mutation cmdmutate.Mutation) (res cmdmutate.Result, _ error) {
 	integrations := []inconfig.IntegrationAgent{config}
 
 	c, err := subcommand.New(subcommand.Opts{
@@ -0,0 +1,474 @@
+// Package pluginpool keeps integration plugins running between mutation and webhook requests.
+// Starting a new process for each request adds noticeable latency to user driven actions,
+// so the plugins are started on first use per integration config and stopped when idle.
+package pluginpool
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/cmd/cmdintegration"
+	"github.com/pinpt/agent/cmd/cmdrunnorestarts/inconfig"
+	"github.com/pinpt/agent/cmd/pkg/directexport"
+	"github.com/pinpt/agent/pkg/expin"
+	"github.com/pinpt/agent/pkg/iloader"
+	"github.com/pinpt/agent/pkg/jsonstore"
+	"github.com/pinpt/agent/pkg/kvstore"
+	"github.com/pinpt/agent/pkg/structmarshal"
+	"github.com/pinpt/agent/rpcdef"
+)
+
+const defaultIdleTimeout = 10 * time.Minute
+const defaultHealthCheckInterval = 30 * time.Second
+
+// Opts are options for New
+type Opts struct {
+	Logger hclog.Logger
+	// AgentConfig is the same config that is passed to subcommands
+	AgentConfig cmdintegration.AgentConfig
+	// IdleTimeout is the time after which unused plugin is stopped. Defaults to 10m.
+	IdleTimeout time.Duration
+	// HealthCheckInterval is how often running plugins are checked. Defaults to 30s.
+	HealthCheckInterval time.Duration
+}
+
+// UnavailableError is returned when the request was not sent to the plugin or the plugin panicked while processing it. In this case the request is retried using a separate process.
+type UnavailableError struct {
+	Err error
+}
+
+func (s *UnavailableError) Error() string {
+	return "plugin unavailable: " + s.Err.Error()
+}
+
+// Pool keeps long running integration plugins, one per integration config
+type Pool struct {
+	opts   Opts
+	logger hclog.Logger
+
+	mu      sync.Mutex
+	plugins map[string]*plugin
+	closed  bool
+	// suspended is set while integration binaries are replaced, plugins are not started until Resume
+	suspended bool
+
+	stop    chan bool
+	stopped chan bool
+}
+
+// New creates the pool and starts background health checks. Call Close to stop all plugins.
+func New(opts Opts) *Pool {
+	if opts.Logger == nil || opts.AgentConfig.PinpointRoot == "" {
+		panic("provide all opts")
+	}
+	if opts.IdleTimeout == 0 {
+		opts.IdleTimeout = defaultIdleTimeout
+	}
+	if opts.HealthCheckInterval == 0 {
+		opts.HealthCheckInterval = defaultHealthCheckInterval
+	}
+	s := &Pool{}
+	s.opts = opts
+	s.logger = opts.Logger.Named("plugin-pool")
+	s.plugins = map[string]*plugin{}
+	s.stop = make(chan bool)
+	s.stopped = make(chan bool)
+	go s.checkLoop()
+	return s
+}
+
+// Mutate calls Mutate on the plugin for passed integration config
+func (s *Pool) Mutate(ctx context.Context, config inconfig.IntegrationAgent, fn string, data string) (res rpcdef.MutateResult, rerr error) {
+	rerr = s.call(config, nil, func(client rpcdef.Integration, exportConfig rpcdef.ExportConfig) error {
+		var err error
+		res, err = client.Mutate(ctx, fn, data, exportConfig)
+		return err
+	})
+	return
+}
+
+// Webhook calls Webhook on the plugin for passed integration config. Git repos requested by the integration are processed in the current process, same as in cmdwebhook. State of the integration with stateKey is used, see fsconf.Locs.ForIntegration.
+func (s *Pool) Webhook(ctx context.Context, config inconfig.IntegrationAgent, stateKey string, headers map[string]string, body string) (res rpcdef.WebhookResult, rerr error) {
+	agentConfig := s.opts.AgentConfig
+	agentConfig.IntegrationStateKey = stateKey
+	locs, err := agentConfig.Locs()
+	if err != nil {
+		rerr = &UnavailableError{Err: err}
+		return
+	}
+	state, err := kvstore.OpenState(s.logger, locs)
+	if err != nil {
+		rerr = &UnavailableError{Err: err}
+		return
+	}
+	lastProcessed, err := jsonstore.New(state)
+	if err != nil {
+		rerr = &UnavailableError{Err: err}
+		return
+	}
+	exporter := directexport.NewRepoExporter(directexport.RepoExporterOpts{
+		Logger:        s.logger,
+		AgentConfig:   agentConfig,
+		LastProcessed: lastProcessed,
+		State:         state,
+		Locs:          locs,
+	})
+	gitExportRes := make(chan directexport.RepoExporterRes)
+	go func() {
+		gitExportRes <- exporter.Run()
+	}()
+
+	rerr = s.call(config, exporter.ExportGitRepo, func(client rpcdef.Integration, exportConfig rpcdef.ExportConfig) error {
+		var err error
+		res, err = client.Webhook(ctx, headers, body, exportConfig)
+		return err
+	})
+
+	exporter.Done()
+	s.logger.Debug("waiting for git processing to finish")
+	gitRes := <-gitExportRes
+	if rerr != nil {
+		return
+	}
+	if gitRes.Err != nil {
+		rerr = fmt.Errorf("git processing failed, err: %v", gitRes.Err)
+		return
+	}
+	if res.MutatedObjects == nil {
+		res.MutatedObjects = rpcdef.MutatedObjects{}
+	}
+	for k, v := range gitRes.Data {
+		res.MutatedObjects[k] = append(res.MutatedObjects[k], v...)
+	}
+	err = lastProcessed.Save()
+	if err != nil {
+		rerr = fmt.Errorf("could not save updated last_processed file, err: %v", err)
+		return
+	}
+	return
+}
+
+// call runs fn on the plugin for passed config, starting it if needed. Calls to the same plugin are serialized, but neither pool nor plugin state is locked during the call. If fn returns an error, the plugin is stopped and checked for panics, next call will start a new one.
+func (s *Pool) call(config inconfig.IntegrationAgent, exportGitRepo func(fetch rpcdef.GitRepoFetch) error, fn func(client rpcdef.Integration, exportConfig rpcdef.ExportConfig) error) error {
+	p, err := s.get(config)
+	if err != nil {
+		return &UnavailableError{Err: err}
+	}
+	defer p.calls.Done()
+
+	p.callMu.Lock()
+	defer p.callMu.Unlock()
+	if p.isClosed() {
+		// stopped by health check after get
+		return &UnavailableError{Err: errors.New("plugin was stopped")}
+	}
+	if err := p.loader.Ping(); err != nil {
+		s.remove(p)
+		p.close(s.logger)
+		return &UnavailableError{Err: err}
+	}
+
+	p.exportGitRepo = exportGitRepo
+	defer func() {
+		p.exportGitRepo = nil
+	}()
+
+	err = fn(p.loader.RPCClient(), p.integration.ExportConfig)
+	s.touch(p)
+	if err != nil {
+		s.logger.Warn("plugin call failed, stopping plugin", "intg", p.integration.Export.String(), "err", err)
+		s.remove(p)
+		if p.close(s.logger) {
+			return &UnavailableError{Err: fmt.Errorf("plugin panicked: %v", err)}
+		}
+		return err
+	}
+	return nil
+}
+
+// get returns running plugin for config or starts a new one. Plugin is started without holding the pool lock, concurrent calls for the same config wait for the same start. Call p.calls.Done when the returned plugin is no longer used.
+func (s *Pool) get(config inconfig.IntegrationAgent) (*plugin, error) {
+	key, err := configKey(config)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, errors.New("pool is closed")
+	}
+	if s.suspended {
+		s.mu.Unlock()
+		return nil, errors.New("pool is suspended")
+	}
+	p, ok := s.plugins[key]
+	if !ok {
+		p = newPlugin(key)
+		s.plugins[key] = p
+	}
+	p.lastUsed = time.Now()
+	p.calls.Add(1)
+	s.mu.Unlock()
+
+	if !ok {
+		err := p.start(s.logger, s.opts.AgentConfig, config)
+		if err != nil {
+			s.remove(p)
+		} else {
+			s.logger.Info("started plugin", "intg", p.integration.Export.String())
+		}
+	}
+	<-p.ready
+	if p.startErr != nil {
+		p.calls.Done()
+		return nil, p.startErr
+	}
+	return p, nil
+}
+
+func (s *Pool) touch(p *plugin) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p.lastUsed = time.Now()
+}
+
+// remove removes the plugin from the pool, does not close it
+func (s *Pool) remove(p *plugin) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.plugins[p.key] == p {
+		delete(s.plugins, p.key)
+	}
+}
+
+func (s *Pool) checkLoop() {
+	defer close(s.stopped)
+	ticker := time.NewTicker(s.opts.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.check()
+		}
+	}
+}
+
+// check stops idle plugins and the ones that do not respond
+func (s *Pool) check() {
+	var idle []*plugin
+	var running []*plugin
+	s.mu.Lock()
+	for key, p := range s.plugins {
+		if !p.started() {
+			// starting or failed to start, removed by get in that case
+			continue
+		}
+		if time.Since(p.lastUsed) > s.opts.IdleTimeout {
+			idle = append(idle, p)
+			delete(s.plugins, key)
+		} else {
+			running = append(running, p)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, p := range idle {
+		s.logger.Debug("stopping idle plugin", "intg", p.integration.Export.String())
+		p.stop(s.logger)
+	}
+	for _, p := range running {
+		if p.isClosed() {
+			continue
+		}
+		// ping is safe to call concurrently with the request in progress
+		if err := p.loader.Ping(); err != nil {
+			s.logger.Warn("plugin health check failed, stopping plugin", "intg", p.integration.Export.String(), "err", err)
+			s.remove(p)
+			p.close(s.logger)
+		}
+	}
+}
+
+// Close stops all plugins. It waits for the calls in progress to complete.
+func (s *Pool) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	plugins := s.plugins
+	s.plugins = map[string]*plugin{}
+	s.mu.Unlock()
+
+	close(s.stop)
+	<-s.stopped
+
+	s.closePlugins(plugins)
+}
+
+// Suspend stops all plugins, so that integration binaries can be replaced. New calls return UnavailableError until Resume is called. It waits for the calls in progress to complete.
+func (s *Pool) Suspend() {
+	s.mu.Lock()
+	s.suspended = true
+	plugins := s.plugins
+	s.plugins = map[string]*plugin{}
+	s.mu.Unlock()
+
+	s.closePlugins(plugins)
+}
+
+// Resume allows starting plugins again after Suspend
+func (s *Pool) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.suspended = false
+}
+
+func (s *Pool) closePlugins(plugins map[string]*plugin) {
+	for _, p := range plugins {
+		<-p.ready
+		if p.startErr != nil {
+			continue
+		}
+		p.stop(s.logger)
+	}
+}
+
+// configKey returns the key of the plugin for the config. Config includes tokens, so changed credentials start a new plugin.
+func configKey(config inconfig.IntegrationAgent) (string, error) {
+	b, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+type plugin struct {
+	key string
+
+	// ready is closed when the plugin process is started, startErr is set if it failed. Fields below are set before ready is closed.
+	ready       chan struct{}
+	startErr    error
+	command     *cmdintegration.Command
+	integration cmdintegration.Integration
+	loader      *iloader.Integration
+
+	// lastUsed is protected by Pool.mu
+	lastUsed time.Time
+	// calls is the number of calls using the plugin, incremented under Pool.mu while the plugin is in the pool
+	calls sync.WaitGroup
+
+	// callMu serializes calls to the plugin, so that ExportGitRepo is routed to the current call
+	callMu        sync.Mutex
+	exportGitRepo func(fetch rpcdef.GitRepoFetch) error
+
+	// mu protects closed, it is not held during calls
+	mu     sync.Mutex
+	closed bool
+}
+
+func newPlugin(key string) *plugin {
+	s := &plugin{}
+	s.key = key
+	s.ready = make(chan struct{})
+	return s
+}
+
+// start starts the plugin process and closes ready
+func (s *plugin) start(logger hclog.Logger, agentConfig cmdintegration.AgentConfig, config inconfig.IntegrationAgent) (rerr error) {
+	defer func() {
+		s.startErr = rerr
+		close(s.ready)
+	}()
+	var in inconfig.Integration
+	err := structmarshal.StructToStruct(config, &in)
+	if err != nil {
+		rerr = err
+		return
+	}
+	// id is used in the plugin log file name, make it unique for each config
+	in.ID = "pool-" + s.key[:8]
+
+	s.command, err = cmdintegration.NewCommand(cmdintegration.Opts{
+		Logger:       logger,
+		AgentConfig:  agentConfig,
+		Integrations: []inconfig.Integration{in},
+	})
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	s.integration = s.command.OnlyIntegration()
+	agent := directexport.AgentDelegateFactory(logger, s)(s.integration.Export)
+	s.loader, err = s.command.NewIntegrationPlugin(s.integration.Export, agent)
+	if err != nil {
+		rerr = err
+		return
+	}
+	return
+}
+
+// started returns true if the plugin process was started successfully
+func (s *plugin) started() bool {
+	select {
+	case <-s.ready:
+		return s.startErr == nil
+	default:
+		return false
+	}
+}
+
+func (s *plugin) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// stop waits for the calls in progress and closes the plugin, call after removing it from the pool
+func (s *plugin) stop(logger hclog.Logger) {
+	s.calls.Wait()
+	s.close(logger)
+}
+
+// close stops the plugin and sends the panic to the backend if there was one. Returns true if the plugin panicked.
+func (s *plugin) close(logger hclog.Logger) (panicked bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.closed = true
+	panicked, err := s.command.CloseOnlyIntegrationAndDetectPanic(s.loader)
+	if err != nil {
+		logger.Error("could not close plugin", "intg", s.integration.Export.String(), "err", err)
+	}
+	return panicked
+}
+
+func (s *plugin) OAuthNewAccessToken(exp expin.Export) (token string, _ error) {
+	return s.command.OAuthNewAccessToken(exp)
+}
+
+func (s *plugin) OAuthNewAccessTokenFromRefreshToken(name string, refresh string) (token string, _ error) {
+	return s.command.OAuthNewAccessTokenFromRefreshToken(name, refresh)
+}
+
+// ExportGitRepo is only called during the plugin call, while callMu is held
+func (s *plugin) ExportGitRepo(fetch rpcdef.GitRepoFetch) error {
+	if s.exportGitRepo == nil {
+		return errors.New("git repo export is not supported for this request")
+	}
+	return s.exportGitRepo(fetch)
+}
@@ -0,0 +1,113 @@
+package pluginpool
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/cmd/cmdintegration"
+	"github.com/pinpt/agent/cmd/cmdrunnorestarts/inconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigKey(t *testing.T) {
+	assert := assert.New(t)
+	c1 := inconfig.IntegrationAgent{}
+	c1.Name = "jira"
+	c1.Config.AccessToken = "t1"
+	c2 := c1
+	k1, err := configKey(c1)
+	assert.NoError(err)
+	k2, err := configKey(c2)
+	assert.NoError(err)
+	assert.Equal(k1, k2)
+
+	c2.Config.AccessToken = "t2"
+	k2, err = configKey(c2)
+	assert.NoError(err)
+	assert.NotEqual(k1, k2)
+}
+
+func TestMutateUnavailable(t *testing.T) {
+	assert := assert.New(t)
+	root, err := ioutil.TempDir("", "pluginpool")
+	assert.NoError(err)
+	defer os.RemoveAll(root)
+
+	agentConfig := cmdintegration.AgentConfig{}
+	agentConfig.CustomerID = "c1"
+	agentConfig.PinpointRoot = root
+	// integration binaries are missing in this dir
+	agentConfig.IntegrationsDir = filepath.Join(root, "integrations")
+
+	pool := New(Opts{
+		Logger:      hclog.New(&hclog.LoggerOptions{Name: "test"}),
+		AgentConfig: agentConfig,
+	})
+	defer pool.Close()
+
+	config := inconfig.IntegrationAgent{}
+	config.Name = "jira"
+	_, err = pool.Mutate(context.Background(), config, "ISSUE_SET_TITLE", `{}`)
+	if assert.Error(err) {
+		_, ok := err.(*UnavailableError)
+		assert.True(ok, "expected UnavailableError, got: %v", err)
+	}
+
+	pool.Suspend()
+	_, err = pool.Mutate(context.Background(), config, "ISSUE_SET_TITLE", `{}`)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "suspended")
+	}
+	pool.Resume()
+	_, err = pool.Mutate(context.Background(), config, "ISSUE_SET_TITLE", `{}`)
+	if assert.Error(err) {
+		assert.NotContains(err.Error(), "suspended")
+	}
+
+	pool.Close()
+	_, err = pool.Mutate(context.Background(), config, "ISSUE_SET_TITLE", `{}`)
+	_, ok := err.(*UnavailableError)
+	assert.True(ok, "expected UnavailableError after close, got: %v", err)
+}
+
+func TestConcurrentStartFailure(t *testing.T) {
+	assert := assert.New(t)
+	root, err := ioutil.TempDir("", "pluginpool")
+	assert.NoError(err)
+	defer os.RemoveAll(root)
+
+	agentConfig := cmdintegration.AgentConfig{}
+	agentConfig.CustomerID = "c1"
+	agentConfig.PinpointRoot = root
+	agentConfig.IntegrationsDir = filepath.Join(root, "integrations")
+
+	pool := New(Opts{
+		Logger:      hclog.New(&hclog.LoggerOptions{Name: "test"}),
+		AgentConfig: agentConfig,
+	})
+	defer pool.Close()
+
+	config := inconfig.IntegrationAgent{}
+	config.Name = "jira"
+	errs := make(chan error)
+	for i := 0; i < 5; i++ {
+		go func() {
+			_, err := pool.Mutate(context.Background(), config, "ISSUE_SET_TITLE", `{}`)
+			errs <- err
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		err := <-errs
+		_, ok := err.(*UnavailableError)
+		assert.True(ok, "expected UnavailableError, got: %v", err)
+	}
+
+	// failed plugin is not kept in the pool
+	pool.mu.Lock()
+	assert.Equal(0, len(pool.plugins))
+	pool.mu.Unlock()
+}
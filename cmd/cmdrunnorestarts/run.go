@@ -25,6 +25,7 @@ import (
 
 	"github.com/pinpt/agent/cmd/pkg/cmdlogger"
 	"github.com/pinpt/agent/pkg/deviceinfo"
+	"github.com/pinpt/agent/pkg/expsink"
 
 	"github.com/pinpt/go-common/datamodel"
 	"github.com/pinpt/go-common/event/action"
@@ -33,6 +34,7 @@ import (
 	"github.com/pinpt/agent/cmd/cmdrunnorestarts/crashes"
 	"github.com/pinpt/agent/cmd/cmdrunnorestarts/exporter"
 	"github.com/pinpt/agent/cmd/cmdrunnorestarts/logsender"
+	"github.com/pinpt/agent/cmd/cmdrunnorestarts/pluginpool"
 	"github.com/pinpt/agent/cmd/cmdrunnorestarts/updater"
 )
 
@@ -84,6 +86,9 @@ type runner struct {
 
 	logSender *logsender.Sender
 
+	// pluginPool keeps integrations running for mutations and webhooks
+	pluginPool *pluginpool.Pool
+
 	onboardingInProgress int64
 }
 
@@ -101,6 +106,10 @@ func newRunner(opts Opts) (*runner, error) {
 	}
 
 	s.conf = opts.AgentConf
+	err := expsink.Validate(s.conf.Output)
+	if err != nil {
+		return nil, err
+	}
 
 	s.agentConfig = s.getAgentConfig()
 	s.deviceInfo = s.getDeviceInfoOpts()
@@ -200,6 +209,20 @@ func (s *runner) Run(ctx context.Context) error {
 		return fmt.Errorf("could not initialize exporter, err: %v", err)
 	}
 
+	s.pluginPool = pluginpool.New(pluginpool.Opts{
+		Logger:      s.logger,
+		AgentConfig: s.agentConfig,
+	})
+	closers = append(closers, s.pluginPool.Close)
+
+	{
+		close, err := s.serveMetrics()
+		if err != nil {
+			return fmt.Errorf("could not start metrics server, err: %v", err)
+		}
+		closers = append(closers, close)
+	}
+
 	go func() {
 		s.sendPings()
 	}()
@@ -208,6 +231,14 @@ func (s *runner) Run(ctx context.Context) error {
 		s.exporter.Run()
 	}()
 
+	{
+		close, err := s.serveStatusAPI()
+		if err != nil {
+			return fmt.Errorf("could not start status api, err: %v", err)
+		}
+		closers = append(closers, close)
+	}
+
 	{
 		close, err := s.handleUpdateEvents(ctx)
 		if err != nil {
@@ -457,6 +488,7 @@ func (s *runner) getAgentConfig() (res cmdintegration.AgentConfig) {
 	res.PinpointRoot = s.opts.PinpointRoot
 	res.IntegrationsDir = s.conf.IntegrationsDir
 	res.Backend.Enable = true
+	res.Output = s.conf.Output
 	return
 }
 
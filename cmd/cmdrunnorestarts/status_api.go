@@ -0,0 +1,225 @@
+package cmdrunnorestarts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/cmd/cmdrunnorestarts/exporter"
+	"github.com/pinpt/agent/pkg/agentconf"
+)
+
+// serveStatusAPI starts http server with service status and export controls if status_addr is set in config. Only localhost addresses are allowed, since the api has no authentication.
+//
+//	GET /status - agent version, configured integrations, queued and running exports, export progress and last export results
+//	POST /export - queue local export of integrations from extra_integrations, body: {"integration_ids": []}, all if empty
+//	POST /export/cancel - cancel export in progress, body: {"job_id": ""}, other exports keep running
+func (s *runner) serveStatusAPI() (closefunc, error) {
+	if s.conf.StatusAddr == "" {
+		return func() {}, nil
+	}
+	if !isLoopbackHost(s.conf.StatusAddr) {
+		return nil, fmt.Errorf("status_addr must be a localhost address, got: %v", s.conf.StatusAddr)
+	}
+	api := &statusAPI{}
+	api.logger = s.logger.Named("status-api")
+	api.runner = s
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", api.status)
+	mux.HandleFunc("/export", api.export)
+	mux.HandleFunc("/export/cancel", api.cancel)
+	server := &http.Server{Handler: api.checkRequest(mux)}
+
+	l, err := net.Listen("tcp", s.conf.StatusAddr)
+	if err != nil {
+		return nil, err
+	}
+	api.logger.Info("serving status api", "addr", "http://"+l.Addr().String())
+	go func() {
+		err := server.Serve(l)
+		if err != nil && err != http.ErrServerClosed {
+			api.logger.Error("status api server failed", "err", err)
+		}
+	}()
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		err := server.Shutdown(ctx)
+		if err != nil {
+			api.logger.Error("could not stop status api server", "err", err)
+		}
+	}, nil
+}
+
+func isLoopbackHost(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+type statusAPI struct {
+	logger hclog.Logger
+	runner *runner
+}
+
+// checkRequest rejects requests with non-localhost Host header to prevent dns rebinding from browsers. POST requests must have json content type, which browsers do not send cross-origin without preflight.
+func (s *statusAPI) checkRequest(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isLoopbackHost(r.Host) {
+			http.Error(w, "invalid host", http.StatusForbidden)
+			return
+		}
+		if r.Method == http.MethodPost {
+			ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if ct != "application/json" {
+				http.Error(w, "content type must be application/json", http.StatusUnsupportedMediaType)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (s *statusAPI) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		s.logger.Warn("could not write response", "err", err)
+	}
+}
+
+func (s *statusAPI) writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+type statusIntegration struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	Inclusions []string `json:"inclusions"`
+}
+
+type statusResponse struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	// Integrations are extra_integrations from config, integrations from the backend are passed in export requests
+	Integrations []statusIntegration  `json:"integrations"`
+	Schedules    []agentconf.Schedule `json:"schedules"`
+	Exporting    bool                 `json:"exporting"`
+	// Running contains state keys of integrations being exported
+	Running []string                 `json:"running"`
+	Queue   []exporter.QueuedRequest `json:"queue"`
+	// Progress is the progress tree of running exports by state key
+	Progress    map[string]interface{}         `json:"progress"`
+	LastExports map[string]exporter.LastExport `json:"last_exports"`
+}
+
+func (s *statusAPI) status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	exp := s.runner.exporter
+	res := statusResponse{}
+	res.Version = os.Getenv("PP_AGENT_VERSION")
+	res.Commit = os.Getenv("PP_AGENT_COMMIT")
+	for _, in := range s.runner.conf.ExtraIntegrations {
+		res.Integrations = append(res.Integrations, statusIntegration{
+			ID:         in.ID,
+			Name:       in.Name,
+			Type:       in.Type.String(),
+			Inclusions: in.Config.Inclusions,
+		})
+	}
+	res.Schedules = s.runner.conf.Schedules
+	res.Exporting = exp.IsRunning()
+	res.Running = exp.RunningIntegrations()
+	var err error
+	res.Queue, err = exp.QueuedRequests()
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	res.Progress, err = exp.Progress()
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	res.LastExports = exp.LastExports()
+	s.writeJSON(w, res)
+}
+
+type exportRequest struct {
+	IntegrationIDs []string `json:"integration_ids"`
+	// UploadURL is required for pinpoint output
+	UploadURL string `json:"upload_url"`
+}
+
+func (s *statusAPI) export(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req exportRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil && err != io.EOF {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+		return
+	}
+	s.logger.Info("received local export request", "integration_ids", req.IntegrationIDs)
+	jobID, err := s.runner.exporter.ExportLocal(req.IntegrationIDs, req.UploadURL)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.writeJSON(w, map[string]string{"job_id": jobID})
+}
+
+type cancelRequest struct {
+	JobID string `json:"job_id"`
+}
+
+func (s *statusAPI) cancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req cancelRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil && err != io.EOF {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+		return
+	}
+	if req.JobID == "" {
+		s.writeError(w, http.StatusBadRequest, errors.New("job_id is required"))
+		return
+	}
+	s.logger.Info("received cancel request", "job_id", req.JobID)
+	err = s.runner.exporter.CancelJob(req.JobID)
+	if err != nil {
+		if err == exporter.ErrJobNotRunning {
+			s.writeError(w, http.StatusNotFound, err)
+			return
+		}
+		s.logger.Error("error processing cancel request", "err", err)
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.writeJSON(w, map[string]bool{"cancelled": true})
+}
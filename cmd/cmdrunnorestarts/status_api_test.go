@@ -0,0 +1,41 @@
+package cmdrunnorestarts
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsLoopbackHost(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(isLoopbackHost("localhost:9101"))
+	assert.True(isLoopbackHost("127.0.0.1:9101"))
+	assert.True(isLoopbackHost("[::1]:9101"))
+	assert.True(isLoopbackHost("localhost"))
+	assert.False(isLoopbackHost(":9101"))
+	assert.False(isLoopbackHost("0.0.0.0:9101"))
+	assert.False(isLoopbackHost("example.com:9101"))
+}
+
+func TestStatusAPICheckRequest(t *testing.T) {
+	api := &statusAPI{logger: hclog.New(&hclog.LoggerOptions{Name: "test"})}
+	h := api.checkRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(method string, host string, contentType string) int {
+		r := httptest.NewRequest(method, "http://"+host+"/export", strings.NewReader("{}"))
+		if contentType != "" {
+			r.Header.Set("Content-Type", contentType)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "localhost:9101", ""))
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "attacker.example.com:9101", ""))
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "127.0.0.1:9101", "application/json; charset=utf-8"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, serve(http.MethodPost, "127.0.0.1:9101", "text/plain"))
+}
@@ -14,6 +14,7 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"sync"
 	"time"
 
 	hclog "github.com/hashicorp/go-hclog"
@@ -27,6 +28,8 @@ import (
 	"github.com/pinpt/agent/pkg/agentconf"
 	"github.com/pinpt/agent/pkg/date"
 	"github.com/pinpt/agent/pkg/deviceinfo"
+	"github.com/pinpt/agent/pkg/fsconf"
+	"github.com/pinpt/agent/pkg/secrets"
 )
 
 // Cancelled implementation of error.
@@ -95,10 +98,11 @@ type KillCmdOpts struct {
 	PrintLog func(msg string, args ...interface{})
 }
 
-// KillCommand stops a running process
+// KillCommand stops all running processes of the command
 func KillCommand(opts KillCmdOpts, cmdname string) error {
 	opts.PrintLog("killing command manually", "cmd", cmdname)
-	return removeProcess(opts, cmdname)
+	removeProcesses(opts, cmdname)
+	return nil
 }
 
 // Run executes the command
@@ -118,9 +122,14 @@ func (c *Command) RunKeepLogFile(ctx context.Context, cmdname string, messageID
 	rerr := func(err error) {
 		rerrv = fmt.Errorf("could not run subcommand %v err: %v", cmdname, err)
 	}
+	config, integrations, err := c.sealedConfig()
+	if err != nil {
+		rerr(fmt.Errorf("could not seal credentials: %v", err))
+		return
+	}
 	fs, err := newFsPassedParams(c.tmpdir, []kv{
-		{"--agent-config-file", c.config},
-		{"--integrations-file", c.integrations},
+		{"--agent-config-file", config},
+		{"--integrations-file", integrations},
 	})
 	defer fs.Clean()
 	if err != nil {
@@ -195,19 +204,16 @@ func (c *Command) RunKeepLogFile(ctx context.Context, cmdname string, messageID
 		return
 	}
 
+	pid := cmd.Process.Pid
 	if cmdname == "export" { // for now, only allow this command to be cancelled
-		if err := addProcess(c.logger, cmdname, cmd.Process); err != nil {
-			rerr(fmt.Errorf("could not start the sub command, process already running: %v %v", err, cmdname))
-			return
-		}
+		addProcess(c.logger, cmdname, cmd.Process)
 		defer func() {
-			// ignore error in this case since it will return an error if the process was kill manually
 			opts := KillCmdOpts{
 				PrintLog: func(msg string, args ...interface{}) {
 					c.logger.Debug(msg, args)
 				},
 			}
-			removeProcess(opts, cmdname)
+			removeProcess(opts, cmdname, pid)
 		}()
 	}
 
@@ -215,7 +221,7 @@ func (c *Command) RunKeepLogFile(ctx context.Context, cmdname string, messageID
 
 	if err != nil {
 		if cmdname == "export" {
-			if _, ok := processes[cmdname]; !ok {
+			if !hasProcess(cmdname, pid) {
 				rerrv = &Cancelled{s: cmdname + " cancelled"}
 				return
 			}
@@ -285,6 +291,27 @@ func (c *Command) handlePanic(filename, cmdname string) error {
 	return nil
 }
 
+// sealedConfig returns copies of config and integrations with credentials sealed, since these are written to temp files passed to subcommand
+func (c *Command) sealedConfig() (config cmdintegration.AgentConfig, integrations []inconfig.IntegrationAgent, _ error) {
+	ring, err := secrets.LoadKeyring(fsconf.New(c.config.PinpointRoot))
+	if err != nil {
+		return config, nil, err
+	}
+	config = c.config
+	err = ring.SealAll(&config.Output.S3.SecretAccessKey)
+	if err != nil {
+		return config, nil, err
+	}
+	integrations = append([]inconfig.IntegrationAgent(nil), c.integrations...)
+	for i := range integrations {
+		err := ring.SealAll(integrations[i].Config.Secrets()...)
+		if err != nil {
+			return config, nil, err
+		}
+	}
+	return config, integrations, nil
+}
+
 type kv struct {
 	K string
 	V interface{}
@@ -350,29 +377,52 @@ func (s *fsPassedParams) Clean() error {
 	return nil
 }
 
-var processes map[string]*os.Process
+// processes contains running processes by command name and pid. Multiple exports can run at the same time.
+var processes map[string]map[int]*os.Process
+var processesMu sync.Mutex
 
 func init() {
-	processes = make(map[string]*os.Process)
+	processes = make(map[string]map[int]*os.Process)
 }
 
-// Warning! Not safe for concurrent use.
-func addProcess(logger hclog.Logger, name string, p *os.Process) error {
-	if _, o := processes[name]; o {
-		return errors.New("process already exists: " + name)
+func addProcess(logger hclog.Logger, name string, p *os.Process) {
+	processesMu.Lock()
+	defer processesMu.Unlock()
+	logger.Debug("adding process to map", "name", name, "pid", p.Pid)
+	if processes[name] == nil {
+		processes[name] = map[int]*os.Process{}
 	}
-	logger.Debug("adding process to map", "name", name)
-	processes[name] = p
-	return nil
+	processes[name][p.Pid] = p
+}
+
+func hasProcess(name string, pid int) bool {
+	processesMu.Lock()
+	defer processesMu.Unlock()
+	_, ok := processes[name][pid]
+	return ok
 }
 
-// Warning! Not safe for concurrent use.
-func removeProcess(opts KillCmdOpts, name string) error {
-	if p, o := processes[name]; o {
+// removeProcess removes the process from map and kills it if still running
+func removeProcess(opts KillCmdOpts, name string, pid int) {
+	processesMu.Lock()
+	p, ok := processes[name][pid]
+	delete(processes[name], pid)
+	processesMu.Unlock()
+	if !ok {
+		return
+	}
+	opts.PrintLog("removing process from map", "name", name, "pid", fmt.Sprint(p.Pid))
+	Kill(opts, p)
+}
+
+// removeProcesses removes and kills all processes of the command
+func removeProcesses(opts KillCmdOpts, name string) {
+	processesMu.Lock()
+	ps := processes[name]
+	delete(processes, name)
+	processesMu.Unlock()
+	for _, p := range ps {
 		opts.PrintLog("removing process from map", "name", name, "pid", fmt.Sprint(p.Pid))
-		delete(processes, name)
 		Kill(opts, p)
 	}
-
-	return nil
 }
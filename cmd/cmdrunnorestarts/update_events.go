@@ -150,9 +150,18 @@ func (s *runner) updateTo(version string) (oldVersion string, updated bool, rerr
 		}
 	}
 
+	// stop running plugins, so that integration binaries can be replaced
+	if s.pluginPool != nil {
+		s.pluginPool.Suspend()
+	}
+
 	upd := updater.New(s.logger, s.fsconf, s.conf)
 	err := upd.Update(version)
 	if err != nil {
+		// service keeps running with previous version
+		if s.pluginPool != nil {
+			s.pluginPool.Resume()
+		}
 		rerr = fmt.Errorf("Could not update: %v", err)
 		return
 	}
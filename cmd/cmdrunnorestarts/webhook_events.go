@@ -16,6 +16,7 @@ import (
 
 	"github.com/pinpt/agent/cmd/cmdmutate"
 	"github.com/pinpt/agent/cmd/cmdrunnorestarts/inconfig"
+	"github.com/pinpt/agent/cmd/cmdrunnorestarts/pluginpool"
 	"github.com/pinpt/agent/cmd/cmdrunnorestarts/subcommand"
 	"github.com/pinpt/agent/cmd/cmdwebhook"
 	"github.com/pinpt/agent/pkg/date"
@@ -50,7 +51,7 @@ func (s *runner) handleWebhookEvents(ctx context.Context) (closefunc, error) {
 
 	cb := func(instance datamodel.ModelReceiveEvent) (datamodel.ModelSendEvent, error) {
 		req := instance.Object().(*agent.WebhookRequest)
-		integrationName := "github" // TODO: req.IntegrationName
+		integrationName := webhookIntegrationName(req.Headers, req.Data)
 		logger := s.logger.With("in", integrationName)
 
 		start := time.Now()
@@ -143,13 +144,75 @@ func (s *runner) handleWebhookEvents(ctx context.Context) (closefunc, error) {
 
 }
 
+// webhookIntegrationName detects integration based on webhook headers and body, since webhook request does not include integration name
+// TODO: use req.IntegrationName when available
+func webhookIntegrationName(headers map[string]string, body string) string {
+	if _, ok := headers["x-gitlab-event"]; ok {
+		return "gitlab"
+	}
+	// bitbucket cloud sends x-hook-uuid together with x-event-key
+	if _, ok := headers["x-hook-uuid"]; ok {
+		return "bitbucket"
+	}
+	// azure devops service hooks do not set any specific headers, check publisher in payload
+	var payload struct {
+		PublisherID string `json:"publisherId"`
+	}
+	if err := json.Unmarshal([]byte(body), &payload); err == nil && payload.PublisherID == "tfs" {
+		return "azure"
+	}
+	return "github"
+}
+
 func (s *runner) execWebhook(ctx context.Context, config inconfig.IntegrationAgent, messageID string, data cmdwebhook.Data) (res cmdmutate.Result, _ error) {
+	// webhooks process git repos using the same state as exports of the integration
+	stateKey, _, err := s.exporter.IntegrationLocs(config)
+	if err != nil {
+		return res, fmt.Errorf("could not get integration state: %v", err)
+	}
+	res, err = s.execWebhookPool(ctx, config, stateKey, data)
+	if err == nil {
+		return res, nil
+	}
+	if _, ok := err.(*pluginpool.UnavailableError); !ok {
+		return res, err
+	}
+	s.logger.Warn("could not use running plugin for webhook, starting separate process", "integration", config.Name, "err", err)
+	return s.execWebhookSubcommand(ctx, config, stateKey, messageID, data)
+}
+
+// execWebhookPool runs the webhook using the plugin kept in the pool, the result is the same as for webhook subcommand
+func (s *runner) execWebhookPool(ctx context.Context, config inconfig.IntegrationAgent, stateKey string, data cmdwebhook.Data) (res cmdmutate.Result, _ error) {
+	body, err := json.Marshal(data.Body)
+	if err != nil {
+		return res, err
+	}
+	s.logger.Debug("executing webhook using plugin pool", "integration", config.Name)
+
+	res0, err := s.pluginPool.Webhook(ctx, config, stateKey, data.Headers, string(body))
+	if err != nil {
+		return res, err
+	}
+	if res0.Error != "" {
+		res.Error = fmt.Sprintf("%v (%v)", res0.Error, config.Name)
+	} else {
+		res.Success = true
+		res.MutatedObjects = res0.MutatedObjects
+	}
+	s.logger.Debug("executing webhook", "success", res.Success, "err", res.Error)
+	return res, nil
+}
+
+func (s *runner) execWebhookSubcommand(ctx context.Context, config inconfig.IntegrationAgent, stateKey string, messageID string, data cmdwebhook.Data) (res cmdmutate.Result, _ error) {
 	integrations := []inconfig.IntegrationAgent{config}
 
+	agentConfig := s.agentConfig
+	agentConfig.IntegrationStateKey = stateKey
+
 	c, err := subcommand.New(subcommand.Opts{
 		Logger:            s.logger,
 		Tmpdir:            s.fsconf.Temp,
-		IntegrationConfig: s.agentConfig,
+		IntegrationConfig: agentConfig,
 		AgentConfig:       s.conf,
 		Integrations:      integrations,
 		DeviceInfo:        s.deviceInfo,
@@ -0,0 +1,16 @@
+package cmdrunnorestarts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookIntegrationName(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("github", webhookIntegrationName(map[string]string{"x-github-event": "pull_request"}, `{}`))
+	assert.Equal("gitlab", webhookIntegrationName(map[string]string{"x-gitlab-event": "Merge Request Hook"}, `{}`))
+	assert.Equal("bitbucket", webhookIntegrationName(map[string]string{"x-event-key": "pullrequest:created", "x-hook-uuid": "{1}"}, `{}`))
+	assert.Equal("azure", webhookIntegrationName(map[string]string{}, `{"publisherId":"tfs","eventType":"git.pullrequest.created"}`))
+	assert.Equal("github", webhookIntegrationName(map[string]string{}, `not json`))
+}
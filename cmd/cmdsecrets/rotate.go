@@ -0,0 +1,50 @@
+// Package cmdsecrets manages the key used to seal secrets in agent config, see pkg/secrets.
+package cmdsecrets
+
+import (
+	"fmt"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/cmd/cmdrunnorestarts/exporter/fsqueue"
+	"github.com/pinpt/agent/pkg/agentconf"
+	"github.com/pinpt/agent/pkg/fs"
+	"github.com/pinpt/agent/pkg/fsconf"
+	"github.com/pinpt/agent/pkg/kvstore"
+	"github.com/pinpt/agent/pkg/secrets"
+)
+
+// Rotate generates a new secrets key and seals all secrets in config and queued export requests with it. Previous key is removed from the key file.
+func Rotate(logger hclog.Logger, locs fsconf.Locs) error {
+	enrolled, err := fs.Exists(locs.Config2)
+	if err != nil {
+		return err
+	}
+	err = secrets.Rotate(locs, func(ring *secrets.Keyring) error {
+		state, err := kvstore.OpenState(logger, locs)
+		if err != nil {
+			return err
+		}
+		err = fsqueue.Reseal(state, ring)
+		if err != nil {
+			return fmt.Errorf("could not reseal export queue: %v", err)
+		}
+		if !enrolled {
+			logger.Info("config does not exist, only rotating the key")
+			return nil
+		}
+		conf, err := agentconf.Load(locs.Config2, ring)
+		if err != nil {
+			return err
+		}
+		return agentconf.Save(conf, locs.Config2, ring)
+	})
+	if err != nil {
+		return err
+	}
+	ring, err := secrets.LoadKeyring(locs)
+	if err != nil {
+		return err
+	}
+	logger.Info("rotated secrets key", "key_file", ring.Location())
+	return nil
+}
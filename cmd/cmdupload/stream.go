@@ -0,0 +1,511 @@
+package cmdupload
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/pkg/fs"
+	"github.com/pinpt/agent/pkg/metrics"
+	"github.com/pinpt/go-common/upload"
+)
+
+const defaultChunkSize = 50 * 1024 * 1024
+
+const defaultStreamCheckInterval = 30 * time.Second
+
+const defaultRetryDelay = 5 * time.Second
+
+const streamUploadAttempts = 5
+
+var errStreamStopped = errors.New("upload stream stopped")
+
+// StreamOpts are options for NewStream
+type StreamOpts struct {
+	Logger hclog.Logger
+	// Dirs maps prefix to uploads dir of one integration export. Prefix is added to file names in zip, since names are only unique within one export.
+	Dirs map[string]string
+	// StateDir stores upload progress, export log and the zip of the chunk being uploaded. Must be unique for the job.
+	StateDir  string
+	UploadURL string
+	APIKey    string
+	// ChunkSize is the minimum size of closed session files needed to upload a chunk before export finishes, chunks are also limited to about this size. Defaults to 50MB.
+	ChunkSize int64
+	// CheckInterval is how often uploads dirs are checked for closed session files. Defaults to 30s.
+	CheckInterval time.Duration
+	// RetryDelay is the delay before the first retry of a failed chunk in Finish, doubled on every retry. Defaults to 5s.
+	RetryDelay time.Duration
+}
+
+// Stream uploads closed session files in chunks while export is still running.
+//
+// Every chunk is a zip of closed session files uploaded using upload.Upload, the same upload used by Run. Files included in a chunk are recorded in progress in StateDir after the chunk is uploaded and deleted right after that. A failed chunk only loses that chunk, its files are kept and uploaded again in the next chunk.
+//
+// If the service is restarted during export, files recorded as uploaded are skipped and deleted, the rest is uploaded by the resumed export of the same job. If the service is restarted after export finished, ExportDone returns true and Finish uploads remaining files with the export log saved in StateDir.
+type Stream struct {
+	opts   StreamOpts
+	logger hclog.Logger
+
+	// mu protects progress, it is never held during uploads
+	mu       sync.Mutex
+	progress streamProgress
+
+	stop chan bool
+	done chan bool
+}
+
+type streamProgress struct {
+	// ExportDone is set when Finish is called, export log is saved in StateDir at that point
+	ExportDone bool `json:"export_done"`
+	// Uploaded contains locations of files in uploaded chunks that may not be deleted yet. Locations are removed after files are deleted, so that files with the same name created by resumed export are uploaded.
+	Uploaded []string `json:"uploaded"`
+	// LogUploaded is set when the final chunk with export log is uploaded
+	LogUploaded bool `json:"log_uploaded"`
+
+	Chunks        int   `json:"chunks"`
+	UploadedParts int   `json:"uploaded_parts"`
+	UploadedSize  int64 `json:"uploaded_size"`
+}
+
+// NewStream creates upload stream, loading progress from StateDir if it exists. Files recorded as uploaded before restart are deleted.
+func NewStream(opts StreamOpts) (*Stream, error) {
+	if opts.ChunkSize == 0 {
+		opts.ChunkSize = defaultChunkSize
+	}
+	if opts.CheckInterval == 0 {
+		opts.CheckInterval = defaultStreamCheckInterval
+	}
+	if opts.RetryDelay == 0 {
+		opts.RetryDelay = defaultRetryDelay
+	}
+	s := &Stream{}
+	s.opts = opts
+	s.logger = opts.Logger.Named("upload-stream")
+
+	err := os.MkdirAll(opts.StateDir, 0777)
+	if err != nil {
+		return nil, err
+	}
+	err = s.load()
+	if err != nil {
+		return nil, fmt.Errorf("could not load upload progress: %v", err)
+	}
+	err = s.removeUploaded()
+	if err != nil {
+		return nil, fmt.Errorf("could not delete uploaded files: %v", err)
+	}
+	return s, nil
+}
+
+func (s *Stream) progressFile() string {
+	return filepath.Join(s.opts.StateDir, "progress.json")
+}
+
+func (s *Stream) logFile() string {
+	return filepath.Join(s.opts.StateDir, "export.log")
+}
+
+func (s *Stream) chunkFile() string {
+	return filepath.Join(s.opts.StateDir, "chunk.zip")
+}
+
+func (s *Stream) load() error {
+	b, err := ioutil.ReadFile(s.progressFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(b, &s.progress)
+}
+
+// save writes progress, must be called with mu held
+func (s *Stream) save() error {
+	b, err := json.Marshal(s.progress)
+	if err != nil {
+		return err
+	}
+	return fs.WriteToTempAndRename(bytes.NewReader(b), s.progressFile())
+}
+
+// ExportDone returns true if export finished before the service was restarted and only upload needs to be resumed
+func (s *Stream) ExportDone() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.progress.ExportDone
+}
+
+// Start periodically uploads chunks of closed session files in the background until Finish or Stop is called. Upload errors are logged and files are uploaded again on the next check.
+func (s *Stream) Start() {
+	s.stop = make(chan bool)
+	s.done = make(chan bool)
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.opts.CheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				err := s.check()
+				if err != nil {
+					s.logger.Error("could not upload export data, will retry", "err", err)
+				}
+			}
+		}
+	}()
+}
+
+func (s *Stream) stopLoop() {
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	s.stop = nil
+}
+
+// Stop stops background uploads started with Start and cancels the chunk upload in progress. Files that were not uploaded are kept, so export of the same job can upload them later.
+func (s *Stream) Stop() {
+	s.stopLoop()
+}
+
+// check uploads full chunks of closed session files. Remaining files are uploaded on the next check or by Finish.
+func (s *Stream) check() error {
+	files, err := s.closedFiles()
+	if err != nil {
+		return err
+	}
+	for _, chunk := range s.splitChunks(files) {
+		if chunkSize(chunk) < s.opts.ChunkSize {
+			return nil
+		}
+		err := s.uploadChunk(chunk, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitChunks groups files into chunks of about ChunkSize
+func (s *Stream) splitChunks(files []streamFile) (res [][]streamFile) {
+	var chunk []streamFile
+	var size int64
+	for _, f := range files {
+		chunk = append(chunk, f)
+		size += f.size
+		if size >= s.opts.ChunkSize {
+			res = append(res, chunk)
+			chunk = nil
+			size = 0
+		}
+	}
+	if len(chunk) != 0 {
+		res = append(res, chunk)
+	}
+	return
+}
+
+func chunkSize(files []streamFile) (res int64) {
+	for _, f := range files {
+		res += f.size
+	}
+	return
+}
+
+// Finish uploads remaining files and export log, retrying failed chunks. Returns the number of parts and size of all chunks uploaded by the stream, including chunks uploaded before restart. Returns ErrNoFilesFound if export did not produce any files.
+func (s *Stream) Finish(ctx context.Context, logFile string) (parts int, size int64, rerr error) {
+	s.stopLoop()
+
+	err := s.exportDone(logFile)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	delay := s.opts.RetryDelay
+	for i := 1; ; i++ {
+		rerr = s.finishUpload()
+		if rerr == nil {
+			s.mu.Lock()
+			parts = s.progress.UploadedParts
+			size = s.progress.UploadedSize
+			chunks := s.progress.Chunks
+			s.mu.Unlock()
+			s.logger.Info("uploaded export data", "chunks", chunks, "parts", parts, "size_kb", size/1024)
+			return
+		}
+		if rerr == ErrNoFilesFound || i == streamUploadAttempts {
+			return
+		}
+		s.logger.Warn("could not upload export data, retrying", "attempt", i, "err", rerr)
+		select {
+		case <-ctx.Done():
+			rerr = ctx.Err()
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// exportDone saves export log and marks export as done, so that only the upload is resumed after restart
+func (s *Stream) exportDone(logFile string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.progress.ExportDone {
+		return nil
+	}
+	if logFile != "" {
+		err := fs.CopyFile(logFile, s.logFile())
+		if err != nil {
+			return err
+		}
+	}
+	s.progress.ExportDone = true
+	return s.save()
+}
+
+// finishUpload uploads all remaining files, the last chunk also contains export log
+func (s *Stream) finishUpload() error {
+	files, err := s.closedFiles()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	chunks := s.progress.Chunks
+	logUploaded := s.progress.LogUploaded
+	s.mu.Unlock()
+	if len(files) == 0 && chunks == 0 {
+		return ErrNoFilesFound
+	}
+	split := s.splitChunks(files)
+	for i, chunk := range split {
+		err := s.uploadChunk(chunk, i == len(split)-1)
+		if err != nil {
+			return err
+		}
+	}
+	if len(split) == 0 && !logUploaded {
+		return s.uploadChunk(nil, true)
+	}
+	return nil
+}
+
+// uploadChunk uploads files as one zip and deletes them after recording them in progress. When final is set, export log is added to the zip if it exists.
+func (s *Stream) uploadChunk(files []streamFile, final bool) error {
+	all := files
+	if final {
+		logExists, err := fs.Exists(s.logFile())
+		if err != nil {
+			return err
+		}
+		if logExists {
+			all = append(all, streamFile{loc: s.logFile(), name: "export.log"})
+		}
+		if len(all) == 0 {
+			return nil
+		}
+	}
+	zipSize, err := writeZip(s.chunkFile(), all)
+	if err != nil {
+		return fmt.Errorf("could not create chunk zip: %v", err)
+	}
+	defer os.Remove(s.chunkFile())
+
+	s.logger.Info("uploading export chunk", "files", len(files), "size_kb", zipSize/1024)
+	parts, size, err := s.upload(s.chunkFile())
+	if err != nil {
+		return err
+	}
+	if size != zipSize {
+		return fmt.Errorf("invalid uploaded size, zip: %v uploaded: %v", zipSize, size)
+	}
+	metrics.Add(metrics.UploadBytes, float64(size))
+
+	s.mu.Lock()
+	for _, f := range files {
+		s.progress.Uploaded = append(s.progress.Uploaded, f.loc)
+	}
+	if final {
+		s.progress.LogUploaded = true
+	}
+	s.progress.Chunks++
+	s.progress.UploadedParts += parts
+	s.progress.UploadedSize += size
+	err = s.save()
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.removeUploaded()
+}
+
+// upload sends the file using upload.Upload. Reading the file fails when Stop is called, which cancels the upload.
+func (s *Stream) upload(loc string) (parts int, size int64, rerr error) {
+	f, err := os.Open(loc)
+	if err != nil {
+		rerr = err
+		return
+	}
+	defer f.Close()
+	return upload.Upload(upload.Options{
+		APIKey:      s.opts.APIKey,
+		Body:        &stoppableReader{r: f, stop: s.stop},
+		ContentType: "application/zip",
+		URL:         s.opts.UploadURL,
+	})
+}
+
+// removeUploaded deletes files recorded as uploaded and removes them from progress
+func (s *Stream) removeUploaded() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.progress.Uploaded) == 0 {
+		return nil
+	}
+	err := removeFiles(s.progress.Uploaded)
+	if err != nil {
+		return err
+	}
+	s.progress.Uploaded = nil
+	return s.save()
+}
+
+// Remove deletes upload progress and saved export log. Call after Finish succeeds.
+func (s *Stream) Remove() error {
+	s.Stop()
+	return os.RemoveAll(s.opts.StateDir)
+}
+
+// stoppableReader returns errStreamStopped once stop is closed
+type stoppableReader struct {
+	r    io.Reader
+	stop chan bool
+}
+
+func (s *stoppableReader) Read(p []byte) (int, error) {
+	if s.stop != nil {
+		select {
+		case <-s.stop:
+			return 0, errStreamStopped
+		default:
+		}
+	}
+	return s.r.Read(p)
+}
+
+type streamFile struct {
+	loc  string
+	name string
+	size int64
+}
+
+// closedFiles returns session files that are closed and can be uploaded. Writers create files with .temp.gz suffix and rename them on close.
+func (s *Stream) closedFiles() (res []streamFile, _ error) {
+	var prefixes []string
+	for prefix := range s.opts.Dirs {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		dir := s.opts.Dirs[prefix]
+		err := filepath.Walk(dir, func(loc string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && loc == dir {
+					return nil
+				}
+				return err
+			}
+			if info.IsDir() || !strings.HasSuffix(loc, ".gz") || strings.HasSuffix(loc, ".temp.gz") {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, loc)
+			if err != nil {
+				return err
+			}
+			relDir, name := filepath.Split(rel)
+			if prefix != "" {
+				name = prefix + "_" + name
+			}
+			res = append(res, streamFile{
+				loc:  loc,
+				name: filepath.ToSlash(filepath.Join(relDir, name)),
+				size: info.Size(),
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// writeZip creates zip with passed files at loc, returns the size of the zip
+func writeZip(loc string, files []streamFile) (_ int64, rerr error) {
+	f, err := os.Create(loc)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		err := f.Close()
+		if err != nil && rerr == nil {
+			rerr = err
+		}
+	}()
+	zw := zip.NewWriter(f)
+	for _, file := range files {
+		err := addZipFile(zw, file)
+		if err != nil {
+			return 0, err
+		}
+	}
+	err = zw.Close()
+	if err != nil {
+		return 0, err
+	}
+	return f.Seek(0, io.SeekCurrent)
+}
+
+func addZipFile(zw *zip.Writer, file streamFile) error {
+	f, err := os.Open(file.loc)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:   file.name,
+		Method: zip.Deflate,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func removeFiles(files []string) error {
+	for _, loc := range files {
+		err := os.Remove(loc)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
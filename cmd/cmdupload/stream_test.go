@@ -0,0 +1,271 @@
+package cmdupload
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+// testUploadServer is a local stand-in for the upload endpoint, recording files in uploaded zips
+type testUploadServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	fail    bool
+	uploads [][]string
+}
+
+func newTestUploadServer() *testUploadServer {
+	s := &testUploadServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *testUploadServer) handle(w http.ResponseWriter, r *http.Request) {
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		http.Error(w, "upload failed", http.StatusInternalServerError)
+		return
+	}
+	if r.Header.Get("Authorization") != "key1" {
+		http.Error(w, "invalid api key", http.StatusUnauthorized)
+		return
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		// part upload without zip data
+		return
+	}
+	var files []string
+	for _, f := range zr.File {
+		files = append(files, f.Name)
+	}
+	sort.Strings(files)
+	s.uploads = append(s.uploads, files)
+}
+
+func (s *testUploadServer) setFail(v bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail = v
+}
+
+func (s *testUploadServer) get() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]string(nil), s.uploads...)
+}
+
+type testStreamEnv struct {
+	dir     string
+	uploads string
+	server  *testUploadServer
+}
+
+func newTestStreamEnv(t *testing.T) *testStreamEnv {
+	dir, err := ioutil.TempDir("", "upload-stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testStreamEnv{}
+	s.dir = dir
+	s.uploads = filepath.Join(dir, "uploads")
+	s.server = newTestUploadServer()
+	return s
+}
+
+func (s *testStreamEnv) Close() {
+	s.server.Close()
+	os.RemoveAll(s.dir)
+}
+
+func (s *testStreamEnv) newStream(t *testing.T) *Stream {
+	res, err := NewStream(StreamOpts{
+		Logger:     hclog.New(&hclog.LoggerOptions{Name: "test"}),
+		Dirs:       map[string]string{"i1": s.uploads},
+		StateDir:   filepath.Join(s.dir, "progress"),
+		UploadURL:  s.server.URL + "/upload/j1",
+		APIKey:     "key1",
+		ChunkSize:  5,
+		RetryDelay: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func (s *testStreamEnv) writeFile(t *testing.T, name string, data string) string {
+	loc := filepath.Join(s.uploads, name)
+	err := os.MkdirAll(filepath.Dir(loc), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(loc, []byte(data), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func (s *testStreamEnv) writeLog(t *testing.T) string {
+	loc := filepath.Join(s.dir, "export.log")
+	err := ioutil.WriteFile(loc, []byte("log"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func assertNotExists(t *testing.T, loc string) {
+	_, err := os.Stat(loc)
+	assert.True(t, os.IsNotExist(err), loc)
+}
+
+func assertExists(t *testing.T, loc string) {
+	_, err := os.Stat(loc)
+	assert.NoError(t, err, loc)
+}
+
+func TestStreamUploadsClosedSessionsInChunks(t *testing.T) {
+	env := newTestStreamEnv(t)
+	defer env.Close()
+	stream := env.newStream(t)
+
+	closed := env.writeFile(t, "model1/1_1.json.gz", "closed")
+	open := env.writeFile(t, "model1/1_2.json.gz.temp.gz", "open")
+
+	// closed file is uploaded as its own chunk and deleted
+	assert.NoError(t, stream.check())
+	assert.Equal(t, [][]string{{"model1/i1_1_1.json.gz"}}, env.server.get())
+	assertNotExists(t, closed)
+	assertExists(t, open)
+
+	// not enough data for a chunk
+	env.writeFile(t, "model2/1_3.json.gz", "a")
+	assert.NoError(t, stream.check())
+	assert.Len(t, env.server.get(), 1)
+
+	assert.NoError(t, os.Rename(open, filepath.Join(env.uploads, "model1/1_2.json.gz")))
+	parts, size, err := stream.Finish(context.Background(), env.writeLog(t))
+	assert.NoError(t, err)
+	assert.True(t, parts > 0)
+	assert.True(t, size > 0)
+	assert.Equal(t, [][]string{
+		{"model1/i1_1_1.json.gz"},
+		{"export.log", "model1/i1_1_2.json.gz", "model2/i1_1_3.json.gz"},
+	}, env.server.get())
+	assertNotExists(t, filepath.Join(env.uploads, "model2/1_3.json.gz"))
+
+	assert.NoError(t, stream.Remove())
+	assertNotExists(t, filepath.Join(env.dir, "progress"))
+}
+
+func TestStreamFailedChunkIsRetried(t *testing.T) {
+	env := newTestStreamEnv(t)
+	defer env.Close()
+	stream := env.newStream(t)
+
+	f1 := env.writeFile(t, "model1/1_1.json.gz", "data1")
+	assert.NoError(t, stream.check())
+	assertNotExists(t, f1)
+
+	// only the failed chunk is kept
+	env.server.setFail(true)
+	f2 := env.writeFile(t, "model1/1_2.json.gz", "data2")
+	assert.Error(t, stream.check())
+	assertExists(t, f2)
+
+	env.server.setFail(false)
+	_, _, err := stream.Finish(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"model1/i1_1_1.json.gz"},
+		{"model1/i1_1_2.json.gz"},
+	}, env.server.get())
+	assertNotExists(t, f2)
+}
+
+func TestStreamResumeAfterExportDone(t *testing.T) {
+	env := newTestStreamEnv(t)
+	defer env.Close()
+	stream := env.newStream(t)
+
+	data := env.writeFile(t, "model1/1_1.json.gz", "data")
+	logFile := env.writeLog(t)
+	env.server.setFail(true)
+	_, _, err := stream.Finish(context.Background(), logFile)
+	assert.Error(t, err)
+	assertExists(t, data)
+	// log file is removed by exporter after Finish
+	assert.NoError(t, os.Remove(logFile))
+
+	// service restarted
+	env.server.setFail(false)
+	stream = env.newStream(t)
+	assert.True(t, stream.ExportDone())
+	_, _, err = stream.Finish(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"export.log", "model1/i1_1_1.json.gz"}}, env.server.get())
+	assertNotExists(t, data)
+}
+
+func TestStreamRestartDuringExport(t *testing.T) {
+	env := newTestStreamEnv(t)
+	defer env.Close()
+	stream := env.newStream(t)
+
+	env.writeFile(t, "model1/1_1.json.gz", "data1")
+	assert.NoError(t, stream.check())
+	stream.Stop()
+
+	// crashed after the chunk was recorded, but before the file was deleted
+	f1 := env.writeFile(t, "model1/1_1.json.gz", "data1")
+	stream.mu.Lock()
+	stream.progress.Uploaded = []string{f1}
+	assert.NoError(t, stream.save())
+	stream.mu.Unlock()
+
+	// export of the same job is resumed, uploaded files are skipped
+	stream = env.newStream(t)
+	assert.False(t, stream.ExportDone())
+	assertNotExists(t, f1)
+
+	env.writeFile(t, "model1/2_1.json.gz", "data2")
+	parts, size, err := stream.Finish(context.Background(), "")
+	assert.NoError(t, err)
+	assert.True(t, parts > 0)
+	assert.True(t, size > 0)
+	assert.Equal(t, [][]string{
+		{"model1/i1_1_1.json.gz"},
+		{"model1/i1_2_1.json.gz"},
+	}, env.server.get())
+}
+
+func TestStreamNoFiles(t *testing.T) {
+	env := newTestStreamEnv(t)
+	defer env.Close()
+	stream := env.newStream(t)
+
+	_, _, err := stream.Finish(context.Background(), "")
+	assert.Equal(t, ErrNoFilesFound, err)
+	assert.Len(t, env.server.get(), 0)
+}
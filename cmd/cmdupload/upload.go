@@ -15,6 +15,7 @@ import (
 	hclog "github.com/hashicorp/go-hclog"
 	"github.com/pinpt/agent/pkg/archive"
 	"github.com/pinpt/agent/pkg/fsconf"
+	"github.com/pinpt/agent/pkg/metrics"
 	"github.com/pinpt/go-common/fileutil"
 	"github.com/pinpt/go-common/upload"
 )
@@ -32,8 +33,20 @@ func Run(ctx context.Context,
 	logFile string) (parts int, size int64, rerr error) {
 
 	fsc := fsconf.New(pinpointRoot)
+	return RunDir(ctx, logger, fsc.Uploads, fsc.UploadZips, uploadURL, jobID, apiKey, logFile)
+}
+
+// RunDir uploads export files from uploadsDir. Zip is created in zipsDir.
+func RunDir(ctx context.Context,
+	logger hclog.Logger,
+	uploadsDir string,
+	zipsDir string,
+	uploadURL string,
+	jobID string,
+	apiKey string,
+	logFile string) (parts int, size int64, rerr error) {
 
-	err := os.MkdirAll(fsc.UploadZips, 0777)
+	err := os.MkdirAll(zipsDir, 0777)
 	if err != nil {
 		rerr = err
 		return
@@ -42,10 +55,10 @@ func Run(ctx context.Context,
 	fileName := time.Now().Format(time.RFC3339)
 	fileName = strings.ReplaceAll(fileName, ":", "_") + "-" + jobID
 
-	zipPath := filepath.Join(fsc.UploadZips, fileName+".zip")
+	zipPath := filepath.Join(zipsDir, fileName+".zip")
 
-	logger.Info("looking for files", "dir", fsc.Uploads)
-	files, err := fileutil.FindFiles(fsc.Uploads, regexp.MustCompile("\\.gz$"))
+	logger.Info("looking for files", "dir", uploadsDir)
+	files, err := fileutil.FindFiles(uploadsDir, regexp.MustCompile("\\.gz$"))
 	if err != nil {
 		rerr = err
 		return
@@ -55,7 +68,7 @@ func Run(ctx context.Context,
 		return
 	}
 	if logFile != "" {
-		pathInUploads := filepath.Join(fsc.Uploads, "export.log")
+		pathInUploads := filepath.Join(uploadsDir, "export.log")
 		err := fs.CopyFile(logFile, pathInUploads)
 		if err != nil {
 			rerr = err
@@ -64,7 +77,7 @@ func Run(ctx context.Context,
 		files = append(files, pathInUploads)
 	}
 
-	err = archive.ZipFiles(zipPath, fsc.Uploads, files)
+	err = archive.ZipFiles(zipPath, uploadsDir, files)
 	if err != nil {
 		rerr = err
 		return
@@ -114,6 +127,8 @@ func runUpload(logger hclog.Logger, zipPath, uploadURL, apiKey string) (parts in
 		return
 	}
 
+	metrics.Add(metrics.UploadBytes, float64(uploadedSize))
+
 	if uploadedSize != zipSize {
 		rerr = fmt.Errorf("invalid updated size, zip: %v uploaded: %v", zipSize, uploadedSize)
 		return
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/pinpt/agent/pkg/jsonstore"
+	"github.com/pinpt/agent/pkg/kvstore"
 	"github.com/pinpt/agent/rpcdef"
 
 	"github.com/pinpt/agent/cmd/cmdintegration"
@@ -64,7 +65,11 @@ func newExport(opts Opts) (*export, error) {
 	}
 	s.Opts = opts
 
-	s.lastProcessed, err = jsonstore.New(s.Locs.LastProcessedFile)
+	state, err := kvstore.OpenState(s.Logger, s.Locs)
+	if err != nil {
+		return nil, err
+	}
+	s.lastProcessed, err = jsonstore.New(state)
 	if err != nil {
 		return nil, err
 	}
@@ -73,6 +78,7 @@ func newExport(opts Opts) (*export, error) {
 		Logger:        s.Logger,
 		AgentConfig:   opts.AgentConfig,
 		LastProcessed: s.lastProcessed,
+		State:         state,
 		Locs:          s.Locs,
 	})
 
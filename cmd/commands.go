@@ -5,22 +5,29 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
+	"time"
 
+	hclog "github.com/hashicorp/go-hclog"
 	pservice "github.com/kardianos/service"
 	"github.com/pinpt/agent/cmd/cmdenroll"
 	"github.com/pinpt/agent/cmd/cmdexport"
 	"github.com/pinpt/agent/cmd/cmdexportonboarddata"
 	"github.com/pinpt/agent/cmd/cmdforcehistorical"
+	"github.com/pinpt/agent/cmd/cmdintegration"
 	"github.com/pinpt/agent/cmd/cmdmutate"
 	"github.com/pinpt/agent/cmd/cmdrun"
 	"github.com/pinpt/agent/cmd/cmdrunnorestarts"
+	"github.com/pinpt/agent/cmd/cmdsecrets"
 	"github.com/pinpt/agent/cmd/cmdserviceinstall"
 	"github.com/pinpt/agent/cmd/cmdvalidate"
 	"github.com/pinpt/agent/cmd/cmdvalidateconfig"
 	"github.com/pinpt/agent/cmd/cmdwebhook"
 	"github.com/pinpt/agent/cmd/pkg/cmdlogger"
 	"github.com/pinpt/agent/pkg/agentconf"
+	"github.com/pinpt/agent/pkg/expsink"
 	"github.com/pinpt/agent/pkg/fsconf"
+	"github.com/pinpt/agent/pkg/secrets"
 	"github.com/pinpt/agent/pkg/service"
 	"github.com/pinpt/agent/rpcdef"
 	pos "github.com/pinpt/go-common/os"
@@ -142,14 +149,49 @@ var cmdExport = &cobra.Command{
 		if err != nil {
 			exitWithErr(logger, err)
 		}
+
+		publish, _ := cmd.Flags().GetBool("publish")
+		if publish {
+			err := publishExport(logger, opts.AgentConfig)
+			if err != nil {
+				exitWithErr(logger, err)
+			}
+		}
 	},
 }
 
+// publishExport writes the exported data to output from agent config. Allows running export without pinpoint backend.
+func publishExport(logger hclog.Logger, agentConfig cmdintegration.AgentConfig) error {
+	if agentConfig.Output.IsPinpoint() {
+		return errors.New("publish requires local or s3 output in agent config")
+	}
+	locs, err := agentConfig.Locs()
+	if err != nil {
+		return err
+	}
+	_, err = expsink.Publish(context.Background(), expsink.PublishOpts{
+		Logger:     logger,
+		Output:     agentConfig.Output,
+		UploadsDir: locs.Uploads,
+		ExportName: expsink.ExportName(time.Now(), agentConfig.Backend.ExportJobID),
+	})
+	if err == expsink.ErrNoFilesFound {
+		logger.Info("skipping publish, no files generated")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// do not publish the same files again on next export
+	return os.RemoveAll(locs.Uploads)
+}
+
 func init() {
 	cmd := cmdExport
 	integrationCommandFlags(cmd)
 	flagOutputFile(cmd)
 	cmd.Flags().Bool("reprocess-historical", false, "Set to true to discard incremental checkpoint and reprocess historical instead.")
+	cmd.Flags().Bool("publish", false, "Publish exported data to local or s3 output set in agent config after export. Allows running export without pinpoint backend.")
 	cmdRoot.AddCommand(cmd)
 }
 
@@ -315,7 +357,11 @@ func envBasedOnAgentConfig(cmd *cobra.Command) (_ cmdlogger.Logger, _ agentconf.
 		exitWithErr2(err)
 	}
 	fsconf := fsconf.New(pinpointRoot)
-	agentConf, err := agentconf.Load(fsconf.Config2)
+	ring, err := secrets.LoadKeyring(fsconf)
+	if err != nil {
+		exitWithErr2(err)
+	}
+	agentConf, err := agentconf.Load(fsconf.Config2, ring)
 	if err != nil {
 		exitWithErr2(err)
 	}
@@ -324,7 +370,16 @@ func envBasedOnAgentConfig(cmd *cobra.Command) (_ cmdlogger.Logger, _ agentconf.
 	if err != nil {
 		exitWithErr(logger, err)
 	}
-	return logger.AddWriter(logWriter), agentConf, pinpointRoot
+	logger = logger.AddWriter(logWriter)
+	// credentials in extra_integrations are added to config manually
+	sealed, err := agentconf.SealPlaintext(fsconf.Config2, ring)
+	if err != nil {
+		exitWithErr(logger, err)
+	}
+	if sealed {
+		logger.Info("sealed plain text credentials in config", "key_file", ring.Location())
+	}
+	return logger, agentConf, pinpointRoot
 }
 
 func runNoRestarts(cmd *cobra.Command, args []string) {
@@ -481,7 +536,7 @@ var cmdForceHistorical = &cobra.Command{
 			return
 		}
 		fsconf := fsconf.New(pinpointRoot)
-		if err := cmdforcehistorical.Run(logger, args[0], fsconf.LastProcessedFile, fsconf.DedupFile); err != nil {
+		if err := cmdforcehistorical.Run(logger, args[0], fsconf); err != nil {
 			logger.Error("error cleaning integration", "err", err)
 			return
 		}
@@ -493,3 +548,34 @@ func init() {
 	integrationCommandFlags(cmd)
 	cmdRoot.AddCommand(cmd)
 }
+
+var cmdSecrets = &cobra.Command{
+	Use:   "secrets",
+	Short: "Manage the key used to seal secrets in agent config",
+}
+
+var cmdSecretsRotate = &cobra.Command{
+	Use:   "rotate",
+	Short: "Generates a new secrets key and seals all secrets in config with it",
+	Long:  "Generates a new secrets key and seals all secrets in config with it. Uses the key file set in " + secrets.KeyFileEnv + " or secrets.key in pinpoint root.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := cmdlogger.NewLogger(cmd)
+		pinpointRoot, err := getPinpointRoot(cmd)
+		if err != nil {
+			exitWithErr(logger, err)
+		}
+		fsconf := fsconf.New(pinpointRoot)
+		if err := cmdsecrets.Rotate(logger, fsconf); err != nil {
+			exitWithErr(logger, err)
+		}
+	},
+}
+
+func init() {
+	cmd := cmdSecretsRotate
+	flagsLogger(cmd)
+	flagPinpointRoot(cmd)
+	cmdSecrets.AddCommand(cmd)
+	cmdRoot.AddCommand(cmdSecrets)
+}
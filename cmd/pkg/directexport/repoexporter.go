@@ -12,6 +12,7 @@ import (
 	"github.com/pinpt/agent/pkg/expsessions"
 	"github.com/pinpt/agent/pkg/gitclone"
 	"github.com/pinpt/agent/pkg/jsonstore"
+	"github.com/pinpt/agent/pkg/kvstore"
 	"github.com/pinpt/agent/rpcdef"
 	"github.com/pinpt/agent/slimrippy/exportrepo"
 )
@@ -20,6 +21,7 @@ type RepoExporterOpts struct {
 	Logger        hclog.Logger
 	AgentConfig   cmdintegration.AgentConfig
 	LastProcessed *jsonstore.Store
+	State         *kvstore.Store
 	Locs          fsconf.Locs
 }
 
@@ -70,6 +72,7 @@ func (s RepoExporter) Run() (res RepoExporterRes) {
 			RefType:    fetch.RefType,
 
 			LastProcessed: s.opts.LastProcessed,
+			State:         s.opts.State,
 			RepoAccess:    access,
 
 			CommitURLTemplate: fetch.CommitURLTemplate,
@@ -17,6 +17,7 @@ import (
 
 	"github.com/pinpt/agent/pkg/filelog"
 	"github.com/pinpt/agent/pkg/fsconf"
+	"github.com/pinpt/agent/pkg/secrets"
 
 	"github.com/fatih/color"
 	ps "github.com/mitchellh/go-ps"
@@ -214,6 +215,11 @@ func integrationCommandOpts(cmd *cobra.Command) (hclog.Logger, cmdintegration.Op
 		exitWithErr(logger, errors.New("missing integrations-json"))
 	}
 
+	err := unsealConfig(&opts)
+	if err != nil {
+		exitWithErr(logger, fmt.Errorf("could not unseal credentials: %v", err))
+	}
+
 	logWriter, err := pinpointLogWriter(opts.AgentConfig.PinpointRoot)
 	if err != nil {
 		exitWithErr(logger, err)
@@ -222,6 +228,54 @@ func integrationCommandOpts(cmd *cobra.Command) (hclog.Logger, cmdintegration.Op
 	return opts.Logger, opts
 }
 
+// unsealConfig unseals credentials in config files written by subcommand. Plain text values passed on command line are kept as is.
+func unsealConfig(opts *cmdintegration.Opts) error {
+	hasSealed := secrets.IsSealed(opts.AgentConfig.Output.S3.SecretAccessKey)
+	isSealed := func(v interface{}) bool {
+		str, ok := v.(string)
+		return ok && secrets.IsSealed(str)
+	}
+	for _, in := range opts.Integrations {
+		for _, v := range in.Config {
+			if isSealed(v) {
+				hasSealed = true
+			}
+		}
+	}
+	if !hasSealed {
+		return nil
+	}
+	root := opts.AgentConfig.PinpointRoot
+	if root == "" {
+		var err error
+		root, err = fsconf.DefaultRoot()
+		if err != nil {
+			return err
+		}
+	}
+	ring, err := secrets.LoadKeyring(fsconf.New(root))
+	if err != nil {
+		return err
+	}
+	err = ring.UnsealAll(&opts.AgentConfig.Output.S3.SecretAccessKey)
+	if err != nil {
+		return err
+	}
+	for _, in := range opts.Integrations {
+		for k, v := range in.Config {
+			if !isSealed(v) {
+				continue
+			}
+			res, err := ring.Unseal(v.(string))
+			if err != nil {
+				return fmt.Errorf("%v of %v integration: %v", k, in.Name, err)
+			}
+			in.Config[k] = res
+		}
+	}
+	return nil
+}
+
 type outputFile struct {
 	logger hclog.Logger
 	close  io.Closer
@@ -17,6 +17,7 @@ import (
 
 	hclog "github.com/hashicorp/go-hclog"
 	"github.com/pinpt/agent/pkg/ids2"
+	"github.com/pinpt/agent/pkg/requests"
 	"github.com/pinpt/go-common/httpdefaults"
 
 	pstrings "github.com/pinpt/go-common/strings"
@@ -95,6 +96,18 @@ func (api *API) postRequest(endPoint string, params stringmap, body interface{},
 	return api.doRequest(http.MethodPost, endPoint, params, reader, out)
 }
 
+func (api *API) patchRequest(endPoint string, params stringmap, body interface{}, out interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return api.doRequest(http.MethodPatch, endPoint, params, bytes.NewBuffer(b), out)
+}
+
+func (api *API) deleteRequest(endPoint string) error {
+	return api.doRequest(http.MethodDelete, endPoint, nil, nil, nil)
+}
+
 func (api *API) GetRequest(endPoint string, params stringmap, out interface{}) error {
 	return api.getRequest(endPoint, params, out)
 }
@@ -135,7 +148,12 @@ func (api *API) doRequest(method, endPoint string, params stringmap, reader io.R
 		return err
 	}
 	req.SetBasicAuth("", api.creds.APIKey)
-	req.Header.Set("Content-Type", "application/json")
+	if method == http.MethodPatch {
+		// work item updates only accept json patch documents
+		req.Header.Set("Content-Type", "application/json-patch+json")
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+	}
 
 	res, err := api.client.Do(req)
 	if err != nil {
@@ -151,6 +169,10 @@ func (api *API) doRequest(method, endPoint string, params stringmap, reader io.R
 	}
 	defer res.Body.Close()
 	//api.logger.Debug("response data", "b", string(b))
+	// delete does not return a body
+	if method == http.MethodDelete && (res.StatusCode == http.StatusOK || res.StatusCode == http.StatusNoContent) {
+		return nil
+	}
 	if res.StatusCode == http.StatusOK {
 		err := json.Unmarshal(b, &out)
 		if err != nil {
@@ -164,7 +186,8 @@ func (api *API) doRequest(method, endPoint string, params stringmap, reader io.R
 		}
 		return nil
 	}
-	return fmt.Errorf("invalid response code: %v request url: %v", res.StatusCode, res.Request.URL)
+	// wrap status code error, so that mutations could detect not found errors
+	return fmt.Errorf("invalid response code: %v request url: %v err: %w", res.StatusCode, res.Request.URL, requests.StatusCodeError{WantStart: 200, WantEnd: 200, Got: res.StatusCode})
 }
 
 // some util functions
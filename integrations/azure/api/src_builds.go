@@ -0,0 +1,128 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pinpt/agent/integrations/pkg/commoncicd"
+	"github.com/pinpt/agent/pkg/date"
+	"github.com/pinpt/integration-sdk/cicd"
+)
+
+// builds api does not support $skip, paginating using finish time instead
+const buildsPageSize = 200
+
+type buildResponse struct {
+	ID            int64     `json:"id"`
+	BuildNumber   string    `json:"buildNumber"`
+	Status        string    `json:"status"`
+	Result        string    `json:"result"`
+	Reason        string    `json:"reason"`
+	QueueTime     time.Time `json:"queueTime"`
+	StartTime     time.Time `json:"startTime"`
+	FinishTime    time.Time `json:"finishTime"`
+	SourceBranch  string    `json:"sourceBranch"`
+	SourceVersion string    `json:"sourceVersion"`
+	Links         struct {
+		Web struct {
+			Href string `json:"href"`
+		} `json:"web"`
+	} `json:"_links"`
+}
+
+// FetchBuilds returns pipeline runs for the repo that finished after finishedAfter
+func (api *API) FetchBuilds(repoid string, reponame string, finishedAfter time.Time) (res []*cicd.Build, rerr error) {
+	projid, err := api.fetchRepoProjectID(repoid)
+	if err != nil {
+		rerr = err
+		return
+	}
+	u := fmt.Sprintf(`%s/_apis/build/builds`, url.PathEscape(projid))
+	seen := map[int64]bool{}
+	minTime := finishedAfter
+	for {
+		params := stringmap{
+			"pagingoff":      "true",
+			"$top":           strconv.Itoa(buildsPageSize),
+			"repositoryId":   repoid,
+			"repositoryType": "TfsGit",
+			"statusFilter":   "completed",
+			"queryOrder":     "finishTimeAscending",
+			"minTime":        minTime.UTC().Format(time.RFC3339Nano),
+		}
+		var page []buildResponse
+		if err := api.getRequest(u, params, &page); err != nil {
+			rerr = err
+			return
+		}
+		for _, b := range page {
+			// minTime is inclusive, builds finished at the same time as the last one on the previous page are returned again
+			if seen[b.ID] {
+				continue
+			}
+			seen[b.ID] = true
+			item := api.convertBuild(reponame, b)
+			if item == nil {
+				continue
+			}
+			res = append(res, item)
+		}
+		if len(page) < buildsPageSize {
+			return
+		}
+		last := page[len(page)-1].FinishTime
+		if !last.After(minTime) {
+			// whole page finished at the same time, should not happen in practice
+			api.logger.Warn("could not paginate builds, too many builds with the same finish time", "repo", reponame, "finish_time", last)
+			return
+		}
+		minTime = last
+	}
+}
+
+func (api *API) fetchRepoProjectID(repoid string) (string, error) {
+	u := fmt.Sprintf(`_apis/git/repositories/%s`, url.PathEscape(repoid))
+	var res []reposResponse
+	if err := api.getRequest(u, stringmap{"pagingoff": "true"}, &res); err != nil {
+		return "", err
+	}
+	if len(res) == 0 {
+		return "", fmt.Errorf("repo not found, repo_id: %v", repoid)
+	}
+	return res[0].Project.ID, nil
+}
+
+// convertBuild returns nil for builds without result
+func (api *API) convertBuild(reponame string, b buildResponse) *cicd.Build {
+	build := &cicd.Build{}
+	switch b.Result {
+	case "succeeded":
+		build.Status = cicd.BuildStatusPass
+	case "failed", "partiallySucceeded":
+		build.Status = cicd.BuildStatusFail
+	case "canceled":
+		build.Status = cicd.BuildStatusCancel
+	default:
+		return nil
+	}
+	build.CustomerID = api.customerid
+	build.RefType = api.reftype
+	build.RefID = strconv.FormatInt(b.ID, 10)
+	build.RepoName = reponame
+	build.Branch = strings.TrimPrefix(b.SourceBranch, "refs/heads/")
+	build.CommitSha = b.SourceVersion
+	build.URL = b.Links.Web.Href
+	build.Automated = b.Reason != "manual"
+	build.Environment = commoncicd.BuildEnvironment(build.Branch)
+	startTime := b.StartTime
+	if startTime.IsZero() {
+		// canceled before start
+		startTime = b.QueueTime
+	}
+	date.ConvertToModel(startTime, &build.StartDate)
+	date.ConvertToModel(b.FinishTime, &build.EndDate)
+	return build
+}
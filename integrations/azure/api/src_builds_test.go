@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pinpt/integration-sdk/cicd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchBuilds(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/org1/_apis/git/repositories/r1":
+			rw.Write([]byte(`{"id":"r1","name":"repo1","project":{"id":"p1","name":"proj1"}}`))
+		case "/org1/p1/_apis/build/builds":
+			q := req.URL.Query()
+			assert.Equal("r1", q.Get("repositoryId"))
+			assert.Equal("completed", q.Get("statusFilter"))
+			assert.Equal("2020-05-01T00:00:00Z", q.Get("minTime"))
+			rw.Write([]byte(`{"count":3,"value":[
+				{"id":1,"status":"completed","result":"succeeded","reason":"individualCI","queueTime":"2020-05-02T09:59:00Z","startTime":"2020-05-02T10:00:00Z","finishTime":"2020-05-02T10:05:00Z","sourceBranch":"refs/heads/master","sourceVersion":"s1","_links":{"web":{"href":"https://dev.azure.com/org1/p1/_build/results?buildId=1"}}},
+				{"id":2,"status":"completed","result":"partiallySucceeded","reason":"manual","startTime":"2020-05-02T11:00:00Z","finishTime":"2020-05-02T11:05:00Z","sourceBranch":"refs/heads/release/1.0","sourceVersion":"s2"},
+				{"id":3,"status":"completed","result":"none","finishTime":"2020-05-02T12:05:00Z"}
+			]}`))
+		default:
+			t.Errorf("unexpected request %v", req.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	builds, err := testAPI(server).FetchBuilds("r1", "proj1/repo1", time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC))
+	assert.NoError(err)
+	if assert.Len(builds, 2) {
+		b := builds[0]
+		assert.Equal("1", b.RefID)
+		assert.Equal("c1", b.CustomerID)
+		assert.Equal("azure", b.RefType)
+		assert.Equal("proj1/repo1", b.RepoName)
+		assert.Equal("master", b.Branch)
+		assert.Equal("s1", b.CommitSha)
+		assert.Equal("https://dev.azure.com/org1/p1/_build/results?buildId=1", b.URL)
+		assert.Equal(cicd.BuildStatusPass, b.Status)
+		assert.True(b.Automated)
+
+		b = builds[1]
+		assert.Equal("release/1.0", b.Branch)
+		assert.Equal(cicd.BuildStatusFail, b.Status)
+		assert.Equal(cicd.BuildEnvironmentRelease, b.Environment)
+		assert.False(b.Automated)
+	}
+}
@@ -31,10 +31,7 @@ func (api *API) FetchPullRequests(ctx *repoprojects.ProjectCtx, repoid string, r
 	var pullrequestcomments []pullRequestResponse
 	var fetchprs []rpcdef.GitRepoFetchPR
 	for _, p := range res {
-		// modify the url to show the ui instead of api call
-		p.URL = strings.ToLower(p.URL)
-		p.URL = strings.Replace(p.URL, "_apis/git/repositories", "_git", 1)
-		p.URL = strings.Replace(p.URL, "/pullrequests/", "/pullrequest/", 1)
+		p.URL = pullRequestUIURL(p.URL)
 
 		// if this is not incremental, return only the objects created after the fromdate
 		if !incremental || p.CreationDate.After(fromdate) {
@@ -128,9 +125,60 @@ func (api *API) FetchPullRequests(ctx *repoprojects.ProjectCtx, repoid string, r
 	return fetchprs, nil
 }
 
+// FetchPullRequest gets a single pull request with its commits, comments and reviews and sends them using passed senders. Used in webhooks.
+// Returns nil GitRepoFetchPR if pull request does not have any commits.
+func (api *API) FetchPullRequest(repoid string, reponame string, prid string, prsender, prcommitsender, prcommentsender, prreviewsender objsender.SessionCommon) (_ *rpcdef.GitRepoFetchPR, rerr error) {
+	p, err := api.fetchPullRequest(repoid, prid)
+	if err != nil {
+		rerr = err
+		return
+	}
+	p.URL = pullRequestUIURL(p.URL)
+	repoRefID := api.IDs.CodeRepo(repoid)
+
+	pr := pullRequestResponseWithShas{}
+	pr.pullRequestResponse = p
+	pr.SourceBranch = strings.TrimPrefix(p.SourceBranch, "refs/heads/")
+	pr.TargetBranch = strings.TrimPrefix(p.TargetBranch, "refs/heads/")
+
+	commits, err := api.fetchPullRequestCommits(pr.Repository.ID, pr.PullRequestID)
+	if err != nil {
+		rerr = fmt.Errorf("error fetching commits for PR pr_id:%v repo_id:%v err:%v", pr.PullRequestID, pr.Repository.ID, err)
+		return
+	}
+	for _, commit := range commits {
+		pr.commitshas = append(pr.commitshas, commit.CommitID)
+		pr := pr
+		api.sendPullRequestCommitObjects(repoRefID, pr, prcommitsender)
+	}
+
+	api.sendPullRequestObjects(repoRefID, pr, reponame, prsender)
+	api.sendPullRequestCommentObject(repoRefID, p, prcommentsender, prreviewsender)
+
+	if len(pr.commitshas) == 0 {
+		return
+	}
+	pridstring := fmt.Sprintf("%d", pr.PullRequestID)
+	return &rpcdef.GitRepoFetchPR{
+		ID:            api.IDs.CodePullRequest(repoRefID, pridstring),
+		RefID:         pridstring,
+		URL:           pr.URL,
+		BranchName:    pr.SourceBranch,
+		LastCommitSHA: pr.commitshas[len(pr.commitshas)-1],
+	}, nil
+}
+
+// pullRequestUIURL modifies the url to show the ui instead of api call
+func pullRequestUIURL(u string) string {
+	u = strings.ToLower(u)
+	u = strings.Replace(u, "_apis/git/repositories", "_git", 1)
+	u = strings.Replace(u, "/pullrequests/", "/pullrequest/", 1)
+	return u
+}
+
 var pullRequestCommentVotedReg = regexp.MustCompile(`(.+?)( voted )(-10|-5|0|5|10.*)`)
 
-func (api *API) sendPullRequestCommentObject(repoRefID string, pr pullRequestResponse, prcsender *objsender.Session, prrsender *objsender.Session) {
+func (api *API) sendPullRequestCommentObject(repoRefID string, pr pullRequestResponse, prcsender objsender.SessionCommon, prrsender objsender.SessionCommon) {
 	threads, err := api.fetchPullRequestThreads(pr.Repository.ID, pr.PullRequestID)
 	if err != nil {
 		api.logger.Error("error fetching threads for PR, skipping", "pr_id", pr.PullRequestID, "repo_id", pr.Repository.ID, "err", err)
@@ -202,7 +250,7 @@ func (api *API) sendPullRequestCommentObject(repoRefID string, pr pullRequestRes
 	}
 }
 
-func (api *API) sendPullRequestObjects(repoRefID string, p pullRequestResponseWithShas, reponame string, prsender *objsender.Session) {
+func (api *API) sendPullRequestObjects(repoRefID string, p pullRequestResponseWithShas, reponame string, prsender objsender.SessionCommon) {
 
 	pr := &sourcecode.PullRequest{
 		BranchName:     p.SourceBranch,
@@ -256,7 +304,7 @@ func (api *API) sendPullRequestObjects(repoRefID string, p pullRequestResponseWi
 		api.logger.Error("error sending pull request", "id", pr.RefID, "err", err)
 	}
 }
-func (api *API) sendPullRequestCommitObjects(repoRefID string, p pullRequestResponseWithShas, sender *objsender.Session) error {
+func (api *API) sendPullRequestCommitObjects(repoRefID string, p pullRequestResponseWithShas, sender objsender.SessionCommon) error {
 	sha := p.commitshas[len(p.commitshas)-1]
 	commits, err := api.fetchSingleCommit(p.Repository.ID, sha)
 	if err != nil {
@@ -295,6 +343,18 @@ func (api *API) fetchPullRequests(repoid string) ([]pullRequestResponse, error)
 	return res, nil
 }
 
+func (api *API) fetchPullRequest(repoid string, prid string) (res pullRequestResponse, _ error) {
+	u := fmt.Sprintf(`_apis/git/repositories/%s/pullRequests/%s`, url.PathEscape(repoid), url.PathEscape(prid))
+	var prs []pullRequestResponse
+	if err := api.getRequest(u, stringmap{"pagingoff": "true"}, &prs); err != nil {
+		return res, err
+	}
+	if len(prs) == 0 {
+		return res, fmt.Errorf("pull request not found, repo_id: %v pr_id: %v", repoid, prid)
+	}
+	return prs[0], nil
+}
+
 func (api *API) fetchPullRequestThreads(repoid string, prid int64) ([]threadsReponse, error) {
 	u := fmt.Sprintf(`_apis/git/repositories/%s/pullRequests/%d/threads`, url.PathEscape(repoid), prid)
 	var res []threadsReponse
@@ -18,21 +18,7 @@ func (api *API) FetchAllRepos(includedByName []string, excludedids []string, inc
 	projectidmap := make(map[string]bool)
 	var allRepos []*sourcecode.Repo
 	for _, repo := range rawrepos {
-		var reponame string
-		if strings.HasPrefix(repo.Name, repo.Project.Name) {
-			reponame = repo.Name
-		} else {
-			reponame = repo.Project.Name + "/" + repo.Name
-		}
-		allRepos = append(allRepos, &sourcecode.Repo{
-			Active:        true,
-			CustomerID:    api.customerid,
-			DefaultBranch: strings.TrimPrefix(repo.DefaultBranch, "refs/heads/"),
-			Name:          reponame,
-			RefID:         repo.ID,
-			RefType:       api.reftype,
-			URL:           repo.RemoteURL,
-		})
+		allRepos = append(allRepos, api.convertRepo(repo))
 		projectidmap[repo.Project.ID] = true
 	}
 
@@ -95,6 +81,37 @@ func (api *API) FetchAllRepos(includedByName []string, excludedids []string, inc
 	return
 }
 
+// FetchRepo gets a single repo by id. Used in webhooks.
+func (api *API) FetchRepo(repoid string) (*sourcecode.Repo, error) {
+	u := fmt.Sprintf(`_apis/git/repositories/%s`, url.PathEscape(repoid))
+	var res []reposResponse
+	if err := api.getRequest(u, stringmap{"pagingoff": "true"}, &res); err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("repo not found, repo_id: %v", repoid)
+	}
+	return api.convertRepo(res[0]), nil
+}
+
+func (api *API) convertRepo(repo reposResponse) *sourcecode.Repo {
+	var reponame string
+	if strings.HasPrefix(repo.Name, repo.Project.Name) {
+		reponame = repo.Name
+	} else {
+		reponame = repo.Project.Name + "/" + repo.Name
+	}
+	return &sourcecode.Repo{
+		Active:        true,
+		CustomerID:    api.customerid,
+		DefaultBranch: strings.TrimPrefix(repo.DefaultBranch, "refs/heads/"),
+		Name:          reponame,
+		RefID:         repo.ID,
+		RefType:       api.reftype,
+		URL:           repo.RemoteURL,
+	}
+}
+
 func (api *API) fetchRepos(projid string) ([]reposResponse, error) {
 	// projid is optional, can be ""
 	u := fmt.Sprintf(`%s/_apis/git/repositories/`, url.PathEscape(projid))
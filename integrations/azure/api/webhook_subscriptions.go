@@ -0,0 +1,179 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// webhookSubscription is a service hook subscription using web hooks consumer
+// https://docs.microsoft.com/en-us/rest/api/azure/devops/hooks/subscriptions?view=azure-devops-rest-5.1
+type webhookSubscription struct {
+	ID               string            `json:"id"`
+	PublisherID      string            `json:"publisherId"`
+	EventType        string            `json:"eventType"`
+	ResourceVersion  string            `json:"resourceVersion"`
+	ConsumerID       string            `json:"consumerId"`
+	ConsumerActionID string            `json:"consumerActionId"`
+	PublisherInputs  map[string]string `json:"publisherInputs"`
+	ConsumerInputs   map[string]string `json:"consumerInputs"`
+	Status           string            `json:"status"`
+	CreatedDate      time.Time         `json:"createdDate"`
+}
+
+// WebhookSubscriptionsRepos registers service hook subscriptions for the passed events on each repo, if they do not exist yet.
+// Subscriptions are scoped to the project and repo, so that we do not get events for repos excluded from export.
+func (api *API) WebhookSubscriptionsRepos(webhookURL string, repoids []string, events []string) error {
+	rawrepos, err := api.fetchRepos("")
+	if err != nil {
+		return err
+	}
+	projectByRepo := map[string]string{}
+	for _, repo := range rawrepos {
+		projectByRepo[repo.ID] = repo.Project.ID
+	}
+	var inputs []map[string]string
+	for _, repoid := range repoids {
+		projid, ok := projectByRepo[repoid]
+		if !ok {
+			api.logger.Warn("could not find project for repo, skipping webhook registration", "repo_id", repoid)
+			continue
+		}
+		inputs = append(inputs, map[string]string{
+			"projectId":  projid,
+			"repository": repoid,
+		})
+	}
+	return api.webhookSubscriptionsCreateIfNotExists(webhookURL, inputs, events)
+}
+
+// WebhookSubscriptionsProjects registers service hook subscriptions for the passed events on each project, if they do not exist yet.
+func (api *API) WebhookSubscriptionsProjects(webhookURL string, projids []string, events []string) error {
+	var inputs []map[string]string
+	for _, projid := range projids {
+		inputs = append(inputs, map[string]string{
+			"projectId": projid,
+		})
+	}
+	return api.webhookSubscriptionsCreateIfNotExists(webhookURL, inputs, events)
+}
+
+// webhookSubscriptionsCreateIfNotExists creates subscriptions for every combination of publisher inputs and event. Subscriptions are matched by event, url and inputs, so a new subscription is created when webhook url changes. Subscriptions with the same event and inputs pointing to a previous webhook url on the same host are removed. When there are multiple matching subscriptions only the newest one is kept. Disabled subscriptions are recreated.
+func (api *API) webhookSubscriptionsCreateIfNotExists(webhookURL string, publisherInputs []map[string]string, events []string) error {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return err
+	}
+
+	existing, err := api.webhookSubscriptionsList()
+	if err != nil {
+		return err
+	}
+
+	for _, inputs := range publisherInputs {
+		for _, event := range events {
+			logger := api.logger.With("event", event, "inputs", inputs)
+
+			var matching []webhookSubscription
+			for _, sub := range existing {
+				if sub.EventType != event || !publisherInputsMatch(sub.PublisherInputs, inputs) {
+					continue
+				}
+				subURL := sub.ConsumerInputs["url"]
+				if subURL == webhookURL {
+					matching = append(matching, sub)
+					continue
+				}
+				if isPreviousWebhookURL(subURL, u) {
+					logger.Info("removing webhook subscription with previous webhook url")
+					if err := api.webhookSubscriptionRemove(sub.ID); err != nil {
+						return err
+					}
+				}
+			}
+
+			if len(matching) == 0 {
+				if err := api.webhookSubscriptionCreate(webhookURL, inputs, event); err != nil {
+					return err
+				}
+				continue
+			}
+
+			sort.SliceStable(matching, func(i, j int) bool {
+				return matching[i].CreatedDate.After(matching[j].CreatedDate)
+			})
+			for _, sub := range matching[1:] {
+				if err := api.webhookSubscriptionRemove(sub.ID); err != nil {
+					return err
+				}
+			}
+
+			sub := matching[0]
+			// subscriptions are disabled by the system after multiple failures
+			if sub.Status != "enabled" {
+				logger.Info("recreating webhook subscription, because the one we had before is not enabled", "status", sub.Status)
+				if err := api.webhookSubscriptionRemove(sub.ID); err != nil {
+					return err
+				}
+				if err := api.webhookSubscriptionCreate(webhookURL, inputs, event); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// isPreviousWebhookURL returns true if subscription url is on the same host as the current webhook url. Subscriptions to other hosts are not created by the agent and are kept.
+func isPreviousWebhookURL(subURL string, webhookURL *url.URL) bool {
+	u, err := url.Parse(subURL)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == webhookURL.Scheme && u.Host == webhookURL.Host
+}
+
+// publisherInputs returned by the api contain additional keys, only check the ones we set
+func publisherInputsMatch(got map[string]string, want map[string]string) bool {
+	for k, v := range want {
+		if got[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (api *API) webhookSubscriptionsList() ([]webhookSubscription, error) {
+	var res []webhookSubscription
+	if err := api.getRequest("_apis/hooks/subscriptions", stringmap{
+		"pagingoff":   "true",
+		"publisherId": "tfs",
+		"consumerId":  "webHooks",
+	}, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (api *API) webhookSubscriptionCreate(webhookURL string, inputs map[string]string, event string) error {
+	api.logger.Info("registering webhook subscription", "event", event, "inputs", inputs)
+	sub := map[string]interface{}{
+		"publisherId":      "tfs",
+		"eventType":        event,
+		"resourceVersion":  "1.0",
+		"consumerId":       "webHooks",
+		"consumerActionId": "httpRequest",
+		"publisherInputs":  inputs,
+		"consumerInputs": map[string]string{
+			"url": webhookURL,
+		},
+	}
+	var res webhookSubscription
+	return api.postRequest("_apis/hooks/subscriptions", nil, sub, &res)
+}
+
+func (api *API) webhookSubscriptionRemove(id string) error {
+	api.logger.Info("removing webhook subscription", "id", id)
+	return api.deleteRequest(fmt.Sprintf(`_apis/hooks/subscriptions/%s`, url.PathEscape(id)))
+}
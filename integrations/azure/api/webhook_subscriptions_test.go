@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookSubscriptionsDedup(t *testing.T) {
+	assert := assert.New(t)
+	const hookURL = "https://example.com/hook"
+
+	var created []string
+	var removed []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			assert.Equal("/org1/_apis/hooks/subscriptions", req.URL.Path)
+			rw.Write([]byte(`{"count":6,"value":[
+				{"id":"s1","eventType":"workitem.created","publisherInputs":{"projectId":"p1","areaPath":""},"consumerInputs":{"url":"` + hookURL + `"},"status":"enabled","createdDate":"2020-01-01T00:00:00Z"},
+				{"id":"s2","eventType":"workitem.created","publisherInputs":{"projectId":"p1"},"consumerInputs":{"url":"` + hookURL + `"},"status":"enabled","createdDate":"2020-02-01T00:00:00Z"},
+				{"id":"s3","eventType":"workitem.updated","publisherInputs":{"projectId":"p1"},"consumerInputs":{"url":"` + hookURL + `"},"status":"disabledBySystem","createdDate":"2020-01-01T00:00:00Z"},
+				{"id":"s4","eventType":"workitem.restored","publisherInputs":{"projectId":"p1"},"consumerInputs":{"url":"https://example.com/old"},"status":"enabled","createdDate":"2020-01-01T00:00:00Z"},
+				{"id":"s5","eventType":"workitem.restored","publisherInputs":{"projectId":"p1"},"consumerInputs":{"url":"https://other.example.com/hook"},"status":"enabled","createdDate":"2020-01-01T00:00:00Z"},
+				{"id":"s6","eventType":"workitem.restored","publisherInputs":{"projectId":"p2"},"consumerInputs":{"url":"https://example.com/old"},"status":"enabled","createdDate":"2020-01-01T00:00:00Z"}
+			]}`))
+		case http.MethodPost:
+			b, err := ioutil.ReadAll(req.Body)
+			assert.NoError(err)
+			var sub webhookSubscription
+			assert.NoError(json.Unmarshal(b, &sub))
+			assert.Equal("p1", sub.PublisherInputs["projectId"])
+			assert.Equal(hookURL, sub.ConsumerInputs["url"])
+			created = append(created, sub.EventType)
+			rw.Write([]byte(`{"id":"new"}`))
+		case http.MethodDelete:
+			removed = append(removed, req.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	err := testAPI(server).WebhookSubscriptionsProjects(hookURL, []string{"p1"}, []string{"workitem.created", "workitem.updated", "workitem.restored"})
+	assert.NoError(err)
+	// older duplicate, disabled and subscriptions with previous url are removed, other hosts and projects are kept
+	assert.Equal([]string{"/org1/_apis/hooks/subscriptions/s1", "/org1/_apis/hooks/subscriptions/s3", "/org1/_apis/hooks/subscriptions/s4"}, removed)
+	// disabled is recreated, subscription with previous url is replaced
+	assert.Equal([]string{"workitem.updated", "workitem.restored"}, created)
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/pinpt/agent/integrations/pkg/mutate"
+	"github.com/pinpt/agent/pkg/date"
+	"github.com/pinpt/integration-sdk/work"
+)
+
+// WorkItemOperation is a json patch operation used to update work item fields
+// https://docs.microsoft.com/en-us/rest/api/azure/devops/wit/work%20items/update?view=azure-devops-rest-5.1
+type WorkItemOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// WorkItemSetField returns an operation that sets the field to the value. Field is the field reference name, for example System.Title.
+func WorkItemSetField(field string, value interface{}) WorkItemOperation {
+	return WorkItemOperation{
+		Op:    "add",
+		Path:  "/fields/" + field,
+		Value: value,
+	}
+}
+
+// UpdateWorkItem applies json patch operations to work item and returns the updated work item
+func (api *API) UpdateWorkItem(refid string, ops []WorkItemOperation) (*WorkItemResponse, error) {
+	api.logger.Info("updating work item", "id", refid)
+	u := fmt.Sprintf(`_apis/wit/workitems/%s`, url.PathEscape(refid))
+	var res WorkItemResponse
+	if err := api.patchRequest(u, nil, ops, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// FetchWorkItem returns the work item using id, which is unique in organization
+func (api *API) FetchWorkItem(refid string) (*WorkItemResponse, error) {
+	u := fmt.Sprintf(`_apis/wit/workitems/%s`, url.PathEscape(refid))
+	var res []WorkItemResponse
+	if err := api.getRequest(u, stringmap{"pagingoff": "true"}, &res); err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("work item not found: %v", refid)
+	}
+	return &res[0], nil
+}
+
+// FetchProjectID returns project id from project name. Work items only contain the name of the project.
+func (api *API) FetchProjectID(name string) (string, error) {
+	u := fmt.Sprintf(`_apis/projects/%s`, url.PathEscape(name))
+	var res []projectResponse
+	if err := api.getRequest(u, stringmap{"pagingoff": "true"}, &res); err != nil {
+		return "", err
+	}
+	if len(res) == 0 || res[0].ID == "" {
+		return "", fmt.Errorf("project not found: %v", name)
+	}
+	return res[0].ID, nil
+}
+
+// FetchWorkItemIssue returns the work item converted to work.Issue, same as in export
+func (api *API) FetchWorkItemIssue(projid string, refid string) (*work.Issue, error) {
+	_, issues, err := api.FetchWorkItemsByIDs(projid, []string{refid})
+	if err != nil {
+		return nil, err
+	}
+	if len(issues) == 0 {
+		return nil, fmt.Errorf("work item is not exported, it could be a test work item type: %v", refid)
+	}
+	return issues[0], nil
+}
+
+// FetchWorkItemTransitions returns the states the work item could be moved to. Transition id is the state name to set in System.State.
+func (api *API) FetchWorkItemTransitions(item *WorkItemResponse) (res []mutate.IssueTransition, _ error) {
+	fields := item.Fields
+	u := fmt.Sprintf(`%s/_apis/wit/workitemtypes/%s`, url.PathEscape(fields.TeamProject), url.PathEscape(fields.WorkItemType))
+	var conf []workConfigRes
+	if err := api.getRequest(u, stringmap{}, &conf); err != nil {
+		return nil, err
+	}
+	if len(conf) == 0 {
+		return nil, fmt.Errorf("work item type not found: %v", fields.WorkItemType)
+	}
+	res = []mutate.IssueTransition{}
+	for _, state := range conf[0].States {
+		if state.Name == fields.State {
+			continue
+		}
+		res = append(res, mutate.IssueTransition{
+			ID:   state.Name,
+			Name: state.Name,
+		})
+	}
+	return res, nil
+}
+
+// FetchUserUniqueName returns the unique name of the user, which is needed to set System.AssignedTo. Only team members of the project are checked, same as in export.
+func (api *API) FetchUserUniqueName(projid string, userRefID string) (string, error) {
+	teamids, err := api.FetchTeamIDs(projid)
+	if err != nil {
+		return "", err
+	}
+	for _, teamid := range teamids {
+		users, err := api.fetchUsers(projid, teamid)
+		if err != nil {
+			return "", err
+		}
+		for _, u := range users {
+			if u.ID == userRefID {
+				return u.UniqueName, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("user not found in project teams: %v", userRefID)
+}
+
+// AddWorkItemComment adds a comment to work item discussion. Uses System.History field, since comments api is only available in preview and not in tfs.
+func (api *API) AddWorkItemComment(projid string, refid string, body string) (*work.IssueComment, error) {
+	if body == "" {
+		return nil, errors.New("comment body is empty")
+	}
+	item, err := api.UpdateWorkItem(refid, []WorkItemOperation{WorkItemSetField("System.History", body)})
+	if err != nil {
+		return nil, err
+	}
+	// comment is a revision of the work item, use revision number to make the id unique
+	comment := &work.IssueComment{
+		Body:       item.Fields.History,
+		CustomerID: api.customerid,
+		IssueID:    api.IDs.WorkIssue(refid),
+		ProjectID:  api.IDs.WorkProject(projid),
+		RefID:      fmt.Sprintf("%d-%d", item.ID, item.Rev),
+		RefType:    api.reftype,
+		UserRefID:  item.Fields.ChangedBy.ID,
+	}
+	date.ConvertToModel(item.Fields.ChangedDate, &comment.CreatedDate)
+	date.ConvertToModel(item.Fields.ChangedDate, &comment.UpdatedDate)
+	return comment, nil
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/pkg/requests"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/exp/errors"
+)
+
+func testAPI(server *httptest.Server) *API {
+	logger := hclog.New(&hclog.LoggerOptions{
+		Name: "test",
+	})
+	creds := &Creds{
+		URL:          server.URL,
+		Organization: "org1",
+		APIKey:       "token1",
+	}
+	return NewAPI(context.Background(), logger, 1, "c1", "azure", creds, false)
+}
+
+func TestUpdateWorkItem(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal(http.MethodPatch, req.Method)
+		assert.Equal("/org1/_apis/wit/workitems/12", req.URL.Path)
+		assert.Equal("application/json-patch+json", req.Header.Get("Content-Type"))
+		var ops []WorkItemOperation
+		b, err := ioutil.ReadAll(req.Body)
+		assert.NoError(err)
+		assert.NoError(json.Unmarshal(b, &ops))
+		assert.Equal([]WorkItemOperation{{Op: "add", Path: "/fields/System.Title", Value: "New title"}}, ops)
+		rw.Write([]byte(`{"id":12,"rev":3,"fields":{"System.TeamProject":"proj1","System.Title":"New title"}}`))
+	}))
+	defer server.Close()
+
+	item, err := testAPI(server).UpdateWorkItem("12", []WorkItemOperation{WorkItemSetField("System.Title", "New title")})
+	assert.NoError(err)
+	assert.Equal(12, item.ID)
+	assert.Equal(3, item.Rev)
+	assert.Equal("New title", item.Fields.Title)
+}
+
+func TestUpdateWorkItemNotFound(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	_, err := testAPI(server).UpdateWorkItem("12", []WorkItemOperation{WorkItemSetField("System.Title", "New title")})
+	var e requests.StatusCodeError
+	if assert.True(errors.As(err, &e)) {
+		assert.Equal(http.StatusNotFound, e.Got)
+	}
+}
+
+func TestFetchWorkItemTransitions(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal("/org1/proj1/_apis/wit/workitemtypes/Bug", req.URL.Path)
+		rw.Write([]byte(`{"name":"Bug","states":[{"name":"New","category":"Proposed"},{"name":"Active","category":"InProgress"},{"name":"Closed","category":"Completed"}]}`))
+	}))
+	defer server.Close()
+
+	item := &WorkItemResponse{}
+	item.Fields.TeamProject = "proj1"
+	item.Fields.WorkItemType = "Bug"
+	item.Fields.State = "Active"
+
+	res, err := testAPI(server).FetchWorkItemTransitions(item)
+	assert.NoError(err)
+	if assert.Len(res, 2) {
+		assert.Equal("New", res[0].ID)
+		assert.Equal("Closed", res[1].Name)
+	}
+}
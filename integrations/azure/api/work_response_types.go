@@ -40,13 +40,6 @@ type changelogResponse struct {
 	RevisedBy usersResponse `json:"revisedBy"`
 }
 
-// type workItemOperation struct {
-// 	Op    string  `json:"op"`
-// 	Path  string  `json:"path"`
-// 	From  *string `json:"from"`
-// 	Value string  `json:"value"`
-// }
-
 // used in work_item.go - fetchItemIDs
 type workItemsResponse struct {
 	AsOf    time.Time `json:"asOf"`
@@ -81,10 +74,12 @@ type WorkItemResponse struct {
 	} `json:"_links"`
 	Fields struct {
 		AssignedTo     usersResponse `json:"System.AssignedTo"`
+		ChangedBy      usersResponse `json:"System.ChangedBy"`
 		ChangedDate    time.Time     `json:"System.ChangedDate"`
 		CreatedDate    time.Time     `json:"System.CreatedDate"`
 		CreatedBy      usersResponse `json:"System.CreatedBy"`
 		Description    string        `json:"System.Description"`
+		History        string        `json:"System.History"`
 		DueDate        time.Time     `json:"Microsoft.VSTS.Scheduling.DueDate"` // ??
 		IterationPath  string        `json:"System.IterationPath"`
 		TeamProject    string        `json:"System.TeamProject"`
@@ -103,6 +98,7 @@ type WorkItemResponse struct {
 		URL string `json:"url"`
 	} `json:"relations"`
 	ID  int    `json:"id"`
+	Rev int    `json:"rev"`
 	URL string `json:"url"`
 }
 
@@ -7,9 +7,11 @@ import (
 	"github.com/pinpt/agent/cmd/cmdrunnorestarts/inconfig"
 	"golang.org/x/exp/errors/fmt"
 
+	"github.com/pinpt/agent/integrations/pkg/commoncicd"
 	"github.com/pinpt/agent/integrations/pkg/repoprojects"
 	"github.com/pinpt/agent/rpcdef"
 	pjson "github.com/pinpt/go-common/json"
+	"github.com/pinpt/integration-sdk/cicd"
 	"github.com/pinpt/integration-sdk/sourcecode"
 )
 
@@ -54,6 +56,10 @@ func (s *Integration) processRepos() (projectIDs []string, exportResults []rpcde
 	s.logger.Info("done fetching all repos")
 	projectIDs = ids
 
+	if err := s.registerWebhooksCode(reposDetails); err != nil {
+		s.logger.Info("could not register webhooks", "err", err)
+	}
+
 	var orgname string
 	if s.Creds.Organization != "" {
 		orgname = s.Creds.Organization
@@ -97,6 +103,14 @@ func (s *Integration) processRepos() (projectIDs []string, exportResults []rpcde
 		if err != nil {
 			return err
 		}
+		// builds are optional, pipelines could be disabled for the project
+		if err := s.exportBuilds(ctx, repo); err != nil {
+			s.logger.Error("could not export builds", "repo", repo.Name, "err", err)
+			// do not update last processed, so that builds are exported again on next run
+			if err := ctx.Rollback(cicd.BuildModelName); err != nil {
+				return err
+			}
+		}
 		return s.ripSource(repo.Repo, fetchprs)
 	}
 
@@ -133,6 +147,23 @@ func (s Repo) GetReadableID() string {
 	return s.Name
 }
 
+func (s *Integration) exportBuilds(ctx *repoprojects.ProjectCtx, repo Repo) error {
+	sender, err := ctx.Session(cicd.BuildModelName)
+	if err != nil {
+		return err
+	}
+	builds, err := s.api.FetchBuilds(repo.RefID, repo.Name, commoncicd.StartTime(sender.LastProcessedTime()))
+	if err != nil {
+		return err
+	}
+	for _, build := range builds {
+		if err := sender.Send(build); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *Integration) appendCredentials(repoURL string) (string, error) {
 	u, err := url.Parse(repoURL)
 	if s.OverrideGitHostName != "" {
@@ -2,12 +2,198 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
 
+	"github.com/pinpt/agent/integrations/azure/api"
+	"github.com/pinpt/agent/integrations/pkg/mutate"
 	"github.com/pinpt/agent/rpcdef"
+	"github.com/pinpt/go-common/datamodel"
+	"github.com/pinpt/integration-sdk/agent"
+	"github.com/pinpt/integration-sdk/work"
 )
 
-func (s *Integration) Mutate(ctx context.Context, fn, data string, config rpcdef.ExportConfig) (res rpcdef.MutateResult, rerr error) {
-	rerr = errors.New("mutate not supported")
+type Model interface {
+	ToMap() map[string]interface{}
+}
+
+func (s *Integration) mutationResult(modelName datamodel.ModelNameType, obj Model) (res rpcdef.MutateResult, rerr error) {
+	objs := rpcdef.MutatedObjects{}
+	objs[modelName.String()] = []interface{}{obj.ToMap()}
+	res.MutatedObjects = objs
+	return
+}
+
+// updateWorkItem applies the operations and returns the refreshed issue, errors are returned in result
+func (s *Integration) updateWorkItem(refid string, ops ...api.WorkItemOperation) rpcdef.MutateResult {
+	item, err := s.api.UpdateWorkItem(refid, ops)
+	if err != nil {
+		return mutate.ResultFromError(err)
+	}
+	projid, err := s.api.FetchProjectID(item.Fields.TeamProject)
+	if err != nil {
+		return mutate.ResultFromError(err)
+	}
+	issue, err := s.api.FetchWorkItemIssue(projid, refid)
+	if err != nil {
+		return mutate.ResultFromError(err)
+	}
+	res, _ := s.mutationResult(work.IssueModelName, issue)
+	return res
+}
+
+// workItemProjectID returns the id of the project the work item belongs to
+func (s *Integration) workItemProjectID(refid string) (string, error) {
+	item, err := s.api.FetchWorkItem(refid)
+	if err != nil {
+		return "", err
+	}
+	return s.api.FetchProjectID(item.Fields.TeamProject)
+}
+
+func (s *Integration) Mutate(ctx context.Context, fn, data string, config rpcdef.ExportConfig) (res rpcdef.MutateResult, _ error) {
+
+	rerr := func(err error) {
+		res = mutate.ResultFromError(err)
+	}
+
+	err := s.initConfig(ctx, config)
+	if err != nil {
+		rerr(err)
+		return
+	}
+
+	if s.IntegrationType != IntegrationTypeIssues {
+		rerr(fmt.Errorf("mutations are only supported for work integration, got: %v", s.IntegrationType))
+		return
+	}
+
+	var action agent.IntegrationMutationRequestAction
+	err = action.FromInterface(fn)
+	if err != nil {
+		rerr(err)
+		return
+	}
+
+	switch action {
+	case agent.IntegrationMutationRequestActionIssueAddComment:
+		var obj struct {
+			IssueRefID string `json:"ref_id"`
+			Body       string `json:"body"`
+		}
+		err := json.Unmarshal([]byte(data), &obj)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		projid, err := s.workItemProjectID(obj.IssueRefID)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		comment, err := s.api.AddWorkItemComment(projid, obj.IssueRefID, obj.Body)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		return s.mutationResult(work.IssueCommentModelName, comment)
+	case agent.IntegrationMutationRequestActionIssueSetTitle:
+		var obj struct {
+			IssueID string `json:"ref_id"`
+			Title   string `json:"title"`
+		}
+		err := json.Unmarshal([]byte(data), &obj)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		if obj.Title == "" {
+			rerr(errors.New("title field not provided"))
+			return
+		}
+		return s.updateWorkItem(obj.IssueID, api.WorkItemSetField("System.Title", obj.Title)), nil
+	case agent.IntegrationMutationRequestActionIssueSetStatus:
+		var obj struct {
+			IssueID      string `json:"ref_id"`
+			TransitionID string `json:"transition_id"`
+		}
+		err := json.Unmarshal([]byte(data), &obj)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		if obj.TransitionID == "" {
+			rerr(errors.New("transition_id field not provided"))
+			return
+		}
+		return s.updateWorkItem(obj.IssueID, api.WorkItemSetField("System.State", obj.TransitionID)), nil
+	case agent.IntegrationMutationRequestActionIssueSetPriority:
+		var obj struct {
+			IssueID    string `json:"ref_id"`
+			PriorityID string `json:"priority_ref_id"`
+		}
+		err := json.Unmarshal([]byte(data), &obj)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		// priority is a number from 1 to 4, same value is exported in issue priority
+		priority, err := strconv.Atoi(obj.PriorityID)
+		if err != nil {
+			rerr(fmt.Errorf("invalid priority_ref_id: %v", err))
+			return
+		}
+		return s.updateWorkItem(obj.IssueID, api.WorkItemSetField("Microsoft.VSTS.Common.Priority", priority)), nil
+	case agent.IntegrationMutationRequestActionIssueSetAssignee:
+		var obj struct {
+			IssueID string `json:"ref_id"`
+			UserID  string `json:"user_ref_id"`
+		}
+		err := json.Unmarshal([]byte(data), &obj)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		// empty value unassigns the work item
+		var assignee string
+		if obj.UserID != "" {
+			projid, err := s.workItemProjectID(obj.IssueID)
+			if err != nil {
+				rerr(err)
+				return
+			}
+			assignee, err = s.api.FetchUserUniqueName(projid, obj.UserID)
+			if err != nil {
+				rerr(err)
+				return
+			}
+		}
+		return s.updateWorkItem(obj.IssueID, api.WorkItemSetField("System.AssignedTo", assignee)), nil
+	case agent.IntegrationMutationRequestActionIssueGetTransitions:
+		var obj struct {
+			IssueID string `json:"ref_id"`
+		}
+		err := json.Unmarshal([]byte(data), &obj)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		item, err := s.api.FetchWorkItem(obj.IssueID)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		transitions, err := s.api.FetchWorkItemTransitions(item)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		res.WebappResponse = transitions
+		return
+	}
+
+	rerr(fmt.Errorf("mutate fn not supported: %v", fn))
 	return
 }
@@ -2,12 +2,263 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
 
+	"github.com/pinpt/agent/integrations/pkg/objsender"
 	"github.com/pinpt/agent/rpcdef"
+	"github.com/pinpt/integration-sdk/sourcecode"
+	"github.com/pinpt/integration-sdk/work"
 )
 
-func (s *Integration) Webhook(ctx context.Context, headers map[string]string, body string, config rpcdef.ExportConfig) (res rpcdef.WebhookResult, rerr error) {
-	rerr = errors.New("webhook not supported")
-	return
+// webhookEventsCode are service hook event types we subscribe to for sourcecode
+// https://docs.microsoft.com/en-us/azure/devops/service-hooks/events?view=azure-devops
+var webhookEventsCode = []string{
+	"git.pullrequest.created",
+	"git.pullrequest.updated",
+	"git.pullrequest.merged",
+	"ms.vss-code.git-pullrequest-comment-event",
+}
+
+// webhookEventsWork are service hook event types we subscribe to for work
+var webhookEventsWork = []string{
+	"workitem.created",
+	"workitem.updated",
+	"workitem.commented",
+	"workitem.restored",
+}
+
+// webhookPayload contains the fields we need from service hook payloads
+type webhookPayload struct {
+	EventType          string          `json:"eventType"`
+	Resource           json.RawMessage `json:"resource"`
+	ResourceContainers struct {
+		Project struct {
+			ID string `json:"id"`
+		} `json:"project"`
+	} `json:"resourceContainers"`
+}
+
+type webhookPullRequest struct {
+	PullRequestID int64 `json:"pullRequestId"`
+	Repository    struct {
+		ID string `json:"id"`
+	} `json:"repository"`
+}
+
+// webhookEvent is the object changed in service hook payload
+type webhookEvent struct {
+	EventType string
+	// PullRequest is set for pull request events
+	PullRequest *webhookPullRequest
+	// WorkItemID and ProjectID are set for work item events
+	WorkItemID string
+	ProjectID  string
+}
+
+func (s webhookEvent) isPullRequest() bool {
+	return s.PullRequest != nil
+}
+
+func (s webhookEvent) isWorkItem() bool {
+	return s.WorkItemID != ""
+}
+
+// parseWebhook returns the pull request or work item from service hook payload. Returns event with only EventType set for unsupported events.
+func parseWebhook(body string) (res webhookEvent, rerr error) {
+	var data webhookPayload
+	err := json.Unmarshal([]byte(body), &data)
+	if err != nil {
+		rerr = err
+		return
+	}
+	res.EventType = data.EventType
+	switch data.EventType {
+	case "":
+		rerr = errors.New("eventType is not provided in payload")
+		return
+	case "git.pullrequest.created",
+		"git.pullrequest.updated",
+		"git.pullrequest.merged",
+		"ms.vss-code.git-pullrequest-comment-event":
+		var pr webhookPullRequest
+		if data.EventType == "ms.vss-code.git-pullrequest-comment-event" {
+			var resource struct {
+				PullRequest webhookPullRequest `json:"pullRequest"`
+			}
+			err = json.Unmarshal(data.Resource, &resource)
+			pr = resource.PullRequest
+		} else {
+			err = json.Unmarshal(data.Resource, &pr)
+		}
+		if err != nil {
+			rerr = err
+			return
+		}
+		if pr.PullRequestID == 0 || pr.Repository.ID == "" {
+			rerr = errors.New("missing resource pullRequestId or repository.id in payload")
+			return
+		}
+		res.PullRequest = &pr
+		return
+	case "workitem.created",
+		"workitem.updated",
+		"workitem.commented",
+		"workitem.restored":
+		// workitem.updated resource is the update with workItemId, other events contain the work item itself
+		var resource struct {
+			ID         int64 `json:"id"`
+			WorkItemID int64 `json:"workItemId"`
+		}
+		err = json.Unmarshal(data.Resource, &resource)
+		if err != nil {
+			rerr = err
+			return
+		}
+		id := resource.WorkItemID
+		if id == 0 {
+			id = resource.ID
+		}
+		if id == 0 {
+			rerr = errors.New("missing resource id in payload")
+			return
+		}
+		if data.ResourceContainers.Project.ID == "" {
+			rerr = errors.New("missing resourceContainers.project.id in payload")
+			return
+		}
+		res.WorkItemID = strconv.FormatInt(id, 10)
+		res.ProjectID = data.ResourceContainers.Project.ID
+		return
+	default:
+		return
+	}
+}
+
+func (s *Integration) Webhook(ctx context.Context, headers map[string]string, body string, config rpcdef.ExportConfig) (res rpcdef.WebhookResult, _ error) {
+
+	rerr := func(err error) {
+		res.Error = err.Error()
+		return
+	}
+
+	if len(body) == 0 {
+		rerr(errors.New("empty webhook body passed"))
+		return
+	}
+
+	err := s.initConfig(ctx, config)
+	if err != nil {
+		rerr(err)
+		return
+	}
+
+	ev, err := parseWebhook(body)
+	if err != nil {
+		rerr(err)
+		return
+	}
+
+	sessions := objsender.NewSessionsWebhook()
+
+	switch {
+	case ev.isPullRequest():
+		if s.IntegrationType != IntegrationTypeCode {
+			s.logger.Info("skipping pull request webhook for work integration")
+			return
+		}
+		pr := ev.PullRequest
+		err = s.webhookPullRequest(sessions, pr.Repository.ID, strconv.FormatInt(pr.PullRequestID, 10), ev.EventType != "ms.vss-code.git-pullrequest-comment-event")
+		if err != nil {
+			rerr(fmt.Errorf("could not get pull request %v", err))
+			return
+		}
+		res.MutatedObjects = sessions.Data
+		return
+	case ev.isWorkItem():
+		if s.IntegrationType != IntegrationTypeIssues {
+			s.logger.Info("skipping work item webhook for sourcecode integration")
+			return
+		}
+		session := sessions.NewSession(work.IssueModelName.String())
+		_, issues, err := s.api.FetchWorkItemsByIDs(ev.ProjectID, []string{ev.WorkItemID})
+		if err != nil {
+			rerr(err)
+			return
+		}
+		for _, issue := range issues {
+			err := session.Send(issue)
+			if err != nil {
+				rerr(err)
+				return
+			}
+		}
+		res.MutatedObjects = sessions.Data
+		return
+	default:
+		s.logger.Info("skipping webhook with unsupported eventType, this is not in a list of supported webhooks", "eventType", ev.EventType)
+		return
+	}
+}
+
+func (s *Integration) webhookPullRequest(sessions *objsender.SessionsWebhook, repoid string, prid string, exportGit bool) error {
+	repo, err := s.api.FetchRepo(repoid)
+	if err != nil {
+		return err
+	}
+
+	prSender := sessions.NewSession(sourcecode.PullRequestModelName.String())
+	commitsSender := sessions.NewSession(sourcecode.PullRequestCommitModelName.String())
+	commentsSender := sessions.NewSession(sourcecode.PullRequestCommentModelName.String())
+	reviewsSender := sessions.NewSession(sourcecode.PullRequestReviewModelName.String())
+
+	fetchpr, err := s.api.FetchPullRequest(repo.RefID, repo.Name, prid, prSender, commitsSender, commentsSender, reviewsSender)
+	if err != nil {
+		return err
+	}
+
+	// comments do not change git data
+	if !exportGit {
+		return nil
+	}
+
+	var fetchprs []rpcdef.GitRepoFetchPR
+	if fetchpr != nil {
+		fetchprs = append(fetchprs, *fetchpr)
+	}
+	return s.ripSource(repo, fetchprs)
+}
+
+func (s *Integration) registerWebhooksCode(repos []*sourcecode.Repo) error {
+	s.logger.Info("registering webhooks")
+
+	url, err := s.agent.GetWebhookURL()
+	if err != nil {
+		return err
+	}
+
+	var repoids []string
+	for _, repo := range repos {
+		repoids = append(repoids, repo.RefID)
+	}
+
+	return s.api.WebhookSubscriptionsRepos(url, repoids, webhookEventsCode)
+}
+
+func (s *Integration) registerWebhooksWork(projects []Project) error {
+	s.logger.Info("registering webhooks")
+
+	url, err := s.agent.GetWebhookURL()
+	if err != nil {
+		return err
+	}
+
+	var projids []string
+	for _, proj := range projects {
+		projids = append(projids, proj.RefID)
+	}
+
+	return s.api.WebhookSubscriptionsProjects(url, projids, webhookEventsWork)
 }
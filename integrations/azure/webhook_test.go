@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWebhookPullRequest(t *testing.T) {
+	assert := assert.New(t)
+	ev, err := parseWebhook(`{"eventType":"git.pullrequest.updated","resource":{"pullRequestId":12,"repository":{"id":"r1"}}}`)
+	assert.NoError(err)
+	assert.True(ev.isPullRequest())
+	assert.False(ev.isWorkItem())
+	assert.Equal(int64(12), ev.PullRequest.PullRequestID)
+	assert.Equal("r1", ev.PullRequest.Repository.ID)
+
+	// comment event contains pull request in a separate field
+	ev, err = parseWebhook(`{"eventType":"ms.vss-code.git-pullrequest-comment-event","resource":{"comment":{"id":1},"pullRequest":{"pullRequestId":13,"repository":{"id":"r2"}}}}`)
+	assert.NoError(err)
+	assert.Equal(int64(13), ev.PullRequest.PullRequestID)
+	assert.Equal("r2", ev.PullRequest.Repository.ID)
+
+	_, err = parseWebhook(`{"eventType":"git.pullrequest.created","resource":{"pullRequestId":12}}`)
+	assert.Error(err)
+}
+
+func TestParseWebhookWorkItem(t *testing.T) {
+	assert := assert.New(t)
+	// updated resource is the update, work item id is in a separate field
+	ev, err := parseWebhook(`{"eventType":"workitem.updated","resource":{"id":3,"workItemId":5},"resourceContainers":{"project":{"id":"p1"}}}`)
+	assert.NoError(err)
+	assert.True(ev.isWorkItem())
+	assert.False(ev.isPullRequest())
+	assert.Equal("5", ev.WorkItemID)
+	assert.Equal("p1", ev.ProjectID)
+
+	ev, err = parseWebhook(`{"eventType":"workitem.created","resource":{"id":7,"fields":{"System.State":"New"}},"resourceContainers":{"project":{"id":"p1"}}}`)
+	assert.NoError(err)
+	assert.Equal("7", ev.WorkItemID)
+
+	_, err = parseWebhook(`{"eventType":"workitem.created","resource":{"id":7}}`)
+	assert.Error(err, "project is required to fetch work item")
+}
+
+func TestParseWebhookUnsupported(t *testing.T) {
+	assert := assert.New(t)
+	ev, err := parseWebhook(`{"eventType":"build.complete","resource":{"id":1}}`)
+	assert.NoError(err)
+	assert.False(ev.isPullRequest())
+	assert.False(ev.isWorkItem())
+
+	// deleted work items are not supported, the issue is not removed from exported data
+	ev, err = parseWebhook(`{"eventType":"workitem.deleted","resource":{"id":7},"resourceContainers":{"project":{"id":"p1"}}}`)
+	assert.NoError(err)
+	assert.False(ev.isWorkItem())
+
+	_, err = parseWebhook(`{"resource":{"id":1}}`)
+	assert.Error(err)
+	_, err = parseWebhook(`not json`)
+	assert.Error(err)
+}
@@ -53,6 +53,10 @@ func (s *Integration) exportWork() (exportResults []rpcdef.ExportProject, rerr e
 		projectsIface = append(projectsIface, project)
 	}
 
+	if err := s.registerWebhooksWork(projects); err != nil {
+		s.logger.Info("could not register webhooks", "err", err)
+	}
+
 	processOpts := repoprojects.ProcessOpts{}
 	processOpts.Logger = s.logger
 	processOpts.ProjectFn = func(ctx *repoprojects.ProjectCtx) error {
@@ -8,15 +8,34 @@ import (
 	"github.com/hashicorp/go-hclog"
 )
 
+// ServerType server type
+type ServerType string
+
+const (
+	// CLOUD is bitbucket.org using 2.0 api
+	CLOUD ServerType = "cloud"
+	// SERVER is self-hosted Bitbucket Server or Data Center using rest/api/1.0
+	SERVER ServerType = "server"
+)
+
 type QueryContext struct {
 	BaseURL string
 	Logger  hclog.Logger
 	Request func(string, url.Values, bool, interface{}, NextPage) (NextPage, error)
+	// RequestJSON makes a request with any http method and optional json body. Used for writes, such as webhook registration.
+	RequestJSON func(method string, url string, params url.Values, body interface{}, response interface{}) error
 
 	CustomerID string
 	RefType    string
 
 	IDs ids2.Gen
+
+	ServerType ServerType
 }
 
 type NextPage string
+
+// IsServer returns true when talking to Bitbucket Server or Data Center
+func (s QueryContext) IsServer() bool {
+	return s.ServerType == SERVER
+}
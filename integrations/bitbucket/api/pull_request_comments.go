@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/url"
 	"strconv"
 	"time"
@@ -13,6 +14,24 @@ import (
 	"github.com/pinpt/integration-sdk/sourcecode"
 )
 
+type pullRequestCommentResponse struct {
+	ID    int64 `json:"id"`
+	Links struct {
+		HTML struct {
+			Href string `json:"href"`
+		} `json:"html"`
+	} `json:"links"`
+	UpdatedOn time.Time `json:"updated_on"`
+	CreatedOn time.Time `json:"created_on"`
+	Content   struct {
+		Raw string `json:"raw"`
+	} `json:"content"`
+	User struct {
+		AccountID string `json:"account_id"`
+	} `json:"user"`
+	Inline json.RawMessage `json:"inline"`
+}
+
 func PullRequestCommentsPage(
 	qc QueryContext,
 	logger hclog.Logger,
@@ -25,23 +44,7 @@ func PullRequestCommentsPage(
 
 	objectPath := pstrings.JoinURL("repositories", repo.NameWithOwner, "pullrequests", pr.RefID, "comments")
 
-	var rcomments []struct {
-		ID    int64 `json:"id"`
-		Links struct {
-			HTML struct {
-				Href string `json:"href"`
-			} `json:"html"`
-		} `json:"links"`
-		UpdatedOn time.Time `json:"updated_on"`
-		CreatedOn time.Time `json:"created_on"`
-		Content   struct {
-			Raw string `json:"raw"`
-		} `json:"content"`
-		User struct {
-			AccountID string `json:"account_id"`
-		} `json:"user"`
-		Inline json.RawMessage `json:"inline"`
-	}
+	var rcomments []pullRequestCommentResponse
 
 	np, err = qc.Request(objectPath, params, true, &rcomments, nextPage)
 	if err != nil {
@@ -53,19 +56,54 @@ func PullRequestCommentsPage(
 		if len(rcomment.Inline) > 0 {
 			continue
 		}
-		item := &sourcecode.PullRequestComment{}
-		item.CustomerID = qc.CustomerID
-		item.RefType = qc.RefType
-		item.RefID = strconv.FormatInt(rcomment.ID, 10)
-		item.URL = rcomment.Links.HTML.Href
-		date.ConvertToModel(rcomment.UpdatedOn, &item.UpdatedDate)
-		item.RepoID = qc.IDs.CodeRepo(repo.RefID)
-		item.PullRequestID = qc.IDs.CodePullRequest(item.RepoID, pr.RefID)
-		item.Body = rcomment.Content.Raw
-		date.ConvertToModel(rcomment.CreatedOn, &item.CreatedDate)
-		item.UserRefID = rcomment.User.AccountID
-		res = append(res, item)
+		res = append(res, convertPullRequestComment(qc, repo, pr, rcomment))
 	}
 
 	return
 }
+
+// PullRequestComment returns a single pull request comment by id. Returns nil for inline (review) comments, since those are not exported.
+func PullRequestComment(
+	qc QueryContext,
+	logger hclog.Logger,
+	repo commonrepo.Repo,
+	pr sourcecode.PullRequest,
+	commentID string) (res *sourcecode.PullRequestComment, rerr error) {
+
+	logger.Debug("pr comment", "comment_id", commentID)
+
+	objectPath := pstrings.JoinURL("repositories", repo.NameWithOwner, "pullrequests", pr.RefID, "comments", commentID)
+
+	var rcomment pullRequestCommentResponse
+
+	_, err := qc.Request(objectPath, nil, false, &rcomment, "")
+	if err != nil {
+		rerr = err
+		return
+	}
+	// requester returns nil error for 404
+	if rcomment.ID == 0 {
+		rerr = fmt.Errorf("pull request comment not found, repo: %v pr_id: %v comment_id: %v", repo.NameWithOwner, pr.RefID, commentID)
+		return
+	}
+	if len(rcomment.Inline) > 0 && string(rcomment.Inline) != "null" {
+		return
+	}
+
+	return convertPullRequestComment(qc, repo, pr, rcomment), nil
+}
+
+func convertPullRequestComment(qc QueryContext, repo commonrepo.Repo, pr sourcecode.PullRequest, rcomment pullRequestCommentResponse) *sourcecode.PullRequestComment {
+	item := &sourcecode.PullRequestComment{}
+	item.CustomerID = qc.CustomerID
+	item.RefType = qc.RefType
+	item.RefID = strconv.FormatInt(rcomment.ID, 10)
+	item.URL = rcomment.Links.HTML.Href
+	date.ConvertToModel(rcomment.UpdatedOn, &item.UpdatedDate)
+	item.RepoID = qc.IDs.CodeRepo(repo.RefID)
+	item.PullRequestID = qc.IDs.CodePullRequest(item.RepoID, pr.RefID)
+	item.Body = rcomment.Content.Raw
+	date.ConvertToModel(rcomment.CreatedOn, &item.CreatedDate)
+	item.UserRefID = rcomment.User.AccountID
+	return item
+}
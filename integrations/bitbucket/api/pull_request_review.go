@@ -0,0 +1,152 @@
+package api
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/integrations/pkg/commonrepo"
+	"github.com/pinpt/agent/pkg/date"
+	"github.com/pinpt/go-common/hash"
+	pstrings "github.com/pinpt/go-common/strings"
+	"github.com/pinpt/integration-sdk/sourcecode"
+)
+
+type pullRequestParticipantResponse struct {
+	Role     string `json:"role"`
+	Approved bool   `json:"approved"`
+	// State is approved, changes_requested or empty
+	State          string    `json:"state"`
+	ParticipatedOn time.Time `json:"participated_on"`
+	User           struct {
+		AccountID string `json:"account_id"`
+	} `json:"user"`
+}
+
+type pullRequestActivityUser struct {
+	AccountID string `json:"account_id"`
+}
+
+// pullRequestActivityResponse contains one of update, approval or changes_request, comments are not used
+type pullRequestActivityResponse struct {
+	Update struct {
+		Date      time.Time                 `json:"date"`
+		Reviewers []pullRequestActivityUser `json:"reviewers"`
+	} `json:"update"`
+	Approval struct {
+		Date time.Time               `json:"date"`
+		User pullRequestActivityUser `json:"user"`
+	} `json:"approval"`
+	ChangesRequest struct {
+		Date time.Time               `json:"date"`
+		User pullRequestActivityUser `json:"user"`
+	} `json:"changes_request"`
+}
+
+// PullRequestReviews returns reviews of the pull request. Approvals and change requests are taken from activity, since it contains timestamps. Reviewer assignments and comments from participants.
+func PullRequestReviews(
+	qc QueryContext,
+	logger hclog.Logger,
+	repo commonrepo.Repo,
+	pr sourcecode.PullRequest) (res []*sourcecode.PullRequestReview, rerr error) {
+
+	logger.Debug("pr reviews")
+
+	objectPath := pstrings.JoinURL("repositories", repo.NameWithOwner, "pullrequests", pr.RefID)
+
+	var rpr struct {
+		Participants []pullRequestParticipantResponse `json:"participants"`
+	}
+
+	_, err := qc.Request(objectPath, nil, false, &rpr, "")
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	params := url.Values{}
+	params.Set("pagelen", "50")
+
+	var activities []pullRequestActivityResponse
+
+	rerr = Paginate(func(nextPage NextPage) (NextPage, error) {
+		var page []pullRequestActivityResponse
+		np, err := qc.Request(pstrings.JoinURL(objectPath, "activity"), params, true, &page, nextPage)
+		if err != nil {
+			return np, err
+		}
+		activities = append(activities, page...)
+		return np, nil
+	})
+	if rerr != nil {
+		return
+	}
+
+	return convertPullRequestReviews(qc, pr, rpr.Participants, activities), nil
+}
+
+func convertPullRequestReviews(qc QueryContext, pr sourcecode.PullRequest, participants []pullRequestParticipantResponse, activities []pullRequestActivityResponse) (res []*sourcecode.PullRequestReview) {
+	pullRequestID := qc.IDs.CodePullRequest(pr.RepoID, pr.RefID)
+
+	add := func(refID string, userRefID string, state sourcecode.PullRequestReviewState, ts time.Time) {
+		review := &sourcecode.PullRequestReview{}
+		review.CustomerID = qc.CustomerID
+		review.RefType = qc.RefType
+		review.RefID = refID
+		review.RepoID = pr.RepoID
+		review.PullRequestID = pullRequestID
+		review.UserRefID = userRefID
+		review.State = state
+		date.ConvertToModel(ts, &review.CreatedDate)
+		res = append(res, review)
+	}
+
+	approved := map[string]bool{}
+	changesRequested := map[string]bool{}
+	// assigned contains the first update which included the user as reviewer
+	assigned := map[string]time.Time{}
+
+	// activity is returned newest first
+	for _, a := range activities {
+		switch {
+		case !a.Approval.Date.IsZero():
+			user := a.Approval.User.AccountID
+			approved[user] = true
+			add(hash.Values(pr.RefID, user, "approval", a.Approval.Date.UnixNano()), user, sourcecode.PullRequestReviewStateApproved, a.Approval.Date)
+		case !a.ChangesRequest.Date.IsZero():
+			user := a.ChangesRequest.User.AccountID
+			changesRequested[user] = true
+			add(hash.Values(pr.RefID, user, "changes_request", a.ChangesRequest.Date.UnixNano()), user, sourcecode.PullRequestReviewStateChangesRequested, a.ChangesRequest.Date)
+		case !a.Update.Date.IsZero():
+			for _, reviewer := range a.Update.Reviewers {
+				assigned[reviewer.AccountID] = a.Update.Date
+			}
+		}
+	}
+
+	for _, p := range participants {
+		user := p.User.AccountID
+		if p.Role == "REVIEWER" {
+			ts, ok := assigned[user]
+			if !ok {
+				ts = p.ParticipatedOn
+			}
+			add(hash.Values(pr.RefID, user, "requested"), user, sourcecode.PullRequestReviewStateRequested, ts)
+		}
+		// fallback to participant state in case activity is not available
+		switch {
+		case p.Approved || p.State == "approved":
+			if !approved[user] {
+				add(hash.Values(pr.RefID, user), user, sourcecode.PullRequestReviewStateApproved, p.ParticipatedOn)
+			}
+		case p.State == "changes_requested":
+			if !changesRequested[user] {
+				add(hash.Values(pr.RefID, user), user, sourcecode.PullRequestReviewStateChangesRequested, p.ParticipatedOn)
+			}
+		case p.Role == "PARTICIPANT":
+			add(hash.Values(pr.RefID, user), user, sourcecode.PullRequestReviewStateCommented, p.ParticipatedOn)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pinpt/agent/pkg/ids2"
+	"github.com/pinpt/integration-sdk/sourcecode"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertPullRequestReviews(t *testing.T) {
+	assert := assert.New(t)
+
+	qc := QueryContext{}
+	qc.CustomerID = "c1"
+	qc.RefType = "bitbucket"
+	qc.IDs = ids2.New("c1", "bitbucket")
+
+	pr := sourcecode.PullRequest{RefID: "1", RepoID: "r1"}
+
+	ts := func(min int) time.Time {
+		return time.Date(2020, 5, 25, 9, min, 0, 0, time.UTC)
+	}
+	epoch := func(min int) int64 {
+		return ts(min).UnixNano() / int64(time.Millisecond)
+	}
+	user := func(id string) pullRequestActivityUser {
+		return pullRequestActivityUser{AccountID: id}
+	}
+
+	var participants []pullRequestParticipantResponse
+	{
+		p := pullRequestParticipantResponse{Role: "REVIEWER", Approved: true, State: "approved", ParticipatedOn: ts(30)}
+		p.User.AccountID = "u1"
+		participants = append(participants, p)
+	}
+	{
+		p := pullRequestParticipantResponse{Role: "REVIEWER", State: "changes_requested", ParticipatedOn: ts(20)}
+		p.User.AccountID = "u2"
+		participants = append(participants, p)
+	}
+	{
+		p := pullRequestParticipantResponse{Role: "PARTICIPANT", ParticipatedOn: ts(15)}
+		p.User.AccountID = "u3"
+		participants = append(participants, p)
+	}
+
+	// newest first
+	var activities []pullRequestActivityResponse
+	{
+		a := pullRequestActivityResponse{}
+		a.Approval.Date = ts(30)
+		a.Approval.User = user("u1")
+		activities = append(activities, a)
+	}
+	{
+		a := pullRequestActivityResponse{}
+		a.Update.Date = ts(10)
+		a.Update.Reviewers = []pullRequestActivityUser{user("u1"), user("u2")}
+		activities = append(activities, a)
+	}
+	{
+		a := pullRequestActivityResponse{}
+		a.Update.Date = ts(0)
+		a.Update.Reviewers = []pullRequestActivityUser{user("u1")}
+		activities = append(activities, a)
+	}
+
+	got := convertPullRequestReviews(qc, pr, participants, activities)
+
+	type review struct {
+		User  string
+		State sourcecode.PullRequestReviewState
+		Date  int64
+	}
+	var reviews []review
+	for _, r := range got {
+		assert.Equal(qc.IDs.CodePullRequest("r1", "1"), r.PullRequestID)
+		reviews = append(reviews, review{r.UserRefID, r.State, r.CreatedDate.Epoch})
+	}
+
+	want := []review{
+		{"u1", sourcecode.PullRequestReviewStateApproved, epoch(30)},
+		{"u1", sourcecode.PullRequestReviewStateRequested, epoch(0)},
+		{"u2", sourcecode.PullRequestReviewStateRequested, epoch(10)},
+		// changes request not found in activity, using participant state
+		{"u2", sourcecode.PullRequestReviewStateChangesRequested, epoch(20)},
+		{"u3", sourcecode.PullRequestReviewStateCommented, epoch(15)},
+	}
+	assert.Equal(want, reviews)
+}
@@ -70,6 +70,21 @@ func ReposAll(qc interface{}, res chan []commonrepo.Repo) error {
 	})
 }
 
+// FirstRepo returns the name of the first repo the user is a member of, empty if there are no repos. Used to validate git clone access.
+func FirstRepo(qc QueryContext) (nameWithOwner string, rerr error) {
+	params := url.Values{}
+	params.Set("pagelen", "1")
+	_, repos, err := ReposPage(qc, params, "")
+	if err != nil {
+		rerr = err
+		return
+	}
+	if len(repos) == 0 {
+		return
+	}
+	return repos[0].NameWithOwner, nil
+}
+
 func ReposPage(
 	qc QueryContext,
 	params url.Values,
@@ -6,11 +6,13 @@ import (
 	"net/http"
 	"net/url"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/pinpt/agent/pkg/oauthtoken"
+	"github.com/pinpt/agent/pkg/requests"
 	"github.com/pinpt/agent/rpcdef"
 	pstrings "github.com/pinpt/go-common/strings"
 )
@@ -24,6 +26,10 @@ type RequesterOpts struct {
 	OAuth      *oauthtoken.Manager
 	Agent      rpcdef.Agent
 	HTTPClient *http.Client
+
+	// AccessToken is a Bitbucket Server HTTP access token, used instead of Username and Password if set
+	AccessToken string
+	ServerType  ServerType
 }
 
 type internalRequest struct {
@@ -51,6 +57,8 @@ type Requester struct {
 func (s *Requester) setAuth(req *http.Request) {
 	if s.opts.UseOAuth {
 		req.Header.Set("Authorization", "Bearer "+s.opts.OAuth.Get())
+	} else if s.opts.AccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.opts.AccessToken)
 	} else {
 		req.SetBasicAuth(s.opts.Username, s.opts.Password)
 	}
@@ -71,6 +79,36 @@ func (e *Requester) Request(url string, params url.Values, pageable bool, respon
 
 }
 
+// RequestJSON makes a request with any http method and optional json body. Used for writes, such as webhook registration.
+func (e *Requester) RequestJSON(method string, url string, params url.Values, body interface{}, response interface{}) error {
+	req := requests.NewRequest()
+	req.Method = method
+	req.URL = pstrings.JoinURL(e.opts.APIURL, url)
+	for k, v := range params {
+		req.Query[k] = v
+	}
+	if e.opts.UseOAuth {
+		req.Header.Set("Authorization", "Bearer "+e.opts.OAuth.Get())
+	} else if e.opts.AccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+e.opts.AccessToken)
+	} else {
+		req.BasicAuthUser = e.opts.Username
+		req.BasicAuthPassword = e.opts.Password
+	}
+
+	if body != nil {
+		var err error
+		req.Body, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	reqs := requests.New(e.logger, e.httpClient)
+	_, err := reqs.JSON(req, response)
+	return err
+}
+
 const maxGeneralRetries = 2
 
 func (e *Requester) makeRequestRetry(req *internalRequest, generalRetry int) (nextPage NextPage, err error) {
@@ -94,6 +132,12 @@ func (e *Requester) request(r *internalRequest, retryThrottled int) (isErrorRetr
 
 	if r.NextPage != "" {
 		u = string(r.NextPage)
+	} else if r.Pageable && e.opts.ServerType == SERVER {
+		// server does not support fields parameter
+		u = pstrings.JoinURL(e.opts.APIURL, r.URL)
+		if len(r.Params) != 0 {
+			u += "?" + r.Params.Encode()
+		}
 	} else if r.Pageable {
 		u = pstrings.JoinURL(e.opts.APIURL, r.URL)
 		tags := getJsonTags(r.Response)
@@ -154,7 +198,25 @@ func (e *Requester) request(r *internalRequest, retryThrottled int) (isErrorRetr
 		return true, np, fmt.Errorf(`bitbucket returned invalid status code: %v`, resp.StatusCode)
 	}
 
-	if r.Pageable {
+	if r.Pageable && e.opts.ServerType == SERVER {
+		var response ServerResponse
+
+		if err = json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			return
+		}
+
+		if err = json.Unmarshal(response.Values, &r.Response); err != nil {
+			return
+		}
+
+		if !response.IsLastPage {
+			np, err = serverNextPage(u, response.NextPageStart)
+			if err != nil {
+				return
+			}
+		}
+
+	} else if r.Pageable {
 		var response Response
 
 		if err = json.NewDecoder(resp.Body).Decode(&response); err != nil {
@@ -183,6 +245,29 @@ type Response struct {
 	Values  json.RawMessage `json:"values"`
 }
 
+// ServerResponse is the paged response format of Bitbucket Server
+// https://docs.atlassian.com/bitbucket-server/rest/7.0.1/bitbucket-rest.html#paging-params
+type ServerResponse struct {
+	Size          int64           `json:"size"`
+	Limit         int64           `json:"limit"`
+	IsLastPage    bool            `json:"isLastPage"`
+	Start         int64           `json:"start"`
+	NextPageStart int64           `json:"nextPageStart"`
+	Values        json.RawMessage `json:"values"`
+}
+
+// serverNextPage returns the url of the next page, server does not return it, only the start offset
+func serverNextPage(current string, nextPageStart int64) (NextPage, error) {
+	u, err := url.Parse(current)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("start", strconv.FormatInt(nextPageStart, 10))
+	u.RawQuery = q.Encode()
+	return NextPage(u.String()), nil
+}
+
 func getJsonTags(i interface{}) string {
 	typ := reflect.TypeOf(i)
 	tags := getJsonTagsFromType(typ)
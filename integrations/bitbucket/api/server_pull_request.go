@@ -0,0 +1,391 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/integrations/pkg/commonpr"
+	"github.com/pinpt/agent/integrations/pkg/commonrepo"
+	"github.com/pinpt/agent/integrations/pkg/objsender"
+	"github.com/pinpt/agent/pkg/date"
+	"github.com/pinpt/agent/pkg/ids"
+	"github.com/pinpt/go-common/hash"
+	pstrings "github.com/pinpt/go-common/strings"
+	"github.com/pinpt/integration-sdk/sourcecode"
+)
+
+type serverPullRequestResponse struct {
+	ID          int64  `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	State       string `json:"state"`
+	CreatedDate int64  `json:"createdDate"`
+	UpdatedDate int64  `json:"updatedDate"`
+	ClosedDate  int64  `json:"closedDate"`
+	FromRef     struct {
+		DisplayID string `json:"displayId"`
+	} `json:"fromRef"`
+	Author struct {
+		User serverUser `json:"user"`
+	} `json:"author"`
+	Reviewers []struct {
+		User   serverUser `json:"user"`
+		Status string     `json:"status"`
+	} `json:"reviewers"`
+	Links struct {
+		Self []serverLink `json:"self"`
+	} `json:"links"`
+}
+
+type serverComment struct {
+	ID          int64           `json:"id"`
+	Text        string          `json:"text"`
+	Author      serverUser      `json:"author"`
+	CreatedDate int64           `json:"createdDate"`
+	UpdatedDate int64           `json:"updatedDate"`
+	Comments    []serverComment `json:"comments"`
+}
+
+type serverActivity struct {
+	ID            int64          `json:"id"`
+	CreatedDate   int64          `json:"createdDate"`
+	User          serverUser     `json:"user"`
+	Action        string         `json:"action"`
+	CommentAction string         `json:"commentAction"`
+	Comment       *serverComment `json:"comment"`
+	// CommentAnchor is set for inline comments on diff
+	CommentAnchor *struct {
+		Path string `json:"path"`
+	} `json:"commentAnchor"`
+	Commit *struct {
+		ID string `json:"id"`
+	} `json:"commit"`
+	// AddedReviewers is set for UPDATED action
+	AddedReviewers []serverUser `json:"addedReviewers"`
+}
+
+// ServerPullRequestPage returns pull requests updated after stopOnUpdatedAt. Pull requests are returned ordered by updated date, newest first.
+// Activities of each pull request are used to get merge and decline information. Comments created from activities are sent to commentsSender.
+func ServerPullRequestPage(
+	qc QueryContext,
+	log hclog.Logger,
+	commentsSender objsender.SessionCommon,
+	repo commonrepo.Repo,
+	params url.Values,
+	stopOnUpdatedAt time.Time,
+	nextPage NextPage) (np NextPage, res []sourcecode.PullRequest, err error) {
+
+	log.Debug("server repo prs", "inc_date", stopOnUpdatedAt, "params", params, "next_page", nextPage)
+
+	repoPath, err := serverRepoPath(repo.NameWithOwner)
+	if err != nil {
+		return
+	}
+
+	params.Set("limit", "50")
+	params.Set("state", "ALL")
+	params.Set("order", "NEWEST")
+
+	var rprs []serverPullRequestResponse
+
+	np, err = qc.Request(pstrings.JoinURL(repoPath, "pull-requests"), params, true, &rprs, nextPage)
+	if err != nil {
+		return
+	}
+
+	for _, rpr := range rprs {
+		if serverTime(rpr.UpdatedDate).Before(stopOnUpdatedAt) {
+			np = ""
+			return
+		}
+		var activities []serverActivity
+		activities, err = serverPullRequestActivities(qc, repoPath, rpr.ID)
+		if err != nil {
+			return
+		}
+		pr := convertServerPullRequest(qc, repo, rpr, activities)
+		for _, comment := range serverPullRequestComments(qc, pr, activities) {
+			if err = commentsSender.Send(comment); err != nil {
+				return
+			}
+		}
+		res = append(res, pr)
+	}
+
+	return
+}
+
+// serverPullRequestActivities returns all activities of the pull request, newest first
+func serverPullRequestActivities(qc QueryContext, repoPath string, prID int64) (res []serverActivity, rerr error) {
+	objectPath := pstrings.JoinURL(repoPath, "pull-requests", strconv.FormatInt(prID, 10), "activities")
+
+	params := url.Values{}
+	params.Set("limit", "100")
+
+	rerr = Paginate(func(nextPage NextPage) (NextPage, error) {
+		var page []serverActivity
+		np, err := qc.Request(objectPath, params, true, &page, nextPage)
+		if err != nil {
+			return np, err
+		}
+		res = append(res, page...)
+		return np, nil
+	})
+	return
+}
+
+func convertServerPullRequest(qc QueryContext, repo commonrepo.Repo, rpr serverPullRequestResponse, activities []serverActivity) (pr sourcecode.PullRequest) {
+	pr.CustomerID = qc.CustomerID
+	pr.RefType = qc.RefType
+	pr.RefID = strconv.FormatInt(rpr.ID, 10)
+	pr.RepoID = qc.IDs.CodeRepo(repo.RefID)
+	pr.BranchName = rpr.FromRef.DisplayID
+	pr.Title = rpr.Title
+	pr.Description = commonpr.ConvertMarkdownToHTML(rpr.Description)
+	if len(rpr.Links.Self) != 0 {
+		pr.URL = rpr.Links.Self[0].Href
+	}
+	pr.Identifier = fmt.Sprintf("#%d", rpr.ID)
+	pr.CreatedByRefID = rpr.Author.User.RefID()
+	date.ConvertToModel(serverTime(rpr.CreatedDate), &pr.CreatedDate)
+	date.ConvertToModel(serverTime(rpr.UpdatedDate), &pr.UpdatedDate)
+	date.ConvertToModel(serverTime(rpr.ClosedDate), &pr.MergedDate)
+	date.ConvertToModel(serverTime(rpr.ClosedDate), &pr.ClosedDate)
+
+	// activities are newest first, use the latest merge or decline in case pr was reopened
+	lastActivity := func(action string) *serverActivity {
+		for i := range activities {
+			if activities[i].Action == action {
+				return &activities[i]
+			}
+		}
+		return nil
+	}
+
+	switch rpr.State {
+	case "OPEN":
+		pr.Status = sourcecode.PullRequestStatusOpen
+	case "DECLINED":
+		pr.Status = sourcecode.PullRequestStatusClosed
+		if a := lastActivity("DECLINED"); a != nil {
+			pr.ClosedByRefID = a.User.RefID()
+		}
+	case "MERGED":
+		pr.Status = sourcecode.PullRequestStatusMerged
+		if a := lastActivity("MERGED"); a != nil {
+			pr.MergedByRefID = a.User.RefID()
+			if a.Commit != nil {
+				pr.MergeSha = a.Commit.ID
+				pr.MergeCommitID = ids.CodeCommit(qc.CustomerID, qc.RefType, pr.RepoID, a.Commit.ID)
+			}
+		}
+	default:
+		qc.Logger.Error("PR has an unknown state", "state", rpr.State, "ref_id", pr.RefID)
+	}
+
+	return
+}
+
+// ServerPullRequestReviews returns reviews of the pull request created from activities
+func ServerPullRequestReviews(
+	qc QueryContext,
+	logger hclog.Logger,
+	repo commonrepo.Repo,
+	pr sourcecode.PullRequest) (res []*sourcecode.PullRequestReview, rerr error) {
+
+	logger.Debug("server pr reviews")
+
+	repoPath, err := serverRepoPath(repo.NameWithOwner)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	var rpr serverPullRequestResponse
+
+	_, err = qc.Request(pstrings.JoinURL(repoPath, "pull-requests", pr.RefID), nil, false, &rpr, "")
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	prID, err := strconv.ParseInt(pr.RefID, 10, 64)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	activities, err := serverPullRequestActivities(qc, repoPath, prID)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	return serverPullRequestReviews(qc, pr, rpr, activities), nil
+}
+
+// serverPullRequestReviews converts approvals, needs work and inline comments to reviews. Current reviewers are returned as requested, using the time they were added.
+func serverPullRequestReviews(qc QueryContext, pr sourcecode.PullRequest, rpr serverPullRequestResponse, activities []serverActivity) (res []*sourcecode.PullRequestReview) {
+	pullRequestID := qc.IDs.CodePullRequest(pr.RepoID, pr.RefID)
+
+	newReview := func(refID string, userRefID string, ts time.Time) *sourcecode.PullRequestReview {
+		review := &sourcecode.PullRequestReview{}
+		review.CustomerID = qc.CustomerID
+		review.RefType = qc.RefType
+		review.RefID = refID
+		review.RepoID = pr.RepoID
+		review.PullRequestID = pullRequestID
+		review.UserRefID = userRefID
+		date.ConvertToModel(ts, &review.CreatedDate)
+		return review
+	}
+
+	// assigned contains the first update which added the user as reviewer
+	assigned := map[string]time.Time{}
+
+	for _, a := range activities {
+		var state sourcecode.PullRequestReviewState
+		switch a.Action {
+		case "APPROVED":
+			state = sourcecode.PullRequestReviewStateApproved
+		case "REVIEWED":
+			// needs work
+			state = sourcecode.PullRequestReviewStateChangesRequested
+		case "UNAPPROVED":
+			state = sourcecode.PullRequestReviewStateDismissed
+		case "UPDATED":
+			for _, reviewer := range a.AddedReviewers {
+				assigned[reviewer.RefID()] = serverTime(a.CreatedDate)
+			}
+			continue
+		case "COMMENTED":
+			if a.CommentAnchor == nil || a.CommentAction != "ADDED" {
+				continue
+			}
+			state = sourcecode.PullRequestReviewStateCommented
+		default:
+			continue
+		}
+		userRefID := a.User.RefID()
+		review := newReview(strconv.FormatInt(a.ID, 10), userRefID, serverTime(a.CreatedDate))
+		review.State = state
+		res = append(res, review)
+	}
+
+	for _, reviewer := range rpr.Reviewers {
+		userRefID := reviewer.User.RefID()
+		ts, ok := assigned[userRefID]
+		if !ok {
+			// added when pull request was created
+			ts = serverTime(rpr.CreatedDate)
+		}
+		review := newReview(hash.Values(pr.RefID, userRefID, "requested"), userRefID, ts)
+		review.State = sourcecode.PullRequestReviewStateRequested
+		res = append(res, review)
+	}
+
+	return
+}
+
+// serverPullRequestComments returns general pull request comments including replies. Inline comments are exported as reviews.
+func serverPullRequestComments(qc QueryContext, pr sourcecode.PullRequest, activities []serverActivity) (res []*sourcecode.PullRequestComment) {
+	pullRequestID := qc.IDs.CodePullRequest(pr.RepoID, pr.RefID)
+
+	var add func(c serverComment)
+	add = func(c serverComment) {
+		item := &sourcecode.PullRequestComment{}
+		item.CustomerID = qc.CustomerID
+		item.RefType = qc.RefType
+		item.RefID = strconv.FormatInt(c.ID, 10)
+		if pr.URL != "" {
+			item.URL = pr.URL + "?commentId=" + item.RefID
+		}
+		item.RepoID = pr.RepoID
+		item.PullRequestID = pullRequestID
+		item.Body = c.Text
+		item.UserRefID = c.Author.RefID()
+		date.ConvertToModel(serverTime(c.CreatedDate), &item.CreatedDate)
+		date.ConvertToModel(serverTime(c.UpdatedDate), &item.UpdatedDate)
+		res = append(res, item)
+		for _, reply := range c.Comments {
+			add(reply)
+		}
+	}
+
+	for _, a := range activities {
+		// comment in ADDED activity contains current text and all replies
+		if a.Action != "COMMENTED" || a.CommentAction != "ADDED" || a.CommentAnchor != nil || a.Comment == nil {
+			continue
+		}
+		add(*a.Comment)
+	}
+
+	return
+}
+
+// ServerPullRequestCommitsPage returns pull request commits, newest first
+func ServerPullRequestCommitsPage(
+	qc QueryContext,
+	logger hclog.Logger,
+	repo commonrepo.Repo,
+	pr sourcecode.PullRequest,
+	params url.Values,
+	stopOnUpdatedAt time.Time,
+	nextPage NextPage) (np NextPage, res []*sourcecode.PullRequestCommit, err error) {
+
+	logger.Debug("server pr commits", "inc_date", stopOnUpdatedAt, "params", params, "next_page", nextPage)
+
+	repoPath, err := serverRepoPath(repo.NameWithOwner)
+	if err != nil {
+		return
+	}
+
+	repoURL, err := ServerRepoWebURL(qc.BaseURL, repo.NameWithOwner)
+	if err != nil {
+		return
+	}
+
+	params.Set("limit", "100")
+
+	var rcommits []struct {
+		ID                 string     `json:"id"`
+		Message            string     `json:"message"`
+		Author             serverUser `json:"author"`
+		AuthorTimestamp    int64      `json:"authorTimestamp"`
+		Committer          serverUser `json:"committer"`
+		CommitterTimestamp int64      `json:"committerTimestamp"`
+	}
+
+	np, err = qc.Request(pstrings.JoinURL(repoPath, "pull-requests", pr.RefID, "commits"), params, true, &rcommits, nextPage)
+	if err != nil {
+		return
+	}
+
+	for _, rcommit := range rcommits {
+		createdAt := serverTime(rcommit.AuthorTimestamp)
+		if createdAt.Before(stopOnUpdatedAt) {
+			np = ""
+			return
+		}
+		item := &sourcecode.PullRequestCommit{}
+		item.CustomerID = qc.CustomerID
+		item.RefType = qc.RefType
+		item.RefID = rcommit.ID
+		item.RepoID = qc.IDs.CodeRepo(repo.RefID)
+		item.PullRequestID = qc.IDs.CodePullRequest(item.RepoID, pr.RefID)
+		item.Sha = rcommit.ID
+		item.Message = rcommit.Message
+		item.URL = pstrings.JoinURL(repoURL, "commits", rcommit.ID)
+		date.ConvertToModel(createdAt, &item.CreatedDate)
+
+		item.AuthorRefID = ids.CodeCommitEmail(qc.CustomerID, rcommit.Author.EmailAddress)
+		item.CommitterRefID = ids.CodeCommitEmail(qc.CustomerID, rcommit.Committer.EmailAddress)
+
+		res = append(res, item)
+	}
+
+	return
+}
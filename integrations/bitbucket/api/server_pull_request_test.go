@@ -0,0 +1,148 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/integrations/pkg/commonrepo"
+	"github.com/pinpt/agent/integrations/pkg/objsender"
+	"github.com/pinpt/agent/pkg/ids2"
+	"github.com/pinpt/integration-sdk/sourcecode"
+	"github.com/stretchr/testify/assert"
+)
+
+type testSender struct {
+	objs []objsender.Model
+}
+
+func (s *testSender) Send(obj objsender.Model) error {
+	s.objs = append(s.objs, obj)
+	return nil
+}
+
+func (s *testSender) Done() error {
+	return nil
+}
+
+func (s *testSender) SetTotal(v int) error {
+	return nil
+}
+
+const testServerPullRequest = `{"id":2,"title":"Fix build","description":"Fixes *build*","state":"MERGED","createdDate":1590397200000,"updatedDate":1590400800000,"closedDate":1590400800000,"fromRef":{"displayId":"fix-build"},"author":{"user":{"id":1,"name":"user1"}},"reviewers":[{"user":{"id":2},"status":"APPROVED"},{"user":{"id":3},"status":"UNAPPROVED"}],"links":{"self":[{"href":"https://bitbucket.example.com/projects/PROJ/repos/test/pull-requests/2"}]}}`
+
+var testServerResponses = map[string]string{
+	"/rest/api/1.0/projects/PROJ/repos/test/pull-requests/2?":                                      testServerPullRequest,
+	"/rest/api/1.0/projects/PROJ/repos/test/pull-requests?limit=50&order=NEWEST&state=ALL":         `{"size":1,"limit":1,"isLastPage":false,"start":0,"nextPageStart":1,"values":[` + testServerPullRequest + `]}`,
+	"/rest/api/1.0/projects/PROJ/repos/test/pull-requests?limit=50&order=NEWEST&start=1&state=ALL": `{"size":1,"limit":1,"isLastPage":true,"start":1,"values":[{"id":1,"title":"Old","state":"OPEN","createdDate":1577869200000,"updatedDate":1577869200000}]}`,
+	"/rest/api/1.0/projects/PROJ/repos/test/pull-requests/2/activities?limit=100": `{"size":6,"limit":100,"isLastPage":true,"start":0,"values":[
+		{"id":15,"createdDate":1590400800000,"user":{"id":1},"action":"MERGED","commit":{"id":"8d51122def5632836d1cb1026e879069e10a1e13"}},
+		{"id":14,"createdDate":1590400000000,"user":{"id":2},"action":"APPROVED"},
+		{"id":13,"createdDate":1590399000000,"user":{"id":2},"action":"COMMENTED","commentAction":"ADDED","comment":{"id":102,"text":"typo here","author":{"id":2},"createdDate":1590399000000,"updatedDate":1590399000000},"commentAnchor":{"path":"main.go"}},
+		{"id":12,"createdDate":1590398000000,"user":{"id":2},"action":"REVIEWED"},
+		{"id":11,"createdDate":1590397800000,"user":{"id":2},"action":"COMMENTED","commentAction":"ADDED","comment":{"id":101,"text":"why?","author":{"id":2},"createdDate":1590397800000,"updatedDate":1590397800000,"comments":[{"id":103,"text":"see issue","author":{"id":1},"createdDate":1590397900000,"updatedDate":1590397900000}]}},
+		{"id":10,"createdDate":1590397500000,"user":{"id":1},"action":"UPDATED","addedReviewers":[{"id":3}]}
+	]}`,
+}
+
+func TestServerPullRequestPage(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal("Bearer token1", req.Header.Get("Authorization"))
+		res, ok := testServerResponses[req.URL.Path+"?"+req.URL.RawQuery]
+		if !ok {
+			t.Errorf("unexpected request %v", req.URL.String())
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rw.Write([]byte(res))
+	}))
+	defer server.Close()
+
+	logger := hclog.New(&hclog.LoggerOptions{
+		Name: "test",
+	})
+
+	opts := RequesterOpts{}
+	opts.Logger = logger
+	opts.APIURL = server.URL + "/rest/api/1.0"
+	opts.AccessToken = "token1"
+	opts.ServerType = SERVER
+	opts.HTTPClient = server.Client()
+	requester := NewRequester(opts)
+
+	qc := QueryContext{}
+	qc.BaseURL = server.URL
+	qc.Logger = logger
+	qc.Request = requester.Request
+	qc.CustomerID = "c1"
+	qc.RefType = "bitbucket"
+	qc.IDs = ids2.New("c1", "bitbucket")
+	qc.ServerType = SERVER
+
+	repo := commonrepo.Repo{RefID: "1", NameWithOwner: "PROJ/test"}
+	comments := &testSender{}
+
+	// the second pr was updated before the last export and should stop pagination
+	stopOnUpdatedAt := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	var prs []sourcecode.PullRequest
+	params := url.Values{}
+	err := Paginate(func(nextPage NextPage) (NextPage, error) {
+		np, res, err := ServerPullRequestPage(qc, logger, comments, repo, params, stopOnUpdatedAt, nextPage)
+		prs = append(prs, res...)
+		return np, err
+	})
+	assert.NoError(err)
+
+	if !assert.Len(prs, 1) {
+		return
+	}
+	pr := prs[0]
+	assert.Equal("2", pr.RefID)
+	assert.Equal("#2", pr.Identifier)
+	assert.Equal("fix-build", pr.BranchName)
+	assert.Equal(sourcecode.PullRequestStatusMerged, pr.Status)
+	assert.Equal("1", pr.CreatedByRefID)
+	assert.Equal("1", pr.MergedByRefID)
+	assert.Equal("8d51122def5632836d1cb1026e879069e10a1e13", pr.MergeSha)
+
+	var commentIDs []string
+	for _, obj := range comments.objs {
+		comment := obj.(*sourcecode.PullRequestComment)
+		commentIDs = append(commentIDs, comment.RefID)
+	}
+	assert.Equal([]string{"101", "103"}, commentIDs)
+
+	reviews, err := ServerPullRequestReviews(qc, logger, repo, pr)
+	assert.NoError(err)
+
+	var reviewStates []sourcecode.PullRequestReviewState
+	var reviewUsers []string
+	var reviewDates []int64
+	for _, review := range reviews {
+		reviewStates = append(reviewStates, review.State)
+		reviewUsers = append(reviewUsers, review.UserRefID)
+		reviewDates = append(reviewDates, review.CreatedDate.Epoch)
+	}
+	assert.Equal([]sourcecode.PullRequestReviewState{
+		sourcecode.PullRequestReviewStateApproved,
+		sourcecode.PullRequestReviewStateCommented,
+		sourcecode.PullRequestReviewStateChangesRequested,
+		sourcecode.PullRequestReviewStateRequested,
+		sourcecode.PullRequestReviewStateRequested,
+	}, reviewStates)
+	assert.Equal([]string{"2", "2", "2", "2", "3"}, reviewUsers)
+	// reviewer added on creation and reviewer added later
+	assert.Equal([]int64{1590400000000, 1590399000000, 1590398000000, 1590397200000, 1590397500000}, reviewDates)
+}
+
+func TestServerNextPage(t *testing.T) {
+	got, err := serverNextPage("https://bitbucket.example.com/rest/api/1.0/repos?limit=100&start=100", 200)
+	assert.NoError(t, err)
+	assert.Equal(t, NextPage("https://bitbucket.example.com/rest/api/1.0/repos?limit=100&start=200"), got)
+}
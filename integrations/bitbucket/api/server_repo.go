@@ -0,0 +1,191 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pinpt/agent/integrations/pkg/commonrepo"
+	pstrings "github.com/pinpt/go-common/strings"
+	"github.com/pinpt/integration-sdk/agent"
+	"github.com/pinpt/integration-sdk/sourcecode"
+)
+
+type serverLink struct {
+	Href string `json:"href"`
+	Name string `json:"name"`
+}
+
+type serverRepoResponse struct {
+	ID          int64  `json:"id"`
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Project     struct {
+		Key string `json:"key"`
+	} `json:"project"`
+	Links struct {
+		Self []serverLink `json:"self"`
+	} `json:"links"`
+}
+
+func (s serverRepoResponse) fullName() string {
+	return s.Project.Key + "/" + s.Slug
+}
+
+func (s serverRepoResponse) url() string {
+	if len(s.Links.Self) == 0 {
+		return ""
+	}
+	return s.Links.Self[0].Href
+}
+
+// serverRepoPath returns api path of the repo. Repos use PROJECT_KEY/repo_slug as NameWithOwner in server mode.
+func serverRepoPath(nameWithOwner string) (string, error) {
+	parts := strings.Split(nameWithOwner, "/")
+	if len(parts) != 2 {
+		return "", fmt.Errorf("invalid repo name, expecting project_key/repo_slug, got: %v", nameWithOwner)
+	}
+	return pstrings.JoinURL("projects", parts[0], "repos", parts[1]), nil
+}
+
+func serverReposPage(qc QueryContext, params url.Values, nextPage NextPage) (np NextPage, res []serverRepoResponse, err error) {
+	qc.Logger.Debug("server repos", "params", params, "next_page", nextPage)
+
+	if params.Get("limit") == "" {
+		params.Set("limit", "100")
+	}
+	params.Set("permission", "REPO_READ")
+
+	np, err = qc.Request("repos", params, true, &res, nextPage)
+	return
+}
+
+// ServerFirstRepo returns the name of the first repo the user has read access to, empty if there are no repos. Used to validate git clone access.
+func ServerFirstRepo(qc QueryContext) (nameWithOwner string, rerr error) {
+	params := url.Values{}
+	params.Set("limit", "1")
+	_, rr, err := serverReposPage(qc, params, "")
+	if err != nil {
+		rerr = err
+		return
+	}
+	if len(rr) == 0 {
+		return
+	}
+	return rr[0].fullName(), nil
+}
+
+// ServerReposAll returns all repos the user has read access to in all projects, including personal projects
+func ServerReposAll(qc interface{}, res chan []commonrepo.Repo) error {
+	q := qc.(QueryContext)
+
+	params := url.Values{}
+
+	return Paginate(func(nextPage NextPage) (NextPage, error) {
+		np, rr, err := serverReposPage(q, params, nextPage)
+		if err != nil {
+			return np, err
+		}
+		var repos []commonrepo.Repo
+		for _, r := range rr {
+			repo := commonrepo.Repo{
+				RefID:         strconv.FormatInt(r.ID, 10),
+				NameWithOwner: r.fullName(),
+			}
+			repo.DefaultBranch, err = ServerRepoDefaultBranch(q, repo.NameWithOwner)
+			if err != nil {
+				return np, err
+			}
+			repos = append(repos, repo)
+		}
+		res <- repos
+		return np, nil
+	})
+}
+
+// ServerRepoDefaultBranch returns the name of default branch, empty if repo does not have any commits yet
+func ServerRepoDefaultBranch(qc QueryContext, nameWithOwner string) (_ string, rerr error) {
+	repoPath, err := serverRepoPath(nameWithOwner)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	var rb struct {
+		DisplayID string `json:"displayId"`
+	}
+
+	// requester returns nil error for 404, which is returned for empty repos
+	_, err = qc.Request(pstrings.JoinURL(repoPath, "branches/default"), nil, false, &rb, "")
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	return rb.DisplayID, nil
+}
+
+// ServerReposSourcecodePage returns repos as sourcecode.Repo. Server api does not return updated date for repos, so all repos are returned on every export.
+func ServerReposSourcecodePage(
+	qc QueryContext,
+	params url.Values,
+	nextPage NextPage) (np NextPage, repos []*sourcecode.Repo, err error) {
+
+	np, rr, err := serverReposPage(qc, params, nextPage)
+	if err != nil {
+		return
+	}
+
+	for _, r := range rr {
+		repo := &sourcecode.Repo{
+			RefID:       strconv.FormatInt(r.ID, 10),
+			RefType:     qc.RefType,
+			CustomerID:  qc.CustomerID,
+			Name:        r.fullName(),
+			URL:         r.url(),
+			Description: r.Description,
+			Active:      true,
+		}
+
+		repos = append(repos, repo)
+	}
+
+	return
+}
+
+// ServerReposUserHasAccessToPage it will fetch repos the user has access to
+func ServerReposUserHasAccessToPage(
+	qc QueryContext,
+	params url.Values,
+	nextPage NextPage) (np NextPage, repos []*agent.RepoResponseRepos, err error) {
+
+	np, rr, err := serverReposPage(qc, params, nextPage)
+	if err != nil {
+		return
+	}
+
+	for _, r := range rr {
+		repo := &agent.RepoResponseRepos{
+			Active:      true,
+			RefID:       strconv.FormatInt(r.ID, 10),
+			RefType:     qc.RefType,
+			Name:        r.fullName(),
+			Description: r.Description,
+		}
+
+		repos = append(repos, repo)
+	}
+
+	return
+}
+
+// ServerRepoWebURL returns the url of the repo in the web ui
+func ServerRepoWebURL(baseURL string, nameWithOwner string) (string, error) {
+	repoPath, err := serverRepoPath(nameWithOwner)
+	if err != nil {
+		return "", err
+	}
+	return pstrings.JoinURL(baseURL, repoPath), nil
+}
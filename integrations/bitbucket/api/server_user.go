@@ -0,0 +1,176 @@
+package api
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/pkg/commitusers"
+	pstrings "github.com/pinpt/go-common/strings"
+	"github.com/pinpt/integration-sdk/sourcecode"
+)
+
+type serverUser struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	Slug         string `json:"slug"`
+	EmailAddress string `json:"emailAddress"`
+	DisplayName  string `json:"displayName"`
+	Type         string `json:"type"`
+	Links        struct {
+		Self []serverLink `json:"self"`
+	} `json:"links"`
+}
+
+// RefID returns the id used for user references in server mode. Empty for commit authors not linked to server users.
+func (s serverUser) RefID() string {
+	if s.ID == 0 {
+		return ""
+	}
+	return strconv.FormatInt(s.ID, 10)
+}
+
+// serverTime converts milliseconds since epoch used in server api
+func serverTime(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+// ServerUsersSourcecodePage returns all users of the server. Requires the user to have at least LICENSED_USER permission.
+func ServerUsersSourcecodePage(
+	qc QueryContext,
+	params url.Values,
+	nextPage NextPage) (np NextPage, users []*sourcecode.User, err error) {
+
+	qc.Logger.Debug("server users request", "params", params, "next_page", nextPage)
+
+	params.Set("limit", "100")
+
+	var us []serverUser
+
+	np, err = qc.Request("users", params, true, &us, nextPage)
+	if err != nil {
+		return
+	}
+
+	for _, u := range us {
+		user := &sourcecode.User{
+			RefID:      u.RefID(),
+			RefType:    qc.RefType,
+			CustomerID: qc.CustomerID,
+			Name:       u.DisplayName,
+			Email:      pstrings.Pointer(u.EmailAddress),
+			Username:   pstrings.Pointer(u.Name),
+			Member:     true,
+			Type:       sourcecode.UserTypeHuman,
+		}
+		if u.Type == "SERVICE" {
+			user.Type = sourcecode.UserTypeBot
+		}
+		if len(u.Links.Self) != 0 {
+			user.URL = pstrings.Pointer(u.Links.Self[0].Href)
+		}
+		if qc.BaseURL != "" {
+			user.AvatarURL = pstrings.Pointer(pstrings.JoinURL(qc.BaseURL, "users", u.Slug, "avatar.png"))
+		}
+
+		users = append(users, user)
+	}
+
+	return
+}
+
+// ServerVersion returns the version of Bitbucket Server. Application properties are available for anonymous users, use ServerAreUserCredentialsValid to check credentials.
+func ServerVersion(qc QueryContext) (version string, rerr error) {
+
+	qc.Logger.Debug("server version")
+
+	var props struct {
+		Version string `json:"version"`
+	}
+
+	_, err := qc.Request("application-properties", nil, false, &props, "")
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	return props.Version, nil
+}
+
+// ServerAreUserCredentialsValid checks credentials using users endpoint, which is not available for anonymous users
+func ServerAreUserCredentialsValid(qc QueryContext) (rerr error) {
+
+	qc.Logger.Debug("server credentials validation")
+
+	params := url.Values{}
+	params.Set("limit", "1")
+
+	var us []serverUser
+
+	_, err := qc.Request("users", params, true, &us, "")
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	return
+}
+
+// ServerCommitUsersSourcecodePage returns commit authors on the default branch
+func ServerCommitUsersSourcecodePage(
+	qc QueryContext,
+	logger hclog.Logger,
+	repo string,
+	defaultBranch string,
+	params url.Values,
+	stopOnUpdatedAt time.Time,
+	nextPage NextPage) (np NextPage, users []commitusers.CommitUser, err error) {
+
+	logger.Debug("server commit users", "default_branch", defaultBranch, "inc_date", stopOnUpdatedAt, "params", params, "next", nextPage)
+
+	repoPath, err := serverRepoPath(repo)
+	if err != nil {
+		return
+	}
+
+	params.Set("limit", "100")
+	params.Set("until", defaultBranch)
+
+	var rcommits []struct {
+		Author          serverUser `json:"author"`
+		AuthorTimestamp int64      `json:"authorTimestamp"`
+	}
+
+	np, err = qc.Request(pstrings.JoinURL(repoPath, "commits"), params, true, &rcommits, nextPage)
+	if err != nil {
+		return
+	}
+
+	for _, c := range rcommits {
+		if serverTime(c.AuthorTimestamp).Before(stopOnUpdatedAt) {
+			np = ""
+			return
+		}
+		if c.Author.EmailAddress == "" {
+			continue
+		}
+
+		user := commitusers.CommitUser{}
+		user.CustomerID = qc.CustomerID
+		user.Name = c.Author.DisplayName
+		if user.Name == "" {
+			// author not linked to server user
+			user.Name = c.Author.Name
+		}
+		user.SourceID = c.Author.RefID()
+		user.Email = c.Author.EmailAddress
+
+		users = append(users, user)
+	}
+
+	return
+}
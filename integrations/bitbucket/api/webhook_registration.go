@@ -0,0 +1,164 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/pinpt/agent/integrations/pkg/commonrepo"
+	"github.com/pinpt/agent/pkg/requests"
+	pstrings "github.com/pinpt/go-common/strings"
+)
+
+// update this using current time, if the format of the url changes, or need a new url for some other reason
+const WebhookReplaceOlderThan = "2020-05-25T10:00:00Z"
+
+// WebhookCreateIfNotExists registers a repository hook for the passed events if it does not exist yet. Events use bitbucket event keys, for example pullrequest:created.
+// Existing hooks are matched using full url.
+// https://developer.atlassian.com/bitbucket/api/2/reference/resource/repositories/%7Bworkspace%7D/%7Brepo_slug%7D/hooks
+func WebhookCreateIfNotExists(qc QueryContext, repo commonrepo.Repo, webhookURL string, events []string, webhookReplaceOlderThan string) (rerr error) {
+	logger := qc.Logger.With("repo", repo.NameWithOwner, "events", events)
+
+	logger.Debug("checking if webhook registration is needed")
+
+	webhooks, noPermissions, err := WebhookList(qc, repo)
+	if err != nil {
+		rerr = err
+		return
+	}
+	if noPermissions {
+		rerr = errors.New("no permissions to list webhooks for repo, admin access is required")
+		return
+	}
+
+	webhookReplaceOlder, err := time.Parse(time.RFC3339, webhookReplaceOlderThan)
+	if err != nil {
+		rerr = fmt.Errorf("invalid webhookReplaceOlderThan constant format: %v", err)
+		return
+	}
+
+	_, err = url.Parse(webhookURL)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	var pinptWebHooks []webhook
+
+	for _, wh := range webhooks {
+		if wh.URL == webhookURL {
+			pinptWebHooks = append(pinptWebHooks, wh)
+		}
+	}
+
+	whCount := len(pinptWebHooks)
+
+	if whCount == 0 {
+		return webhookCreate(qc, repo, webhookURL, events)
+	} else if whCount > 1 {
+
+		sort.SliceStable(pinptWebHooks, func(i, j int) bool {
+			return pinptWebHooks[i].CreatedAt.Unix() > pinptWebHooks[j].CreatedAt.Unix()
+		})
+
+		for _, wh := range pinptWebHooks[1:] {
+			err := webhookRemove(qc, repo, wh.UUID)
+			if err != nil {
+				rerr = err
+				return
+			}
+		}
+	}
+
+	wh := pinptWebHooks[0]
+	var update bool
+	if wh.CreatedAt.Before(webhookReplaceOlder) {
+		logger.Info("recreating webhook, because the one we had before is older than", "deadline", webhookReplaceOlderThan)
+		update = true
+	}
+	if !wh.Active {
+		logger.Info("recreating webhook, because the one we had before is not active")
+		update = true
+	}
+	if !reflect.DeepEqual(pstrings.SortCopy(events), pstrings.SortCopy(wh.Events)) {
+		logger.Info("recreating webhook, because the one we had before had different settings")
+		update = true
+	}
+
+	if update {
+		err := webhookRemove(qc, repo, wh.UUID)
+		if err != nil {
+			rerr = err
+			return
+		}
+		err = webhookCreate(qc, repo, webhookURL, events)
+		if err != nil {
+			rerr = err
+			return
+		}
+	}
+
+	return
+}
+
+type webhook struct {
+	UUID      string    `json:"uuid"`
+	URL       string    `json:"url"`
+	Active    bool      `json:"active"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func WebhookList(qc QueryContext, repo commonrepo.Repo) (res []webhook, noPermissions bool, rerr error) {
+	var rhooks struct {
+		Values []webhook `json:"values"`
+	}
+
+	// bitbucket limits the number of hooks per repo, so all of them fit into one page
+	params := url.Values{}
+	params.Set("pagelen", "100")
+
+	err := qc.RequestJSON(http.MethodGet, pstrings.JoinURL("repositories", repo.NameWithOwner, "hooks"), params, nil, &rhooks)
+	if err != nil {
+		var e requests.StatusCodeError
+		if errors.As(err, &e) && (e.Got == http.StatusNotFound || e.Got == http.StatusForbidden) {
+			noPermissions = true
+			return
+		}
+		rerr = err
+		return
+	}
+
+	res = rhooks.Values
+	return
+}
+
+func webhookCreate(qc QueryContext, repo commonrepo.Repo, webhookURL string, events []string) (rerr error) {
+	qc.Logger.Info("registering webhook for repo", "repo", repo.NameWithOwner, "events", events)
+
+	data := map[string]interface{}{
+		"description": "pinpoint",
+		"url":         webhookURL,
+		"active":      true,
+		"events":      events,
+	}
+
+	var res interface{}
+	err := qc.RequestJSON(http.MethodPost, pstrings.JoinURL("repositories", repo.NameWithOwner, "hooks"), nil, data, &res)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	return nil
+}
+
+func webhookRemove(qc QueryContext, repo commonrepo.Repo, hookUUID string) error {
+	qc.Logger.Info("removing webhook", "repo", repo.NameWithOwner, "hook_uuid", hookUUID)
+
+	return qc.RequestJSON(http.MethodDelete, pstrings.JoinURL("repositories", repo.NameWithOwner, "hooks", url.PathEscape(hookUUID)), nil, nil, nil)
+}
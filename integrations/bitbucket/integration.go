@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	pjson "github.com/pinpt/go-common/json"
+	pstrings "github.com/pinpt/go-common/strings"
 
 	"github.com/pinpt/agent/cmd/cmdrunnorestarts/inconfig"
 	"github.com/pinpt/agent/integrations/pkg/objsender"
@@ -48,6 +49,11 @@ type Config struct {
 	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
 
 	Exclusions []string `json:"exclusions"`
+
+	// ServerType is cloud (default) for bitbucket.org or server for Bitbucket Server and Data Center
+	ServerType api.ServerType `json:"server_type"`
+	// AccessToken is Bitbucket Server HTTP access token, used instead of username and password
+	AccessToken string `json:"access_token"`
 }
 
 type Integration struct {
@@ -89,9 +95,39 @@ func (s *Integration) ValidateConfig(ctx context.Context, exportConfig rpcdef.Ex
 		return
 	}
 
-	res.ServerVersion = "cloud"
+	var repo string
+	if s.qc.IsServer() {
+		res.ServerVersion, err = api.ServerVersion(s.qc)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		err = api.ServerAreUserCredentialsValid(s.qc)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		repo, err = api.ServerFirstRepo(s.qc)
+	} else {
+		res.ServerVersion = "cloud"
+		err = api.AreUserCredentialsValid(s.qc)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		repo, err = api.FirstRepo(s.qc)
+	}
+	if err != nil {
+		rerr(err)
+		return
+	}
+	if repo == "" {
+		// no repos to check git clone access
+		return
+	}
 
-	err = api.AreUserCredentialsValid(s.qc)
+	// agent checks git clone access using this url
+	res.RepoURL, err = s.getRepoURL(repo)
 	if err != nil {
 		rerr(err)
 		return
@@ -132,6 +168,7 @@ func (s *Integration) initWithConfig(config rpcdef.ExportConfig) error {
 	s.qc.CustomerID = config.Pinpoint.CustomerID
 	s.qc.Logger = s.logger
 	s.qc.RefType = s.refType
+	s.qc.ServerType = s.config.ServerType
 	s.customerID = config.Pinpoint.CustomerID
 
 	if s.UseOAuth {
@@ -154,15 +191,21 @@ func (s *Integration) initWithConfig(config rpcdef.ExportConfig) error {
 		opts := api.RequesterOpts{}
 		opts.Logger = s.logger
 		opts.APIURL = s.config.URL + "/2.0"
+		if s.qc.IsServer() {
+			opts.APIURL = s.config.URL + "/rest/api/1.0"
+		}
 		opts.Username = s.config.Username
 		opts.Password = s.config.Password
 		opts.UseOAuth = s.UseOAuth
 		opts.OAuth = oauth
 		opts.Agent = s.agent
 		opts.HTTPClient = s.clientManager.Clients.TLSInsecure
+		opts.AccessToken = s.config.AccessToken
+		opts.ServerType = s.config.ServerType
 		requester := api.NewRequester(opts)
 
 		s.qc.Request = requester.Request
+		s.qc.RequestJSON = requester.RequestJSON
 		s.qc.IDs = ids2.New(s.customerID, s.refType)
 	}
 
@@ -179,8 +222,27 @@ func (s *Integration) setConfig(config rpcdef.ExportConfig) error {
 		return err
 	}
 
+	switch def.ServerType {
+	case "":
+		def.ServerType = api.CLOUD
+	case api.CLOUD, api.SERVER:
+	default:
+		return rerr("invalid server_type %v, expecting %v or %v", def.ServerType, api.CLOUD, api.SERVER)
+	}
+
 	s.UseOAuth = config.UseOAuth
-	if s.UseOAuth {
+	if def.ServerType == api.SERVER {
+		if s.UseOAuth {
+			return rerr("oauth is not supported for bitbucket server")
+		}
+		if def.URL == "" {
+			return rerr("url is missing")
+		}
+		def.URL = strings.TrimSuffix(def.URL, "/")
+		if def.AccessToken == "" && (def.Username == "" || def.Password == "") {
+			return rerr("access_token or username and password are required")
+		}
+	} else if s.UseOAuth {
 		def.URL = "https://api.bitbucket.org"
 	} else {
 		if def.URL == "" {
@@ -212,6 +274,9 @@ func (s *Integration) export(ctx context.Context) (exportResults []rpcdef.Export
 func (s *Integration) exportAllRepos(ctx context.Context) (_ []rpcdef.ExportProject, err error) {
 
 	repos, err := commonrepo.ReposAllSlice(func(res chan []commonrepo.Repo) error {
+		if s.qc.IsServer() {
+			return api.ServerReposAll(s.qc, res)
+		}
 		return api.ReposAll(s.qc, res)
 	})
 	if err != nil {
@@ -220,6 +285,12 @@ func (s *Integration) exportAllRepos(ctx context.Context) (_ []rpcdef.ExportProj
 
 	repos = commonrepo.Filter(s.logger, repos, s.config.FilterConfig)
 
+	if s.qc.IsServer() {
+		s.logger.Info("webhooks are not supported for bitbucket server, skipping registration")
+	} else if err := s.registerWebhooks(repos); err != nil {
+		s.logger.Info("could not register webhooks", "err", err)
+	}
+
 	if s.config.OnlyGit {
 		s.logger.Warn("only_ripsrc flag passed, skipping export of data from bitbucket api")
 		for _, repo := range repos {
@@ -231,7 +302,11 @@ func (s *Integration) exportAllRepos(ctx context.Context) (_ []rpcdef.ExportProj
 		return
 	}
 
-	if err := s.exportWorkspacesUsers(ctx, repos); err != nil {
+	if s.qc.IsServer() {
+		if err := s.exportServerUsers(ctx); err != nil {
+			return nil, err
+		}
+	} else if err := s.exportWorkspacesUsers(ctx, repos); err != nil {
 		return nil, err
 	}
 
@@ -356,7 +431,14 @@ func (s *Integration) exportRepos(ctx context.Context, logger hclog.Logger, send
 	stopOnUpdatedAt := sender.LastProcessedTime()
 
 	return api.Paginate(func(nextPage api.NextPage) (api.NextPage, error) {
-		np, repos, err := api.ReposSourcecodePage(s.qc, params, stopOnUpdatedAt, nextPage)
+		var np api.NextPage
+		var repos []*sourcecode.Repo
+		var err error
+		if s.qc.IsServer() {
+			np, repos, err = api.ServerReposSourcecodePage(s.qc, url.Values{}, nextPage)
+		} else {
+			np, repos, err = api.ReposSourcecodePage(s.qc, params, stopOnUpdatedAt, nextPage)
+		}
 		if err != nil {
 			return np, err
 		}
@@ -404,6 +486,35 @@ func (s *Integration) exportUsers(ctx context.Context, logger hclog.Logger, grou
 
 }
 
+func (s *Integration) exportServerUsers(ctx context.Context) error {
+
+	sender, err := objsender.Root(s.agent, sourcecode.UserModelName.String())
+	if err != nil {
+		return err
+	}
+
+	params := url.Values{}
+
+	err = api.Paginate(func(nextPage api.NextPage) (api.NextPage, error) {
+		np, users, err := api.ServerUsersSourcecodePage(s.qc, params, nextPage)
+		if err != nil {
+			return np, err
+		}
+		for _, user := range users {
+			if err := sender.Send(user); err != nil {
+				return np, err
+			}
+		}
+		return np, nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return sender.Done()
+}
+
 func (s *Integration) exportCommitUsersForRepo(ctx *repoprojects.ProjectCtx, repo commonrepo.Repo) (err error) {
 	usersSender, err := ctx.Session(commitusers.TableName)
 	if err != nil {
@@ -416,7 +527,11 @@ func (s *Integration) exportCommitUsersForRepo(ctx *repoprojects.ProjectCtx, rep
 	stopOnUpdatedAt := usersSender.LastProcessedTime()
 
 	return api.Paginate(func(nextPage api.NextPage) (api.NextPage, error) {
-		np, users, err := api.CommitUsersSourcecodePage(s.qc, ctx.Logger, repo.NameWithOwner, repo.DefaultBranch, params, stopOnUpdatedAt, nextPage)
+		pageFn := api.CommitUsersSourcecodePage
+		if s.qc.IsServer() {
+			pageFn = api.ServerCommitUsersSourcecodePage
+		}
+		np, users, err := pageFn(s.qc, ctx.Logger, repo.NameWithOwner, repo.DefaultBranch, params, stopOnUpdatedAt, nextPage)
 		if err != nil {
 			return np, err
 		}
@@ -436,6 +551,10 @@ func (s *Integration) exportCommitUsersForRepo(ctx *repoprojects.ProjectCtx, rep
 
 func (s *Integration) getRepoURL(nameWithOwner string) (string, error) {
 
+	if s.qc.IsServer() {
+		return s.getServerRepoURL(nameWithOwner)
+	}
+
 	var bbURL string
 	if strings.Contains(s.config.URL, "api.bitbucket.org") {
 		bbURL = strings.Replace(s.config.URL, "api.", "", -1)
@@ -456,6 +575,28 @@ func (s *Integration) getRepoURL(nameWithOwner string) (string, error) {
 	return u.String(), nil
 }
 
+// getServerRepoURL returns http clone url for bitbucket server, which uses /scm/project_key/repo_slug.git format
+func (s *Integration) getServerRepoURL(nameWithOwner string) (string, error) {
+	u, err := url.Parse(s.config.URL)
+	if err != nil {
+		return "", err
+	}
+	if s.config.AccessToken != "" {
+		// access tokens are passed as password, username is only checked for personal tokens
+		username := s.config.Username
+		if username == "" {
+			username = "x-token-auth"
+		}
+		u.User = url.UserPassword(username, s.config.AccessToken)
+	} else if s.config.Username != "" {
+		u.User = url.UserPassword(s.config.Username, s.config.Password)
+	} else {
+		return "", errors.New("no Username/Password or AccessToken passed to getServerRepoURL")
+	}
+	u.Path = pstrings.JoinURL(u.Path, "scm", strings.ToLower(nameWithOwner)+".git")
+	return u.String(), nil
+}
+
 func (s *Integration) exportGit(repo commonrepo.Repo, prs []rpcdef.GitRepoFetchPR) error {
 	repoURL, err := s.getRepoURL(repo.NameWithOwner)
 	if err != nil {
@@ -467,8 +608,17 @@ func (s *Integration) exportGit(repo commonrepo.Repo, prs []rpcdef.GitRepoFetchP
 	args.UniqueName = repo.NameWithOwner
 	args.RefType = s.refType
 	args.URL = repoURL
-	args.CommitURLTemplate = commiturl.CommitURLTemplate(repo, s.config.URL)
-	args.BranchURLTemplate = commiturl.BranchURLTemplate(repo, s.config.URL)
+	if s.qc.IsServer() {
+		repoWebURL, err := api.ServerRepoWebURL(s.config.URL, repo.NameWithOwner)
+		if err != nil {
+			return err
+		}
+		args.CommitURLTemplate = repoWebURL + "/commits/@@@sha@@@"
+		args.BranchURLTemplate = repoWebURL + "/browse?at=refs%2Fheads%2F@@@branch@@@"
+	} else {
+		args.CommitURLTemplate = commiturl.CommitURLTemplate(repo, s.config.URL)
+		args.BranchURLTemplate = commiturl.BranchURLTemplate(repo, s.config.URL)
+	}
 	args.PRs = prs
 	if err = s.agent.ExportGitRepo(args); err != nil {
 		return err
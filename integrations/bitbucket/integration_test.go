@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/integrations/pkg/testutil"
+	"github.com/pinpt/agent/rpcdef"
+	"github.com/stretchr/testify/assert"
+)
+
+func testValidateServer(t *testing.T, handler http.HandlerFunc) (serverURL string, _ rpcdef.ValidationResult) {
+	assert := assert.New(t)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	s := NewIntegration(hclog.New(&hclog.LoggerOptions{
+		Name: "test",
+	}))
+	assert.NoError(s.Init(&testutil.Agent{}))
+
+	config := rpcdef.ExportConfig{}
+	config.Pinpoint.CustomerID = "c1"
+	config.Integration.Config = map[string]interface{}{
+		"url":          server.URL,
+		"server_type":  "server",
+		"access_token": "token1",
+	}
+	res, err := s.ValidateConfig(context.Background(), config)
+	assert.NoError(err)
+	return server.URL, res
+}
+
+func TestValidateConfigServer(t *testing.T) {
+	assert := assert.New(t)
+	serverURL, res := testValidateServer(t, func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal("Bearer token1", req.Header.Get("Authorization"))
+		switch req.URL.Path + "?" + req.URL.RawQuery {
+		case "/rest/api/1.0/application-properties?":
+			rw.Write([]byte(`{"version":"7.2.1"}`))
+		case "/rest/api/1.0/users?limit=1":
+			rw.Write([]byte(`{"size":1,"limit":1,"isLastPage":false,"start":0,"nextPageStart":1,"values":[{"id":1,"name":"user1"}]}`))
+		case "/rest/api/1.0/repos?limit=1&permission=REPO_READ":
+			rw.Write([]byte(`{"size":1,"limit":1,"isLastPage":false,"start":0,"nextPageStart":1,"values":[{"id":1,"slug":"test","project":{"key":"PROJ"}}]}`))
+		default:
+			t.Errorf("unexpected request %v", req.URL.String())
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	})
+	assert.Empty(res.Errors)
+	assert.Equal("7.2.1", res.ServerVersion)
+	assert.Equal(strings.Replace(serverURL, "http://", "http://x-token-auth:token1@", 1)+"/scm/proj/test.git", res.RepoURL)
+}
+
+func TestValidateConfigServerInvalidCredentials(t *testing.T) {
+	assert := assert.New(t)
+	_, res := testValidateServer(t, func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/rest/api/1.0/application-properties":
+			// available for anonymous users
+			rw.Write([]byte(`{"version":"7.2.1"}`))
+		default:
+			rw.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+	assert.Len(res.Errors, 1)
+	assert.Empty(res.RepoURL)
+}
@@ -30,7 +30,11 @@ func (s *Integration) onboardExportRepos(ctx context.Context) (res rpcdef.Onboar
 	params.Set("pagelen", "100")
 
 	rerr = api.Paginate(func(nextPage api.NextPage) (np api.NextPage, _ error) {
-		pageInfo, repos, err := api.ResposUserHasAccessToPage(s.qc, params, nextPage)
+		pageFn := api.ResposUserHasAccessToPage
+		if s.qc.IsServer() {
+			pageFn = api.ServerReposUserHasAccessToPage
+		}
+		pageInfo, repos, err := pageFn(s.qc, params, nextPage)
 		if err != nil {
 			return np, err
 		}
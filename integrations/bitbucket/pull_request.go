@@ -36,12 +36,6 @@ func (s *Integration) exportPullRequestsForRepo(ctx *repoprojects.ProjectCtx, re
 		return
 	}
 
-	reviewsSender, err := ctx.Session(sourcecode.PullRequestReviewModelName)
-	if err != nil {
-		rerr = err
-		return
-	}
-
 	ctx.Logger.Info("exporting")
 
 	// export changed pull requests
@@ -49,13 +43,20 @@ func (s *Integration) exportPullRequestsForRepo(ctx *repoprojects.ProjectCtx, re
 	pullRequestsInitial := make(chan []sourcecode.PullRequest)
 	go func() {
 		defer close(pullRequestsInitial)
-		if err := s.exportPullRequestsRepo(ctx.Logger, repo, pullRequestSender, reviewsSender, pullRequestsInitial, pullRequestSender.LastProcessedTime()); err != nil {
+		var err error
+		if s.qc.IsServer() {
+			err = s.exportServerPullRequestsRepo(ctx.Logger, repo, pullRequestSender, commentsSender, pullRequestsInitial)
+		} else {
+			err = s.exportPullRequestsRepo(ctx.Logger, repo, pullRequestSender, pullRequestsInitial, pullRequestSender.LastProcessedTime())
+		}
+		if err != nil {
 			pullRequestsErr = err
 		}
 	}()
 
 	// export comments, reviews, commits concurrently
 	pullRequestsForComments := make(chan []sourcecode.PullRequest, 10)
+	pullRequestsForReviews := make(chan []sourcecode.PullRequest, 10)
 	pullRequestsForCommits := make(chan []sourcecode.PullRequest, 10)
 
 	var errMu sync.Mutex
@@ -69,6 +70,8 @@ func (s *Integration) exportPullRequestsForRepo(ctx *repoprojects.ProjectCtx, re
 		// drain all pull requests on error
 		for range pullRequestsForComments {
 		}
+		for range pullRequestsForReviews {
+		}
 		for range pullRequestsForCommits {
 		}
 	}
@@ -76,9 +79,11 @@ func (s *Integration) exportPullRequestsForRepo(ctx *repoprojects.ProjectCtx, re
 	go func() {
 		for item := range pullRequestsInitial {
 			pullRequestsForComments <- item
+			pullRequestsForReviews <- item
 			pullRequestsForCommits <- item
 		}
 		close(pullRequestsForComments)
+		close(pullRequestsForReviews)
 		close(pullRequestsForCommits)
 
 		if pullRequestsErr != nil {
@@ -96,52 +101,30 @@ func (s *Integration) exportPullRequestsForRepo(ctx *repoprojects.ProjectCtx, re
 		}
 	}()
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.exportPullRequestsReviews(ctx.Logger, pullRequestSender, repo, pullRequestsForReviews)
+		if err != nil {
+			setErr(fmt.Errorf("error getting reviews %s", err))
+		}
+	}()
+
 	// set commits on the rp and then send the pr
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
+		commitsStopOnUpdatedAt := commitsSender.LastProcessedTime()
 		for prs := range pullRequestsForCommits {
 			for _, pr := range prs {
 				logger := ctx.Logger.With("pr_id", pr.RefID)
-				commits, err := s.exportPullRequestCommits(logger, repo, pr, commitsSender)
+				meta, err := s.exportPRCommitsAddingToPR(logger, repo, pr, commitsStopOnUpdatedAt, pullRequestSender, commitsSender)
 				if err != nil {
-					setErr(fmt.Errorf("error getting commits %s", err))
-					return
-				}
-
-				if len(commits) > 0 {
-					meta := rpcdef.GitRepoFetchPR{}
-					repoID := s.qc.IDs.CodeRepo(repo.RefID)
-					meta.ID = s.qc.IDs.CodePullRequest(repoID, pr.RefID)
-					meta.RefID = pr.RefID
-					meta.URL = pr.URL
-					meta.BranchName = pr.BranchName
-					meta.LastCommitSHA = commits[0].Sha
-					res = append(res, meta)
-				}
-				for ind := len(commits) - 1; ind >= 0; ind-- {
-					pr.CommitShas = append(pr.CommitShas, commits[ind].Sha)
-				}
-
-				pr.CommitIds = s.qc.IDs.CodeCommits(pr.RepoID, pr.CommitShas)
-				if len(pr.CommitShas) == 0 {
-					logger.Info("found PullRequest with no commits (ignoring it)", "repo", repo.NameWithOwner, "pr_ref_id", pr.RefID, "pr.url", pr.URL)
-				} else {
-					pr.BranchID = s.qc.IDs.CodeBranch(pr.RepoID, pr.BranchName, pr.CommitShas[0])
-				}
-
-				if err = pullRequestSender.Send(&pr); err != nil {
 					setErr(err)
 					return
 				}
-
-				for _, c := range commits {
-					c.BranchID = pr.BranchID
-					err := commitsSender.Send(c)
-					if err != nil {
-						setErr(err)
-						return
-					}
+				if meta != nil {
+					res = append(res, *meta)
 				}
 			}
 		}
@@ -150,7 +133,52 @@ func (s *Integration) exportPullRequestsForRepo(ctx *repoprojects.ProjectCtx, re
 	return
 }
 
-func (s *Integration) exportPullRequestsRepo(logger hclog.Logger, repo commonrepo.Repo, prSender *objsender.Session, reviewsSender *objsender.Session, pullRequests chan []sourcecode.PullRequest, lastProcessed time.Time) error {
+// exportPRCommitsAddingToPR gets pr commits, sets commit fields on pr and sends both pr and commits. Returns metadata needed for git export of the pr, nil if pr has no commits.
+func (s *Integration) exportPRCommitsAddingToPR(logger hclog.Logger, repo commonrepo.Repo, pr sourcecode.PullRequest, commitsStopOnUpdatedAt time.Time, pullRequestSender objsender.SessionCommon, commitsSender objsender.SessionCommon) (res *rpcdef.GitRepoFetchPR, rerr error) {
+	commits, err := s.exportPullRequestCommits(logger, repo, pr, commitsStopOnUpdatedAt)
+	if err != nil {
+		rerr = fmt.Errorf("error getting commits %s", err)
+		return
+	}
+
+	if len(commits) > 0 {
+		meta := rpcdef.GitRepoFetchPR{}
+		repoID := s.qc.IDs.CodeRepo(repo.RefID)
+		meta.ID = s.qc.IDs.CodePullRequest(repoID, pr.RefID)
+		meta.RefID = pr.RefID
+		meta.URL = pr.URL
+		meta.BranchName = pr.BranchName
+		meta.LastCommitSHA = commits[0].Sha
+		res = &meta
+	}
+	for ind := len(commits) - 1; ind >= 0; ind-- {
+		pr.CommitShas = append(pr.CommitShas, commits[ind].Sha)
+	}
+
+	pr.CommitIds = s.qc.IDs.CodeCommits(pr.RepoID, pr.CommitShas)
+	if len(pr.CommitShas) == 0 {
+		logger.Info("found PullRequest with no commits (ignoring it)", "repo", repo.NameWithOwner, "pr_ref_id", pr.RefID, "pr.url", pr.URL)
+	} else {
+		pr.BranchID = s.qc.IDs.CodeBranch(pr.RepoID, pr.BranchName, pr.CommitShas[0])
+	}
+
+	if err = pullRequestSender.Send(&pr); err != nil {
+		rerr = err
+		return
+	}
+
+	for _, c := range commits {
+		c.BranchID = pr.BranchID
+		err := commitsSender.Send(c)
+		if err != nil {
+			rerr = err
+			return
+		}
+	}
+	return
+}
+
+func (s *Integration) exportPullRequestsRepo(logger hclog.Logger, repo commonrepo.Repo, prSender *objsender.Session, pullRequests chan []sourcecode.PullRequest, lastProcessed time.Time) error {
 
 	params := url.Values{}
 	params.Add("state", "MERGED")
@@ -166,7 +194,24 @@ func (s *Integration) exportPullRequestsRepo(logger hclog.Logger, repo commonrep
 	}
 
 	return api.Paginate(func(nextPage api.NextPage) (api.NextPage, error) {
-		np, res, err := api.PullRequestPage(s.qc, logger, reviewsSender, repo, params, nextPage)
+		np, res, err := api.PullRequestPage(s.qc, logger, repo, params, nextPage)
+		if err != nil {
+			return np, err
+		}
+		pullRequests <- res
+		return np, nil
+	})
+}
+
+// exportServerPullRequestsRepo exports pull requests from bitbucket server. Comments are sent together with pull requests, since they are retrieved from pull request activities.
+func (s *Integration) exportServerPullRequestsRepo(logger hclog.Logger, repo commonrepo.Repo, prSender *objsender.Session, commentsSender *objsender.Session, pullRequests chan []sourcecode.PullRequest) error {
+
+	params := url.Values{}
+
+	stopOnUpdatedAt := prSender.LastProcessedTime()
+
+	return api.Paginate(func(nextPage api.NextPage) (api.NextPage, error) {
+		np, res, err := api.ServerPullRequestPage(s.qc, logger, commentsSender, repo, params, stopOnUpdatedAt, nextPage)
 		if err != nil {
 			return np, err
 		}
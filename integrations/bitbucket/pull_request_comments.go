@@ -13,6 +13,12 @@ import (
 )
 
 func (s *Integration) exportPullRequestsComments(logger hclog.Logger, commentsSender *objsender.Session, repo commonrepo.Repo, pullRequests chan []sourcecode.PullRequest) error {
+	if s.qc.IsServer() {
+		// comments are exported together with pull requests in server mode
+		for range pullRequests {
+		}
+		return nil
+	}
 	for prs := range pullRequests {
 		for _, pr := range prs {
 			logger := logger.With("pr_id", pr.RefID)
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/integrations/bitbucket/api"
+	"github.com/pinpt/agent/integrations/pkg/commonrepo"
+	"github.com/pinpt/agent/integrations/pkg/objsender"
+	"github.com/pinpt/integration-sdk/sourcecode"
+)
+
+func (s *Integration) exportPullRequestsReviews(logger hclog.Logger, prSender *objsender.Session, repo commonrepo.Repo, pullRequests chan []sourcecode.PullRequest) error {
+	for prs := range pullRequests {
+		for _, pr := range prs {
+			logger := logger.With("pr_id", pr.RefID)
+			err := s.exportPullRequestReviews(logger, prSender, repo, pr)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Integration) exportPullRequestReviews(logger hclog.Logger, prSender *objsender.Session, repo commonrepo.Repo, pr sourcecode.PullRequest) error {
+
+	reviewsSender, err := prSender.Session(sourcecode.PullRequestReviewModelName.String(), pr.RefID, pr.RefID)
+	if err != nil {
+		return err
+	}
+
+	err = s.sendPullRequestReviews(logger, reviewsSender, repo, pr)
+	if err != nil {
+		return err
+	}
+
+	return reviewsSender.Done()
+}
+
+func (s *Integration) sendPullRequestReviews(logger hclog.Logger, reviewsSender objsender.SessionCommon, repo commonrepo.Repo, pr sourcecode.PullRequest) error {
+	reviewsFn := api.PullRequestReviews
+	if s.qc.IsServer() {
+		reviewsFn = api.ServerPullRequestReviews
+	}
+
+	reviews, err := reviewsFn(s.qc, logger, repo, pr)
+	if err != nil {
+		return err
+	}
+
+	if err := reviewsSender.SetTotal(len(reviews)); err != nil {
+		return err
+	}
+
+	for _, obj := range reviews {
+		if err := reviewsSender.Send(obj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -2,12 +2,210 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
+	"time"
 
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/integrations/bitbucket/api"
+	"github.com/pinpt/agent/integrations/pkg/commonrepo"
+	"github.com/pinpt/agent/integrations/pkg/objsender"
 	"github.com/pinpt/agent/rpcdef"
+	"github.com/pinpt/integration-sdk/sourcecode"
 )
 
-func (s *Integration) Webhook(ctx context.Context, headers map[string]string, body string, config rpcdef.ExportConfig) (res rpcdef.WebhookResult, rerr error) {
-	rerr = errors.New("webhook not supported")
+// webhookEvents are bitbucket event keys we register repository hooks for
+// https://confluence.atlassian.com/bitbucket/event-payloads-740262817.html
+var webhookEvents = []string{
+	"pullrequest:created",
+	"pullrequest:updated",
+	"pullrequest:approved",
+	"pullrequest:unapproved",
+	"pullrequest:fulfilled",
+	"pullrequest:rejected",
+	"pullrequest:comment_created",
+	"pullrequest:comment_updated",
+	"repo:push",
+}
+
+// webhookPayload contains the fields we need from bitbucket webhook payloads
+type webhookPayload struct {
+	Repository struct {
+		UUID     string `json:"uuid"`
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	PullRequest struct {
+		ID int64 `json:"id"`
+	} `json:"pullrequest"`
+	Comment struct {
+		ID int64 `json:"id"`
+	} `json:"comment"`
+}
+
+func (s *Integration) Webhook(ctx context.Context, headers map[string]string, body string, config rpcdef.ExportConfig) (res rpcdef.WebhookResult, _ error) {
+
+	rerr := func(err error) {
+		res.Error = err.Error()
+		return
+	}
+
+	if len(body) == 0 {
+		rerr(errors.New("empty webhook body passed"))
+		return
+	}
+
+	err := s.initWithConfig(config)
+	if err != nil {
+		rerr(err)
+		return
+	}
+
+	if s.qc.IsServer() {
+		rerr(errors.New("webhooks are not supported for bitbucket server"))
+		return
+	}
+
+	var data webhookPayload
+
+	err = json.Unmarshal([]byte(body), &data)
+	if err != nil {
+		rerr(err)
+		return
+	}
+
+	repo, err := repoFromWebhook(data)
+	if err != nil {
+		rerr(err)
+		return
+	}
+
+	sessions := objsender.NewSessionsWebhook()
+
+	xEventKey, _ := headers["x-event-key"]
+	switch xEventKey {
+	case "":
+		rerr(fmt.Errorf("x-event-key key is not provided in headers %v", headers))
+		return
+	case "pullrequest:created",
+		"pullrequest:updated",
+		"pullrequest:approved",
+		"pullrequest:unapproved",
+		"pullrequest:fulfilled",
+		"pullrequest:rejected":
+		if data.PullRequest.ID == 0 {
+			rerr(errors.New("missing pullrequest.id in payload"))
+			return
+		}
+		prMeta, err := s.webhookPullRequest(s.logger, sessions, repo, strconv.FormatInt(data.PullRequest.ID, 10))
+		if err != nil {
+			rerr(fmt.Errorf("could not get pull request %v", err))
+			return
+		}
+		var prs []rpcdef.GitRepoFetchPR
+		if prMeta != nil {
+			prs = append(prs, *prMeta)
+		}
+		err = s.exportGit(repo, prs)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		res.MutatedObjects = sessions.Data
+		return
+	case "pullrequest:comment_created",
+		"pullrequest:comment_updated":
+		if data.PullRequest.ID == 0 {
+			rerr(errors.New("missing pullrequest.id in payload"))
+			return
+		}
+		if data.Comment.ID == 0 {
+			rerr(errors.New("missing comment.id in payload"))
+			return
+		}
+		pr, err := api.PullRequest(s.qc, s.logger, repo, strconv.FormatInt(data.PullRequest.ID, 10))
+		if err != nil {
+			rerr(err)
+			return
+		}
+		obj, err := api.PullRequestComment(s.qc, s.logger, repo, pr, strconv.FormatInt(data.Comment.ID, 10))
+		if err != nil {
+			rerr(err)
+			return
+		}
+		if obj == nil {
+			s.logger.Info("skipping webhook for inline comment", "comment_id", data.Comment.ID)
+			res.MutatedObjects = sessions.Data
+			return
+		}
+		session := sessions.NewSession(sourcecode.PullRequestCommentModelName.String())
+		session.Send(obj)
+		res.MutatedObjects = sessions.Data
+		return
+	case "repo:push":
+		err = s.exportGit(repo, nil)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		return
+	default:
+		s.logger.Info("skipping webhook with unsupported x-event-key, this is not in a list of supported webhooks", "x-event-key", xEventKey)
+		return
+	}
+}
+
+func repoFromWebhook(data webhookPayload) (res commonrepo.Repo, rerr error) {
+	res.RefID = data.Repository.UUID
+	if res.RefID == "" {
+		rerr = errors.New("missing repository.uuid in payload")
+		return
+	}
+	res.NameWithOwner = data.Repository.FullName
+	if res.NameWithOwner == "" {
+		rerr = errors.New("missing repository.full_name in payload")
+		return
+	}
 	return
 }
+
+func (s *Integration) webhookPullRequest(logger hclog.Logger, sessions *objsender.SessionsWebhook, repo commonrepo.Repo, prID string) (res *rpcdef.GitRepoFetchPR, rerr error) {
+	logger = logger.With("repo", repo.NameWithOwner, "pr_id", prID)
+
+	pr, err := api.PullRequest(s.qc, logger, repo, prID)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	reviewsSender := sessions.NewSession(sourcecode.PullRequestReviewModelName.String())
+	if err := s.sendPullRequestReviews(logger, reviewsSender, repo, pr); err != nil {
+		rerr = err
+		return
+	}
+
+	pullRequestSender := sessions.NewSession(sourcecode.PullRequestModelName.String())
+	commitsSender := sessions.NewSession(sourcecode.PullRequestCommitModelName.String())
+
+	// webhooks are not incremental, get all commits for pr
+	return s.exportPRCommitsAddingToPR(logger, repo, pr, time.Time{}, pullRequestSender, commitsSender)
+}
+
+func (s *Integration) registerWebhooks(repos []commonrepo.Repo) error {
+	s.logger.Info("registering webhooks")
+
+	url, err := s.agent.GetWebhookURL()
+	if err != nil {
+		return err
+	}
+
+	for _, repo := range repos {
+		err := api.WebhookCreateIfNotExists(s.qc, repo, url, webhookEvents, api.WebhookReplaceOlderThan)
+		if err != nil {
+			s.logger.Info("could not register webhooks for repo", "err", err, "repo", repo.NameWithOwner)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/integrations/pkg/testutil"
+	"github.com/pinpt/agent/rpcdef"
+	"github.com/pinpt/integration-sdk/sourcecode"
+	"github.com/stretchr/testify/assert"
+)
+
+var testAPIResponses = map[string]string{
+	"/2.0/repositories/pinpt/test/pullrequests/1":              `{"id":1,"title":"Add readme","summary":{"html":"<p>Adds readme</p>"},"state":"OPEN","source":{"branch":{"name":"readme"}},"links":{"html":{"href":"https://bitbucket.org/pinpt/test/pull-requests/1"}},"created_on":"2020-05-25T09:14:51.123456+00:00","updated_on":"2020-05-25T09:20:11.123456+00:00","author":{"account_id":"557058:1"},"participants":[{"role":"REVIEWER","approved":true,"participated_on":"2020-05-25T09:20:11.123456+00:00","user":{"account_id":"557058:2"}}]}`,
+	"/2.0/repositories/pinpt/test/pullrequests/1/activity":     `{"pagelen":50,"values":[{"approval":{"date":"2020-05-25T09:20:11.123456+00:00","user":{"account_id":"557058:2"}}},{"update":{"date":"2020-05-25T09:14:51.123456+00:00","state":"OPEN","reviewers":[{"account_id":"557058:2"}]}}]}`,
+	"/2.0/repositories/pinpt/test/pullrequests/1/commits":      `{"pagelen":100,"values":[{"hash":"da1560886d4f094c3e6c9ef40349f7d38b5d27d7","message":"Add readme","date":"2020-05-25T09:10:00+00:00","author":{"raw":"Test User <test@example.com>"}}]}`,
+	"/2.0/repositories/pinpt/test/pullrequests/1/comments/101": `{"id":101,"content":{"raw":"Looks good"},"links":{"html":{"href":"https://bitbucket.org/pinpt/test/pull-requests/1/_/diff#comment-101"}},"user":{"account_id":"557058:2"},"created_on":"2020-05-25T09:22:40.123456+00:00","updated_on":"2020-05-25T09:22:40.123456+00:00"}`,
+}
+
+func testWebhook(t *testing.T, event string, payloadFile string) (*testutil.Agent, rpcdef.WebhookResult) {
+	assert := assert.New(t)
+
+	server := testutil.NewServer(t, testutil.ServerOpts{
+		Responses: testAPIResponses,
+		Check: func(req *http.Request) {
+			user, pass, _ := req.BasicAuth()
+			assert.Equal("user1", user)
+			assert.Equal("pass1", pass)
+		},
+	})
+	defer server.Close()
+
+	payload := testutil.Payload(t, payloadFile)
+
+	agent := &testutil.Agent{}
+	s := NewIntegration(hclog.New(&hclog.LoggerOptions{
+		Name: "test",
+	}))
+	assert.NoError(s.Init(agent))
+
+	config := rpcdef.ExportConfig{}
+	config.Pinpoint.CustomerID = "c1"
+	config.Integration.Config = map[string]interface{}{
+		"url":      server.URL,
+		"username": "user1",
+		"password": "pass1",
+	}
+
+	res, err := s.Webhook(context.Background(), map[string]string{"x-event-key": event}, payload, config)
+	assert.NoError(err)
+	assert.Empty(res.Error)
+	return agent, res
+}
+
+func TestWebhookPullRequest(t *testing.T) {
+	assert := assert.New(t)
+	agent, res := testWebhook(t, "pullrequest:created", "pullrequest_created.json")
+
+	prs := res.MutatedObjects[sourcecode.PullRequestModelName.String()]
+	if assert.Len(prs, 1) {
+		pr := prs[0].(map[string]interface{})
+		assert.Equal("1", pr["ref_id"])
+		assert.Equal("Add readme", pr["title"])
+		assert.Equal("#1", pr["identifier"])
+	}
+	reviews := res.MutatedObjects[sourcecode.PullRequestReviewModelName.String()]
+	if assert.Len(reviews, 2) {
+		// approval from activity and reviewer assignment from participants
+		for _, review := range reviews {
+			assert.Equal("557058:2", review.(map[string]interface{})["user_ref_id"])
+		}
+	}
+	assert.Len(res.MutatedObjects[sourcecode.PullRequestCommitModelName.String()], 1)
+
+	if assert.Len(agent.Fetches, 1) {
+		fetch := agent.Fetches[0]
+		assert.Equal("pinpt/test", fetch.UniqueName)
+		if assert.Len(fetch.PRs, 1) {
+			assert.Equal("1", fetch.PRs[0].RefID)
+			assert.Equal("da1560886d4f094c3e6c9ef40349f7d38b5d27d7", fetch.PRs[0].LastCommitSHA)
+		}
+	}
+}
+
+func TestWebhookPullRequestComment(t *testing.T) {
+	assert := assert.New(t)
+	agent, res := testWebhook(t, "pullrequest:comment_created", "pullrequest_comment_created.json")
+
+	comments := res.MutatedObjects[sourcecode.PullRequestCommentModelName.String()]
+	if assert.Len(comments, 1) {
+		comment := comments[0].(map[string]interface{})
+		assert.Equal("101", comment["ref_id"])
+		assert.Equal("Looks good", comment["body"])
+	}
+	assert.Empty(agent.Fetches)
+}
+
+func TestWebhookPush(t *testing.T) {
+	assert := assert.New(t)
+	agent, res := testWebhook(t, "repo:push", "repo_push.json")
+	assert.Empty(res.MutatedObjects)
+	if assert.Len(agent.Fetches, 1) {
+		assert.Equal("pinpt/test", agent.Fetches[0].UniqueName)
+		assert.Empty(agent.Fetches[0].PRs)
+	}
+}
@@ -0,0 +1,304 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pinpt/agent/integrations/pkg/commoncicd"
+	"github.com/pinpt/agent/pkg/date"
+	"github.com/pinpt/agent/pkg/requests"
+	pjson "github.com/pinpt/go-common/json"
+	pstrings "github.com/pinpt/go-common/strings"
+	"github.com/pinpt/integration-sdk/cicd"
+)
+
+func restGet(qc QueryContext, u string, query url.Values, accept string, res interface{}) (http.Header, error) {
+	req, err := newRestRequest(qc, "")
+	if err != nil {
+		return nil, err
+	}
+	req.URL = u
+	if query != nil {
+		req.Query = query
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	reqs := requests.New(qc.Logger, qc.Clients.TLSInsecure)
+	resp, err := reqs.JSON(req, res)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Resp.Header, nil
+}
+
+// checkSuitesPerCommit and checkRunsPerSuite limit nested connections of the builds query, commits with more suites or runs are rare and the rest is skipped
+const (
+	checkSuitesPerCommit = 20
+	checkRunsPerSuite    = 50
+)
+
+type checkSuite struct {
+	HeadBranch string
+	HeadSHA    string
+}
+
+type checkRun struct {
+	ID          int64     `json:"databaseId"`
+	HTMLURL     string    `json:"permalink"`
+	Status      string    `json:"status"`
+	Conclusion  string    `json:"conclusion"`
+	StartedAt   time.Time `json:"startedAt"`
+	CompletedAt time.Time `json:"completedAt"`
+}
+
+// BuildsPage returns completed check runs of commits on the branch in one page of commit history, so check suites are not requested per commit. Only the runs completed after completedAfter are returned. Use with PaginateCommits.
+func BuildsPage(qc QueryContext, repo Repo, branchName string, queryParams string, completedAfter time.Time) (pi PageInfo, res []*cicd.Build, rerr error) {
+	qc.Logger.Debug("builds request", "repo", repo.NameWithOwner, "branchName", branchName, "q", queryParams)
+
+	query := `
+	query {
+		node (id: ` + pjson.Stringify(repo.ID) + `) {
+			... on Repository {
+				ref(qualifiedName: ` + pjson.Stringify(branchName) + `){
+					target {
+						... on Commit {
+							history(` + queryParams + `){
+								pageInfo {
+									hasNextPage
+									endCursor
+									hasPreviousPage
+									startCursor
+								}
+								nodes {
+									oid
+									checkSuites(first: ` + strconv.Itoa(checkSuitesPerCommit) + `){
+										nodes {
+											branch {
+												name
+											}
+											checkRuns(first: ` + strconv.Itoa(checkRunsPerSuite) + `){
+												nodes {
+													databaseId
+													permalink
+													status
+													conclusion
+													startedAt
+													completedAt
+												}
+											}
+										}
+									}
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	`
+
+	var requestRes struct {
+		Data struct {
+			Node struct {
+				Ref struct {
+					Target struct {
+						History struct {
+							PageInfo PageInfo `json:"pageInfo"`
+							Nodes    []struct {
+								OID         string `json:"oid"`
+								CheckSuites struct {
+									Nodes []struct {
+										Branch struct {
+											Name string `json:"name"`
+										} `json:"branch"`
+										CheckRuns struct {
+											Nodes []checkRun `json:"nodes"`
+										} `json:"checkRuns"`
+									} `json:"nodes"`
+								} `json:"checkSuites"`
+							} `json:"nodes"`
+						} `json:"history"`
+					} `json:"target"`
+				} `json:"ref"`
+			} `json:"node"`
+		} `json:"data"`
+	}
+
+	err := qc.Request(query, nil, &requestRes)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	history := requestRes.Data.Node.Ref.Target.History
+	for _, commit := range history.Nodes {
+		for _, suiteData := range commit.CheckSuites.Nodes {
+			suite := checkSuite{HeadBranch: suiteData.Branch.Name, HeadSHA: commit.OID}
+			if suite.HeadBranch == "" {
+				suite.HeadBranch = branchName
+			}
+			for _, run := range suiteData.CheckRuns.Nodes {
+				// graphql returns enum values in upper case
+				run.Status = strings.ToLower(run.Status)
+				run.Conclusion = strings.ToLower(run.Conclusion)
+				if run.Status != "completed" || !run.CompletedAt.After(completedAfter) {
+					continue
+				}
+				res = append(res, convertCheckRun(qc, repo, suite, run))
+			}
+		}
+	}
+	return history.PageInfo, res, nil
+}
+
+func convertCheckRun(qc QueryContext, repo Repo, suite checkSuite, run checkRun) *cicd.Build {
+	build := &cicd.Build{}
+	build.CustomerID = qc.CustomerID
+	build.RefType = qc.RefType
+	build.RefID = strconv.FormatInt(run.ID, 10)
+	build.RepoName = repo.NameWithOwner
+	build.Branch = suite.HeadBranch
+	build.CommitSha = suite.HeadSHA
+	build.URL = run.HTMLURL
+	// check runs are always created by apps
+	build.Automated = true
+	build.Environment = commoncicd.BuildEnvironment(suite.HeadBranch)
+	date.ConvertToModel(run.StartedAt, &build.StartDate)
+	date.ConvertToModel(run.CompletedAt, &build.EndDate)
+	switch run.Conclusion {
+	case "success", "neutral", "skipped":
+		build.Status = cicd.BuildStatusPass
+	case "cancelled":
+		build.Status = cicd.BuildStatusCancel
+	default:
+		// failure, timed_out, action_required
+		build.Status = cicd.BuildStatusFail
+	}
+	return build
+}
+
+type deployment struct {
+	ID          int64     `json:"id"`
+	SHA         string    `json:"sha"`
+	Environment string    `json:"environment"`
+	CreatedAt   time.Time `json:"created_at"`
+	Creator     struct {
+		Type string `json:"type"`
+	} `json:"creator"`
+	// ProductionEnvironment is only returned by newer api versions
+	ProductionEnvironment bool `json:"production_environment"`
+}
+
+type deploymentStatus struct {
+	State          string    `json:"state"`
+	TargetURL      string    `json:"target_url"`
+	LogURL         string    `json:"log_url"`
+	EnvironmentURL string    `json:"environment_url"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Deployments returns deployments which completed after completedAfter
+func Deployments(qc QueryContext, repo Repo, completedAfter time.Time) (res []*cicd.Deployment, rerr error) {
+	u := pstrings.JoinURL(qc.APIURL3, "repos/"+repo.NameWithOwner+"/deployments")
+	createdAfter := completedAfter.Add(-commoncicd.CompletionWindow)
+	var deployments []deployment
+	done := false
+	rerr = PaginateV3(func(next string) (http.Header, error) {
+		var query url.Values
+		if next == "" {
+			next = u
+			query = url.Values{"per_page": []string{"100"}}
+		}
+		var data []deployment
+		header, err := restGet(qc, next, query, "", &data)
+		if err != nil {
+			return nil, err
+		}
+		// returned newest first
+		for _, d := range data {
+			if d.CreatedAt.Before(createdAfter) {
+				done = true
+				break
+			}
+			deployments = append(deployments, d)
+		}
+		if done {
+			return http.Header{}, nil
+		}
+		return header, nil
+	})
+	if rerr != nil {
+		return
+	}
+	for _, d := range deployments {
+		status, ok, err := lastDeploymentStatus(qc, repo, d.ID)
+		if err != nil {
+			rerr = err
+			return
+		}
+		if !ok || !status.CreatedAt.After(completedAfter) {
+			continue
+		}
+		item := convertDeployment(qc, repo, d, status)
+		if item == nil {
+			// still in progress
+			continue
+		}
+		res = append(res, item)
+	}
+	return
+}
+
+func lastDeploymentStatus(qc QueryContext, repo Repo, id int64) (res deploymentStatus, ok bool, rerr error) {
+	u := pstrings.JoinURL(qc.APIURL3, "repos/"+repo.NameWithOwner+"/deployments/"+strconv.FormatInt(id, 10)+"/statuses")
+	// returned newest first
+	query := url.Values{"per_page": []string{"1"}}
+	var data []deploymentStatus
+	_, err := restGet(qc, u, query, "", &data)
+	if err != nil {
+		rerr = err
+		return
+	}
+	if len(data) == 0 {
+		return
+	}
+	return data[0], true, nil
+}
+
+// convertDeployment returns nil if deployment is not completed
+func convertDeployment(qc QueryContext, repo Repo, d deployment, status deploymentStatus) *cicd.Deployment {
+	item := &cicd.Deployment{}
+	switch status.State {
+	// inactive is set on previous successful deployments to the same environment
+	case "success", "inactive":
+		item.Status = cicd.DeploymentStatusPass
+	case "failure", "error":
+		item.Status = cicd.DeploymentStatusFail
+	default:
+		// pending, queued, in_progress
+		return nil
+	}
+	item.CustomerID = qc.CustomerID
+	item.RefType = qc.RefType
+	item.RefID = strconv.FormatInt(d.ID, 10)
+	item.RepoName = repo.NameWithOwner
+	item.CommitSha = d.SHA
+	item.Automated = d.Creator.Type == "Bot"
+	if d.ProductionEnvironment {
+		item.Environment = cicd.DeploymentEnvironmentProduction
+	} else {
+		item.Environment = commoncicd.DeploymentEnvironment(d.Environment)
+	}
+	item.URL = status.LogURL
+	if item.URL == "" {
+		item.URL = status.TargetURL
+	}
+	date.ConvertToModel(d.CreatedAt, &item.StartDate)
+	date.ConvertToModel(status.CreatedAt, &item.EndDate)
+	return item
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/pkg/reqstats"
+	"github.com/pinpt/integration-sdk/cicd"
+	"github.com/stretchr/testify/assert"
+)
+
+func testCICDQueryContext(t *testing.T, server *httptest.Server) QueryContext {
+	logger := hclog.New(&hclog.LoggerOptions{
+		Name: "test",
+	})
+	rm, err := reqstats.New(reqstats.Opts{
+		Logger:                logger,
+		TLSInsecureSkipVerify: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return QueryContext{
+		APIURL3:    server.URL,
+		Logger:     logger,
+		Clients:    rm.Clients,
+		CustomerID: "c1",
+		RefType:    "github",
+		AuthToken:  testAuthToken,
+	}
+}
+
+func testAuthToken() (string, error) {
+	return "token1", nil
+}
+
+func TestBuildsPage(t *testing.T) {
+	assert := assert.New(t)
+
+	qc := QueryContext{
+		Logger:     hclog.NewNullLogger(),
+		CustomerID: "c1",
+		RefType:    "github",
+	}
+	qc.Request = func(query string, vars map[string]interface{}, res interface{}) error {
+		assert.Contains(query, `ref(qualifiedName: "master")`)
+		assert.Contains(query, "history(first: 100)")
+		return json.Unmarshal([]byte(`{"data":{"node":{"ref":{"target":{"history":{
+			"pageInfo":{"hasNextPage":true,"endCursor":"c1"},
+			"nodes":[{"oid":"s1","checkSuites":{"nodes":[{"branch":{"name":"master"},"checkRuns":{"nodes":[
+				{"databaseId":1,"permalink":"https://github.com/pinpt/test/runs/1","status":"COMPLETED","conclusion":"SUCCESS","startedAt":"2020-05-02T10:00:00Z","completedAt":"2020-05-02T10:05:00Z"},
+				{"databaseId":2,"status":"COMPLETED","conclusion":"TIMED_OUT","startedAt":"2020-05-02T10:00:00Z","completedAt":"2020-05-02T11:00:00Z"},
+				{"databaseId":3,"status":"IN_PROGRESS","startedAt":"2020-05-02T10:00:00Z"},
+				{"databaseId":4,"status":"COMPLETED","conclusion":"CANCELLED","startedAt":"2020-04-01T10:00:00Z","completedAt":"2020-04-01T10:01:00Z"}
+			]}}]}}]
+		}}}}}}`), res)
+	}
+
+	repo := Repo{ID: "R1", NameWithOwner: "pinpt/test"}
+	completedAfter := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+	pi, builds, err := BuildsPage(qc, repo, "master", "first: 100", completedAfter)
+	assert.NoError(err)
+	assert.True(pi.HasNextPage)
+	assert.Equal("c1", pi.EndCursor)
+	if assert.Len(builds, 2) {
+		b := builds[0]
+		assert.Equal("1", b.RefID)
+		assert.Equal("github", b.RefType)
+		assert.Equal("c1", b.CustomerID)
+		assert.Equal("pinpt/test", b.RepoName)
+		assert.Equal("master", b.Branch)
+		assert.Equal("s1", b.CommitSha)
+		assert.Equal("https://github.com/pinpt/test/runs/1", b.URL)
+		assert.Equal(cicd.BuildStatusPass, b.Status)
+		assert.True(b.Automated)
+		assert.Equal(cicd.BuildStatusFail, builds[1].Status)
+	}
+}
+
+func TestDeployments(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/repos/pinpt/test/deployments":
+			rw.Write([]byte(`[
+				{"id":3,"sha":"s3","environment":"staging","created_at":"2020-05-03T10:00:00Z","creator":{"type":"User"}},
+				{"id":2,"sha":"s2","environment":"production","created_at":"2020-05-02T10:00:00Z","creator":{"type":"Bot"}},
+				{"id":1,"sha":"s1","environment":"production","created_at":"2020-04-01T10:00:00Z","creator":{"type":"Bot"}}
+			]`))
+		case "/repos/pinpt/test/deployments/3/statuses":
+			rw.Write([]byte(`[{"state":"in_progress","created_at":"2020-05-03T10:01:00Z"}]`))
+		case "/repos/pinpt/test/deployments/2/statuses":
+			rw.Write([]byte(`[{"state":"failure","log_url":"https://ci.example.com/2","created_at":"2020-05-02T10:10:00Z"}]`))
+		default:
+			t.Errorf("unexpected request %v", req.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	qc := testCICDQueryContext(t, server)
+	repo := Repo{ID: "R1", NameWithOwner: "pinpt/test"}
+	completedAfter := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+	res, err := Deployments(qc, repo, completedAfter)
+	assert.NoError(err)
+	if assert.Len(res, 1) {
+		d := res[0]
+		assert.Equal("2", d.RefID)
+		assert.Equal("s2", d.CommitSha)
+		assert.Equal("https://ci.example.com/2", d.URL)
+		assert.Equal(cicd.DeploymentStatusFail, d.Status)
+		assert.Equal(cicd.DeploymentEnvironmentProduction, d.Environment)
+		assert.True(d.Automated)
+	}
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"github.com/hashicorp/go-hclog"
 	"github.com/pinpt/agent/pkg/ids"
+	"github.com/pinpt/agent/pkg/ids2"
 	"github.com/pinpt/agent/pkg/reqstats"
 )
 
@@ -33,7 +34,10 @@ type QueryContext struct {
 
 	Clients reqstats.Clients
 
-	AuthToken string
+	// AuthToken returns token for rest api requests. Github app installation tokens are refreshed before expiry.
+	AuthToken func() (string, error)
+
+	IDs ids2.Gen
 }
 
 func (s QueryContext) WithLogger(logger hclog.Logger) QueryContext {
@@ -1,5 +1,7 @@
 package api
 
+import "fmt"
+
 func PREditTitle(qc QueryContext, id, title string) error {
 	qc.Logger.Info("editing pr title", "pr", id, "title", title)
 
@@ -41,3 +43,278 @@ func PREditBody(qc QueryContext, id, body string) error {
 	var res interface{}
 	return qc.Request(query, vars, &res)
 }
+
+func prMutation(qc QueryContext, query string, vars map[string]interface{}) error {
+	var res interface{}
+	return qc.Request(query, vars, &res)
+}
+
+// PRAddReviewers requests reviews from users, already requested reviewers are kept
+func PRAddReviewers(qc QueryContext, id string, userIDs []string) error {
+	qc.Logger.Info("requesting pr reviews", "pr", id, "users", userIDs)
+
+	query := `
+	mutation($id:ID! $userIds:[ID!]) {
+		requestReviews(input:{
+			pullRequestId: $id,
+			userIds: $userIds,
+			union: true
+		}) {
+			clientMutationId
+		}
+	}
+	`
+	vars := map[string]interface{}{
+		"id":      id,
+		"userIds": userIDs,
+	}
+	return prMutation(qc, query, vars)
+}
+
+// PRLabelIDs returns ids of repository labels using names. Labels are looked up by name, so repositories with any number of labels are supported.
+func PRLabelIDs(qc QueryContext, id string, names []string) (res []string, rerr error) {
+	query := `
+	query($id:ID! $name:String!) {
+		node(id: $id) {
+			... on PullRequest {
+				repository {
+					label(name: $name) {
+						id
+					}
+				}
+			}
+		}
+	}
+	`
+	for _, name := range names {
+		vars := map[string]interface{}{
+			"id":   id,
+			"name": name,
+		}
+		var requestRes struct {
+			Data struct {
+				Node struct {
+					Repository struct {
+						Label *struct {
+							ID string `json:"id"`
+						} `json:"label"`
+					} `json:"repository"`
+				} `json:"node"`
+			} `json:"data"`
+		}
+		err := qc.Request(query, vars, &requestRes)
+		if err != nil {
+			rerr = err
+			return
+		}
+		label := requestRes.Data.Node.Repository.Label
+		if label == nil {
+			rerr = fmt.Errorf("label not found in repository: %v", name)
+			return
+		}
+		res = append(res, label.ID)
+	}
+	return
+}
+
+// PRAddLabels adds labels using label ids
+func PRAddLabels(qc QueryContext, id string, labelIDs []string) error {
+	qc.Logger.Info("adding pr labels", "pr", id, "labels", labelIDs)
+
+	query := `
+	mutation($id:ID! $labelIds:[ID!]!) {
+		addLabelsToLabelable(input:{
+			labelableId: $id,
+			labelIds: $labelIds
+		}) {
+			clientMutationId
+		}
+	}
+	`
+	vars := map[string]interface{}{
+		"id":       id,
+		"labelIds": labelIDs,
+	}
+	return prMutation(qc, query, vars)
+}
+
+// PRRemoveLabels removes labels using label ids
+func PRRemoveLabels(qc QueryContext, id string, labelIDs []string) error {
+	qc.Logger.Info("removing pr labels", "pr", id, "labels", labelIDs)
+
+	query := `
+	mutation($id:ID! $labelIds:[ID!]!) {
+		removeLabelsFromLabelable(input:{
+			labelableId: $id,
+			labelIds: $labelIds
+		}) {
+			clientMutationId
+		}
+	}
+	`
+	vars := map[string]interface{}{
+		"id":       id,
+		"labelIds": labelIDs,
+	}
+	return prMutation(qc, query, vars)
+}
+
+// PRAddAssignees adds assignees using user ids
+func PRAddAssignees(qc QueryContext, id string, userIDs []string) error {
+	qc.Logger.Info("adding pr assignees", "pr", id, "users", userIDs)
+
+	query := `
+	mutation($id:ID! $assigneeIds:[ID!]!) {
+		addAssigneesToAssignable(input:{
+			assignableId: $id,
+			assigneeIds: $assigneeIds
+		}) {
+			clientMutationId
+		}
+	}
+	`
+	vars := map[string]interface{}{
+		"id":          id,
+		"assigneeIds": userIDs,
+	}
+	return prMutation(qc, query, vars)
+}
+
+// PRRemoveAssignees removes assignees using user ids
+func PRRemoveAssignees(qc QueryContext, id string, userIDs []string) error {
+	qc.Logger.Info("removing pr assignees", "pr", id, "users", userIDs)
+
+	query := `
+	mutation($id:ID! $assigneeIds:[ID!]!) {
+		removeAssigneesFromAssignable(input:{
+			assignableId: $id,
+			assigneeIds: $assigneeIds
+		}) {
+			clientMutationId
+		}
+	}
+	`
+	vars := map[string]interface{}{
+		"id":          id,
+		"assigneeIds": userIDs,
+	}
+	return prMutation(qc, query, vars)
+}
+
+// PRAddComment adds a comment to pull request conversation
+func PRAddComment(qc QueryContext, id string, body string) error {
+	qc.Logger.Info("adding pr comment", "pr", id)
+
+	query := `
+	mutation($id:ID! $body:String!) {
+		addComment(input:{
+			subjectId: $id,
+			body: $body
+		}) {
+			clientMutationId
+		}
+	}
+	`
+	vars := map[string]interface{}{
+		"id":   id,
+		"body": body,
+	}
+	return prMutation(qc, query, vars)
+}
+
+// PRMerge merges pull request. mergeMethod is one of MERGE, SQUASH or REBASE.
+func PRMerge(qc QueryContext, id string, mergeMethod string) error {
+	qc.Logger.Info("merging pr", "pr", id, "merge_method", mergeMethod)
+
+	query := `
+	mutation($id:ID! $mergeMethod:PullRequestMergeMethod!) {
+		mergePullRequest(input:{
+			pullRequestId: $id,
+			mergeMethod: $mergeMethod
+		}) {
+			clientMutationId
+		}
+	}
+	`
+	vars := map[string]interface{}{
+		"id":          id,
+		"mergeMethod": mergeMethod,
+	}
+	return prMutation(qc, query, vars)
+}
+
+// PRClose closes pull request without merging
+func PRClose(qc QueryContext, id string) error {
+	qc.Logger.Info("closing pr", "pr", id)
+
+	query := `
+	mutation($id:ID!) {
+		closePullRequest(input:{
+			pullRequestId: $id
+		}) {
+			clientMutationId
+		}
+	}
+	`
+	vars := map[string]interface{}{
+		"id": id,
+	}
+	return prMutation(qc, query, vars)
+}
+
+// PRReopen reopens closed pull request
+func PRReopen(qc QueryContext, id string) error {
+	qc.Logger.Info("reopening pr", "pr", id)
+
+	query := `
+	mutation($id:ID!) {
+		reopenPullRequest(input:{
+			pullRequestId: $id
+		}) {
+			clientMutationId
+		}
+	}
+	`
+	vars := map[string]interface{}{
+		"id": id,
+	}
+	return prMutation(qc, query, vars)
+}
+
+// PRConvertToDraft converts pull request to draft
+func PRConvertToDraft(qc QueryContext, id string) error {
+	qc.Logger.Info("converting pr to draft", "pr", id)
+
+	query := `
+	mutation($id:ID!) {
+		convertPullRequestToDraft(input:{
+			pullRequestId: $id
+		}) {
+			clientMutationId
+		}
+	}
+	`
+	vars := map[string]interface{}{
+		"id": id,
+	}
+	return prMutation(qc, query, vars)
+}
+
+// PRMarkReadyForReview marks draft pull request as ready for review
+func PRMarkReadyForReview(qc QueryContext, id string) error {
+	qc.Logger.Info("marking pr ready for review", "pr", id)
+
+	query := `
+	mutation($id:ID!) {
+		markPullRequestReadyForReview(input:{
+			pullRequestId: $id
+		}) {
+			clientMutationId
+		}
+	}
+	`
+	vars := map[string]interface{}{
+		"id": id,
+	}
+	return prMutation(qc, query, vars)
+}
@@ -81,7 +81,11 @@ func OrgsEnterpriseAll(qc QueryContext) (res []Org, rerr error) {
 
 func OrgsEnterprisePage(qc QueryContext, u string) (res []Org, header http.Header, rerr error) {
 	// This is not necessary in certain server configurations. But in some it's required use token for this
-	req := newRestRequest(qc, "organizations")
+	req, err := newRestRequest(qc, "organizations")
+	if err != nil {
+		rerr = err
+		return
+	}
 	if u != "" {
 		req.URL = u
 	}
@@ -141,6 +141,10 @@ func PaginateV3(fn PaginateV3Fn) error {
 }
 
 func getNextFromLinkHeader(link string) (string, error) {
+	// not returned when all results fit in one page
+	if strings.TrimSpace(link) == "" {
+		return "", nil
+	}
 	links := strings.Split(link, ",")
 	for _, link := range links {
 		link = strings.TrimSpace(link)
@@ -5,9 +5,13 @@ import (
 	pstrings "github.com/pinpt/go-common/strings"
 )
 
-func newRestRequest(qc QueryContext, urlPath string) requests.Request {
-	req := requests.NewRequest()
+func newRestRequest(qc QueryContext, urlPath string) (req requests.Request, _ error) {
+	token, err := qc.AuthToken()
+	if err != nil {
+		return req, err
+	}
+	req = requests.NewRequest()
 	req.URL = pstrings.JoinURL(qc.APIURL3, urlPath)
-	req.Header.Set("Authorization", "token "+qc.AuthToken)
-	return req
+	req.Header.Set("Authorization", "token "+token)
+	return req, nil
 }
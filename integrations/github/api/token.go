@@ -9,7 +9,11 @@ import (
 )
 
 func TokenScopes(qc QueryContext) (scopes []string, rerr error) {
-	req := newRestRequest(qc, "rate_limit")
+	req, err := newRestRequest(qc, "rate_limit")
+	if err != nil {
+		rerr = err
+		return
+	}
 	reqs := requests.New(qc.Logger, qc.Clients.TLSInsecure)
 	resp, err := reqs.Do(context.TODO(), req)
 	if err != nil {
@@ -126,7 +126,12 @@ func WebhookList(qc QueryContext, repo Repo) (res []webhook, noPermissions bool,
 	req.Method = "GET"
 	req.URL = pstrings.JoinURL(qc.APIURL3, "repos", repo.NameWithOwner, "hooks")
 	req.Header = http.Header{}
-	req.Header.Set("Authorization", "token "+qc.AuthToken)
+	token, err := qc.AuthToken()
+	if err != nil {
+		rerr = err
+		return
+	}
+	req.Header.Set("Authorization", "token "+token)
 
 	resp, err := reqs.JSON(req, &res)
 	if err != nil {
@@ -166,9 +171,13 @@ func webhookCreate(qc QueryContext, repo Repo, webhookURL string, events []strin
 	req.Method = "POST"
 	req.URL = pstrings.JoinURL(qc.APIURL3, "repos", repo.NameWithOwner, "hooks")
 	req.Header = http.Header{}
-	req.Header.Set("Authorization", "token "+qc.AuthToken)
+	token, err := qc.AuthToken()
+	if err != nil {
+		rerr = err
+		return
+	}
+	req.Header.Set("Authorization", "token "+token)
 
-	var err error
 	req.Body, err = json.Marshal(data)
 	if err != nil {
 		rerr = err
@@ -193,7 +202,11 @@ func webhookRemove(qc QueryContext, repo Repo, hookID int) error {
 	req.Method = "DELETE"
 	req.URL = pstrings.JoinURL(qc.APIURL3, "repos", repo.NameWithOwner, "hooks", strconv.Itoa(hookID))
 	req.Header = http.Header{}
-	req.Header.Set("Authorization", "token "+qc.AuthToken)
+	token, err := qc.AuthToken()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "token "+token)
 
 	res, err := reqs.Do(context.Background(), req)
 	if err != nil {
@@ -131,9 +131,10 @@ func TestWebhookCreateIfNotExists(t *testing.T) {
 	assert.NoError(err)
 
 	qc := QueryContext{
-		APIURL3: server.URL,
-		Logger:  logger,
-		Clients: rm.Clients,
+		APIURL3:   server.URL,
+		Logger:    logger,
+		Clients:   rm.Clients,
+		AuthToken: testAuthToken,
 	}
 
 	// don't do anything
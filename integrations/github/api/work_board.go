@@ -0,0 +1,95 @@
+package api
+
+import (
+	"github.com/pinpt/integration-sdk/work"
+)
+
+type workProjectGraphql struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Columns struct {
+		Nodes []struct {
+			Name string `json:"name"`
+			// TODO, IN_PROGRESS, DONE or null if column does not have automation
+			Purpose string `json:"purpose"`
+		} `json:"nodes"`
+	} `json:"columns"`
+}
+
+// WorkBoardsPage returns repo projects as kanban boards. Column statuses are based on column automation purpose, columns without automation do not have statuses.
+func WorkBoardsPage(
+	qc QueryContext,
+	repo Repo,
+	queryParams string) (pi PageInfo, res []*work.KanbanBoard, totalCount int, rerr error) {
+
+	qc.Logger.Debug("work boards request", "repo", repo.NameWithOwner, "q", queryParams)
+
+	query := `
+	query {
+		node (id: "` + repo.ID + `") {
+			... on Repository {
+				projects(` + queryParams + `) {
+					totalCount
+					pageInfo {
+						hasNextPage
+						endCursor
+						hasPreviousPage
+						startCursor
+					}
+					nodes {
+						id
+						name
+						columns(first:100) {
+							nodes {
+								name
+								purpose
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	`
+
+	var requestRes struct {
+		Data struct {
+			Node struct {
+				Projects struct {
+					TotalCount int                  `json:"totalCount"`
+					PageInfo   PageInfo             `json:"pageInfo"`
+					Nodes      []workProjectGraphql `json:"nodes"`
+				} `json:"projects"`
+			} `json:"node"`
+		} `json:"data"`
+	}
+
+	err := qc.Request(query, nil, &requestRes)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	projects := requestRes.Data.Node.Projects
+	for _, data := range projects.Nodes {
+		item := &work.KanbanBoard{}
+		item.CustomerID = qc.CustomerID
+		item.RefType = qc.RefType
+		item.RefID = data.ID
+		item.Name = data.Name
+		item.ProjectIds = []string{qc.IDs.WorkProject(repo.ID)}
+		for _, column := range data.Columns.Nodes {
+			statusIds := make([]string, 0)
+			if status := workIssueStatusFromColumnPurpose(column.Purpose); status != "" {
+				statusIds = append(statusIds, qc.IDs.WorkIssueStatus(workIssueStatusRefIDs[status]))
+			}
+			item.Columns = append(item.Columns, work.KanbanBoardColumns{
+				Name:      column.Name,
+				StatusIds: statusIds,
+			})
+		}
+		res = append(res, item)
+	}
+
+	return projects.PageInfo, res, projects.TotalCount, nil
+}
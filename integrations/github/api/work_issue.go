@@ -0,0 +1,267 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pinpt/agent/pkg/date"
+	"github.com/pinpt/integration-sdk/work"
+)
+
+// GitHub issues only have OPEN and CLOSED states. Open issues placed in a project column with in progress automation are marked as in progress.
+const (
+	WorkIssueStatusOpen       = "Open"
+	WorkIssueStatusInProgress = "In Progress"
+	WorkIssueStatusClosed     = "Closed"
+)
+
+// workIssueStatusRefIDs maps status names to ref ids of exported work.IssueStatus
+var workIssueStatusRefIDs = map[string]string{
+	WorkIssueStatusOpen:       "open",
+	WorkIssueStatusInProgress: "in_progress",
+	WorkIssueStatusClosed:     "closed",
+}
+
+// WorkIssueStatuses returns all statuses used for issues
+func WorkIssueStatuses(qc QueryContext) (res []*work.IssueStatus) {
+	for _, name := range []string{WorkIssueStatusOpen, WorkIssueStatusInProgress, WorkIssueStatusClosed} {
+		item := &work.IssueStatus{}
+		item.CustomerID = qc.CustomerID
+		item.RefType = qc.RefType
+		item.RefID = workIssueStatusRefIDs[name]
+		item.Name = name
+		res = append(res, item)
+	}
+	return
+}
+
+// workIssueStatusFromColumnPurpose returns issue status for project column purpose (TODO, IN_PROGRESS or DONE), empty if column has no automation
+func workIssueStatusFromColumnPurpose(purpose string) string {
+	switch purpose {
+	case "TODO":
+		return WorkIssueStatusOpen
+	case "IN_PROGRESS":
+		return WorkIssueStatusInProgress
+	case "DONE":
+		return WorkIssueStatusClosed
+	}
+	return ""
+}
+
+type WorkIssue struct {
+	*work.Issue
+	HasComments      bool
+	HasTimelineItems bool
+}
+
+// workIssueTimelineItemTypes are the timeline events converted to issue changelog
+const workIssueTimelineItemTypes = "[ASSIGNED_EVENT,UNASSIGNED_EVENT,LABELED_EVENT,UNLABELED_EVENT,CLOSED_EVENT,REOPENED_EVENT,RENAMED_TITLE_EVENT,MILESTONED_EVENT,DEMILESTONED_EVENT]"
+
+const workIssueFieldsGraphql = `
+updatedAt
+id
+number
+repository {
+	id
+	nameWithOwner
+}
+title
+bodyHTML
+url
+createdAt
+# OPEN or CLOSED
+state
+author ` + userFields + `
+assignees(first:10) {
+	nodes ` + userFields2 + `
+}
+labels(first:100) {
+	nodes {
+		name
+	}
+}
+milestone {
+	id
+	dueOn
+}
+projectCards(first:10) {
+	nodes {
+		column {
+			purpose
+		}
+	}
+}
+comments {
+	totalCount
+}
+timelineItems(itemTypes:` + workIssueTimelineItemTypes + `) {
+	totalCount
+}
+`
+
+type workIssueGraphql struct {
+	ID         string `json:"id"`
+	Repository struct {
+		ID            string `json:"id"`
+		NameWithOwner string `json:"nameWithOwner"`
+	}
+	Number    int       `json:"number"`
+	Title     string    `json:"title"`
+	BodyHTML  string    `json:"bodyHTML"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	State     string    `json:"state"`
+	Author    User      `json:"author"`
+	Assignees struct {
+		Nodes []User `json:"nodes"`
+	} `json:"assignees"`
+	Labels struct {
+		Nodes []struct {
+			Name string `json:"name"`
+		} `json:"nodes"`
+	} `json:"labels"`
+	Milestone *struct {
+		ID    string    `json:"id"`
+		DueOn time.Time `json:"dueOn"`
+	} `json:"milestone"`
+	ProjectCards struct {
+		Nodes []struct {
+			Column *struct {
+				Purpose string `json:"purpose"`
+			} `json:"column"`
+		} `json:"nodes"`
+	} `json:"projectCards"`
+	Comments struct {
+		TotalCount int `json:"totalCount"`
+	} `json:"comments"`
+	TimelineItems struct {
+		TotalCount int `json:"totalCount"`
+	} `json:"timelineItems"`
+}
+
+func convertWorkIssue(qc QueryContext, data workIssueGraphql) WorkIssue {
+	item := &work.Issue{}
+	item.CustomerID = qc.CustomerID
+	item.RefType = qc.RefType
+	item.RefID = data.ID
+	item.ProjectID = qc.IDs.WorkProject(data.Repository.ID)
+	item.Identifier = fmt.Sprintf("%s#%d", data.Repository.NameWithOwner, data.Number)
+	item.Title = data.Title
+	item.Description = `<div class="source-github">` + data.BodyHTML + `</div>`
+	item.URL = data.URL
+	item.Type = "Issue"
+	date.ConvertToModel(data.CreatedAt, &item.CreatedDate)
+	date.ConvertToModel(data.UpdatedAt, &item.UpdatedDate)
+
+	switch data.State {
+	case "OPEN":
+		item.Status = WorkIssueStatusOpen
+		for _, card := range data.ProjectCards.Nodes {
+			if card.Column != nil && workIssueStatusFromColumnPurpose(card.Column.Purpose) == WorkIssueStatusInProgress {
+				item.Status = WorkIssueStatusInProgress
+			}
+		}
+	case "CLOSED":
+		item.Status = WorkIssueStatusClosed
+	default:
+		qc.Logger.Error("could not process issue state, state is unknown", "state", data.State, "issue_url", data.URL)
+	}
+	item.StatusID = qc.IDs.WorkIssueStatus(workIssueStatusRefIDs[item.Status])
+
+	item.Tags = make([]string, 0)
+	for _, label := range data.Labels.Nodes {
+		item.Tags = append(item.Tags, label.Name)
+	}
+
+	item.SprintIds = make([]string, 0)
+	if data.Milestone != nil {
+		item.SprintIds = append(item.SprintIds, qc.IDs.WorkSprintID(data.Milestone.ID))
+		date.ConvertToModel(data.Milestone.DueOn, &item.PlannedEndDate)
+	}
+
+	if qc.ExportUserUsingFullDetails != nil {
+		{
+			var err error
+			item.CreatorRefID, err = qc.ExportUserUsingFullDetails(qc.Logger, data.Author)
+			if err != nil {
+				qc.Logger.Error("could not resolve issue author", "login", data.Author.Login, "issue_url", data.URL)
+			}
+			item.ReporterRefID = item.CreatorRefID
+		}
+		// work.Issue supports only one assignee, using the first one
+		if len(data.Assignees.Nodes) != 0 {
+			assignee := data.Assignees.Nodes[0]
+			var err error
+			item.AssigneeRefID, err = qc.ExportUserUsingFullDetails(qc.Logger, assignee)
+			if err != nil {
+				qc.Logger.Error("could not resolve issue assignee", "login", assignee.Login, "issue_url", data.URL)
+			}
+		}
+	}
+
+	res := WorkIssue{}
+	res.Issue = item
+	res.HasComments = data.Comments.TotalCount != 0
+	res.HasTimelineItems = data.TimelineItems.TotalCount != 0
+	return res
+}
+
+// WorkIssuesPage returns issues of the repo ordered by updated date. Pull requests are not included, since those are exported by sourcecode integration.
+func WorkIssuesPage(
+	qc QueryContext,
+	repo Repo,
+	queryParams string, stopOnUpdatedAt time.Time) (pi PageInfo, res []WorkIssue, totalCount int, rerr error) {
+
+	qc.Logger.Debug("work issues request", "repo", repo.NameWithOwner, "q", queryParams)
+
+	query := `
+	query {
+		node (id: "` + repo.ID + `") {
+			... on Repository {
+				issues(` + queryParams + `) {
+					totalCount
+					pageInfo {
+						hasNextPage
+						endCursor
+						hasPreviousPage
+						startCursor
+					}
+					nodes {
+						` + workIssueFieldsGraphql + `
+					}
+				}
+			}
+		}
+	}
+	`
+
+	var requestRes struct {
+		Data struct {
+			Node struct {
+				Issues struct {
+					TotalCount int                `json:"totalCount"`
+					PageInfo   PageInfo           `json:"pageInfo"`
+					Nodes      []workIssueGraphql `json:"nodes"`
+				} `json:"issues"`
+			} `json:"node"`
+		} `json:"data"`
+	}
+
+	err := qc.Request(query, nil, &requestRes)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	issues := requestRes.Data.Node.Issues
+
+	for _, data := range issues.Nodes {
+		if data.UpdatedAt.Before(stopOnUpdatedAt) {
+			return
+		}
+		res = append(res, convertWorkIssue(qc, data))
+	}
+
+	return issues.PageInfo, res, issues.TotalCount, nil
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"time"
+
+	"github.com/pinpt/agent/pkg/date"
+	"github.com/pinpt/integration-sdk/work"
+)
+
+type workIssueTimelineItem struct {
+	Typename  string    `json:"__typename"`
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Actor     User      `json:"actor"`
+	// Assignee is set for AssignedEvent and UnassignedEvent in newer versions, User in older enterprise versions
+	Assignee User `json:"assignee"`
+	User     User `json:"user"`
+	Label    struct {
+		Name string `json:"name"`
+	} `json:"label"`
+	PreviousTitle  string `json:"previousTitle"`
+	CurrentTitle   string `json:"currentTitle"`
+	MilestoneTitle string `json:"milestoneTitle"`
+}
+
+func getWorkIssueTimelineQuery(issueRefID, queryParams string, assigneeAvailability bool) string {
+
+	var userAssignatedEvent string
+	if assigneeAvailability {
+		userAssignatedEvent = "assignee " + userFields
+	} else {
+		userAssignatedEvent = "user " + userFields2
+	}
+
+	return `
+	query {
+		node (id: "` + issueRefID + `") {
+			... on Issue {
+				timelineItems(` + queryParams + `) {
+					totalCount
+					pageInfo {
+						hasNextPage
+						endCursor
+						hasPreviousPage
+						startCursor
+					}
+					nodes {
+						... on AssignedEvent {
+							__typename
+							id
+							createdAt
+							actor ` + userFields + `
+							` + userAssignatedEvent + `
+						}
+						... on UnassignedEvent {
+							__typename
+							id
+							createdAt
+							actor ` + userFields + `
+							` + userAssignatedEvent + `
+						}
+						... on LabeledEvent {
+							__typename
+							id
+							createdAt
+							actor ` + userFields + `
+							label { name }
+						}
+						... on UnlabeledEvent {
+							__typename
+							id
+							createdAt
+							actor ` + userFields + `
+							label { name }
+						}
+						... on ClosedEvent {
+							__typename
+							id
+							createdAt
+							actor ` + userFields + `
+						}
+						... on ReopenedEvent {
+							__typename
+							id
+							createdAt
+							actor ` + userFields + `
+						}
+						... on RenamedTitleEvent {
+							__typename
+							id
+							createdAt
+							actor ` + userFields + `
+							previousTitle
+							currentTitle
+						}
+						... on MilestonedEvent {
+							__typename
+							id
+							createdAt
+							actor ` + userFields + `
+							milestoneTitle
+						}
+						... on DemilestonedEvent {
+							__typename
+							id
+							createdAt
+							actor ` + userFields + `
+							milestoneTitle
+						}
+					}
+				}
+			}
+		}
+	}
+	`
+}
+
+// WorkIssueChangelogPage returns issue changelog based on timeline events. Timeline events only contain milestone titles, milestoneRefIDs is used to map them to sprints.
+func WorkIssueChangelogPage(
+	qc QueryContext,
+	issueRefID string,
+	queryParams string,
+	assigneeAvailability bool,
+	milestoneRefIDs map[string]string) (pi PageInfo, res []work.IssueChangeLog, totalCount int, rerr error) {
+
+	if issueRefID == "" {
+		panic("missing issue id")
+	}
+
+	logger := qc.Logger.With("issue", issueRefID)
+
+	queryParams += " itemTypes:" + workIssueTimelineItemTypes
+
+	logger.Debug("work issue timeline items request", "q", queryParams)
+
+	query := getWorkIssueTimelineQuery(issueRefID, queryParams, assigneeAvailability)
+
+	var requestRes struct {
+		Data struct {
+			Node struct {
+				TimelineItems struct {
+					TotalCount int                     `json:"totalCount"`
+					PageInfo   PageInfo                `json:"pageInfo"`
+					Nodes      []workIssueTimelineItem `json:"nodes"`
+				} `json:"timelineItems"`
+			} `json:"node"`
+		} `json:"data"`
+	}
+
+	err := qc.Request(query, nil, &requestRes)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	userRefID := func(user User) string {
+		if qc.ExportUserUsingFullDetails == nil {
+			return ""
+		}
+		refID, err := qc.ExportUserUsingFullDetails(logger, user)
+		if err != nil {
+			logger.Error("could not resolve user in issue timeline event", "login", user.Login)
+		}
+		return refID
+	}
+
+	items := requestRes.Data.Node.TimelineItems
+	for _, data := range items.Nodes {
+		item := work.IssueChangeLog{}
+		item.RefID = data.ID
+		date.ConvertToModel(data.CreatedAt, &item.CreatedDate)
+
+		switch data.Typename {
+		case "":
+			continue
+		case "AssignedEvent", "UnassignedEvent":
+			assignee := data.Assignee
+			if !assigneeAvailability {
+				assignee = data.User
+			}
+			if assignee.Login == "" {
+				logger.Debug("skipped assigned event, since it did not have login for assigned user")
+				continue
+			}
+			item.Field = work.IssueChangeLogFieldAssigneeRefID
+			if data.Typename == "AssignedEvent" {
+				item.To = userRefID(assignee)
+				item.ToString = assignee.Login
+			} else {
+				item.From = userRefID(assignee)
+				item.FromString = assignee.Login
+			}
+		case "LabeledEvent":
+			item.Field = work.IssueChangeLogFieldTags
+			item.To = data.Label.Name
+			item.ToString = data.Label.Name
+		case "UnlabeledEvent":
+			item.Field = work.IssueChangeLogFieldTags
+			item.From = data.Label.Name
+			item.FromString = data.Label.Name
+		case "ClosedEvent":
+			item.Field = work.IssueChangeLogFieldStatus
+			item.From = WorkIssueStatusOpen
+			item.FromString = WorkIssueStatusOpen
+			item.To = WorkIssueStatusClosed
+			item.ToString = WorkIssueStatusClosed
+		case "ReopenedEvent":
+			item.Field = work.IssueChangeLogFieldStatus
+			item.From = WorkIssueStatusClosed
+			item.FromString = WorkIssueStatusClosed
+			item.To = WorkIssueStatusOpen
+			item.ToString = WorkIssueStatusOpen
+		case "RenamedTitleEvent":
+			item.Field = work.IssueChangeLogFieldTitle
+			item.From = data.PreviousTitle
+			item.FromString = data.PreviousTitle
+			item.To = data.CurrentTitle
+			item.ToString = data.CurrentTitle
+		case "MilestonedEvent":
+			item.Field = work.IssueChangeLogFieldSprintIds
+			item.To = qc.IDs.WorkSprintID(milestoneRefIDs[data.MilestoneTitle])
+			item.ToString = data.MilestoneTitle
+		case "DemilestonedEvent":
+			item.Field = work.IssueChangeLogFieldSprintIds
+			item.From = qc.IDs.WorkSprintID(milestoneRefIDs[data.MilestoneTitle])
+			item.FromString = data.MilestoneTitle
+		default:
+			logger.Warn("unexpected issue timeline event", "type", data.Typename)
+			continue
+		}
+
+		item.UserID = userRefID(data.Actor)
+
+		res = append(res, item)
+	}
+
+	return items.PageInfo, res, items.TotalCount, nil
+}
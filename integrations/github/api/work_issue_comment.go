@@ -0,0 +1,100 @@
+package api
+
+import (
+	"time"
+
+	"github.com/pinpt/agent/pkg/date"
+	"github.com/pinpt/integration-sdk/work"
+)
+
+type workIssueCommentGraphql struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	BodyHTML  string    `json:"bodyHTML"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Author    User      `json:"author"`
+}
+
+func WorkIssueCommentsPage(
+	qc QueryContext,
+	repo Repo,
+	issueRefID string,
+	queryParams string) (pi PageInfo, res []*work.IssueComment, totalCount int, rerr error) {
+
+	if issueRefID == "" {
+		panic("missing issue id")
+	}
+
+	qc.Logger.Debug("work issue comments request", "issue", issueRefID, "q", queryParams)
+
+	query := `
+	query {
+		node (id: "` + issueRefID + `") {
+			... on Issue {
+				comments(` + queryParams + `) {
+					totalCount
+					pageInfo {
+						hasNextPage
+						endCursor
+						hasPreviousPage
+						startCursor
+					}
+					nodes {
+						id
+						url
+						bodyHTML
+						createdAt
+						updatedAt
+						author ` + userFields + `
+					}
+				}
+			}
+		}
+	}
+	`
+
+	var requestRes struct {
+		Data struct {
+			Node struct {
+				Comments struct {
+					TotalCount int                       `json:"totalCount"`
+					PageInfo   PageInfo                  `json:"pageInfo"`
+					Nodes      []workIssueCommentGraphql `json:"nodes"`
+				} `json:"comments"`
+			} `json:"node"`
+		} `json:"data"`
+	}
+
+	err := qc.Request(query, nil, &requestRes)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	comments := requestRes.Data.Node.Comments
+	for _, data := range comments.Nodes {
+		item := &work.IssueComment{}
+		item.CustomerID = qc.CustomerID
+		item.RefType = qc.RefType
+		item.RefID = data.ID
+		item.URL = data.URL
+		item.ProjectID = qc.IDs.WorkProject(repo.ID)
+		item.IssueID = qc.IDs.WorkIssue(issueRefID)
+		item.Body = `<div class="source-github">` + data.BodyHTML + `</div>`
+		date.ConvertToModel(data.CreatedAt, &item.CreatedDate)
+		date.ConvertToModel(data.UpdatedAt, &item.UpdatedDate)
+
+		if qc.ExportUserUsingFullDetails != nil {
+			var err error
+			item.UserRefID, err = qc.ExportUserUsingFullDetails(qc.Logger, data.Author)
+			if err != nil {
+				qc.Logger.Error("could not resolve issue comment author", "login", data.Author.Login, "comment_url", data.URL)
+			}
+		}
+
+		res = append(res, item)
+	}
+
+	return comments.PageInfo, res, comments.TotalCount, nil
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/pkg/ids2"
+	"github.com/pinpt/integration-sdk/work"
+	"github.com/stretchr/testify/assert"
+)
+
+func testWorkQueryContext(response string) QueryContext {
+	qc := QueryContext{}
+	qc.Logger = hclog.New(&hclog.LoggerOptions{
+		Name: "test",
+	})
+	qc.CustomerID = "c1"
+	qc.RefType = "github"
+	qc.IDs = ids2.New("c1", "github")
+	qc.Request = func(query string, vars map[string]interface{}, res interface{}) error {
+		return json.Unmarshal([]byte(response), res)
+	}
+	qc.ExportUserUsingFullDetails = func(logger hclog.Logger, user User) (string, error) {
+		if user.Typename == "" {
+			return "ghost", nil
+		}
+		return user.ID, nil
+	}
+	return qc
+}
+
+const testWorkIssuesResponse = `{"data":{"node":{"issues":{"totalCount":2,"pageInfo":{"hasNextPage":true,"endCursor":"c2"},"nodes":[
+	{"updatedAt":"2020-05-10T10:00:00Z","id":"I1","number":5,"repository":{"id":"R1","nameWithOwner":"pinpt/test"},"title":"Crash on start","bodyHTML":"<p>crash</p>","url":"https://github.com/pinpt/test/issues/5","createdAt":"2020-05-01T10:00:00Z","state":"OPEN",
+		"author":{"__typename":"User","id":"U1","login":"user1"},
+		"assignees":{"nodes":[{"__typename":"User","id":"U2","login":"user2"},{"__typename":"User","id":"U3","login":"user3"}]},
+		"labels":{"nodes":[{"name":"bug"},{"name":"p1"}]},
+		"milestone":{"id":"M1","dueOn":"2020-06-01T00:00:00Z"},
+		"projectCards":{"nodes":[{"column":{"purpose":"IN_PROGRESS"}}]},
+		"comments":{"totalCount":2},
+		"timelineItems":{"totalCount":0}},
+	{"updatedAt":"2020-04-01T10:00:00Z","id":"I2","number":4,"repository":{"id":"R1","nameWithOwner":"pinpt/test"},"state":"CLOSED"}
+]}}}}`
+
+func TestWorkIssuesPage(t *testing.T) {
+	assert := assert.New(t)
+
+	qc := testWorkQueryContext(testWorkIssuesResponse)
+	repo := Repo{ID: "R1", NameWithOwner: "pinpt/test"}
+
+	// second issue was updated before last export
+	stopOnUpdatedAt := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+	_, res, _, err := WorkIssuesPage(qc, repo, "first: 10", stopOnUpdatedAt)
+	assert.NoError(err)
+	if !assert.Len(res, 1) {
+		return
+	}
+	issue := res[0]
+	assert.True(issue.HasComments)
+	assert.False(issue.HasTimelineItems)
+	assert.Equal("I1", issue.RefID)
+	assert.Equal("pinpt/test#5", issue.Identifier)
+	assert.Equal(qc.IDs.WorkProject("R1"), issue.ProjectID)
+	assert.Equal(WorkIssueStatusInProgress, issue.Status)
+	assert.Equal(qc.IDs.WorkIssueStatus("in_progress"), issue.StatusID)
+	assert.Equal([]string{"bug", "p1"}, issue.Tags)
+	assert.Equal([]string{qc.IDs.WorkSprintID("M1")}, issue.SprintIds)
+	assert.Equal("U1", issue.CreatorRefID)
+	assert.Equal("U2", issue.AssigneeRefID)
+	assert.Equal(`<div class="source-github"><p>crash</p></div>`, issue.Description)
+}
+
+const testWorkIssueTimelineResponse = `{"data":{"node":{"timelineItems":{"totalCount":6,"pageInfo":{"hasNextPage":false},"nodes":[
+	{"__typename":"AssignedEvent","id":"E1","createdAt":"2020-05-01T10:00:00Z","actor":{"__typename":"User","id":"U1","login":"user1"},"assignee":{"__typename":"User","id":"U2","login":"user2"}},
+	{"__typename":"LabeledEvent","id":"E2","createdAt":"2020-05-01T11:00:00Z","actor":{"__typename":"User","id":"U1","login":"user1"},"label":{"name":"bug"}},
+	{"__typename":"MilestonedEvent","id":"E3","createdAt":"2020-05-01T12:00:00Z","actor":{"__typename":"User","id":"U1","login":"user1"},"milestoneTitle":"v1"},
+	{"__typename":"RenamedTitleEvent","id":"E4","createdAt":"2020-05-02T10:00:00Z","actor":{"__typename":"User","id":"U2","login":"user2"},"previousTitle":"Crash","currentTitle":"Crash on start"},
+	{"__typename":"ClosedEvent","id":"E5","createdAt":"2020-05-03T10:00:00Z","actor":{}},
+	{}
+]}}}}`
+
+func TestWorkIssueChangelogPage(t *testing.T) {
+	assert := assert.New(t)
+
+	qc := testWorkQueryContext(testWorkIssueTimelineResponse)
+
+	_, res, _, err := WorkIssueChangelogPage(qc, "I1", "first: 10", true, map[string]string{"v1": "M1"})
+	assert.NoError(err)
+
+	type change struct {
+		RefID    string
+		UserID   string
+		Field    work.IssueChangeLogField
+		From     string
+		To       string
+		ToString string
+	}
+	var got []change
+	for _, c := range res {
+		got = append(got, change{c.RefID, c.UserID, c.Field, c.From, c.To, c.ToString})
+	}
+	want := []change{
+		{"E1", "U1", work.IssueChangeLogFieldAssigneeRefID, "", "U2", "user2"},
+		{"E2", "U1", work.IssueChangeLogFieldTags, "", "bug", "bug"},
+		{"E3", "U1", work.IssueChangeLogFieldSprintIds, "", qc.IDs.WorkSprintID("M1"), "v1"},
+		{"E4", "U2", work.IssueChangeLogFieldTitle, "Crash", "Crash on start", "Crash on start"},
+		// deleted user
+		{"E5", "ghost", work.IssueChangeLogFieldStatus, WorkIssueStatusOpen, WorkIssueStatusClosed, WorkIssueStatusClosed},
+	}
+	assert.Equal(want, got)
+}
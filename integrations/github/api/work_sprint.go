@@ -0,0 +1,103 @@
+package api
+
+import (
+	"time"
+
+	"github.com/pinpt/agent/pkg/date"
+	"github.com/pinpt/integration-sdk/work"
+)
+
+type workMilestoneGraphql struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// OPEN or CLOSED
+	State     string    `json:"state"`
+	CreatedAt time.Time `json:"createdAt"`
+	ClosedAt  time.Time `json:"closedAt"`
+	DueOn     time.Time `json:"dueOn"`
+}
+
+// WorkSprintsPage returns repo milestones as sprints. Milestones do not have a start date, creation date is used instead.
+func WorkSprintsPage(
+	qc QueryContext,
+	repo Repo,
+	queryParams string) (pi PageInfo, res []*work.Sprint, totalCount int, rerr error) {
+
+	qc.Logger.Debug("work sprints request", "repo", repo.NameWithOwner, "q", queryParams)
+
+	query := `
+	query {
+		node (id: "` + repo.ID + `") {
+			... on Repository {
+				milestones(` + queryParams + `) {
+					totalCount
+					pageInfo {
+						hasNextPage
+						endCursor
+						hasPreviousPage
+						startCursor
+					}
+					nodes {
+						id
+						title
+						description
+						state
+						createdAt
+						closedAt
+						dueOn
+					}
+				}
+			}
+		}
+	}
+	`
+
+	var requestRes struct {
+		Data struct {
+			Node struct {
+				Milestones struct {
+					TotalCount int                    `json:"totalCount"`
+					PageInfo   PageInfo               `json:"pageInfo"`
+					Nodes      []workMilestoneGraphql `json:"nodes"`
+				} `json:"milestones"`
+			} `json:"node"`
+		} `json:"data"`
+	}
+
+	err := qc.Request(query, nil, &requestRes)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	milestones := requestRes.Data.Node.Milestones
+	for _, data := range milestones.Nodes {
+		res = append(res, convertWorkSprint(qc, data))
+	}
+
+	return milestones.PageInfo, res, milestones.TotalCount, nil
+}
+
+func convertWorkSprint(qc QueryContext, data workMilestoneGraphql) *work.Sprint {
+	item := &work.Sprint{}
+	item.CustomerID = qc.CustomerID
+	item.RefType = qc.RefType
+	item.RefID = data.ID
+	item.Name = data.Title
+	item.Goal = data.Description
+	date.ConvertToModel(data.CreatedAt, &item.StartedDate)
+	date.ConvertToModel(data.DueOn, &item.EndedDate)
+
+	switch data.State {
+	case "CLOSED":
+		item.Status = work.SprintStatusClosed
+		date.ConvertToModel(data.ClosedAt, &item.CompletedDate)
+	case "OPEN":
+		item.Status = work.SprintStatusActive
+	default:
+		qc.Logger.Error("could not process milestone state, state is unknown", "state", data.State, "milestone", data.Title)
+	}
+
+	return item
+}
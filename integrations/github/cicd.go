@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/pinpt/agent/integrations/github/api"
+	"github.com/pinpt/agent/integrations/pkg/commoncicd"
+	"github.com/pinpt/agent/integrations/pkg/repoprojects"
+	"github.com/pinpt/integration-sdk/cicd"
+)
+
+// exportBuildsAndDeployments exports check runs of default branch commits as builds and deployments with their latest status
+func (s *Integration) exportBuildsAndDeployments(ctx *repoprojects.ProjectCtx, repo api.RepoWithDefaultBranch) error {
+	logger := ctx.Logger.With("repo", repo.NameWithOwner)
+	qc := s.qc.WithLogger(logger)
+
+	buildsSender, err := ctx.Session(cicd.BuildModelName)
+	if err != nil {
+		return err
+	}
+	if repo.DefaultBranch == "" {
+		logger.Debug("skipping builds, repo has no commits")
+	} else {
+		completedAfter := commoncicd.StartTime(buildsSender.LastProcessedTime())
+		logger.Info("exporting builds")
+		err = api.PaginateCommits(completedAfter.Add(-commoncicd.CompletionWindow), func(query string) (api.PageInfo, error) {
+			pi, builds, err := api.BuildsPage(qc, repo.Repo(), repo.DefaultBranch, query, completedAfter)
+			if err != nil {
+				return pi, err
+			}
+			for _, build := range builds {
+				if err := buildsSender.Send(build); err != nil {
+					return pi, err
+				}
+			}
+			return pi, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	deploymentsSender, err := ctx.Session(cicd.DeploymentModelName)
+	if err != nil {
+		return err
+	}
+	deployments, err := api.Deployments(qc, repo.Repo(), commoncicd.StartTime(deploymentsSender.LastProcessedTime()))
+	if err != nil {
+		return err
+	}
+	logger.Info("exporting deployments", "count", len(deployments))
+	for _, d := range deployments {
+		if err := deploymentsSender.Send(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -11,11 +11,15 @@ import (
 	"github.com/pinpt/agent/cmd/cmdrunnorestarts/inconfig"
 	"github.com/pinpt/agent/integrations/pkg/objsender"
 	"github.com/pinpt/agent/integrations/pkg/repoprojects"
+	"github.com/pinpt/agent/pkg/githubapp"
 	"github.com/pinpt/agent/pkg/ids"
+	"github.com/pinpt/agent/pkg/ids2"
 	"github.com/pinpt/agent/pkg/reqstats"
 	"github.com/pinpt/agent/pkg/structmarshal"
 	"github.com/pinpt/go-common/number"
+	"github.com/pinpt/integration-sdk/cicd"
 	"github.com/pinpt/integration-sdk/sourcecode"
+	"github.com/pinpt/integration-sdk/work"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/pinpt/agent/integrations/github/api"
@@ -74,6 +78,11 @@ type Integration struct {
 	enterpriseVersion string
 
 	assigneeAvailability AssigneeAvailability
+
+	integrationType inconfig.IntegrationType
+
+	// appTokens is set when authenticating as github app installation
+	appTokens *githubapp.Tokens
 }
 
 func (i *Integration) isAssigneeAvailable() bool {
@@ -135,6 +144,9 @@ type Config struct {
 	Repos                 []string
 	Concurrency           int
 	TLSInsecureSkipVerify bool
+
+	// App is set when using github app installation instead of personal or oauth token
+	App *githubapp.Config
 }
 
 type configDef struct {
@@ -178,10 +190,21 @@ func (s *Integration) setIntegrationConfig(data rpcdef.IntegrationConfig) error
 		inConfig.APIKey = token
 		inConfig.URL = "https://github.com"
 	}
-	if inConfig.APIKey == "" {
-		return errors.New("missing api_key")
+	app, isApp, err := githubapp.ConfigFromMap(data.Config)
+	if err != nil {
+		return rerr("%v", err)
+	}
+	if isApp {
+		res.App = &app
+		if inConfig.URL == "" {
+			inConfig.URL = "https://github.com"
+		}
+	} else {
+		if inConfig.APIKey == "" {
+			return errors.New("missing api_key")
+		}
+		res.Token = inConfig.APIKey
 	}
-	res.Token = inConfig.APIKey
 
 	if inConfig.URL == "" {
 		return errors.New("missing url")
@@ -245,8 +268,10 @@ func urlAppend(p1, p2 string) string {
 func (s *Integration) initWithConfig(exportConfig rpcdef.ExportConfig) error {
 	s.customerID = exportConfig.Pinpoint.CustomerID
 	s.assigneeAvailability = AssigneeAvailability{}
+	s.integrationType = exportConfig.Integration.Type
 	s.qc.CustomerID = s.customerID
 	s.qc.RefType = "github"
+	s.qc.IDs = ids2.New(s.customerID, s.qc.RefType)
 	err := s.setIntegrationConfig(exportConfig.Integration)
 	if err != nil {
 		return err
@@ -259,7 +284,7 @@ func (s *Integration) initWithConfig(exportConfig rpcdef.ExportConfig) error {
 
 	s.qc.APIURL = s.config.APIURL
 	s.qc.APIURL3 = s.config.APIURL3
-	s.qc.AuthToken = s.config.Token
+	s.qc.AuthToken = s.token
 	s.clientManager, err = reqstats.New(reqstats.Opts{
 		Logger:                s.logger,
 		TLSInsecureSkipVerify: s.config.TLSInsecureSkipVerify,
@@ -268,6 +293,18 @@ func (s *Integration) initWithConfig(exportConfig rpcdef.ExportConfig) error {
 		return err
 	}
 	s.clients = s.clientManager.Clients
+	s.appTokens = nil
+	if s.config.App != nil {
+		s.appTokens, err = githubapp.New(githubapp.Opts{
+			Logger: s.logger,
+			Client: s.clients.TLSInsecure,
+			APIURL: s.config.APIURL3,
+			Config: *s.config.App,
+		})
+		if err != nil {
+			return err
+		}
+	}
 	s.qc.Clients = s.clients
 	s.qc.Request = s.makeRequest
 
@@ -304,6 +341,15 @@ func (s *Integration) getOrgs() (res []api.Org, _ error) {
 		s.logger.Info("only_organization passed", "org", s.config.Organization)
 		return []api.Org{{Login: s.config.Organization}}, nil
 	}
+	if s.appTokens != nil {
+		// installation tokens have no viewer, use the organization the app is installed on
+		inst, err := s.appTokens.Installation()
+		if err != nil {
+			return nil, err
+		}
+		s.logger.Info("using organization of github app installation", "org", inst.Account.Login)
+		return []api.Org{{Login: inst.Account.Login}}, nil
+	}
 	var err error
 	if !s.config.Enterprise {
 		res, err = api.OrgsAll(s.qc)
@@ -395,12 +441,22 @@ func (s *Integration) export(ctx context.Context) (_ []rpcdef.ExportProject, rer
 		filteredRepos = append(filteredRepos, r.(exportRepo))
 	}
 
-	err = s.registerWebhooks(filteredRepos)
-	if err != nil {
-		s.logger.Info("could not register webhooks", "err", err)
+	isWork := s.integrationType == inconfig.IntegrationTypeWork
+
+	// webhooks only support sourcecode objects
+	if !isWork {
+		err = s.registerWebhooks(filteredRepos)
+		if err != nil {
+			s.logger.Info("could not register webhooks", "err", err)
+		}
 	}
 
-	repoSender, err := objsender.Root(s.agent, sourcecode.RepoModelName.String())
+	repoModelName := sourcecode.RepoModelName.String()
+	if isWork {
+		repoModelName = work.ProjectModelName.String()
+	}
+
+	repoSender, err := objsender.Root(s.agent, repoModelName)
 	if err != nil {
 		rerr = err
 		return
@@ -415,10 +471,21 @@ func (s *Integration) export(ctx context.Context) (_ []rpcdef.ExportProject, rer
 		return
 	}
 
+	if isWork {
+		err = s.exportWorkIssueStatuses()
+		if err != nil {
+			rerr = err
+			return
+		}
+	}
+
 	processOpts := repoprojects.ProcessOpts{}
 	processOpts.Logger = s.logger
 	processOpts.ProjectFn = func(ctx *repoprojects.ProjectCtx) error {
 		repo := ctx.Project.(exportRepo)
+		if isWork {
+			return s.exportWorkProject(ctx, repo.Repo())
+		}
 		return s.exportRepo(ctx, repo.RepoWithDefaultBranch)
 	}
 
@@ -431,6 +498,9 @@ func (s *Integration) export(ctx context.Context) (_ []rpcdef.ExportProject, rer
 	processOpts.Projects = filteredReposIface
 
 	processOpts.IntegrationType = inconfig.IntegrationTypeSourcecode
+	if isWork {
+		processOpts.IntegrationType = inconfig.IntegrationTypeWork
+	}
 	processOpts.CustomerID = s.customerID
 	processOpts.RefType = s.refType
 	processOpts.Sender = repoSender
@@ -539,6 +609,17 @@ func (s *Integration) exportRepo(ctx *repoprojects.ProjectCtx, repo api.RepoWith
 		return err
 	}
 
+	// builds are optional, checks api is not available in older enterprise versions and could be restricted for the token
+	err = s.exportBuildsAndDeployments(ctx, repo)
+	if err != nil {
+		logger.Error("could not export builds and deployments", "repo", repo.NameWithOwner, "err", err)
+		// do not update last processed, so that builds are exported again on next run
+		err = ctx.Rollback(cicd.BuildModelName, cicd.DeploymentModelName)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = s.exportPullRequestsAndRelated(ctx, repo.Repo())
 	if err != nil {
 		return err
@@ -548,7 +629,7 @@ func (s *Integration) exportRepo(ctx *repoprojects.ProjectCtx, repo api.RepoWith
 }
 
 func (s *Integration) exportGit(repo api.Repo, prs []PRMeta) error {
-	repoURL, err := getRepoURL(s.config.RepoURLPrefix, url.UserPassword(s.config.Token, ""), repo.NameWithOwner)
+	repoURL, err := s.repoURL(repo.NameWithOwner)
 	if err != nil {
 		return err
 	}
@@ -746,6 +827,28 @@ func (s *Integration) exportPRCommitsAddingToPR(logger hclog.Logger, repo api.Re
 	return nil
 }
 
+// token returns personal or oauth token from config, or installation token when using github app
+func (s *Integration) token() (string, error) {
+	if s.appTokens == nil {
+		return s.config.Token, nil
+	}
+	return s.appTokens.Token()
+}
+
+// repoURL returns url for git clone with credentials
+func (s *Integration) repoURL(nameWithOwner string) (string, error) {
+	token, err := s.token()
+	if err != nil {
+		return "", err
+	}
+	user := url.UserPassword(token, "")
+	if s.appTokens != nil {
+		// agent replaces the token before cloning, since installation tokens expire in 1 hour
+		user = githubapp.CloneUser(token)
+	}
+	return getRepoURL(s.config.RepoURLPrefix, user, nameWithOwner)
+}
+
 func getRepoURL(repoURLPrefix string, user *url.Userinfo, nameWithOwner string) (string, error) {
 	u, err := url.Parse(repoURLPrefix)
 	if err != nil {
@@ -20,6 +20,11 @@ func (s *Integration) getUpdatedPR(prRefID string) (_ map[string]interface{}, re
 		rerr = err
 		return
 	}
+	// node is null when id is valid, but the object does not exist
+	if pr.RefID == "" {
+		rerr = mutate.NotFoundError{Message: "pull request " + prRefID}
+		return
+	}
 	m := pr.ToMap()
 	delete(m, "created_by_ref_id")
 	delete(m, "closed_by_ref_id")
@@ -66,6 +71,10 @@ func (s *Integration) Mutate(ctx context.Context, fn, data string, config rpcdef
 
 	s.qc.Request = s.makeRequestNoRetries
 
+	if res, ok := s.mutatePullRequest(fn, data); ok {
+		return res, nil
+	}
+
 	var action agent.IntegrationMutationRequestAction
 	err = action.FromInterface(fn)
 	if err != nil {
@@ -117,3 +126,112 @@ func (s *Integration) Mutate(ctx context.Context, fn, data string, config rpcdef
 	rerr(fmt.Errorf("mutate fn not supported: %v", fn))
 	return
 }
+
+// mutatePullRequest handles pull request actions which are not yet defined in agent.IntegrationMutationRequestAction. Returns false if fn is not one of them.
+func (s *Integration) mutatePullRequest(fn, data string) (res rpcdef.MutateResult, ok bool) {
+
+	rerr := func(err error) {
+		res = mutate.ResultFromError(err)
+	}
+
+	var obj struct {
+		RefID       string   `json:"ref_id"`
+		UserRefIDs  []string `json:"user_ref_ids"`
+		Labels      []string `json:"labels"`
+		Body        string   `json:"body"`
+		MergeMethod string   `json:"merge_method"`
+	}
+
+	var mutation func() error
+	switch fn {
+	case mutate.ActionPrAddReviewers:
+		mutation = func() error {
+			if len(obj.UserRefIDs) == 0 {
+				return errors.New("user_ref_ids field not provided")
+			}
+			return api.PRAddReviewers(s.qc, obj.RefID, obj.UserRefIDs)
+		}
+	case mutate.ActionPrAddLabels, mutate.ActionPrRemoveLabels:
+		mutation = func() error {
+			if len(obj.Labels) == 0 {
+				return errors.New("labels field not provided")
+			}
+			labelIDs, err := api.PRLabelIDs(s.qc, obj.RefID, obj.Labels)
+			if err != nil {
+				return err
+			}
+			if fn == mutate.ActionPrAddLabels {
+				return api.PRAddLabels(s.qc, obj.RefID, labelIDs)
+			}
+			return api.PRRemoveLabels(s.qc, obj.RefID, labelIDs)
+		}
+	case mutate.ActionPrAddAssignees, mutate.ActionPrRemoveAssignees:
+		mutation = func() error {
+			if len(obj.UserRefIDs) == 0 {
+				return errors.New("user_ref_ids field not provided")
+			}
+			if fn == mutate.ActionPrAddAssignees {
+				return api.PRAddAssignees(s.qc, obj.RefID, obj.UserRefIDs)
+			}
+			return api.PRRemoveAssignees(s.qc, obj.RefID, obj.UserRefIDs)
+		}
+	case mutate.ActionPrAddComment:
+		mutation = func() error {
+			if obj.Body == "" {
+				return errors.New("body field not provided")
+			}
+			return api.PRAddComment(s.qc, obj.RefID, obj.Body)
+		}
+	case mutate.ActionPrMerge:
+		mutation = func() error {
+			switch obj.MergeMethod {
+			case "":
+				obj.MergeMethod = "MERGE"
+			case "MERGE", "SQUASH", "REBASE":
+			default:
+				return fmt.Errorf("invalid merge_method, expected MERGE, SQUASH or REBASE, got: %v", obj.MergeMethod)
+			}
+			return api.PRMerge(s.qc, obj.RefID, obj.MergeMethod)
+		}
+	case mutate.ActionPrClose:
+		mutation = func() error {
+			return api.PRClose(s.qc, obj.RefID)
+		}
+	case mutate.ActionPrReopen:
+		mutation = func() error {
+			return api.PRReopen(s.qc, obj.RefID)
+		}
+	case mutate.ActionPrSetDraft:
+		mutation = func() error {
+			return api.PRConvertToDraft(s.qc, obj.RefID)
+		}
+	case mutate.ActionPrSetReady:
+		mutation = func() error {
+			return api.PRMarkReadyForReview(s.qc, obj.RefID)
+		}
+	default:
+		return
+	}
+	ok = true
+
+	err := json.Unmarshal([]byte(data), &obj)
+	if err != nil {
+		rerr(err)
+		return
+	}
+	if obj.RefID == "" {
+		rerr(errors.New("ref_id field not provided"))
+		return
+	}
+	err = mutation()
+	if err != nil {
+		rerr(err)
+		return
+	}
+	res, err = s.returnUpdatedPR(obj.RefID)
+	if err != nil {
+		rerr(err)
+		return
+	}
+	return
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/integrations/pkg/mutate"
+	"github.com/pinpt/agent/rpcdef"
+	"github.com/pinpt/integration-sdk/agent"
+	"github.com/pinpt/integration-sdk/sourcecode"
+	"github.com/stretchr/testify/assert"
+)
+
+const testPullRequestNode = `{"data":{"node":{"id":"PR1","number":3,"title":"Add readme","state":"OPEN","url":"https://github.example.com/pinpt/test/pull/3","repository":{"id":"R1","nameWithOwner":"pinpt/test"},"labels":{"nodes":[{"name":"bug"}]}}}}`
+
+type testGraphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+// testMutate runs the mutation against mock graphql server and returns the mutations that were called
+func testMutate(t *testing.T, fn string, data string, notFound bool) (mutations []testGraphQLRequest, res rpcdef.MutateResult) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet {
+			// enterprise version check
+			rw.Header().Set("X-GitHub-Enterprise-Version", "2.21")
+			rw.Write([]byte(`{}`))
+			return
+		}
+		assert.Equal("/api/graphql", req.URL.Path)
+		assert.Equal("bearer token1", req.Header.Get("Authorization"))
+		b, err := ioutil.ReadAll(req.Body)
+		assert.NoError(err)
+		var body testGraphQLRequest
+		assert.NoError(json.Unmarshal(b, &body))
+		if notFound {
+			rw.Write([]byte(`{"data":{"node":null},"errors":[{"type":"NOT_FOUND","path":["node"],"message":"Could not resolve to a node with the global id of 'PR2'"}]}`))
+			return
+		}
+		query := strings.TrimSpace(body.Query)
+		switch {
+		case strings.HasPrefix(query, "mutation"):
+			mutations = append(mutations, body)
+			rw.Write([]byte(`{"data":{}}`))
+		case strings.HasPrefix(query, "query($id:ID! $name:String!)"):
+			// repository label by name
+			labels := map[string]string{"bug": "L1", "feature": "L2"}
+			id, ok := labels[body.Variables["name"].(string)]
+			if !ok {
+				rw.Write([]byte(`{"data":{"node":{"repository":{"label":null}}}}`))
+				return
+			}
+			rw.Write([]byte(`{"data":{"node":{"repository":{"label":{"id":"` + id + `"}}}}}`))
+		default:
+			rw.Write([]byte(testPullRequestNode))
+		}
+	}))
+	defer server.Close()
+
+	s := NewIntegration(hclog.New(&hclog.LoggerOptions{
+		Name: "test",
+	}))
+	assert.NoError(s.Init(nil))
+
+	config := rpcdef.ExportConfig{}
+	config.Pinpoint.CustomerID = "c1"
+	config.Integration.Config = map[string]interface{}{
+		"url":     server.URL,
+		"api_key": "token1",
+	}
+
+	res, err := s.Mutate(context.Background(), fn, data, config)
+	assert.NoError(err)
+	return
+}
+
+func assertUpdatedPR(t *testing.T, res rpcdef.MutateResult) {
+	assert := assert.New(t)
+	assert.Empty(res.Error)
+	prs := res.MutatedObjects[sourcecode.PullRequestModelName.String()]
+	if assert.Len(prs, 1) {
+		pr := prs[0].(map[string]interface{})
+		assert.Equal("PR1", pr["ref_id"])
+		assert.Equal("pinpt/test#3", pr["identifier"])
+	}
+}
+
+func TestMutatePullRequest(t *testing.T) {
+	cases := []struct {
+		Fn       string
+		Data     string
+		Mutation string
+		Vars     map[string]interface{}
+	}{
+		{mutate.ActionPrAddReviewers, `{"ref_id":"PR1","user_ref_ids":["U1"]}`, "requestReviews", map[string]interface{}{"id": "PR1", "userIds": []interface{}{"U1"}}},
+		{mutate.ActionPrAddLabels, `{"ref_id":"PR1","labels":["feature"]}`, "addLabelsToLabelable", map[string]interface{}{"id": "PR1", "labelIds": []interface{}{"L2"}}},
+		{mutate.ActionPrRemoveLabels, `{"ref_id":"PR1","labels":["bug"]}`, "removeLabelsFromLabelable", map[string]interface{}{"id": "PR1", "labelIds": []interface{}{"L1"}}},
+		{mutate.ActionPrAddAssignees, `{"ref_id":"PR1","user_ref_ids":["U1","U2"]}`, "addAssigneesToAssignable", map[string]interface{}{"id": "PR1", "assigneeIds": []interface{}{"U1", "U2"}}},
+		{mutate.ActionPrRemoveAssignees, `{"ref_id":"PR1","user_ref_ids":["U1"]}`, "removeAssigneesFromAssignable", map[string]interface{}{"id": "PR1", "assigneeIds": []interface{}{"U1"}}},
+		{mutate.ActionPrAddComment, `{"ref_id":"PR1","body":"Looks good"}`, "addComment", map[string]interface{}{"id": "PR1", "body": "Looks good"}},
+		{mutate.ActionPrMerge, `{"ref_id":"PR1"}`, "mergePullRequest", map[string]interface{}{"id": "PR1", "mergeMethod": "MERGE"}},
+		{mutate.ActionPrMerge, `{"ref_id":"PR1","merge_method":"SQUASH"}`, "mergePullRequest", map[string]interface{}{"id": "PR1", "mergeMethod": "SQUASH"}},
+		{mutate.ActionPrClose, `{"ref_id":"PR1"}`, "closePullRequest", map[string]interface{}{"id": "PR1"}},
+		{mutate.ActionPrReopen, `{"ref_id":"PR1"}`, "reopenPullRequest", map[string]interface{}{"id": "PR1"}},
+		{mutate.ActionPrSetDraft, `{"ref_id":"PR1"}`, "convertPullRequestToDraft", map[string]interface{}{"id": "PR1"}},
+		{mutate.ActionPrSetReady, `{"ref_id":"PR1"}`, "markPullRequestReadyForReview", map[string]interface{}{"id": "PR1"}},
+		{agent.IntegrationMutationRequestActionPrSetTitle.String(), `{"ref_id":"PR1","title":"Add readme"}`, "updatePullRequest", map[string]interface{}{"id": "PR1", "title": "Add readme"}},
+		{agent.IntegrationMutationRequestActionPrSetDescription.String(), `{"ref_id":"PR1","body_markdown":"Adds readme"}`, "updatePullRequest", map[string]interface{}{"id": "PR1", "body": "Adds readme"}},
+	}
+	for _, c := range cases {
+		t.Run(c.Fn, func(t *testing.T) {
+			assert := assert.New(t)
+			mutations, res := testMutate(t, c.Fn, c.Data, false)
+			assertUpdatedPR(t, res)
+			if assert.Len(mutations, 1) {
+				assert.Contains(mutations[0].Query, c.Mutation+"(input:")
+				assert.Equal(c.Vars, mutations[0].Variables)
+			}
+		})
+	}
+}
+
+func TestMutatePullRequestInvalidData(t *testing.T) {
+	assert := assert.New(t)
+
+	mutations, res := testMutate(t, mutate.ActionPrAddLabels, `{"ref_id":"PR1","labels":["missing"]}`, false)
+	assert.Empty(mutations)
+	assert.Contains(res.Error, "label not found in repository: missing")
+
+	mutations, res = testMutate(t, mutate.ActionPrMerge, `{"ref_id":"PR1","merge_method":"FAST_FORWARD"}`, false)
+	assert.Empty(mutations)
+	assert.Contains(res.Error, "invalid merge_method")
+
+	_, res = testMutate(t, mutate.ActionPrClose, `{}`, false)
+	assert.Equal("ref_id field not provided", res.Error)
+}
+
+func TestMutatePullRequestNotFound(t *testing.T) {
+	assert := assert.New(t)
+	_, res := testMutate(t, mutate.ActionPrClose, `{"ref_id":"PR2"}`, true)
+	assert.NotEmpty(res.Error)
+	assert.Equal(mutate.ErrNotFound, res.ErrorCode)
+}
@@ -2,15 +2,21 @@ package main
 
 import (
 	"context"
+	"strings"
 
 	"github.com/pinpt/agent/integrations/github/api"
 	"github.com/pinpt/agent/rpcdef"
+	"github.com/pinpt/integration-sdk/agent"
 )
 
 func (s *Integration) OnboardExport(ctx context.Context, objectType rpcdef.OnboardExportType, config rpcdef.ExportConfig) (res rpcdef.OnboardExportResult, _ error) {
 	switch objectType {
 	case rpcdef.OnboardExportTypeRepos:
 		return s.onboardExportRepos(ctx, config)
+	case rpcdef.OnboardExportTypeProjects:
+		return s.onboardExportProjects(ctx, config)
+	case rpcdef.OnboardExportTypeWorkConfig:
+		return s.onboardWorkConfig(ctx, config)
 	default:
 		res.Error = rpcdef.ErrOnboardExportNotSupported
 		return
@@ -24,34 +30,105 @@ func (s *Integration) onboardExportRepos(ctx context.Context, config rpcdef.Expo
 		return res, err
 	}
 
-	orgs, err := s.getOrgs()
+	repos, err := s.onboardReposAll()
 	if err != nil {
 		return res, err
 	}
 
 	var records []map[string]interface{}
+	for _, r := range repos {
+		records = append(records, r.ToMap())
+	}
+
+	res.Data = records
+
+	return res, nil
+}
+
+// onboardExportProjects returns repos as projects for work integration, since issues belong to repos
+func (s *Integration) onboardExportProjects(ctx context.Context, config rpcdef.ExportConfig) (res rpcdef.OnboardExportResult, _ error) {
+
+	err := s.initWithConfig(config)
+	if err != nil {
+		return res, err
+	}
+
+	repos, err := s.onboardReposAll()
+	if err != nil {
+		return res, err
+	}
+
+	var records []map[string]interface{}
+	for _, r := range repos {
+		identifier := r.Name
+		if parts := strings.Split(r.Name, "/"); len(parts) == 2 {
+			identifier = parts[1]
+		}
+		records = append(records, (&agent.ProjectResponseProjects{
+			Active:            r.Active,
+			Description:       &r.Description,
+			Identifier:        identifier,
+			Error:             agent.ProjectResponseProjectsError(r.Error),
+			Name:              r.Name,
+			RefID:             r.RefID,
+			RefType:           r.RefType,
+			WebhookPermission: r.WebhookPermission,
+		}).ToMap())
+	}
+
+	res.Data = records
+
+	return res, nil
+}
+
+func (s *Integration) onboardReposAll() (res []*agent.RepoResponseRepos, _ error) {
+	orgs, err := s.getOrgs()
+	if err != nil {
+		return nil, err
+	}
+
 	for _, org := range orgs {
 		repos, err := api.ReposForOnboardAll(s.qc, org)
 		if err != nil {
-			return res, err
-		}
-		for _, r := range repos {
-			records = append(records, r.ToMap())
+			return nil, err
 		}
+		res = append(res, repos...)
 	}
 
 	if len(orgs) == 0 {
 		// personal repos
 		repos, err := api.ReposForOnboardAll(s.qc, api.Org{})
 		if err != nil {
-			return res, err
-		}
-		for _, r := range repos {
-			records = append(records, r.ToMap())
+			return nil, err
 		}
+		res = append(res, repos...)
 	}
 
-	res.Data = records
-
 	return res, nil
 }
+
+// onboardWorkConfig maps issue statuses to work config categories. Issues are in progress when placed in project column with in progress automation.
+func (s *Integration) onboardWorkConfig(ctx context.Context, config rpcdef.ExportConfig) (res rpcdef.OnboardExportResult, _ error) {
+
+	err := s.initWithConfig(config)
+	if err != nil {
+		return res, err
+	}
+
+	ws := &agent.WorkStatusResponseWorkConfig{}
+	ws.CustomerID = s.customerID
+	ws.IntegrationID = config.Integration.ID
+	ws.RefType = s.refType
+	ws.Statuses = agent.WorkStatusResponseWorkConfigStatuses{
+		OpenStatus:       []string{api.WorkIssueStatusOpen},
+		InProgressStatus: []string{api.WorkIssueStatusInProgress},
+		ClosedStatus:     []string{api.WorkIssueStatusClosed},
+	}
+	ws.TopLevelIssue = agent.WorkStatusResponseWorkConfigTopLevelIssue{
+		Name: "Issue",
+		Type: "Issue",
+	}
+
+	res.Data = ws.ToMap()
+	return
+}
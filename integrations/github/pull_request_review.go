@@ -36,19 +36,10 @@ func (s *Integration) exportPullRequestsReviews(logger hclog.Logger, prSender *o
 func (s *Integration) exportPullRequestReviews(logger hclog.Logger, reviewsSender objsender.SessionCommon, repo api.Repo, prID string) error {
 	return api.PaginateRegularWithPageSize(pageSizeHeavyQueries, func(query string) (api.PageInfo, error) {
 
-		if !s.isAssigneeAvailableSet() {
-			s.logger.Info("check assignee availability")
+		s.checkAssigneeAvailability(func() error {
 			_, _, _, err := api.PullRequestReviewTimelineItemsPage(s.qc, repo, prID, query, true)
-			if err != nil {
-				if strings.Contains(err.Error(), "Field 'assignee' doesn't exist on type 'AssignedEvent'") {
-					s.logger.Info("setting assignee availability", "status", false)
-					s.setAssigneeAvailability(false)
-				}
-			} else {
-				s.logger.Info("setting assignee availability", "status", false)
-				s.setAssigneeAvailability(true)
-			}
-		}
+			return err
+		})
 
 		pi, res, totalCount, err := api.PullRequestReviewTimelineItemsPage(s.qc, repo, prID, query, s.isAssigneeAvailable())
 		if err != nil {
@@ -67,3 +58,21 @@ func (s *Integration) exportPullRequestReviews(logger hclog.Logger, reviewsSende
 		return pi, nil
 	})
 }
+
+// checkAssigneeAvailability checks if assignee field is available on AssignedEvent by issuing the request using it. Older enterprise versions only support user field.
+func (s *Integration) checkAssigneeAvailability(request func() error) {
+	if s.isAssigneeAvailableSet() {
+		return
+	}
+	s.logger.Info("check assignee availability")
+	err := request()
+	if err != nil {
+		if strings.Contains(err.Error(), "Field 'assignee' doesn't exist on type 'AssignedEvent'") {
+			s.logger.Info("setting assignee availability", "status", false)
+			s.setAssigneeAvailability(false)
+		}
+	} else {
+		s.logger.Info("setting assignee availability", "status", true)
+		s.setAssigneeAvailability(true)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/cmd/cmdrunnorestarts/inconfig"
 	"github.com/pinpt/agent/integrations/github/api"
 	"github.com/pinpt/agent/integrations/pkg/objsender"
 )
@@ -46,7 +47,12 @@ func (s *Integration) exportRepoMetadataPerOrgOrUser(logger hclog.Logger, sender
 			if !shouldInclude[repo.Name] {
 				continue
 			}
-			err := sender.Send(repo)
+			var err error
+			if s.integrationType == inconfig.IntegrationTypeWork {
+				err = sender.Send(workProject(repo))
+			} else {
+				err = sender.Send(repo)
+			}
 			if err != nil {
 				return pi, err
 			}
@@ -12,6 +12,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/pinpt/agent/integrations/pkg/mutate"
 	"github.com/pinpt/agent/pkg/requests"
 )
 
@@ -57,7 +58,11 @@ func (s *Integration) makeRequestNoRetries(query string, vars map[string]interfa
 	req.URL = s.config.APIURL
 	req.Body = dataJSON
 	req.Header = http.Header{}
-	req.Header.Set("Authorization", "bearer "+s.config.Token)
+	token, err := s.token()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+token)
 	s.setAcceptHeader(&req.Header)
 	req.Header.Set("Content-Type", "application/json")
 
@@ -83,6 +88,10 @@ func (s *Integration) makeRequestNoRetries(query string, vars map[string]interfa
 	json.Unmarshal(b, &errRes)
 	if len(errRes.Errors) != 0 {
 		err1 := errRes.Errors[0]
+		// graphql returns 200 status code for missing objects
+		if err1.Type == "NOT_FOUND" {
+			return resp.ErrorContext(mutate.NotFoundError{Message: err1.Message})
+		}
 		err := fmt.Errorf("api request failed: type: %v message %v", err1.Type, err1.Message)
 		return resp.ErrorContext(err)
 	}
@@ -248,7 +257,13 @@ func (s *Integration) makeRequestRetryThrottled(reqDef request, res interface{},
 		s.setAcceptHeader(&req.Header)
 	}
 
-	req.Header.Set("Authorization", "bearer "+s.config.Token)
+	token, err := s.token()
+	if err != nil {
+		rerr = err
+		isErrorRetryable = true
+		return
+	}
+	req.Header.Set("Authorization", "bearer "+token)
 	resp, err := s.clients.TLSInsecure.Do(req)
 	if err != nil {
 		rerr = err
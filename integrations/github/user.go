@@ -6,12 +6,14 @@ import (
 	"sync"
 
 	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/cmd/cmdrunnorestarts/inconfig"
 	"github.com/pinpt/agent/integrations/pkg/objsender"
 
 	pstrings "github.com/pinpt/go-common/strings"
 
 	"github.com/pinpt/agent/integrations/github/api"
 	"github.com/pinpt/integration-sdk/sourcecode"
+	"github.com/pinpt/integration-sdk/work"
 )
 
 // map[login]refID
@@ -27,8 +29,12 @@ func NewUsers(integration *Integration, noExport bool) (*Users, error) {
 	s := &Users{}
 	s.integration = integration
 	if !noExport {
+		modelName := sourcecode.UserModelName.String()
+		if integration.integrationType == inconfig.IntegrationTypeWork {
+			modelName = work.UserModelName.String()
+		}
 		var err error
-		s.sender, err = objsender.Root(integration.agent, sourcecode.UserModelName.String())
+		s.sender, err = objsender.Root(integration.agent, modelName)
 		if err != nil {
 			return nil, err
 		}
@@ -133,7 +139,7 @@ func (s *Users) sendUsers(users []*sourcecode.User) error {
 			return nil
 		}
 		s.exportedRefID[user.RefID] = true
-		err := s.sender.Send(user)
+		err := s.send(user)
 		if err != nil {
 			return err
 		}
@@ -141,6 +147,31 @@ func (s *Users) sendUsers(users []*sourcecode.User) error {
 	return nil
 }
 
+// send sends the user as work.User when exporting work integration
+func (s *Users) send(user *sourcecode.User) error {
+	if s.integration.integrationType != inconfig.IntegrationTypeWork {
+		return s.sender.Send(user)
+	}
+	var username string
+	if user.Username != nil {
+		username = *user.Username
+	}
+	return s.sender.Send(&work.User{
+		AssociatedRefID: user.AssociatedRefID,
+		AvatarURL:       user.AvatarURL,
+		CustomerID:      user.CustomerID,
+		Email:           user.Email,
+		ID:              user.ID,
+		Member:          user.Member,
+		Name:            user.Name,
+		RefID:           user.RefID,
+		RefType:         user.RefType,
+		URL:             user.URL,
+		Username:        username,
+		Hashcode:        user.Hashcode,
+	})
+}
+
 func (s *Users) exportInstanceUsers() error {
 	resChan := make(chan []*sourcecode.User)
 	done := make(chan error)
@@ -164,7 +195,7 @@ func (s *Users) exportUsersFromChan(usersChan chan []*sourcecode.User) error {
 	for users := range usersChan {
 		for _, user := range users {
 			s.loginToID[*user.Username] = user.RefID
-			err := s.sender.Send(user)
+			err := s.send(user)
 			if err != nil {
 				return err
 			}
@@ -3,8 +3,8 @@ package main
 import (
 	"context"
 	"fmt"
-	"net/url"
 
+	"github.com/pinpt/agent/cmd/cmdrunnorestarts/inconfig"
 	"github.com/pinpt/agent/integrations/github/api"
 	"github.com/pinpt/agent/rpcdef"
 )
@@ -54,6 +54,47 @@ func (s *Integration) checkTokenScopes() error {
 	return nil
 }
 
+type appPermission struct {
+	Name  string
+	Level string
+}
+
+func (s appPermission) String() string {
+	return s.Name + ":" + s.Level
+}
+
+// requiredAppPermissions returns permissions the github app needs for the features used by export, replacing token scopes
+func (s *Integration) requiredAppPermissions() []appPermission {
+	// https://docs.github.com/en/rest/reference/permissions-required-for-github-apps
+	res := []appPermission{{"metadata", "read"}, {"contents", "read"}, {"members", "read"}}
+	if s.integrationType == inconfig.IntegrationTypeWork {
+		return append(res, appPermission{"issues", "read"})
+	}
+	// webhooks are registered for sourcecode exports, including only_git
+	res = append(res, appPermission{"repository_hooks", "write"})
+	if s.config.OnlyGit {
+		return res
+	}
+	return append(res, appPermission{"pull_requests", "read"}, appPermission{"checks", "read"}, appPermission{"deployments", "read"})
+}
+
+func (s *Integration) checkAppPermissions() error {
+	inst, err := s.appTokens.Installation()
+	if err != nil {
+		return err
+	}
+	if inst.Account.Type != "Organization" {
+		return fmt.Errorf("github app must be installed on an organization, got installation on %v %v", inst.Account.Type, inst.Account.Login)
+	}
+	required := s.requiredAppPermissions()
+	for _, p := range required {
+		if !inst.HasPermission(p.Name, p.Level) {
+			return fmt.Errorf("No required permission %v with %v access. Permissions wanted: %v got: %v", p.Name, p.Level, required, inst.Permissions)
+		}
+	}
+	return nil
+}
+
 func (s *Integration) ValidateConfig(ctx context.Context,
 	exportConfig rpcdef.ExportConfig) (res rpcdef.ValidationResult, _ error) {
 
@@ -77,10 +118,18 @@ func (s *Integration) ValidateConfig(ctx context.Context,
 		res.ServerVersion = "cloud"
 	}
 
-	err = s.checkTokenScopes()
-	if err != nil {
-		rerr(fmt.Errorf("Token scope err: %v", err))
-		return
+	if s.appTokens != nil {
+		err = s.checkAppPermissions()
+		if err != nil {
+			rerr(fmt.Errorf("Github app permission err: %v", err))
+			return
+		}
+	} else {
+		err = s.checkTokenScopes()
+		if err != nil {
+			rerr(fmt.Errorf("Token scope err: %v", err))
+			return
+		}
 	}
 
 	orgs, err := s.getOrgs()
@@ -103,7 +152,7 @@ LOOP:
 			return
 		}
 		if len(repos) > 0 {
-			repoURL, err := getRepoURL(s.config.RepoURLPrefix, url.UserPassword(s.config.Token, ""), repos[0].NameWithOwner)
+			repoURL, err := s.repoURL(repos[0].NameWithOwner)
 			if err != nil {
 				rerr(err)
 				return
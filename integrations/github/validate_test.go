@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/pinpt/agent/cmd/cmdrunnorestarts/inconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequiredAppPermissions(t *testing.T) {
+	names := func(s *Integration) (res []string) {
+		for _, p := range s.requiredAppPermissions() {
+			res = append(res, p.String())
+		}
+		return
+	}
+	s := &Integration{}
+	s.integrationType = inconfig.IntegrationTypeSourcecode
+	assert.Equal(t, []string{"metadata:read", "contents:read", "members:read", "repository_hooks:write", "pull_requests:read", "checks:read", "deployments:read"}, names(s))
+
+	s.config.OnlyGit = true
+	assert.Equal(t, []string{"metadata:read", "contents:read", "members:read", "repository_hooks:write"}, names(s))
+
+	s = &Integration{}
+	s.integrationType = inconfig.IntegrationTypeWork
+	assert.Equal(t, []string{"metadata:read", "contents:read", "members:read", "issues:read"}, names(s))
+}
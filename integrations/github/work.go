@@ -0,0 +1,198 @@
+package main
+
+import (
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/integrations/github/api"
+	"github.com/pinpt/agent/integrations/pkg/objsender"
+	"github.com/pinpt/agent/integrations/pkg/repoprojects"
+	"github.com/pinpt/integration-sdk/sourcecode"
+	"github.com/pinpt/integration-sdk/work"
+)
+
+func workProject(repo *sourcecode.Repo) *work.Project {
+	return &work.Project{
+		Active:      repo.Active,
+		CustomerID:  repo.CustomerID,
+		Description: &repo.Description,
+		ID:          repo.ID,
+		Name:        repo.Name,
+		RefID:       repo.RefID,
+		RefType:     repo.RefType,
+		UpdatedAt:   repo.UpdatedAt,
+		URL:         repo.URL,
+		Hashcode:    repo.Hashcode,
+	}
+}
+
+// exportWorkIssueStatuses exports statuses used for all issues. Statuses are fixed, since github issues only have open and closed states.
+func (s *Integration) exportWorkIssueStatuses() error {
+	sender, err := objsender.Root(s.agent, work.IssueStatusModelName.String())
+	if err != nil {
+		return err
+	}
+	statuses := api.WorkIssueStatuses(s.qc)
+	err = sender.SetTotal(len(statuses))
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		err := sender.Send(status)
+		if err != nil {
+			return err
+		}
+	}
+	return sender.Done()
+}
+
+func (s *Integration) exportWorkProject(ctx *repoprojects.ProjectCtx, repo api.Repo) error {
+	logger := ctx.Logger
+
+	// milestones are needed to link milestone changes in issue timeline to sprints
+	milestoneRefIDs, err := s.exportWorkSprints(ctx, repo)
+	if err != nil {
+		return err
+	}
+
+	// boards are optional, projects could be disabled for the repo
+	err = s.exportWorkBoards(ctx, repo)
+	if err != nil {
+		logger.Error("could not export project boards", "repo", repo.NameWithOwner, "err", err)
+	}
+
+	return s.exportWorkIssues(ctx, repo, milestoneRefIDs)
+}
+
+// exportWorkSprints exports all milestones of the repo as sprints and returns map[title]refID
+func (s *Integration) exportWorkSprints(ctx *repoprojects.ProjectCtx, repo api.Repo) (milestoneRefIDs map[string]string, _ error) {
+	sender, err := ctx.Session(work.SprintModelName)
+	if err != nil {
+		return nil, err
+	}
+	milestoneRefIDs = map[string]string{}
+	err = api.PaginateRegular(func(query string) (api.PageInfo, error) {
+		pi, res, totalCount, err := api.WorkSprintsPage(s.qc.WithLogger(ctx.Logger), repo, query)
+		if err != nil {
+			return pi, err
+		}
+		err = sender.SetTotal(totalCount)
+		if err != nil {
+			return pi, err
+		}
+		for _, obj := range res {
+			milestoneRefIDs[obj.Name] = obj.RefID
+			err := sender.Send(obj)
+			if err != nil {
+				return pi, err
+			}
+		}
+		return pi, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return milestoneRefIDs, nil
+}
+
+func (s *Integration) exportWorkBoards(ctx *repoprojects.ProjectCtx, repo api.Repo) error {
+	sender, err := ctx.Session(work.KanbanBoardModelName)
+	if err != nil {
+		return err
+	}
+	return api.PaginateRegular(func(query string) (api.PageInfo, error) {
+		pi, res, totalCount, err := api.WorkBoardsPage(s.qc.WithLogger(ctx.Logger), repo, query)
+		if err != nil {
+			return pi, err
+		}
+		err = sender.SetTotal(totalCount)
+		if err != nil {
+			return pi, err
+		}
+		for _, obj := range res {
+			err := sender.Send(obj)
+			if err != nil {
+				return pi, err
+			}
+		}
+		return pi, nil
+	})
+}
+
+func (s *Integration) exportWorkIssues(ctx *repoprojects.ProjectCtx, repo api.Repo, milestoneRefIDs map[string]string) error {
+	logger := ctx.Logger
+
+	issuesSender, err := ctx.Session(work.IssueModelName)
+	if err != nil {
+		return err
+	}
+	commentsSender, err := ctx.Session(work.IssueCommentModelName)
+	if err != nil {
+		return err
+	}
+
+	lastProcessed := issuesSender.LastProcessedTime()
+
+	return api.PaginateNewerThanWithPageSize(lastProcessed, pageSizeHeavyQueries, func(query string, stopOnUpdatedAt time.Time) (api.PageInfo, error) {
+		pi, res, totalCount, err := api.WorkIssuesPage(s.qc.WithLogger(logger), repo, query, stopOnUpdatedAt)
+		if err != nil {
+			return pi, err
+		}
+		err = issuesSender.SetTotal(totalCount)
+		if err != nil {
+			return pi, err
+		}
+		for _, issue := range res {
+			if issue.HasTimelineItems {
+				err := s.exportWorkIssueChangelog(logger, issue, milestoneRefIDs)
+				if err != nil {
+					return pi, err
+				}
+			}
+			err := issuesSender.Send(issue.Issue)
+			if err != nil {
+				return pi, err
+			}
+			if issue.HasComments {
+				err := s.exportWorkIssueComments(logger, commentsSender, repo, issue.RefID)
+				if err != nil {
+					return pi, err
+				}
+			}
+		}
+		return pi, nil
+	})
+}
+
+// exportWorkIssueChangelog adds changelog from issue timeline to the issue
+func (s *Integration) exportWorkIssueChangelog(logger hclog.Logger, issue api.WorkIssue, milestoneRefIDs map[string]string) error {
+	qc := s.qc.WithLogger(logger)
+	return api.PaginateRegularWithPageSize(pageSizeHeavyQueries, func(query string) (api.PageInfo, error) {
+		s.checkAssigneeAvailability(func() error {
+			_, _, _, err := api.WorkIssueChangelogPage(qc, issue.RefID, query, true, milestoneRefIDs)
+			return err
+		})
+		pi, res, _, err := api.WorkIssueChangelogPage(qc, issue.RefID, query, s.isAssigneeAvailable(), milestoneRefIDs)
+		if err != nil {
+			return pi, err
+		}
+		issue.ChangeLog = append(issue.ChangeLog, res...)
+		return pi, nil
+	})
+}
+
+func (s *Integration) exportWorkIssueComments(logger hclog.Logger, commentsSender *objsender.Session, repo api.Repo, issueRefID string) error {
+	return api.PaginateRegularWithPageSize(pageSizeHeavyQueries, func(query string) (api.PageInfo, error) {
+		pi, res, _, err := api.WorkIssueCommentsPage(s.qc.WithLogger(logger), repo, issueRefID, query)
+		if err != nil {
+			return pi, err
+		}
+		for _, obj := range res {
+			err := commentsSender.Send(obj)
+			if err != nil {
+				return pi, err
+			}
+		}
+		return pi, nil
+	})
+}
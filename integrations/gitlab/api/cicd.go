@@ -0,0 +1,225 @@
+package api
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/integrations/pkg/commoncicd"
+	"github.com/pinpt/agent/integrations/pkg/commonrepo"
+	"github.com/pinpt/agent/pkg/date"
+	pstrings "github.com/pinpt/go-common/strings"
+	"github.com/pinpt/integration-sdk/cicd"
+)
+
+type pipelineResponse struct {
+	ID         int64     `json:"id"`
+	SHA        string    `json:"sha"`
+	Ref        string    `json:"ref"`
+	Status     string    `json:"status"`
+	Source     string    `json:"source"`
+	WebURL     string    `json:"web_url"`
+	CreatedAt  time.Time `json:"created_at"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// PipelinesPage returns finished pipelines updated after updatedAfter as builds. Pipelines that are still running are skipped, they will be exported once finished.
+func PipelinesPage(
+	qc QueryContext,
+	repo commonrepo.Repo,
+	params url.Values,
+	updatedAfter time.Time) (pi PageInfo, res []*cicd.Build, err error) {
+
+	qc.Logger.Debug("repo pipelines", "repo_ref_id", repo.RefID, "repo", repo.NameWithOwner, "updated_after", updatedAfter.String(), "params", params)
+
+	objectPath := pstrings.JoinURL("projects", url.QueryEscape(repo.RefID), "pipelines")
+	params.Set("per_page", "100")
+	params.Set("updated_after", updatedAfter.UTC().Format(time.RFC3339))
+	params.Set("order_by", "updated_at")
+	params.Set("sort", "asc")
+
+	var rpipelines []pipelineResponse
+	pi, err = qc.Request(objectPath, params, &rpipelines)
+	if err != nil {
+		return
+	}
+
+	for _, rp := range rpipelines {
+		status, ok := buildStatus(rp.Status)
+		if !ok {
+			continue
+		}
+		// list does not include start and finish times
+		var detail pipelineResponse
+		_, err = qc.Request(pstrings.JoinURL(objectPath, strconv.FormatInt(rp.ID, 10)), nil, &detail)
+		if err != nil {
+			return
+		}
+		if detail.Source == "" {
+			detail.Source = rp.Source
+		}
+		res = append(res, convertPipeline(qc, repo, detail, status))
+	}
+	return
+}
+
+func buildStatus(status string) (res cicd.BuildStatus, finished bool) {
+	switch status {
+	case "success", "skipped":
+		return cicd.BuildStatusPass, true
+	case "failed":
+		return cicd.BuildStatusFail, true
+	case "canceled":
+		return cicd.BuildStatusCancel, true
+	}
+	// created, waiting_for_resource, preparing, pending, running, manual, scheduled
+	return
+}
+
+func convertPipeline(qc QueryContext, repo commonrepo.Repo, rp pipelineResponse, status cicd.BuildStatus) *cicd.Build {
+	build := &cicd.Build{}
+	build.CustomerID = qc.CustomerID
+	build.RefType = qc.RefType
+	build.RefID = strconv.FormatInt(rp.ID, 10)
+	build.RepoName = repo.NameWithOwner
+	build.Branch = rp.Ref
+	build.CommitSha = rp.SHA
+	build.URL = rp.WebURL
+	build.Status = status
+	// web is used for pipelines started manually in ui
+	build.Automated = rp.Source != "web"
+	build.Environment = commoncicd.BuildEnvironment(rp.Ref)
+	startedAt := rp.StartedAt
+	if startedAt.IsZero() {
+		// skipped and canceled pipelines may not have started
+		startedAt = rp.CreatedAt
+	}
+	date.ConvertToModel(startedAt, &build.StartDate)
+	date.ConvertToModel(rp.FinishedAt, &build.EndDate)
+	return build
+}
+
+type deploymentResponse struct {
+	ID          int64     `json:"id"`
+	SHA         string    `json:"sha"`
+	Ref         string    `json:"ref"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+	Environment struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	} `json:"environment"`
+	Deployable struct {
+		Status     string    `json:"status"`
+		WebURL     string    `json:"web_url"`
+		StartedAt  time.Time `json:"started_at"`
+		FinishedAt time.Time `json:"finished_at"`
+	} `json:"deployable"`
+}
+
+type environmentResponse struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	// Tier is only returned by newer versions
+	Tier string `json:"tier"`
+}
+
+// Environments returns the deployment environment for each environment id of the project
+func Environments(qc QueryContext, repo commonrepo.Repo) (res map[int64]cicd.DeploymentEnvironment, err error) {
+	res = map[int64]cicd.DeploymentEnvironment{}
+	objectPath := pstrings.JoinURL("projects", url.QueryEscape(repo.RefID), "environments")
+	err = PaginateStartAt(qc.Logger, func(log hclog.Logger, params url.Values) (pi PageInfo, err error) {
+		params.Set("per_page", "100")
+		var renvs []environmentResponse
+		pi, err = qc.Request(objectPath, params, &renvs)
+		if err != nil {
+			return
+		}
+		for _, env := range renvs {
+			res[env.ID] = deploymentEnvironment(env)
+		}
+		return
+	})
+	return
+}
+
+func deploymentEnvironment(env environmentResponse) cicd.DeploymentEnvironment {
+	switch env.Tier {
+	case "production":
+		return cicd.DeploymentEnvironmentProduction
+	case "staging", "testing":
+		return cicd.DeploymentEnvironmentBeta
+	case "development":
+		return cicd.DeploymentEnvironmentDevelopment
+	}
+	return commoncicd.DeploymentEnvironment(env.Name)
+}
+
+// DeploymentsPage returns finished deployments updated after updatedAfter
+func DeploymentsPage(
+	qc QueryContext,
+	repo commonrepo.Repo,
+	environments map[int64]cicd.DeploymentEnvironment,
+	params url.Values,
+	updatedAfter time.Time) (pi PageInfo, res []*cicd.Deployment, err error) {
+
+	qc.Logger.Debug("repo deployments", "repo_ref_id", repo.RefID, "repo", repo.NameWithOwner, "updated_after", updatedAfter.String(), "params", params)
+
+	objectPath := pstrings.JoinURL("projects", url.QueryEscape(repo.RefID), "deployments")
+	params.Set("per_page", "100")
+	params.Set("updated_after", updatedAfter.UTC().Format(time.RFC3339))
+	params.Set("order_by", "updated_at")
+	params.Set("sort", "asc")
+
+	var rdeployments []deploymentResponse
+	pi, err = qc.Request(objectPath, params, &rdeployments)
+	if err != nil {
+		return
+	}
+	for _, rd := range rdeployments {
+		item := convertDeployment(qc, repo, environments, rd)
+		if item == nil {
+			continue
+		}
+		res = append(res, item)
+	}
+	return
+}
+
+// convertDeployment returns nil if deployment is not finished
+func convertDeployment(qc QueryContext, repo commonrepo.Repo, environments map[int64]cicd.DeploymentEnvironment, rd deploymentResponse) *cicd.Deployment {
+	item := &cicd.Deployment{}
+	switch rd.Status {
+	case "success":
+		item.Status = cicd.DeploymentStatusPass
+	case "failed":
+		item.Status = cicd.DeploymentStatusFail
+	case "canceled":
+		item.Status = cicd.DeploymentStatusCancel
+	default:
+		// created, running, blocked
+		return nil
+	}
+	item.CustomerID = qc.CustomerID
+	item.RefType = qc.RefType
+	item.RefID = strconv.FormatInt(rd.ID, 10)
+	item.RepoName = repo.NameWithOwner
+	item.CommitSha = rd.SHA
+	item.URL = rd.Deployable.WebURL
+	// api does not tell if the deploy job was started manually, so all deployments are considered to be automated
+	item.Automated = true
+	if env, ok := environments[rd.Environment.ID]; ok {
+		item.Environment = env
+	} else {
+		item.Environment = commoncicd.DeploymentEnvironment(rd.Environment.Name)
+	}
+	startedAt := rd.Deployable.StartedAt
+	if startedAt.IsZero() {
+		startedAt = rd.CreatedAt
+	}
+	date.ConvertToModel(startedAt, &item.StartDate)
+	date.ConvertToModel(rd.Deployable.FinishedAt, &item.EndDate)
+	return item
+}
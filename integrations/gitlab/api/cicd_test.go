@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/integrations/pkg/commonrepo"
+	"github.com/pinpt/integration-sdk/cicd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertDeployment(t *testing.T) {
+	assert := assert.New(t)
+	qc := QueryContext{}
+	qc.Logger = hclog.New(&hclog.LoggerOptions{Name: "test"})
+	qc.CustomerID = "c1"
+	qc.RefType = "gitlab"
+	repo := commonrepo.Repo{RefID: "1", NameWithOwner: "pinpt/test"}
+
+	var rds []deploymentResponse
+	err := json.Unmarshal([]byte(`[
+		{"id":41,"sha":"s1","status":"success","created_at":"2020-05-02T10:00:00Z","environment":{"id":1,"name":"live"},"deployable":{"web_url":"https://gitlab.com/pinpt/test/-/jobs/7","started_at":"2020-05-02T10:01:00Z","finished_at":"2020-05-02T10:05:00Z"}},
+		{"id":42,"sha":"s2","status":"failed","created_at":"2020-05-02T11:00:00Z","environment":{"id":2,"name":"review/fix"}},
+		{"id":43,"sha":"s3","status":"running","created_at":"2020-05-02T12:00:00Z","environment":{"id":1,"name":"live"}}
+	]`), &rds)
+	assert.NoError(err)
+
+	environments := map[int64]cicd.DeploymentEnvironment{
+		1: deploymentEnvironment(environmentResponse{ID: 1, Name: "live", Tier: "production"}),
+	}
+
+	d := convertDeployment(qc, repo, environments, rds[0])
+	if assert.NotNil(d) {
+		assert.Equal("41", d.RefID)
+		assert.Equal("s1", d.CommitSha)
+		assert.Equal("pinpt/test", d.RepoName)
+		assert.Equal("https://gitlab.com/pinpt/test/-/jobs/7", d.URL)
+		assert.Equal(cicd.DeploymentStatusPass, d.Status)
+		assert.Equal(cicd.DeploymentEnvironmentProduction, d.Environment)
+	}
+	d = convertDeployment(qc, repo, environments, rds[1])
+	if assert.NotNil(d) {
+		assert.Equal(cicd.DeploymentStatusFail, d.Status)
+		assert.Equal(cicd.DeploymentEnvironmentOther, d.Environment)
+	}
+	assert.Nil(convertDeployment(qc, repo, environments, rds[2]))
+}
+
+func TestBuildStatus(t *testing.T) {
+	assert := assert.New(t)
+	status, ok := buildStatus("failed")
+	assert.True(ok)
+	assert.Equal(cicd.BuildStatusFail, status)
+	_, ok = buildStatus("running")
+	assert.False(ok)
+}
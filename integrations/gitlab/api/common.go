@@ -22,6 +22,10 @@ type QueryContext struct {
 	BaseURL string
 	Logger  hclog.Logger
 	Request func(url string, params url.Values, response interface{}) (PageInfo, error)
+	// RequestJSON makes a request with any http method and optional json body. Used for writes, such as webhook registration.
+	RequestJSON func(method string, url string, params url.Values, body interface{}, response interface{}) error
+	// GraphQL makes a graphql api request, only used for lookups not supported by rest api
+	GraphQL func(query string, vars map[string]interface{}, response interface{}) error
 
 	CustomerID string
 	RefType    string
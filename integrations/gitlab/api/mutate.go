@@ -0,0 +1,131 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pinpt/agent/integrations/pkg/mutate"
+	"github.com/pinpt/agent/pkg/date"
+	pstrings "github.com/pinpt/go-common/strings"
+	"github.com/pinpt/integration-sdk/work"
+)
+
+// PullRequestProjectAndIID returns project id and iid of merge request from its ref_id. ref_id is the global merge request id, which rest api does not support, so it is resolved using graphql api.
+// https://docs.gitlab.com/ee/api/graphql/reference/#querymergerequest
+func PullRequestProjectAndIID(qc QueryContext, refID string) (projectID string, iid string, rerr error) {
+	if refID == "" {
+		rerr = errors.New("ref_id field not provided")
+		return
+	}
+	query := `query($id: MergeRequestID!) {
+		mergeRequest(id: $id) {
+			iid
+			project {
+				id
+			}
+		}
+	}`
+	vars := map[string]interface{}{
+		"id": "gid://gitlab/MergeRequest/" + refID,
+	}
+	var res struct {
+		MergeRequest *struct {
+			IID     string `json:"iid"`
+			Project struct {
+				ID string `json:"id"`
+			} `json:"project"`
+		} `json:"mergeRequest"`
+	}
+	err := qc.GraphQL(query, vars, &res)
+	if err != nil {
+		rerr = err
+		return
+	}
+	if res.MergeRequest == nil {
+		rerr = mutate.NotFoundError{Message: "merge request " + refID}
+		return
+	}
+	// project id is also a global id, for example gid://gitlab/Project/15
+	gid := res.MergeRequest.Project.ID
+	projectID = gid[strings.LastIndex(gid, "/")+1:]
+	return projectID, res.MergeRequest.IID, nil
+}
+
+// PullRequestEdit updates merge request fields, such as title or description.
+// https://docs.gitlab.com/ee/api/merge_requests.html#update-mr
+func PullRequestEdit(qc QueryContext, projectID string, iid string, fields map[string]interface{}) error {
+	qc.Logger.Info("editing merge request", "project", projectID, "iid", iid)
+
+	var res interface{}
+	return qc.RequestJSON(http.MethodPut, pstrings.JoinURL("projects", url.QueryEscape(projectID), "merge_requests", iid), nil, fields, &res)
+}
+
+// WorkIssueEdit updates issue fields, such as title, assignee_ids or state_event.
+// https://docs.gitlab.com/ee/api/issues.html#edit-issue
+func WorkIssueEdit(qc QueryContext, projectID string, iid string, fields map[string]interface{}) error {
+	qc.Logger.Info("editing issue", "project", projectID, "iid", iid)
+
+	var res interface{}
+	return qc.RequestJSON(http.MethodPut, pstrings.JoinURL("projects", url.QueryEscape(projectID), "issues", iid), nil, fields, &res)
+}
+
+// WorkIssueAddComment creates a note on issue
+// https://docs.gitlab.com/ee/api/notes.html#create-new-issue-note
+func WorkIssueAddComment(qc QueryContext, projectID string, iid string, body string) (_ *work.IssueComment, rerr error) {
+	qc.Logger.Info("adding issue comment", "project", projectID, "iid", iid)
+
+	var res struct {
+		ID        int64     `json:"id"`
+		Body      string    `json:"body"`
+		Author    UserModel `json:"author"`
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+	data := map[string]interface{}{
+		"body": body,
+	}
+	err := qc.RequestJSON(http.MethodPost, pstrings.JoinURL("projects", url.QueryEscape(projectID), "issues", iid, "notes"), nil, data, &res)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	// same fields as in WorkIssuesDiscussionsPage
+	comment := &work.IssueComment{
+		RefID:     fmt.Sprint(res.ID),
+		RefType:   qc.RefType,
+		UserRefID: strconv.FormatInt(res.Author.ID, 10),
+		IssueID:   iid,
+		ProjectID: projectID,
+		Body:      res.Body,
+	}
+	date.ConvertToModel(res.CreatedAt, &comment.CreatedDate)
+	date.ConvertToModel(res.UpdatedAt, &comment.UpdatedDate)
+	return comment, nil
+}
+
+// WorkIssueTransitions returns possible state changes for issue. Gitlab issues only have opened and closed states, transition id is the state_event to pass to WorkIssueEdit.
+func WorkIssueTransitions(qc QueryContext, projectID string, iid string) (res []mutate.IssueTransition, rerr error) {
+	var issue struct {
+		State string `json:"state"`
+	}
+	err := qc.RequestJSON(http.MethodGet, pstrings.JoinURL("projects", url.QueryEscape(projectID), "issues", iid), nil, nil, &issue)
+	if err != nil {
+		rerr = err
+		return
+	}
+	switch issue.State {
+	case "opened":
+		res = append(res, mutate.IssueTransition{ID: "close", Name: "Close"})
+	case "closed":
+		res = append(res, mutate.IssueTransition{ID: "reopen", Name: "Reopen"})
+	default:
+		rerr = fmt.Errorf("unknown issue state: %v", issue.State)
+	}
+	return
+}
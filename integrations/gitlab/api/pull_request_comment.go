@@ -12,6 +12,17 @@ import (
 	"github.com/pinpt/integration-sdk/sourcecode"
 )
 
+type pullRequestCommentResponse struct {
+	ID     int64 `json:"id"`
+	Author struct {
+		ID int64 `json:"id"`
+	} `json:"author"`
+	Body      string    `json:"body"`
+	UpdatedAt time.Time `json:"updated_at"`
+	CreatedAt time.Time `json:"created_at"`
+	System    bool      `json:"system"`
+}
+
 func PullRequestCommentsPage(
 	qc QueryContext,
 	repo commonrepo.Repo,
@@ -22,45 +33,65 @@ func PullRequestCommentsPage(
 
 	objectPath := pstrings.JoinURL("projects", url.QueryEscape(repo.RefID), "merge_requests", pr.IID, "notes")
 
-	var rcomments []struct {
-		ID     int64 `json:"id"`
-		Author struct {
-			ID int64 `json:"id"`
-		} `json:"author"`
-		Body      string    `json:"body"`
-		UpdatedAt time.Time `json:"updated_at"`
-		CreatedAt time.Time `json:"created_at"`
-		System    bool      `json:"system"`
-	}
+	var rcomments []pullRequestCommentResponse
 
 	pi, err = qc.Request(objectPath, params, &rcomments)
 	if err != nil {
 		return
 	}
 
-	u, err := url.Parse(qc.BaseURL)
-	if err != nil {
-		return pi, res, err
-	}
-
 	for _, rcomment := range rcomments {
 		if rcomment.System {
 			continue
 		}
-		item := &sourcecode.PullRequestComment{}
-		item.CustomerID = qc.CustomerID
-		item.RefType = qc.RefType
-		item.RefID = fmt.Sprint(rcomment.ID)
-		item.URL = pstrings.JoinURL(u.Scheme, "://", u.Hostname(), repo.NameWithOwner, "merge_requests", pr.IID)
-		date.ConvertToModel(rcomment.UpdatedAt, &item.UpdatedDate)
-		item.RepoID = qc.IDs.CodeRepo(repo.RefID)
-		item.PullRequestID = qc.IDs.CodePullRequest(item.RepoID, pr.ID)
-		item.Body = rcomment.Body
-		date.ConvertToModel(rcomment.CreatedAt, &item.CreatedDate)
-
-		item.UserRefID = strconv.FormatInt(rcomment.Author.ID, 10)
+		item, err := convertPullRequestComment(qc, repo, pr, rcomment)
+		if err != nil {
+			return pi, res, err
+		}
 		res = append(res, item)
 	}
 
 	return
 }
+
+// PullRequestComment returns a single pull request comment. Returns nil if the note is a system note, since those are not exported as comments.
+func PullRequestComment(qc QueryContext, repo commonrepo.Repo, pr PullRequest, noteID string) (res *sourcecode.PullRequestComment, err error) {
+
+	qc.Logger.Debug("pull request comment", "repo", repo.RefID, "pr_iid", pr.IID, "note_id", noteID)
+
+	objectPath := pstrings.JoinURL("projects", url.QueryEscape(repo.RefID), "merge_requests", pr.IID, "notes", noteID)
+
+	var rcomment pullRequestCommentResponse
+
+	_, err = qc.Request(objectPath, nil, &rcomment)
+	if err != nil {
+		return
+	}
+
+	if rcomment.System {
+		return nil, nil
+	}
+
+	return convertPullRequestComment(qc, repo, pr, rcomment)
+}
+
+func convertPullRequestComment(qc QueryContext, repo commonrepo.Repo, pr PullRequest, rcomment pullRequestCommentResponse) (*sourcecode.PullRequestComment, error) {
+	u, err := url.Parse(qc.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	item := &sourcecode.PullRequestComment{}
+	item.CustomerID = qc.CustomerID
+	item.RefType = qc.RefType
+	item.RefID = fmt.Sprint(rcomment.ID)
+	item.URL = pstrings.JoinURL(u.Scheme, "://", u.Hostname(), repo.NameWithOwner, "merge_requests", pr.IID)
+	date.ConvertToModel(rcomment.UpdatedAt, &item.UpdatedDate)
+	item.RepoID = qc.IDs.CodeRepo(repo.RefID)
+	item.PullRequestID = qc.IDs.CodePullRequest(item.RepoID, pr.ID)
+	item.Body = rcomment.Body
+	date.ConvertToModel(rcomment.CreatedAt, &item.CreatedDate)
+
+	item.UserRefID = strconv.FormatInt(rcomment.Author.ID, 10)
+	return item, nil
+}
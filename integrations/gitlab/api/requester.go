@@ -8,10 +8,12 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/pkg/requests"
 	"github.com/pinpt/agent/rpcdef"
 	"github.com/pinpt/go-common/httpdefaults"
 	pstrings "github.com/pinpt/go-common/strings"
@@ -92,6 +94,75 @@ func (e *Requester) MakeRequest(url string, params url.Values, response interfac
 
 }
 
+// MakeRequestJSON makes a request using passed http method, marshalling body to json if not nil. It does not retry, since it is used for non-idempotent requests. Returned error wraps requests.StatusCodeError on unexpected status codes.
+func (e *Requester) MakeRequestJSON(method string, url string, params url.Values, body interface{}, response interface{}) error {
+	e.opts.Concurrency <- true
+	defer func() {
+		<-e.opts.Concurrency
+	}()
+
+	req := requests.NewRequest()
+	req.Method = method
+	req.URL = pstrings.JoinURL(e.opts.APIURL, url)
+	for k, v := range params {
+		req.Query[k] = v
+	}
+	e.setAuthHeader(req.Header)
+
+	if body != nil {
+		var err error
+		req.Body, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	reqs := requests.New(e.opts.Logger, e.opts.Client)
+	_, err := reqs.JSON(req, response)
+	return err
+}
+
+// MakeGraphQL makes a graphql api request and unmarshals data field of the result into response. Errors returned in the result are returned as error.
+// https://docs.gitlab.com/ee/api/graphql/
+func (e *Requester) MakeGraphQL(query string, vars map[string]interface{}, response interface{}) error {
+	e.opts.Concurrency <- true
+	defer func() {
+		<-e.opts.Concurrency
+	}()
+
+	req := requests.NewRequest()
+	req.Method = http.MethodPost
+	// graphql endpoint is not versioned
+	req.URL = strings.TrimSuffix(e.opts.APIURL, "/v4") + "/graphql"
+	req.Header.Set("Content-Type", "application/json")
+	e.setAuthHeader(req.Header)
+
+	var err error
+	req.Body, err = json.Marshal(map[string]interface{}{
+		"query":     query,
+		"variables": vars,
+	})
+	if err != nil {
+		return err
+	}
+
+	var res struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	reqs := requests.New(e.opts.Logger, e.opts.Client)
+	_, err = reqs.JSON(req, &res)
+	if err != nil {
+		return err
+	}
+	if len(res.Errors) != 0 {
+		return fmt.Errorf("graphql request failed: %v", res.Errors[0].Message)
+	}
+	return json.Unmarshal(res.Data, response)
+}
+
 const maxGeneralRetries = 2
 
 func (e *Requester) makeRequestRetry(req *internalRequest, generalRetry int) (pageInfo PageInfo, err error) {
@@ -109,11 +180,11 @@ func (e *Requester) makeRequestRetry(req *internalRequest, generalRetry int) (pa
 	return
 }
 
-func (e *Requester) setAuthHeader(req *http.Request) {
+func (e *Requester) setAuthHeader(header http.Header) {
 	if e.opts.APIKey == "" {
-		req.Header.Set("Authorization", "bearer "+e.opts.AccessToken)
+		header.Set("Authorization", "bearer "+e.opts.AccessToken)
 	} else {
-		req.Header.Set("Private-Token", e.opts.APIKey)
+		header.Set("Private-Token", e.opts.APIKey)
 	}
 }
 
@@ -136,7 +207,7 @@ func (e *Requester) request(r *internalRequest, retryThrottled int) (isErrorRetr
 		return false, pi, err
 	}
 	req.Header.Set("Accept", "application/json")
-	e.setAuthHeader(req)
+	e.setAuthHeader(req.Header)
 
 	resp, err := e.opts.Client.Do(req)
 	if err != nil {
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pinpt/agent/integrations/pkg/commonrepo"
+	"github.com/pinpt/agent/pkg/requests"
+	pstrings "github.com/pinpt/go-common/strings"
+)
+
+// update this using current time, if the format of the url changes, or need a new url for some other reason
+const WebhookReplaceOlderThan = "2020-05-20T10:00:00Z"
+
+// webhookEventTypes are all event types supported by gitlab project hooks. Each one corresponds to <type>_events field in api.
+// https://docs.gitlab.com/ee/api/projects.html#add-project-hook
+var webhookEventTypes = []string{
+	"push",
+	"issues",
+	"confidential_issues",
+	"merge_requests",
+	"tag_push",
+	"note",
+	"confidential_note",
+	"job",
+	"pipeline",
+	"wiki_page",
+}
+
+// WebhookCreateIfNotExists registers a project hook for the passed events if it does not exist yet. Events are named the same as gitlab api fields without _events suffix, for example merge_requests.
+// Existing hooks are matched using full url, since both work and sourcecode integrations could register hooks for the same project.
+func WebhookCreateIfNotExists(qc QueryContext, repo commonrepo.Repo, webhookURL string, events []string, webhookReplaceOlderThan string) (rerr error) {
+	logger := qc.Logger.With("repo", repo.NameWithOwner, "events", events)
+
+	logger.Debug("checking if webhook registration is needed")
+
+	webhooks, noPermissions, err := WebhookList(qc, repo)
+	if err != nil {
+		rerr = err
+		return
+	}
+	if noPermissions {
+		rerr = errors.New("no permissions to list webhooks for repo")
+		return
+	}
+
+	webhookReplaceOlder, err := time.Parse(time.RFC3339, webhookReplaceOlderThan)
+	if err != nil {
+		rerr = fmt.Errorf("invalid webhookReplaceOlderThan constant format: %v", err)
+		return
+	}
+
+	_, err = url.Parse(webhookURL)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	var pinptWebHooks []webhook
+
+	for _, wh := range webhooks {
+		if wh.URL == webhookURL {
+			pinptWebHooks = append(pinptWebHooks, wh)
+		}
+	}
+
+	whCount := len(pinptWebHooks)
+
+	if whCount == 0 {
+		return webhookCreate(qc, repo, webhookURL, events)
+	} else if whCount > 1 {
+
+		sort.SliceStable(pinptWebHooks, func(i, j int) bool {
+			return pinptWebHooks[i].CreatedAt.Unix() > pinptWebHooks[j].CreatedAt.Unix()
+		})
+
+		for _, wh := range pinptWebHooks[1:] {
+			err := webhookRemove(qc, repo, wh.ID)
+			if err != nil {
+				rerr = err
+				return
+			}
+		}
+	}
+
+	wh := pinptWebHooks[0]
+	var update bool
+	if wh.CreatedAt.Before(webhookReplaceOlder) {
+		logger.Info("recreating webhook, because the one we had before is older than", "deadline", webhookReplaceOlderThan)
+		update = true
+	}
+	if !reflect.DeepEqual(pstrings.SortCopy(events), pstrings.SortCopy(wh.Events)) {
+		logger.Info("recreating webhook, because the one we had before had different settings", "repo", repo.NameWithOwner)
+		update = true
+	}
+
+	if update {
+		err := webhookRemove(qc, repo, wh.ID)
+		if err != nil {
+			rerr = err
+			return
+		}
+		err = webhookCreate(qc, repo, webhookURL, events)
+		if err != nil {
+			rerr = err
+			return
+		}
+	}
+
+	return
+}
+
+type webhook struct {
+	ID        int
+	URL       string
+	Events    []string
+	CreatedAt time.Time
+}
+
+func WebhookList(qc QueryContext, repo commonrepo.Repo) (res []webhook, noPermissions bool, rerr error) {
+	var rhooks []map[string]interface{}
+
+	params := url.Values{}
+	params.Set("per_page", "100")
+
+	err := qc.RequestJSON(http.MethodGet, pstrings.JoinURL("projects", url.QueryEscape(repo.RefID), "hooks"), params, nil, &rhooks)
+	if err != nil {
+		var e requests.StatusCodeError
+		if errors.As(err, &e) && (e.Got == http.StatusNotFound || e.Got == http.StatusForbidden) {
+			noPermissions = true
+			return
+		}
+		rerr = err
+		return
+	}
+
+	for _, rhook := range rhooks {
+		wh := webhook{}
+		id, _ := rhook["id"].(float64)
+		wh.ID = int(id)
+		wh.URL, _ = rhook["url"].(string)
+		createdAt, _ := rhook["created_at"].(string)
+		if createdAt != "" {
+			wh.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
+			if err != nil {
+				rerr = fmt.Errorf("invalid created_at for hook: %v", err)
+				return
+			}
+		}
+		for _, ev := range webhookEventTypes {
+			if enabled, _ := rhook[ev+"_events"].(bool); enabled {
+				wh.Events = append(wh.Events, ev)
+			}
+		}
+		res = append(res, wh)
+	}
+	return
+}
+
+func webhookCreate(qc QueryContext, repo commonrepo.Repo, webhookURL string, events []string) (rerr error) {
+	qc.Logger.Info("registering webhook for repo", "repo", repo.NameWithOwner, "events", events)
+
+	data := map[string]interface{}{}
+	data["url"] = webhookURL
+	data["enable_ssl_verification"] = true
+	// push_events is enabled by default, so set all event fields explicitly
+	for _, ev := range webhookEventTypes {
+		data[ev+"_events"] = false
+	}
+	for _, ev := range events {
+		data[ev+"_events"] = true
+	}
+
+	var res interface{}
+	err := qc.RequestJSON(http.MethodPost, pstrings.JoinURL("projects", url.QueryEscape(repo.RefID), "hooks"), nil, data, &res)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	return nil
+}
+
+func webhookRemove(qc QueryContext, repo commonrepo.Repo, hookID int) error {
+	qc.Logger.Info("removing webhook", "repo", repo.NameWithOwner, "hook_id", hookID)
+
+	return qc.RequestJSON(http.MethodDelete, pstrings.JoinURL("projects", url.QueryEscape(repo.RefID), "hooks", strconv.Itoa(hookID)), nil, nil, nil)
+}
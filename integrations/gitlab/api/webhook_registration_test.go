@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/integrations/pkg/commonrepo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookCreateIfNotExists(t *testing.T) {
+
+	assert := assert.New(t)
+
+	var mu sync.Mutex
+	var created []map[string]interface{}
+	var deleted []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case req.Method == http.MethodGet && req.URL.Path == "/api/v4/projects/1/hooks":
+			rw.Write([]byte(`[]`))
+		case req.Method == http.MethodGet && req.URL.Path == "/api/v4/projects/2/hooks":
+			rw.Write([]byte(`[
+				{"id":10,"url":"https://test.example.com/hook","push_events":true,"merge_requests_events":true,"note_events":true,"created_at":"2030-01-01T00:00:00Z"},
+				{"id":11,"url":"https://other.example.com/hook","push_events":true,"created_at":"2030-01-01T00:00:00Z"}
+			]`))
+		case req.Method == http.MethodGet && req.URL.Path == "/api/v4/projects/3/hooks":
+			rw.Write([]byte(`[
+				{"id":20,"url":"https://test.example.com/hook","push_events":true,"created_at":"2030-01-01T00:00:00Z"}
+			]`))
+		case req.Method == http.MethodGet && req.URL.Path == "/api/v4/projects/4/hooks":
+			rw.WriteHeader(http.StatusForbidden)
+			rw.Write([]byte(`{"message":"403 Forbidden"}`))
+		case req.Method == http.MethodPost:
+			b, err := ioutil.ReadAll(req.Body)
+			assert.NoError(err)
+			var data map[string]interface{}
+			assert.NoError(json.Unmarshal(b, &data))
+			created = append(created, data)
+			rw.WriteHeader(http.StatusCreated)
+			rw.Write([]byte(`{"id":30}`))
+		case req.Method == http.MethodDelete:
+			deleted = append(deleted, req.URL.Path)
+			rw.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request %v %v", req.Method, req.URL.Path)
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	logger := hclog.New(&hclog.LoggerOptions{
+		Name: "test",
+	})
+
+	requester := NewRequester(RequesterOpts{
+		Logger:      logger,
+		APIURL:      server.URL + "/api/v4",
+		APIKey:      "token1",
+		Concurrency: make(chan bool, 1),
+	})
+
+	qc := QueryContext{
+		Logger:      logger,
+		Request:     requester.MakeRequest,
+		RequestJSON: requester.MakeRequestJSON,
+	}
+
+	events := []string{"merge_requests", "note", "push"}
+
+	// no hooks, create
+	err := WebhookCreateIfNotExists(qc, commonrepo.Repo{RefID: "1", NameWithOwner: "pinpt/test1"}, "https://test.example.com/hook", events, WebhookReplaceOlderThan)
+	assert.NoError(err)
+	if assert.Len(created, 1) {
+		assert.Equal("https://test.example.com/hook", created[0]["url"])
+		assert.Equal(true, created[0]["merge_requests_events"])
+		assert.Equal(true, created[0]["note_events"])
+		assert.Equal(true, created[0]["push_events"])
+		assert.Equal(false, created[0]["issues_events"])
+	}
+	assert.Empty(deleted)
+
+	// hook with the same settings exists, do nothing
+	created = nil
+	err = WebhookCreateIfNotExists(qc, commonrepo.Repo{RefID: "2", NameWithOwner: "pinpt/test2"}, "https://test.example.com/hook", events, WebhookReplaceOlderThan)
+	assert.NoError(err)
+	assert.Empty(created)
+	assert.Empty(deleted)
+
+	// hook with different events exists, recreate
+	err = WebhookCreateIfNotExists(qc, commonrepo.Repo{RefID: "3", NameWithOwner: "pinpt/test3"}, "https://test.example.com/hook", events, WebhookReplaceOlderThan)
+	assert.NoError(err)
+	assert.Len(created, 1)
+	assert.Equal([]string{"/api/v4/projects/3/hooks/20"}, deleted)
+
+	// no permissions
+	err = WebhookCreateIfNotExists(qc, commonrepo.Repo{RefID: "4", NameWithOwner: "pinpt/test4"}, "https://test.example.com/hook", events, WebhookReplaceOlderThan)
+	assert.EqualError(err, "no permissions to list webhooks for repo")
+
+	// bad replace date
+	err = WebhookCreateIfNotExists(qc, commonrepo.Repo{RefID: "2", NameWithOwner: "pinpt/test2"}, "https://test.example.com/hook", events, "baddate")
+	assert.Error(err)
+}
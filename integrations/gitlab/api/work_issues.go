@@ -26,61 +26,97 @@ func WorkIssuesPage(qc QueryContext, projectID string, usermap UsernameMap, comm
 		return
 	}
 	for _, rawissue := range rawissues {
+		item := convertWorkIssue(qc, projectID, rawissue, usermap, commentChan)
+		res = append(res, item)
+	}
 
-		idparts := strings.Split(projectID, "/")
-		var identifier string
-		if len(idparts) == 1 {
-			identifier = idparts[0] + "-" + fmt.Sprint(rawissue.Iid)
-		} else {
-			identifier = idparts[1] + "-" + fmt.Sprint(rawissue.Iid)
-		}
-		item := &work.Issue{}
-		item.CustomerID = qc.CustomerID
-		item.RefType = qc.RefType
-		item.RefID = fmt.Sprint(rawissue.Iid)
-
-		item.AssigneeRefID = fmt.Sprint(rawissue.Assignee.ID)
-		item.ReporterRefID = fmt.Sprint(rawissue.Author.ID)
-		item.CreatorRefID = fmt.Sprint(rawissue.Author.ID)
-		item.Description = rawissue.Description
-		if rawissue.EpicIid != 0 {
-			item.EpicID = pstrings.Pointer(fmt.Sprint(rawissue.EpicIid))
-		}
-		item.Identifier = identifier
-		item.ProjectID = qc.IDs.WorkProject(fmt.Sprint(rawissue.ProjectID))
-		item.Title = rawissue.Title
-		item.Status = rawissue.State
-		item.Tags = rawissue.Labels
-		item.Type = "Issue"
-		item.URL = rawissue.WebURL
-
-		date.ConvertToModel(rawissue.CreatedAt, &item.CreatedDate)
-		date.ConvertToModel(rawissue.UpdatedAt, &item.UpdatedDate)
-
-		item.SprintIds = []string{qc.IDs.WorkSprintID(fmt.Sprint(rawissue.Milestone.Iid))}
-		duedate, err := time.Parse("2006-01-02", rawissue.Milestone.DueDate)
-		if err != nil {
-			duedate = time.Time{}
+	return
+}
+
+// WorkIssueByIID returns a single issue using project specific iid together with its comments
+func WorkIssueByIID(qc QueryContext, projectID string, iid string, usermap UsernameMap) (res *work.Issue, comments []work.IssueComment, err error) {
+
+	qc.Logger.Debug("work issue", "project", projectID, "iid", iid)
+
+	objectPath := pstrings.JoinURL("projects", url.QueryEscape(projectID), "issues", iid)
+
+	var rawissue IssueModel
+
+	_, err = qc.Request(objectPath, nil, &rawissue)
+	if err != nil {
+		return
+	}
+
+	commentChan := make(chan []work.IssueComment)
+	done := make(chan bool)
+	go func() {
+		for c := range commentChan {
+			comments = append(comments, c...)
 		}
-		date.ConvertToModel(duedate, &item.PlannedEndDate)
+		done <- true
+	}()
+	res = convertWorkIssue(qc, projectID, rawissue, usermap, commentChan)
+	close(commentChan)
+	<-done
 
-		startdate, err := time.Parse("2006-01-02", rawissue.Milestone.StartDate)
+	return
+}
+
+func convertWorkIssue(qc QueryContext, projectID string, rawissue IssueModel, usermap UsernameMap, commentChan chan []work.IssueComment) *work.Issue {
+	idparts := strings.Split(projectID, "/")
+	var identifier string
+	if len(idparts) == 1 {
+		identifier = idparts[0] + "-" + fmt.Sprint(rawissue.Iid)
+	} else {
+		identifier = idparts[1] + "-" + fmt.Sprint(rawissue.Iid)
+	}
+	item := &work.Issue{}
+	item.CustomerID = qc.CustomerID
+	item.RefType = qc.RefType
+	item.RefID = fmt.Sprint(rawissue.Iid)
+
+	item.AssigneeRefID = fmt.Sprint(rawissue.Assignee.ID)
+	item.ReporterRefID = fmt.Sprint(rawissue.Author.ID)
+	item.CreatorRefID = fmt.Sprint(rawissue.Author.ID)
+	item.Description = rawissue.Description
+	if rawissue.EpicIid != 0 {
+		item.EpicID = pstrings.Pointer(fmt.Sprint(rawissue.EpicIid))
+	}
+	item.Identifier = identifier
+	item.ProjectID = qc.IDs.WorkProject(fmt.Sprint(rawissue.ProjectID))
+	item.Title = rawissue.Title
+	item.Status = rawissue.State
+	item.Tags = rawissue.Labels
+	item.Type = "Issue"
+	item.URL = rawissue.WebURL
+
+	date.ConvertToModel(rawissue.CreatedAt, &item.CreatedDate)
+	date.ConvertToModel(rawissue.UpdatedAt, &item.UpdatedDate)
+
+	item.SprintIds = []string{qc.IDs.WorkSprintID(fmt.Sprint(rawissue.Milestone.Iid))}
+	duedate, err := time.Parse("2006-01-02", rawissue.Milestone.DueDate)
+	if err != nil {
+		duedate = time.Time{}
+	}
+	date.ConvertToModel(duedate, &item.PlannedEndDate)
+
+	startdate, err := time.Parse("2006-01-02", rawissue.Milestone.StartDate)
+	if err != nil {
+		startdate = time.Time{}
+	}
+	date.ConvertToModel(startdate, &item.PlannedStartDate)
+	err = PaginateStartAt(qc.Logger, func(log hclog.Logger, paginationParams url.Values) (page PageInfo, _ error) {
+		pi, changelogs, comments, err := WorkIssuesDiscussionsPage(qc, projectID, fmt.Sprint(rawissue.Iid), usermap, paginationParams)
 		if err != nil {
-			startdate = time.Time{}
+			return page, err
 		}
-		date.ConvertToModel(startdate, &item.PlannedStartDate)
-		err = PaginateStartAt(qc.Logger, func(log hclog.Logger, paginationParams url.Values) (page PageInfo, _ error) {
-			pi, changelogs, comments, err := WorkIssuesDiscussionsPage(qc, projectID, fmt.Sprint(rawissue.Iid), usermap, paginationParams)
-			if err != nil {
-				return page, err
-			}
-			item.ChangeLog = append(item.ChangeLog, changelogs...)
-			commentChan <- comments
-			return pi, nil
-		})
-
-		res = append(res, item)
+		item.ChangeLog = append(item.ChangeLog, changelogs...)
+		commentChan <- comments
+		return pi, nil
+	})
+	if err != nil {
+		qc.Logger.Error("could not get issue discussions", "issue", item.RefID, "err", err)
 	}
 
-	return
+	return item
 }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/url"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/integrations/gitlab/api"
+	"github.com/pinpt/agent/integrations/pkg/commoncicd"
+	"github.com/pinpt/agent/integrations/pkg/commonrepo"
+	"github.com/pinpt/agent/integrations/pkg/repoprojects"
+	"github.com/pinpt/integration-sdk/cicd"
+)
+
+// exportBuildsAndDeployments exports finished pipelines as builds and finished deployments of environments
+func (s *Integration) exportBuildsAndDeployments(ctx *repoprojects.ProjectCtx, repo commonrepo.Repo) error {
+	logger := ctx.Logger.With("repo", repo.NameWithOwner)
+
+	buildsSender, err := ctx.Session(cicd.BuildModelName)
+	if err != nil {
+		return err
+	}
+	buildsAfter := commoncicd.StartTime(buildsSender.LastProcessedTime())
+	err = api.PaginateStartAt(logger, func(log hclog.Logger, parameters url.Values) (api.PageInfo, error) {
+		pi, res, err := api.PipelinesPage(s.qc, repo, parameters, buildsAfter)
+		if err != nil {
+			return pi, err
+		}
+		for _, build := range res {
+			if err := buildsSender.Send(build); err != nil {
+				return pi, err
+			}
+		}
+		return pi, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	deploymentsSender, err := ctx.Session(cicd.DeploymentModelName)
+	if err != nil {
+		return err
+	}
+	environments, err := api.Environments(s.qc, repo)
+	if err != nil {
+		return err
+	}
+	deploymentsAfter := commoncicd.StartTime(deploymentsSender.LastProcessedTime())
+	return api.PaginateStartAt(logger, func(log hclog.Logger, parameters url.Values) (api.PageInfo, error) {
+		pi, res, err := api.DeploymentsPage(s.qc, repo, environments, parameters, deploymentsAfter)
+		if err != nil {
+			return pi, err
+		}
+		for _, d := range res {
+			if err := deploymentsSender.Send(d); err != nil {
+				return pi, err
+			}
+		}
+		return pi, nil
+	})
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/pinpt/agent/pkg/structmarshal"
 	"github.com/pinpt/agent/rpcdef"
 	"github.com/pinpt/go-common/datamodel"
+	"github.com/pinpt/integration-sdk/cicd"
 	"github.com/pinpt/integration-sdk/sourcecode"
 	"github.com/pinpt/integration-sdk/work"
 )
@@ -160,6 +161,8 @@ func (s *Integration) initWithConfig(config rpcdef.ExportConfig) error {
 		requester := api.NewRequester(opts)
 
 		s.qc.Request = requester.MakeRequest
+		s.qc.RequestJSON = requester.MakeRequestJSON
+		s.qc.GraphQL = requester.MakeGraphQL
 		s.qc.IDs = ids2.New(s.customerID, s.refType)
 	}
 
@@ -279,6 +282,11 @@ func (s *Integration) exportGroup(ctx context.Context, groupSession *objsender.S
 
 	repos = commonrepo.Filter(logger, repos, s.config.FilterConfig)
 
+	err = s.registerWebhooks(logger, repos, intType)
+	if err != nil {
+		logger.Info("could not register webhooks", "err", err)
+	}
+
 	if intType == inconfig.IntegrationTypeSourcecode && s.config.OnlyGit {
 		logger.Warn("only_ripsrc flag passed, skipping export of data from gitlab api")
 		for _, repo := range repos {
@@ -379,6 +387,15 @@ func (s *Integration) exportProjectChildren(ctx *repoprojects.ProjectCtx, projec
 }
 func (s *Integration) exportRepoChildren(ctx *repoprojects.ProjectCtx, repo commonrepo.Repo) error {
 
+	// builds are optional, pipelines return an error when ci is disabled for the project
+	if err := s.exportBuildsAndDeployments(ctx, repo); err != nil {
+		s.logger.Error("could not export builds and deployments", "repo", repo.NameWithOwner, "err", err)
+		// do not update last processed, so that builds are exported again on next run
+		if err := ctx.Rollback(cicd.BuildModelName, cicd.DeploymentModelName); err != nil {
+			return err
+		}
+	}
+
 	prs, err := s.exportPullRequestsForRepo(ctx, repo)
 	if err != nil {
 		return err
@@ -549,45 +566,13 @@ func (s *Integration) exportPullRequestsForRepo(ctx *repoprojects.ProjectCtx, re
 		defer wg.Done()
 		for prs := range pullRequestsForCommits {
 			for _, pr := range prs {
-				commits, err := s.exportPullRequestCommits(logger, repo, pr)
+				meta, err := s.exportPRCommitsAddingToPR(logger, repo, pr, pullRequestSender, commitsSender)
 				if err != nil {
-					s.logger.Error("error getting commits", "err", err)
-					continue
-				}
-
-				commitsSender.SetTotal(len(commits))
-
-				if len(commits) > 0 {
-					meta := rpcdef.GitRepoFetchPR{}
-					repoID := s.qc.IDs.CodeRepo(repo.RefID)
-					meta.ID = s.qc.IDs.CodePullRequest(repoID, pr.RefID)
-					meta.RefID = pr.RefID
-					meta.URL = pr.URL
-					meta.BranchName = pr.BranchName
-					meta.LastCommitSHA = commits[0].Sha
-					res = append(res, meta)
-				}
-				for ind := len(commits) - 1; ind >= 0; ind-- {
-					pr.CommitShas = append(pr.CommitShas, commits[ind].Sha)
-				}
-
-				pr.CommitIds = ids.CodeCommits(s.qc.CustomerID, s.refType, pr.RepoID, pr.CommitShas)
-				if len(pr.CommitShas) == 0 {
-					logger.Info("found PullRequest with no commits (ignoring it)", "repo", repo.NameWithOwner, "pr_ref_id", pr.RefID, "pr.url", pr.URL)
-				} else {
-					pr.BranchID = s.qc.IDs.CodeBranch(pr.RepoID, pr.BranchName, pr.CommitShas[0])
-				}
-				if err = pullRequestSender.Send(pr); err != nil {
-					s.logger.Error("error with pull request sender", "err", err)
+					s.logger.Error("error exporting pr commits", "err", err)
 					continue
 				}
-
-				for _, c := range commits {
-					c.BranchID = pr.BranchID
-					if err := commitsSender.Send(c); err != nil {
-						s.logger.Error("error with commit sender", "err", err)
-						continue
-					}
+				if meta != nil {
+					res = append(res, *meta)
 				}
 			}
 		}
@@ -596,6 +581,51 @@ func (s *Integration) exportPullRequestsForRepo(ctx *repoprojects.ProjectCtx, re
 	return
 }
 
+// exportPRCommitsAddingToPR exports pull request commits, sets commit related fields on pr and sends it. Returns pr metadata for git export, or nil if pr has no commits.
+func (s *Integration) exportPRCommitsAddingToPR(logger hclog.Logger, repo commonrepo.Repo, pr api.PullRequest, pullRequestSender objsender.SessionCommon, commitsSender objsender.SessionCommon) (res *rpcdef.GitRepoFetchPR, rerr error) {
+	commits, err := s.exportPullRequestCommits(logger, repo, pr)
+	if err != nil {
+		rerr = fmt.Errorf("error getting commits: %v", err)
+		return
+	}
+
+	commitsSender.SetTotal(len(commits))
+
+	if len(commits) > 0 {
+		meta := rpcdef.GitRepoFetchPR{}
+		repoID := s.qc.IDs.CodeRepo(repo.RefID)
+		meta.ID = s.qc.IDs.CodePullRequest(repoID, pr.RefID)
+		meta.RefID = pr.RefID
+		meta.URL = pr.URL
+		meta.BranchName = pr.BranchName
+		meta.LastCommitSHA = commits[0].Sha
+		res = &meta
+	}
+	for ind := len(commits) - 1; ind >= 0; ind-- {
+		pr.CommitShas = append(pr.CommitShas, commits[ind].Sha)
+	}
+
+	pr.CommitIds = ids.CodeCommits(s.qc.CustomerID, s.refType, pr.RepoID, pr.CommitShas)
+	if len(pr.CommitShas) == 0 {
+		logger.Info("found PullRequest with no commits (ignoring it)", "repo", repo.NameWithOwner, "pr_ref_id", pr.RefID, "pr.url", pr.URL)
+	} else {
+		pr.BranchID = s.qc.IDs.CodeBranch(pr.RepoID, pr.BranchName, pr.CommitShas[0])
+	}
+	if err = pullRequestSender.Send(pr); err != nil {
+		rerr = fmt.Errorf("error with pull request sender: %v", err)
+		return
+	}
+
+	for _, c := range commits {
+		c.BranchID = pr.BranchID
+		if err := commitsSender.Send(c); err != nil {
+			s.logger.Error("error with commit sender", "err", err)
+			continue
+		}
+	}
+	return
+}
+
 func (s *Integration) getRepoURL(nameWithOwner string) (string, error) {
 	u, err := url.Parse(s.config.URL)
 	if err != nil {
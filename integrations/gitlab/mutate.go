@@ -2,12 +2,265 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
 
+	"github.com/pinpt/agent/integrations/gitlab/api"
+	"github.com/pinpt/agent/integrations/pkg/commonrepo"
+	"github.com/pinpt/agent/integrations/pkg/mutate"
 	"github.com/pinpt/agent/rpcdef"
+	"github.com/pinpt/go-common/datamodel"
+	"github.com/pinpt/integration-sdk/agent"
+	"github.com/pinpt/integration-sdk/sourcecode"
+	"github.com/pinpt/integration-sdk/work"
 )
 
-func (s *Integration) Mutate(ctx context.Context, fn, data string, config rpcdef.ExportConfig) (res rpcdef.MutateResult, rerr error) {
-	rerr = errors.New("mutate not supported")
+// issueRef identifies the issue in mutation data. ref_id of issue is iid, which is only unique within the project, so project_ref_id is also needed.
+type issueRef struct {
+	RefID        string `json:"ref_id"`
+	ProjectRefID string `json:"project_ref_id"`
+}
+
+func (s issueRef) validate() error {
+	if s.RefID == "" {
+		return errors.New("ref_id field not provided")
+	}
+	if s.ProjectRefID == "" {
+		return errors.New("project_ref_id field not provided")
+	}
+	return nil
+}
+
+func (s *Integration) returnUpdatedPR(projectID string, iid string) (res rpcdef.MutateResult, rerr error) {
+	pr, err := api.PullRequestByIID(s.qc, commonrepo.Repo{RefID: projectID}, iid)
+	if err != nil {
+		rerr = err
+		return
+	}
+	m := pr.ToMap()
+	// commits are not retrieved here
+	delete(m, "commit_ids")
+	delete(m, "commit_shas")
+	delete(m, "branch_id")
+	objs := rpcdef.MutatedObjects{}
+	objs[sourcecode.PullRequestModelName.String()] = []interface{}{m}
+	res.MutatedObjects = objs
+	return
+}
+
+func (s *Integration) returnUpdatedIssue(projectID string, iid string) (res rpcdef.MutateResult, rerr error) {
+	issue, _, err := api.WorkIssueByIID(s.qc, projectID, iid, api.UsernameMap{})
+	if err != nil {
+		rerr = err
+		return
+	}
+	m := issue.ToMap()
+	// changelog needs usernames mapped to user ids, which requires getting all project users
+	delete(m, "change_log")
+	objs := rpcdef.MutatedObjects{}
+	objs[work.IssueModelName.String()] = []interface{}{m}
+	res.MutatedObjects = objs
+	return
+}
+
+type Model interface {
+	ToMap() map[string]interface{}
+}
+
+func (s *Integration) mutationResult(modelName datamodel.ModelNameType, obj Model) (res rpcdef.MutateResult, rerr error) {
+	objs := rpcdef.MutatedObjects{}
+	objs[modelName.String()] = []interface{}{obj.ToMap()}
+	res.MutatedObjects = objs
+	return
+}
+
+func (s *Integration) Mutate(ctx context.Context, fn, data string, config rpcdef.ExportConfig) (res rpcdef.MutateResult, _ error) {
+
+	rerr := func(err error) {
+		res = mutate.ResultFromError(err)
+	}
+
+	err := s.initWithConfig(config)
+	if err != nil {
+		rerr(err)
+		return
+	}
+
+	var action agent.IntegrationMutationRequestAction
+	err = action.FromInterface(fn)
+	if err != nil {
+		rerr(err)
+		return
+	}
+
+	switch action {
+	case agent.IntegrationMutationRequestActionPrSetTitle:
+		var obj struct {
+			RefID string `json:"ref_id"`
+			Title string `json:"title"`
+		}
+		err := json.Unmarshal([]byte(data), &obj)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		projectID, iid, err := api.PullRequestProjectAndIID(s.qc, obj.RefID)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		err = api.PullRequestEdit(s.qc, projectID, iid, map[string]interface{}{"title": obj.Title})
+		if err != nil {
+			rerr(err)
+			return
+		}
+		return s.returnUpdatedPR(projectID, iid)
+	case agent.IntegrationMutationRequestActionPrSetDescription:
+		var obj struct {
+			RefID        string `json:"ref_id"`
+			BodyMarkdown string `json:"body_markdown"`
+		}
+		err := json.Unmarshal([]byte(data), &obj)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		if obj.BodyMarkdown == "" {
+			rerr(errors.New("body_markdown field not provided"))
+			return
+		}
+		projectID, iid, err := api.PullRequestProjectAndIID(s.qc, obj.RefID)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		err = api.PullRequestEdit(s.qc, projectID, iid, map[string]interface{}{"description": obj.BodyMarkdown})
+		if err != nil {
+			rerr(err)
+			return
+		}
+		return s.returnUpdatedPR(projectID, iid)
+	case agent.IntegrationMutationRequestActionIssueAddComment:
+		var obj struct {
+			issueRef
+			Body string `json:"body"`
+		}
+		err := json.Unmarshal([]byte(data), &obj)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		if err := obj.validate(); err != nil {
+			rerr(err)
+			return
+		}
+		projectID, iid := obj.ProjectRefID, obj.RefID
+		comment, err := api.WorkIssueAddComment(s.qc, projectID, iid, obj.Body)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		return s.mutationResult(work.IssueCommentModelName, comment)
+	case agent.IntegrationMutationRequestActionIssueSetTitle:
+		var obj struct {
+			issueRef
+			Title string `json:"title"`
+		}
+		err := json.Unmarshal([]byte(data), &obj)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		if err := obj.validate(); err != nil {
+			rerr(err)
+			return
+		}
+		projectID, iid := obj.ProjectRefID, obj.RefID
+		err = api.WorkIssueEdit(s.qc, projectID, iid, map[string]interface{}{"title": obj.Title})
+		if err != nil {
+			rerr(err)
+			return
+		}
+		return s.returnUpdatedIssue(projectID, iid)
+	case agent.IntegrationMutationRequestActionIssueSetAssignee:
+		var obj struct {
+			issueRef
+			UserID string `json:"user_ref_id"`
+		}
+		err := json.Unmarshal([]byte(data), &obj)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		if err := obj.validate(); err != nil {
+			rerr(err)
+			return
+		}
+		projectID, iid := obj.ProjectRefID, obj.RefID
+		// empty list unassigns all users
+		assignees := []int64{}
+		if obj.UserID != "" {
+			id, err := strconv.ParseInt(obj.UserID, 10, 64)
+			if err != nil {
+				rerr(fmt.Errorf("invalid user_ref_id: %v", err))
+				return
+			}
+			assignees = append(assignees, id)
+		}
+		err = api.WorkIssueEdit(s.qc, projectID, iid, map[string]interface{}{"assignee_ids": assignees})
+		if err != nil {
+			rerr(err)
+			return
+		}
+		return s.returnUpdatedIssue(projectID, iid)
+	case agent.IntegrationMutationRequestActionIssueSetStatus:
+		var obj struct {
+			issueRef
+			TransitionID string `json:"transition_id"`
+		}
+		err := json.Unmarshal([]byte(data), &obj)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		if obj.TransitionID != "close" && obj.TransitionID != "reopen" {
+			rerr(fmt.Errorf("invalid transition_id, expected close or reopen, got: %v", obj.TransitionID))
+			return
+		}
+		if err := obj.validate(); err != nil {
+			rerr(err)
+			return
+		}
+		projectID, iid := obj.ProjectRefID, obj.RefID
+		err = api.WorkIssueEdit(s.qc, projectID, iid, map[string]interface{}{"state_event": obj.TransitionID})
+		if err != nil {
+			rerr(err)
+			return
+		}
+		return s.returnUpdatedIssue(projectID, iid)
+	case agent.IntegrationMutationRequestActionIssueGetTransitions:
+		var obj issueRef
+		err := json.Unmarshal([]byte(data), &obj)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		if err := obj.validate(); err != nil {
+			rerr(err)
+			return
+		}
+		projectID, iid := obj.ProjectRefID, obj.RefID
+		transitions, err := api.WorkIssueTransitions(s.qc, projectID, iid)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		res.WebappResponse = transitions
+		return
+	}
+
+	rerr(fmt.Errorf("mutate fn not supported: %v", fn))
 	return
 }
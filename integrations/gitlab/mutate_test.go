@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/cmd/cmdrunnorestarts/inconfig"
+	"github.com/pinpt/agent/integrations/pkg/mutate"
+	"github.com/pinpt/agent/integrations/pkg/testutil"
+	"github.com/pinpt/agent/rpcdef"
+	"github.com/pinpt/integration-sdk/sourcecode"
+	"github.com/pinpt/integration-sdk/work"
+	"github.com/stretchr/testify/assert"
+)
+
+func testMutate(t *testing.T, fn string, data string) (edits []string, res rpcdef.MutateResult) {
+	assert := assert.New(t)
+
+	server := testutil.NewServer(t, testutil.ServerOpts{
+		Responses: testAPIResponses,
+		Handle: func(rw http.ResponseWriter, req *http.Request) bool {
+			if req.Method == http.MethodPut {
+				edits = append(edits, req.URL.Path)
+			}
+			if req.URL.Path == "/api/graphql" {
+				testGraphQL(t, rw, req)
+				return true
+			}
+			return false
+		},
+		NotFound: `{"message":"404 Not found"}`,
+	})
+	defer server.Close()
+
+	s := NewIntegration(hclog.New(&hclog.LoggerOptions{
+		Name: "test",
+	}))
+	assert.NoError(s.Init(&testutil.Agent{}))
+
+	config := rpcdef.ExportConfig{}
+	config.Pinpoint.CustomerID = "c1"
+	config.Integration.Type = inconfig.IntegrationTypeWork
+	config.Integration.Config = map[string]interface{}{
+		"url":     server.URL,
+		"api_key": "token1",
+	}
+
+	res, err := s.Mutate(context.Background(), fn, data, config)
+	assert.NoError(err)
+	return
+}
+
+// testGraphQL resolves merge request 99 to project 15 and iid 3, other merge requests are not found
+func testGraphQL(t *testing.T, rw http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Variables struct {
+			ID string `json:"id"`
+		} `json:"variables"`
+	}
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body.Variables.ID != "gid://gitlab/MergeRequest/99" {
+		rw.Write([]byte(`{"data":{"mergeRequest":null}}`))
+		return
+	}
+	rw.Write([]byte(`{"data":{"mergeRequest":{"iid":"3","project":{"id":"gid://gitlab/Project/15"}}}}`))
+}
+
+func TestMutatePRSetTitle(t *testing.T) {
+	assert := assert.New(t)
+	edits, res := testMutate(t, "PR_SET_TITLE", `{"ref_id":"99","title":"Add readme"}`)
+	assert.Empty(res.Error)
+	assert.Equal([]string{"/api/v4/projects/15/merge_requests/3"}, edits)
+	prs := res.MutatedObjects[sourcecode.PullRequestModelName.String()]
+	if assert.Len(prs, 1) {
+		pr := prs[0].(map[string]interface{})
+		assert.Equal("Add readme", pr["title"])
+		assert.Equal("99", pr["ref_id"])
+		assert.Equal("pinpt/agent-test!3", pr["identifier"])
+	}
+}
+
+func TestMutatePRSetDescription(t *testing.T) {
+	assert := assert.New(t)
+	edits, res := testMutate(t, "PR_SET_DESCRIPTION", `{"ref_id":"99","body_markdown":"Adds readme"}`)
+	assert.Empty(res.Error)
+	assert.Equal([]string{"/api/v4/projects/15/merge_requests/3"}, edits)
+	assert.Len(res.MutatedObjects[sourcecode.PullRequestModelName.String()], 1)
+}
+
+func TestMutatePRNotFound(t *testing.T) {
+	assert := assert.New(t)
+	edits, res := testMutate(t, "PR_SET_TITLE", `{"ref_id":"100","title":"Add readme"}`)
+	assert.Empty(edits)
+	assert.NotEmpty(res.Error)
+	assert.Equal(mutate.ErrNotFound, res.ErrorCode)
+}
+
+func TestMutatePRMissingRefID(t *testing.T) {
+	assert := assert.New(t)
+	_, res := testMutate(t, "PR_SET_TITLE", `{"identifier":"pinpt/agent-test!3","title":"Add readme"}`)
+	assert.Contains(res.Error, "ref_id")
+}
+
+func TestMutateIssueSetTitle(t *testing.T) {
+	assert := assert.New(t)
+	edits, res := testMutate(t, "ISSUE_SET_TITLE", `{"ref_id":"7","project_ref_id":"15","title":"Missing readme"}`)
+	assert.Empty(res.Error)
+	assert.Equal([]string{"/api/v4/projects/15/issues/7"}, edits)
+	issues := res.MutatedObjects[work.IssueModelName.String()]
+	if assert.Len(issues, 1) {
+		issue := issues[0].(map[string]interface{})
+		assert.Equal("Missing readme", issue["title"])
+		assert.Equal("7", issue["ref_id"])
+	}
+}
+
+func TestMutateIssueGetTransitions(t *testing.T) {
+	assert := assert.New(t)
+	_, res := testMutate(t, "ISSUE_GET_TRANSITIONS", `{"ref_id":"7","project_ref_id":"15"}`)
+	assert.Empty(res.Error)
+	assert.NotNil(res.WebappResponse)
+}
+
+func TestMutateIssueNotFound(t *testing.T) {
+	assert := assert.New(t)
+	_, res := testMutate(t, "ISSUE_SET_TITLE", `{"ref_id":"8","project_ref_id":"15","title":"Missing readme"}`)
+	assert.NotEmpty(res.Error)
+	assert.Equal(mutate.ErrNotFound, res.ErrorCode)
+}
+
+func TestMutateIssueMissingProject(t *testing.T) {
+	assert := assert.New(t)
+	edits, res := testMutate(t, "ISSUE_SET_TITLE", `{"ref_id":"7","title":"Missing readme"}`)
+	assert.Empty(edits)
+	assert.Contains(res.Error, "project_ref_id")
+}
@@ -30,7 +30,16 @@ func (s *Integration) exportPullRequestComments(logger hclog.Logger, prSender *o
 		return err
 	}
 
-	err = api.PaginateStartAt(logger, func(log hclog.Logger, paginationParams url.Values) (page api.PageInfo, _ error) {
+	err = s.sendPullRequestComments(logger, commentsSender, repo, pr)
+	if err != nil {
+		return err
+	}
+
+	return commentsSender.Done()
+}
+
+func (s *Integration) sendPullRequestComments(logger hclog.Logger, commentsSender objsender.SessionCommon, repo commonrepo.Repo, pr api.PullRequest) error {
+	return api.PaginateStartAt(logger, func(log hclog.Logger, paginationParams url.Values) (page api.PageInfo, _ error) {
 		pi, res, err := api.PullRequestCommentsPage(s.qc, repo, pr, paginationParams)
 		if err != nil {
 			return pi, err
@@ -49,9 +58,4 @@ func (s *Integration) exportPullRequestComments(logger hclog.Logger, prSender *o
 
 		return pi, nil
 	})
-	if err != nil {
-		return err
-	}
-
-	return commentsSender.Done()
 }
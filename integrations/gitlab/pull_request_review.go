@@ -37,7 +37,16 @@ func (s *Integration) exportPullRequestReviews(logger hclog.Logger, prSender *ob
 		return err
 	}
 
-	err = api.PaginateStartAt(logger, func(log hclog.Logger, paginationParams url.Values) (page api.PageInfo, _ error) {
+	err = s.sendPullRequestReviews(logger, reviewsSender, repo, pr)
+	if err != nil {
+		return err
+	}
+
+	return reviewsSender.Done()
+}
+
+func (s *Integration) sendPullRequestReviews(logger hclog.Logger, reviewsSender objsender.SessionCommon, repo commonrepo.Repo, pr api.PullRequest) error {
+	return api.PaginateStartAt(logger, func(log hclog.Logger, paginationParams url.Values) (page api.PageInfo, _ error) {
 		pi, res, err := api.PullRequestReviewsPage(s.qc, repo, pr, paginationParams)
 		if err != nil {
 			return pi, err
@@ -56,9 +65,4 @@ func (s *Integration) exportPullRequestReviews(logger hclog.Logger, prSender *ob
 		return pi, nil
 
 	})
-	if err != nil {
-		return err
-	}
-
-	return reviewsSender.Done()
 }
@@ -2,12 +2,305 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
 
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/cmd/cmdrunnorestarts/inconfig"
+	"github.com/pinpt/agent/integrations/gitlab/api"
+	"github.com/pinpt/agent/integrations/pkg/commonrepo"
+	"github.com/pinpt/agent/integrations/pkg/objsender"
 	"github.com/pinpt/agent/rpcdef"
+	"github.com/pinpt/integration-sdk/sourcecode"
+	"github.com/pinpt/integration-sdk/work"
 )
 
-func (s *Integration) Webhook(ctx context.Context, headers map[string]string, body string, config rpcdef.ExportConfig) (res rpcdef.WebhookResult, rerr error) {
-	rerr = errors.New("webhook not supported")
+// webhook events for project hooks, named the same as gitlab api fields without _events suffix
+var webhookEventsSourcecode = []string{
+	"merge_requests",
+	"note",
+	"push",
+}
+
+var webhookEventsWork = []string{
+	"issues",
+	"note",
+}
+
+// webhookPayload contains the fields we need from gitlab webhook payloads
+// https://docs.gitlab.com/ee/user/project/integrations/webhooks.html
+type webhookPayload struct {
+	ObjectKind string `json:"object_kind"`
+	Project    struct {
+		ID                int64  `json:"id"`
+		PathWithNamespace string `json:"path_with_namespace"`
+		DefaultBranch     string `json:"default_branch"`
+	} `json:"project"`
+	ObjectAttributes struct {
+		ID           int64  `json:"id"`
+		IID          int64  `json:"iid"`
+		NoteableType string `json:"noteable_type"`
+	} `json:"object_attributes"`
+	MergeRequest struct {
+		IID int64 `json:"iid"`
+	} `json:"merge_request"`
+	Issue struct {
+		IID int64 `json:"iid"`
+	} `json:"issue"`
+}
+
+func (s *Integration) Webhook(ctx context.Context, headers map[string]string, body string, config rpcdef.ExportConfig) (res rpcdef.WebhookResult, _ error) {
+
+	rerr := func(err error) {
+		res.Error = err.Error()
+		return
+	}
+
+	if len(body) == 0 {
+		rerr(errors.New("empty webhook body passed"))
+		return
+	}
+
+	err := s.initWithConfig(config)
+	if err != nil {
+		rerr(err)
+		return
+	}
+
+	var data webhookPayload
+
+	err = json.Unmarshal([]byte(body), &data)
+	if err != nil {
+		rerr(err)
+		return
+	}
+
+	repo, err := repoFromWebhook(data)
+	if err != nil {
+		rerr(err)
+		return
+	}
+
+	sessions := objsender.NewSessionsWebhook()
+
+	isWork := config.Integration.Type == inconfig.IntegrationTypeWork
+
+	xGitlabEvent, _ := headers["x-gitlab-event"]
+	switch xGitlabEvent {
+	case "":
+		rerr(fmt.Errorf("x-gitlab-event key is not provided in headers %v", headers))
+		return
+	case "Merge Request Hook":
+		if isWork {
+			s.logger.Info("skipping merge request webhook for work integration")
+			return
+		}
+		if data.ObjectAttributes.IID == 0 {
+			rerr(errors.New("missing object_attributes.iid in payload"))
+			return
+		}
+		prMeta, err := s.webhookPullRequest(s.logger, sessions, repo, strconv.FormatInt(data.ObjectAttributes.IID, 10))
+		if err != nil {
+			rerr(fmt.Errorf("could not get pull request %v", err))
+			return
+		}
+		var prs []rpcdef.GitRepoFetchPR
+		if prMeta != nil {
+			prs = append(prs, *prMeta)
+		}
+		err = s.exportGit(repo, prs)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		res.MutatedObjects = sessions.Data
+		return
+	case "Note Hook":
+		switch data.ObjectAttributes.NoteableType {
+		case "MergeRequest":
+			if isWork {
+				s.logger.Info("skipping merge request note webhook for work integration")
+				return
+			}
+			if data.MergeRequest.IID == 0 {
+				rerr(errors.New("missing merge_request.iid in payload"))
+				return
+			}
+			pr, err := api.PullRequestByIID(s.qc, repo, strconv.FormatInt(data.MergeRequest.IID, 10))
+			if err != nil {
+				rerr(err)
+				return
+			}
+			obj, err := api.PullRequestComment(s.qc, repo, pr, strconv.FormatInt(data.ObjectAttributes.ID, 10))
+			if err != nil {
+				rerr(err)
+				return
+			}
+			if obj == nil {
+				s.logger.Info("skipping webhook for system note", "note_id", data.ObjectAttributes.ID)
+				return
+			}
+			session := sessions.NewSession(sourcecode.PullRequestCommentModelName.String())
+			err = session.Send(obj)
+			if err != nil {
+				rerr(err)
+				return
+			}
+			res.MutatedObjects = sessions.Data
+			return
+		case "Issue":
+			if !isWork {
+				s.logger.Info("skipping issue note webhook for sourcecode integration")
+				return
+			}
+			if data.Issue.IID == 0 {
+				rerr(errors.New("missing issue.iid in payload"))
+				return
+			}
+			err := s.webhookWorkIssue(sessions, repo, strconv.FormatInt(data.Issue.IID, 10))
+			if err != nil {
+				rerr(err)
+				return
+			}
+			res.MutatedObjects = sessions.Data
+			return
+		default:
+			s.logger.Info("skipping note webhook with unsupported noteable_type", "noteable_type", data.ObjectAttributes.NoteableType)
+			return
+		}
+	case "Issue Hook":
+		if !isWork {
+			s.logger.Info("skipping issue webhook for sourcecode integration")
+			return
+		}
+		if data.ObjectAttributes.IID == 0 {
+			rerr(errors.New("missing object_attributes.iid in payload"))
+			return
+		}
+		err := s.webhookWorkIssue(sessions, repo, strconv.FormatInt(data.ObjectAttributes.IID, 10))
+		if err != nil {
+			rerr(err)
+			return
+		}
+		res.MutatedObjects = sessions.Data
+		return
+	case "Push Hook":
+		if isWork {
+			s.logger.Info("skipping push webhook for work integration")
+			return
+		}
+		err = s.exportGit(repo, nil)
+		if err != nil {
+			rerr(err)
+			return
+		}
+		return
+	default:
+		s.logger.Info("skipping webhook with unsupported x-gitlab-event, this is not in a list of supported webhooks", "x-gitlab-event", xGitlabEvent)
+		return
+	}
+}
+
+func repoFromWebhook(data webhookPayload) (res commonrepo.Repo, rerr error) {
+	if data.Project.ID == 0 {
+		rerr = errors.New("missing project.id in payload")
+		return
+	}
+	res.RefID = strconv.FormatInt(data.Project.ID, 10)
+	res.NameWithOwner = data.Project.PathWithNamespace
+	if res.NameWithOwner == "" {
+		rerr = errors.New("missing project.path_with_namespace in payload")
+		return
+	}
+	res.DefaultBranch = data.Project.DefaultBranch
 	return
 }
+
+func (s *Integration) webhookPullRequest(logger hclog.Logger, sessions *objsender.SessionsWebhook, repo commonrepo.Repo, prIID string) (res *rpcdef.GitRepoFetchPR, rerr error) {
+	logger = logger.With("repo", repo.NameWithOwner)
+
+	pr, err := api.PullRequestByIID(s.qc, repo, prIID)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	commentsSender := sessions.NewSession(sourcecode.PullRequestCommentModelName.String())
+	err = s.sendPullRequestComments(logger, commentsSender, repo, pr)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	reviewsSender := sessions.NewSession(sourcecode.PullRequestReviewModelName.String())
+	err = s.sendPullRequestReviews(logger, reviewsSender, repo, pr)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	pullRequestSender := sessions.NewSession(sourcecode.PullRequestModelName.String())
+	commitsSender := sessions.NewSession(sourcecode.PullRequestCommitModelName.String())
+
+	return s.exportPRCommitsAddingToPR(logger, repo, pr, pullRequestSender, commitsSender)
+}
+
+func (s *Integration) webhookWorkIssue(sessions *objsender.SessionsWebhook, repo commonrepo.Repo, issueIID string) error {
+	usermap := api.UsernameMap{}
+	if s.isGitlabCom {
+		// user emails are not available on gitlab.com, map usernames using project members same as in export
+		err := api.PaginateStartAt(s.logger, func(log hclog.Logger, parameters url.Values) (api.PageInfo, error) {
+			pi, _, err := api.RepoUsersPageREST(s.qc, repo, usermap, parameters)
+			return pi, err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	issue, comments, err := api.WorkIssueByIID(s.qc, repo.RefID, issueIID, usermap)
+	if err != nil {
+		return err
+	}
+
+	issueSender := sessions.NewSession(work.IssueModelName.String())
+	err = issueSender.Send(issue)
+	if err != nil {
+		return err
+	}
+
+	commentSender := sessions.NewSession(work.IssueCommentModelName.String())
+	for _, comment := range comments {
+		err := commentSender.Send(&comment)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Integration) registerWebhooks(logger hclog.Logger, repos []commonrepo.Repo, intType inconfig.IntegrationType) error {
+	logger.Info("registering webhooks")
+
+	url, err := s.agent.GetWebhookURL()
+	if err != nil {
+		return err
+	}
+
+	events := webhookEventsSourcecode
+	if intType == inconfig.IntegrationTypeWork {
+		events = webhookEventsWork
+	}
+
+	for _, repo := range repos {
+		err := api.WebhookCreateIfNotExists(s.qc, repo, url, events, api.WebhookReplaceOlderThan)
+		if err != nil {
+			logger.Info("could not register webhooks for repo", "err", err, "repo", repo.NameWithOwner)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/cmd/cmdrunnorestarts/inconfig"
+	"github.com/pinpt/agent/integrations/pkg/testutil"
+	"github.com/pinpt/agent/rpcdef"
+	"github.com/pinpt/integration-sdk/sourcecode"
+	"github.com/pinpt/integration-sdk/work"
+	"github.com/stretchr/testify/assert"
+)
+
+var testAPIResponses = map[string]string{
+	"/api/v4/projects/15/merge_requests/3":           `{"id":99,"iid":3,"title":"Add readme","description":"Adds readme","state":"opened","source_branch":"readme","web_url":"http://gitlab.example.com/pinpt/agent-test/-/merge_requests/3","created_at":"2020-05-19T09:14:51Z","updated_at":"2020-05-19T09:20:11Z","author":{"id":1},"references":{"full":"pinpt/agent-test!3"}}`,
+	"/api/v4/projects/15/merge_requests/3/notes":     `[{"id":101,"body":"Looks good","author":{"id":1},"created_at":"2020-05-19T09:22:40Z","updated_at":"2020-05-19T09:22:40Z","system":false},{"id":102,"body":"added 1 commit","author":{"id":1},"system":true}]`,
+	"/api/v4/projects/15/merge_requests/3/notes/101": `{"id":101,"body":"Looks good","author":{"id":1},"created_at":"2020-05-19T09:22:40Z","updated_at":"2020-05-19T09:22:40Z","system":false}`,
+	"/api/v4/projects/15/merge_requests/3/approvals": `{"id":99,"approved_by":[{"user":{"id":2}}],"created_at":"2020-05-19T09:14:51Z"}`,
+	"/api/v4/projects/15/merge_requests/3/commits":   `[{"id":"da1560886d4f094c3e6c9ef40349f7d38b5d27d7","message":"Add readme","created_at":"2020-05-19T09:10:00Z","author_email":"admin@example.com","committer_email":"admin@example.com"}]`,
+	"/api/v4/projects/15/issues/7":                   `{"id":301,"iid":7,"project_id":15,"title":"Missing readme","description":"Readme is missing","state":"opened","author":{"id":1},"assignee":{"id":2},"web_url":"http://gitlab.example.com/pinpt/agent-test/-/issues/7","created_at":"2020-05-19T09:30:02Z","updated_at":"2020-05-19T09:31:17Z"}`,
+	"/api/v4/projects/15/issues/7/discussions.json":  `[{"id":"d1","notes":[{"id":401,"author":{"username":"root"},"body":"Will add it","system":false,"created_at":"2020-05-19T09:31:17Z","updated_at":"2020-05-19T09:31:17Z"}]}]`,
+}
+
+func testWebhook(t *testing.T, intType inconfig.IntegrationType, event string, payloadFile string) (*testutil.Agent, rpcdef.WebhookResult) {
+	assert := assert.New(t)
+
+	server := testutil.NewServer(t, testutil.ServerOpts{
+		Responses: testAPIResponses,
+		Check: func(req *http.Request) {
+			assert.Equal("token1", req.Header.Get("Private-Token"))
+		},
+	})
+	defer server.Close()
+
+	payload := testutil.Payload(t, payloadFile)
+
+	agent := &testutil.Agent{}
+	s := NewIntegration(hclog.New(&hclog.LoggerOptions{
+		Name: "test",
+	}))
+	assert.NoError(s.Init(agent))
+
+	config := rpcdef.ExportConfig{}
+	config.Pinpoint.CustomerID = "c1"
+	config.Integration.Type = intType
+	config.Integration.Config = map[string]interface{}{
+		"url":     server.URL,
+		"api_key": "token1",
+	}
+
+	res, err := s.Webhook(context.Background(), map[string]string{"x-gitlab-event": event}, payload, config)
+	assert.NoError(err)
+	assert.Empty(res.Error)
+	return agent, res
+}
+
+func TestWebhookMergeRequest(t *testing.T) {
+	assert := assert.New(t)
+	agent, res := testWebhook(t, inconfig.IntegrationTypeSourcecode, "Merge Request Hook", "merge_request_hook.json")
+
+	prs := res.MutatedObjects[sourcecode.PullRequestModelName.String()]
+	if assert.Len(prs, 1) {
+		pr := prs[0].(map[string]interface{})
+		assert.Equal("99", pr["ref_id"])
+		assert.Equal("Add readme", pr["title"])
+	}
+	assert.Len(res.MutatedObjects[sourcecode.PullRequestCommentModelName.String()], 1)
+	assert.Len(res.MutatedObjects[sourcecode.PullRequestReviewModelName.String()], 1)
+	assert.Len(res.MutatedObjects[sourcecode.PullRequestCommitModelName.String()], 1)
+
+	if assert.Len(agent.Fetches, 1) {
+		fetch := agent.Fetches[0]
+		assert.Equal("pinpt/agent-test", fetch.UniqueName)
+		if assert.Len(fetch.PRs, 1) {
+			assert.Equal("99", fetch.PRs[0].RefID)
+			assert.Equal("da1560886d4f094c3e6c9ef40349f7d38b5d27d7", fetch.PRs[0].LastCommitSHA)
+		}
+	}
+}
+
+func TestWebhookNoteMergeRequest(t *testing.T) {
+	assert := assert.New(t)
+	agent, res := testWebhook(t, inconfig.IntegrationTypeSourcecode, "Note Hook", "note_hook_merge_request.json")
+
+	comments := res.MutatedObjects[sourcecode.PullRequestCommentModelName.String()]
+	if assert.Len(comments, 1) {
+		comment := comments[0].(map[string]interface{})
+		assert.Equal("101", comment["ref_id"])
+		assert.Equal("Looks good", comment["body"])
+	}
+	assert.Empty(agent.Fetches)
+}
+
+func TestWebhookIssue(t *testing.T) {
+	assert := assert.New(t)
+	_, res := testWebhook(t, inconfig.IntegrationTypeWork, "Issue Hook", "issue_hook.json")
+
+	issues := res.MutatedObjects[work.IssueModelName.String()]
+	if assert.Len(issues, 1) {
+		issue := issues[0].(map[string]interface{})
+		assert.Equal("7", issue["ref_id"])
+		assert.Equal("Missing readme", issue["title"])
+		assert.Equal("15-7", issue["identifier"])
+	}
+	assert.Len(res.MutatedObjects[work.IssueCommentModelName.String()], 1)
+}
+
+func TestWebhookIssueSkippedForSourcecode(t *testing.T) {
+	assert := assert.New(t)
+	_, res := testWebhook(t, inconfig.IntegrationTypeSourcecode, "Issue Hook", "issue_hook.json")
+	assert.Empty(res.MutatedObjects)
+}
+
+func TestWebhookPush(t *testing.T) {
+	assert := assert.New(t)
+	agent, res := testWebhook(t, inconfig.IntegrationTypeSourcecode, "Push Hook", "push_hook.json")
+	assert.Empty(res.MutatedObjects)
+	if assert.Len(agent.Fetches, 1) {
+		assert.Equal("pinpt/agent-test", agent.Fetches[0].UniqueName)
+		assert.Empty(agent.Fetches[0].PRs)
+	}
+}
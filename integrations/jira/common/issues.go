@@ -49,12 +49,13 @@ func (s *JiraCommon) IssuesAndChangelogs(
 	projectSender.SetTotal(len(projects))
 
 	sprints := NewSprints()
+	exportedIssues := newIssueSet()
 
 	processOpts := repoprojects.ProcessOpts{}
 	processOpts.Logger = s.opts.Logger
 	processOpts.ProjectFn = func(ctx *repoprojects.ProjectCtx) error {
 		project := ctx.Project.(Project)
-		return s.issuesAndChangelogsForProject(ctx, project, fieldByID, sprints)
+		return s.issuesAndChangelogsForProject(ctx, project, fieldByID, sprints, exportedIssues)
 	}
 
 	processOpts.Concurrency = issuesAndChangelogsProjectConcurrency
@@ -120,6 +121,12 @@ func (s *JiraCommon) IssuesAndChangelogs(
 		return
 	}
 
+	err = s.exportWorklogs(projects, exportedIssues)
+	if err != nil {
+		rerr = err
+		return
+	}
+
 	return exportResult, nil
 
 }
@@ -166,7 +173,8 @@ func (s *JiraCommon) issuesAndChangelogsForProject(
 	ctx *repoprojects.ProjectCtx,
 	project Project,
 	fieldByID map[string]commonapi.CustomField,
-	sprints *Sprints) error {
+	sprints *Sprints,
+	exportedIssues *issueSet) error {
 
 	logger := s.opts.Logger
 
@@ -179,6 +187,10 @@ func (s *JiraCommon) issuesAndChangelogsForProject(
 	if err != nil {
 		return err
 	}
+	senderTimeTracking, err := ctx.Session(commonapi.IssueTimeTrackingModelName)
+	if err != nil {
+		return err
+	}
 
 	err = commonapi.PaginateStartAt(func(paginationParams url.Values) (hasMore bool, pageSize int, rerr error) {
 		pi, resIssues, err := commonapi.IssuesAndChangelogsPage(qc, project.Project, fieldByID, senderIssues.LastProcessedTime(), paginationParams, issueResolver.IssueRefIDFromKey)
@@ -213,6 +225,12 @@ func (s *JiraCommon) issuesAndChangelogsForProject(
 				rerr = err
 				return
 			}
+			err = senderTimeTracking.Send(obj.TimeTracking)
+			if err != nil {
+				rerr = err
+				return
+			}
+			exportedIssues.Add(obj.RefID)
 		}
 		for _, obj := range resIssues {
 			err := s.exportIssueComments(senderIssues, project, obj.RefID, obj.Identifier)
@@ -0,0 +1,146 @@
+package common
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pinpt/agent/integrations/jira/commonapi"
+	"github.com/pinpt/agent/integrations/pkg/objsender"
+)
+
+// worklogsUpdatedDelay is subtracted from last processed time, since worklog/updated does not return worklogs updated in the last minute
+const worklogsUpdatedDelay = time.Minute
+
+// worklogsInitialLookback limits worklogs exported on the first run. worklog/updated is not filtered by project, so exporting all history would page through all worklogs of the instance.
+const worklogsInitialLookback = 365 * 24 * time.Hour
+
+// issueSet is a set of issue ref ids exported in the current run, safe for concurrent use
+type issueSet struct {
+	mu sync.Mutex
+	m  map[string]bool
+}
+
+func newIssueSet() *issueSet {
+	return &issueSet{m: map[string]bool{}}
+}
+
+func (s *issueSet) Add(refID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[refID] = true
+}
+
+func (s *issueSet) Has(refID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.m[refID]
+}
+
+// exportWorklogs exports worklogs updated since last export and ids of deleted worklogs. worklog/updated is not filtered by project, so worklogs for issues outside of exported projects are skipped. On the first run only worklogs updated in worklogsInitialLookback are exported.
+func (s *JiraCommon) exportWorklogs(projects []Project, exportedIssues *issueSet) error {
+	logger := s.opts.Logger
+	qc := s.CommonQC()
+
+	sender, err := objsender.Root(s.agent, commonapi.WorklogModelName)
+	if err != nil {
+		return err
+	}
+	lastProcessed := sender.LastProcessedTime()
+	var since time.Time
+	if lastProcessed.IsZero() {
+		since = time.Now().Add(-worklogsInitialLookback)
+	} else {
+		since = lastProcessed.Add(-worklogsUpdatedDelay)
+	}
+
+	projectIDs := map[string]bool{}
+	for _, p := range projects {
+		projectIDs[p.JiraID] = true
+	}
+	// included caches whether issues that were not exported in this run belong to exported projects. Also needed on the first run, since issues could be created or moved between projects while the export is running.
+	included := map[string]bool{}
+	resolveIssues := func(worklogs []commonapi.Worklog) error {
+		var ids []string
+		seen := map[string]bool{}
+		for _, item := range worklogs {
+			id := item.IssueRefID
+			if exportedIssues.Has(id) || seen[id] {
+				continue
+			}
+			if _, ok := included[id]; ok {
+				continue
+			}
+			seen[id] = true
+			ids = append(ids, id)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		issueProjects, err := commonapi.IssueProjects(qc, ids)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			// issues could be deleted or not visible to the user
+			included[id] = projectIDs[issueProjects[id]]
+		}
+		return nil
+	}
+
+	logger.Info("exporting worklogs", "since", since)
+	updatedSince := since
+	for {
+		ids, until, lastPage, err := commonapi.WorklogsUpdatedPage(qc, updatedSince)
+		if err != nil {
+			return err
+		}
+		worklogs, err := commonapi.WorklogsByIDs(qc, ids)
+		if err != nil {
+			return err
+		}
+		err = resolveIssues(worklogs)
+		if err != nil {
+			return err
+		}
+		for _, item := range worklogs {
+			if !exportedIssues.Has(item.IssueRefID) && !included[item.IssueRefID] {
+				continue
+			}
+			err := sender.Send(item)
+			if err != nil {
+				return err
+			}
+		}
+		if lastPage || len(ids) == 0 {
+			break
+		}
+		updatedSince = until
+	}
+
+	if !lastProcessed.IsZero() {
+		// issue is not returned for deleted worklogs, so deletes are sent for all projects
+		deletedSince := since
+		for {
+			ids, until, lastPage, err := commonapi.WorklogsDeletedPage(qc, deletedSince)
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				item := commonapi.Worklog{}
+				item.CustomerID = qc.CustomerID
+				item.RefID = strconv.FormatInt(id, 10)
+				item.Deleted = true
+				err := sender.Send(item)
+				if err != nil {
+					return err
+				}
+			}
+			if lastPage || len(ids) == 0 {
+				break
+			}
+			deletedSince = until
+		}
+	}
+	return sender.Done()
+}
@@ -29,6 +29,7 @@ type CustomFieldValue struct {
 type IssueWithCustomFields struct {
 	*work.Issue
 	CustomFields []CustomFieldValue
+	TimeTracking IssueTimeTracking
 }
 
 func relativeDuration(d time.Duration) string {
@@ -132,6 +133,11 @@ type issueFields struct {
 		Content   string `json:"content"`
 		Thumbnail string `json:"thumbnail"`
 	} `json:"attachment"`
+
+	// time tracking fields in seconds, nil if not set
+	TimeOriginalEstimate *int64 `json:"timeoriginalestimate"`
+	TimeEstimate         *int64 `json:"timeestimate"`
+	TimeSpent            *int64 `json:"timespent"`
 }
 
 // IssuesAndChangelogsPage returns issues and related changelogs. Calls qc.ExportUser for each user. Current difference from jira-cloud version is that user.Key is used instead of user.AccountID everywhere.
@@ -403,6 +409,13 @@ func convertIssue(qc QueryContext, data issueSource, fieldByID map[string]Custom
 	item.URL = qc.IssueURL(data.Key)
 	item.Tags = fields.Labels
 
+	item.TimeTracking.CustomerID = qc.CustomerID
+	item.TimeTracking.IssueID = qc.IssueID(data.ID)
+	item.TimeTracking.IssueRefID = data.ID
+	item.TimeTracking.OriginalEstimate = fields.TimeOriginalEstimate
+	item.TimeTracking.RemainingEstimate = fields.TimeEstimate
+	item.TimeTracking.TimeSpent = fields.TimeSpent
+
 	for _, link := range fields.IssueLinks {
 		var linkType work.IssueLinkedIssuesLinkType
 		reverseDirection := false
@@ -781,3 +794,47 @@ func GetIssueKeys(qc QueryContext, issueIDOrKey string) (res IssueKeys, rerr err
 
 	return res, nil
 }
+
+// maxIssuesPerProjectsRequest is the number of issue ids passed in one search request in IssueProjects
+const maxIssuesPerProjectsRequest = 100
+
+// IssueProjects returns project ref ids for passed issue ref ids, using one search request per 100 issues. Issues that were deleted or are not visible to the user are not included in the result.
+func IssueProjects(qc QueryContext, issueRefIDs []string) (res map[string]string, rerr error) {
+	res = map[string]string{}
+	for len(issueRefIDs) != 0 {
+		batch := issueRefIDs
+		if len(batch) > maxIssuesPerProjectsRequest {
+			batch = issueRefIDs[:maxIssuesPerProjectsRequest]
+		}
+		issueRefIDs = issueRefIDs[len(batch):]
+
+		params := url.Values{}
+		// missing issues are returned as warnings instead of failing the query
+		params.Set("validateQuery", "warn")
+		params.Set("jql", "id in ("+strings.Join(batch, ",")+")")
+		params.Set("fields", "project")
+		params.Set("maxResults", strconv.Itoa(len(batch)))
+
+		qc.Logger.Debug("issue projects request", "issues", len(batch))
+
+		var rr struct {
+			Issues []struct {
+				ID     string `json:"id"`
+				Fields struct {
+					Project struct {
+						ID string `json:"id"`
+					} `json:"project"`
+				} `json:"fields"`
+			} `json:"issues"`
+		}
+		err := qc.Req.Get("search", params, &rr)
+		if err != nil {
+			rerr = err
+			return
+		}
+		for _, issue := range rr.Issues {
+			res[issue.ID] = issue.Fields.Project.ID
+		}
+	}
+	return
+}
@@ -0,0 +1,219 @@
+package commonapi
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pinpt/agent/pkg/requests"
+	"github.com/pinpt/go-common/datetime"
+)
+
+// WorklogModelName is the model for issue worklogs. Requires work.IssueWorklog in integration-sdk, Worklog.ToMap matches its fields until the sdk model is released.
+const WorklogModelName = "work.IssueWorklog"
+
+// IssueTimeTrackingModelName is the model for issue estimates and time spent. Depends on work.IssueTimeTracking being added to integration-sdk.
+const IssueTimeTrackingModelName = "work.IssueTimeTracking"
+
+// Worklog is the time logged by the user on the issue
+type Worklog struct {
+	CustomerID       string
+	RefID            string
+	IssueID          string
+	IssueRefID       string
+	UserRefID        string
+	TimeSpentSeconds int64
+	StartedDate      time.Time
+	CreatedDate      time.Time
+	UpdatedDate      time.Time
+	// Deleted is set for worklogs deleted in jira, only ids are sent for these
+	Deleted bool
+}
+
+func (s Worklog) ToMap() map[string]interface{} {
+	res := map[string]interface{}{}
+	res["customer_id"] = s.CustomerID
+	res["ref_id"] = s.RefID
+	res["ref_type"] = refType
+	if s.Deleted {
+		res["deleted"] = true
+		return res
+	}
+	res["issue_id"] = s.IssueID
+	res["issue_ref_id"] = s.IssueRefID
+	res["user_ref_id"] = s.UserRefID
+	res["time_spent_seconds"] = s.TimeSpentSeconds
+	res["started_date"] = dateMap(s.StartedDate)
+	res["created_date"] = dateMap(s.CreatedDate)
+	res["updated_date"] = dateMap(s.UpdatedDate)
+	return res
+}
+
+// IssueTimeTracking contains estimates and time spent on the issue in seconds. Nil values are not set in jira.
+type IssueTimeTracking struct {
+	CustomerID        string
+	IssueID           string
+	IssueRefID        string
+	OriginalEstimate  *int64
+	RemainingEstimate *int64
+	TimeSpent         *int64
+}
+
+func (s IssueTimeTracking) ToMap() map[string]interface{} {
+	res := map[string]interface{}{}
+	res["customer_id"] = s.CustomerID
+	res["ref_id"] = s.IssueRefID
+	res["ref_type"] = refType
+	res["issue_id"] = s.IssueID
+	res["original_estimate_seconds"] = s.OriginalEstimate
+	res["remaining_estimate_seconds"] = s.RemainingEstimate
+	res["time_spent_seconds"] = s.TimeSpent
+	return res
+}
+
+func dateMap(ts time.Time) map[string]interface{} {
+	res := map[string]interface{}{}
+	if ts.IsZero() {
+		return res
+	}
+	d, _ := datetime.NewDateWithTime(ts)
+	res["epoch"] = d.Epoch
+	res["offset"] = d.Offset
+	res["rfc3339"] = d.Rfc3339
+	return res
+}
+
+// WorklogsUpdatedPage returns ids of worklogs updated since the passed time. Next page should be requested with since set to until. The endpoint returns up to 1000 ids per page.
+func WorklogsUpdatedPage(qc QueryContext, since time.Time) (ids []int64, until time.Time, lastPage bool, rerr error) {
+	return worklogsChangedPage(qc, "worklog/updated", since)
+}
+
+// WorklogsDeletedPage returns ids of worklogs deleted since the passed time. Pagination is the same as in WorklogsUpdatedPage.
+func WorklogsDeletedPage(qc QueryContext, since time.Time) (ids []int64, until time.Time, lastPage bool, rerr error) {
+	return worklogsChangedPage(qc, "worklog/deleted", since)
+}
+
+func worklogsChangedPage(qc QueryContext, objectPath string, since time.Time) (ids []int64, until time.Time, lastPage bool, rerr error) {
+	params := url.Values{}
+	params.Set("since", strconv.FormatInt(timeToMs(since), 10))
+
+	qc.Logger.Debug("worklogs changed request", "path", objectPath, "since", since)
+
+	var rr struct {
+		Values []struct {
+			WorklogID int64 `json:"worklogId"`
+		} `json:"values"`
+		Until    int64 `json:"until"`
+		LastPage bool  `json:"lastPage"`
+	}
+	err := qc.Req.Get(objectPath, params, &rr)
+	if err != nil {
+		rerr = err
+		return
+	}
+	for _, v := range rr.Values {
+		ids = append(ids, v.WorklogID)
+	}
+	return ids, msToTime(rr.Until), rr.LastPage, nil
+}
+
+// maxWorklogsPerListRequest is the limit of ids for worklog/list
+const maxWorklogsPerListRequest = 1000
+
+type worklogResponse struct {
+	ID               string `json:"id"`
+	IssueID          string `json:"issueId"`
+	Author           User   `json:"author"`
+	Started          string `json:"started"`
+	Created          string `json:"created"`
+	Updated          string `json:"updated"`
+	TimeSpentSeconds int64  `json:"timeSpentSeconds"`
+}
+
+// WorklogsByIDs returns worklogs for passed ids. Calls qc.ExportUser for authors.
+func WorklogsByIDs(qc QueryContext, ids []int64) (res []Worklog, rerr error) {
+	for len(ids) != 0 {
+		batch := ids
+		if len(batch) > maxWorklogsPerListRequest {
+			batch = ids[:maxWorklogsPerListRequest]
+		}
+		ids = ids[len(batch):]
+
+		reqObj := struct {
+			IDs []int64 `json:"ids"`
+		}{
+			IDs: batch,
+		}
+		req := requests.Request{}
+		req.Method = "POST"
+		req.URL = qc.Req.URL("worklog/list")
+		var err error
+		req.Body, err = json.Marshal(reqObj)
+		if err != nil {
+			rerr = err
+			return
+		}
+		var rr []worklogResponse
+		_, err = qc.Req.JSON(req, &rr)
+		if err != nil {
+			rerr = err
+			return
+		}
+		for _, data := range rr {
+			item, err := convertWorklog(qc, data)
+			if err != nil {
+				rerr = err
+				return
+			}
+			res = append(res, item)
+		}
+	}
+	return
+}
+
+func convertWorklog(qc QueryContext, data worklogResponse) (item Worklog, rerr error) {
+	item.CustomerID = qc.CustomerID
+	item.RefID = data.ID
+	item.IssueRefID = data.IssueID
+	item.IssueID = qc.IssueID(data.IssueID)
+	item.TimeSpentSeconds = data.TimeSpentSeconds
+	if !data.Author.IsZero() {
+		item.UserRefID = data.Author.RefID()
+		if qc.ExportUser != nil {
+			err := qc.ExportUser(data.Author)
+			if err != nil {
+				rerr = err
+				return
+			}
+		}
+	}
+	var err error
+	item.StartedDate, err = ParseTime(data.Started)
+	if err != nil {
+		rerr = err
+		return
+	}
+	item.CreatedDate, err = ParseTime(data.Created)
+	if err != nil {
+		rerr = err
+		return
+	}
+	item.UpdatedDate, err = ParseTime(data.Updated)
+	if err != nil {
+		rerr = err
+		return
+	}
+	return
+}
+
+func timeToMs(ts time.Time) int64 {
+	if ts.IsZero() {
+		return 0
+	}
+	return ts.UnixNano() / int64(time.Millisecond)
+}
+
+func msToTime(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
@@ -0,0 +1,143 @@
+package commonapi
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/pkg/requests"
+	"github.com/stretchr/testify/assert"
+)
+
+type testWorklogRequester struct {
+	listIDs [][]int64
+	paths   []string
+}
+
+func (s *testWorklogRequester) Get(objPath string, params url.Values, res interface{}) error {
+	s.paths = append(s.paths, objPath)
+	data := `{"values":[{"worklogId":101,"updatedTime":1588327200000},{"worklogId":102,"updatedTime":1588327260000}],"since":1588327200000,"until":1588327260000,"lastPage":true}`
+	return json.Unmarshal([]byte(data), res)
+}
+
+func (s *testWorklogRequester) Get2(objPath string, params url.Values, res interface{}) (int, error) {
+	return 200, s.Get(objPath, params, res)
+}
+
+func (s *testWorklogRequester) GetAgile(objPath string, params url.Values, res interface{}) error {
+	panic("not implemented")
+}
+
+func (s *testWorklogRequester) JSON(req requests.Request, res interface{}) (_ requests.Result, rerr error) {
+	var body struct {
+		IDs []int64 `json:"ids"`
+	}
+	if err := json.Unmarshal(req.Body, &body); err != nil {
+		rerr = err
+		return
+	}
+	s.listIDs = append(s.listIDs, body.IDs)
+	data := `[{"id":"101","issueId":"10001","author":{"accountId":"u1"},"started":"2020-05-01T10:00:00.000+0000","created":"2020-05-01T12:00:00.000+0000","updated":"2020-05-01T12:00:00.000+0000","timeSpentSeconds":3600}]`
+	rerr = json.Unmarshal([]byte(data), res)
+	return
+}
+
+func (s *testWorklogRequester) URL(objPath string) string {
+	return "https://example.atlassian.net/rest/api/3/" + objPath
+}
+
+func testWorklogQC(req Requester) QueryContext {
+	qc := QueryContext{}
+	qc.WebsiteURL = "https://example.atlassian.net"
+	qc.Logger = hclog.New(&hclog.LoggerOptions{Name: "test"})
+	qc.CustomerID = "c1"
+	qc.Req = req
+	return qc
+}
+
+func TestWorklogsUpdatedPage(t *testing.T) {
+	assert := assert.New(t)
+	ids, until, lastPage, err := WorklogsUpdatedPage(testWorklogQC(&testWorklogRequester{}), time.Time{})
+	assert.NoError(err)
+	assert.Equal([]int64{101, 102}, ids)
+	assert.True(lastPage)
+	assert.Equal(int64(1588327260000), timeToMs(until))
+}
+
+func TestWorklogsDeletedPage(t *testing.T) {
+	assert := assert.New(t)
+	req := &testWorklogRequester{}
+	ids, _, lastPage, err := WorklogsDeletedPage(testWorklogQC(req), time.Now())
+	assert.NoError(err)
+	assert.Equal([]string{"worklog/deleted"}, req.paths)
+	assert.Equal([]int64{101, 102}, ids)
+	assert.True(lastPage)
+}
+
+func TestWorklogDeletedToMap(t *testing.T) {
+	w := Worklog{CustomerID: "c1", RefID: "101", Deleted: true}
+	assert.Equal(t, map[string]interface{}{"customer_id": "c1", "ref_id": "101", "ref_type": "jira", "deleted": true}, w.ToMap())
+}
+
+// testIssueProjectsRequester returns project 1 for even issue ids, odd issue ids do not exist
+type testIssueProjectsRequester struct {
+	testWorklogRequester
+	jqls []string
+}
+
+func (s *testIssueProjectsRequester) Get(objPath string, params url.Values, res interface{}) error {
+	s.jqls = append(s.jqls, params.Get("jql"))
+	ids := strings.Split(strings.TrimSuffix(strings.TrimPrefix(params.Get("jql"), "id in ("), ")"), ",")
+	var issues []string
+	for _, id := range ids {
+		n, _ := strconv.Atoi(id)
+		if n%2 == 0 {
+			issues = append(issues, `{"id":"`+id+`","fields":{"project":{"id":"1"}}}`)
+		}
+	}
+	return json.Unmarshal([]byte(`{"issues":[`+strings.Join(issues, ",")+`]}`), res)
+}
+
+func TestIssueProjects(t *testing.T) {
+	assert := assert.New(t)
+	req := &testIssueProjectsRequester{}
+	var ids []string
+	for i := 0; i < 150; i++ {
+		ids = append(ids, strconv.Itoa(i))
+	}
+	res, err := IssueProjects(testWorklogQC(req), ids)
+	assert.NoError(err)
+	assert.Len(req.jqls, 2)
+	assert.Len(res, 75)
+	assert.Equal("1", res["148"])
+	_, ok := res["149"]
+	assert.False(ok)
+}
+
+func TestWorklogsByIDs(t *testing.T) {
+	assert := assert.New(t)
+	req := &testWorklogRequester{}
+	var ids []int64
+	for i := 0; i < 1500; i++ {
+		ids = append(ids, int64(i))
+	}
+	res, err := WorklogsByIDs(testWorklogQC(req), ids)
+	assert.NoError(err)
+	// split into requests of 1000
+	if assert.Len(req.listIDs, 2) {
+		assert.Len(req.listIDs[0], 1000)
+		assert.Len(req.listIDs[1], 500)
+	}
+	if assert.Len(res, 2) {
+		w := res[0]
+		assert.Equal("101", w.RefID)
+		assert.Equal("10001", w.IssueRefID)
+		assert.Equal("u1", w.UserRefID)
+		assert.Equal(int64(3600), w.TimeSpentSeconds)
+		assert.Equal(time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC), w.StartedDate.UTC())
+	}
+}
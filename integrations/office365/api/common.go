@@ -19,12 +19,14 @@ import (
 )
 
 type API interface {
-	GetEventsAndUsers(calid string) ([]*calendar.Event, map[string]*calendar.User, error)
+	GetEventsAndUsers(calid string, lastSyncState string) ([]*calendar.Event, map[string]*calendar.User, string, error)
 	GetMainCalendars() ([]*calendar.Calendar, error)
 	GetSharedCalendars() ([]*calendar.Calendar, error)
 	Validate() error
 }
 
+const defaultBaseURL = "https://graph.microsoft.com/v1.0/"
+
 type api struct {
 	logger           hclog.Logger
 	refreshTokenFunc refreshTokenFunc
@@ -33,6 +35,8 @@ type api struct {
 	refType          string
 	ids              ids2.Gen
 	accessToken      string
+
+	baseURL string
 }
 type refreshTokenFunc = func() (string, error)
 
@@ -57,6 +61,7 @@ func New(logger hclog.Logger, customerID string, refType string, refreshToken re
 		ids:              ids2.New(customerID, refType),
 		accessToken:      accessToken,
 		refreshTokenFunc: refreshToken,
+		baseURL:          defaultBaseURL,
 	}, nil
 }
 
@@ -64,13 +69,18 @@ type queryParams map[string]string
 
 func (s *api) get(u string, params queryParams, res interface{}) error {
 	// ========== create request ==========
-	requesturl, _ := url.Parse(pstrings.JoinURL("https://graph.microsoft.com/v1.0/", u))
+	requesturl, _ := url.Parse(pstrings.JoinURL(s.baseURL, u))
 	vals := requesturl.Query()
 	for k, v := range params {
 		vals.Set(k, v)
 	}
 	requesturl.RawQuery = vals.Encode()
-	req, err := http.NewRequest(http.MethodGet, requesturl.String(), nil)
+	return s.getURL(requesturl.String(), res)
+}
+
+// getURL fetches the full url, used directly for links returned by the api, such as delta links
+func (s *api) getURL(requesturl string, res interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, requesturl, nil)
 	if err != nil {
 		return fmt.Errorf("error creating request. err %v", err)
 	}
@@ -98,13 +108,34 @@ func (s *api) get(u string, params queryParams, res interface{}) error {
 		if s.accessToken, err = s.refreshTokenFunc(); err != nil {
 			return err
 		}
-		return s.get(u, params, req)
+		return s.getURL(requesturl, res)
 	default:
 		b, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
 			return fmt.Errorf("error reading response body. err %v", err)
 		}
-		return fmt.Errorf("error fetching from google calendar api. response_code: %v. response: %v", resp.StatusCode, string(b))
+		rerr := &apiError{StatusCode: resp.StatusCode, Body: string(b)}
+		var errRes struct {
+			Error struct {
+				Code string `json:"code"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(b, &errRes) == nil {
+			rerr.Code = errRes.Error.Code
+		}
+		return rerr
 	}
 	return nil
 }
+
+// apiError is returned for responses with unexpected status code
+type apiError struct {
+	StatusCode int
+	// Code is the error code from response body, for example syncStateNotFound
+	Code string
+	Body string
+}
+
+func (s *apiError) Error() string {
+	return fmt.Sprintf("error fetching from office365 api. response_code: %v. response: %v", s.StatusCode, s.Body)
+}
@@ -1,6 +1,10 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
@@ -55,94 +59,222 @@ type calendarViewResponse struct {
 	} `json:"start"`
 	Subject string `json:"subject"`
 	WebLink string `json:"WebLink"`
+
+	// IsCancelled is set when the organizer cancelled the meeting
+	IsCancelled bool `json:"isCancelled"`
+	// Removed is set in delta responses for events deleted or moved out of the time window, only id is returned
+	Removed *struct {
+		// Reason is deleted or changed (moved out of the time window)
+		Reason string `json:"reason"`
+	} `json:"@removed"`
+}
+
+type calendarViewDeltaResponse struct {
+	Value []calendarViewResponse `json:"value"`
+	// DeltaLink is returned on the last page, used to fetch changes in the next export
+	DeltaLink string `json:"@odata.deltaLink"`
+}
+
+// syncWindowMinAhead is how far ahead the end of the sync window has to be. Delta links keep the range of the initial request, so a full sync is done to move the window once it drifts.
+const syncWindowMinAhead = 11 * 30 * 24 * time.Hour
+
+// syncWindow is the time range of events fetched on full sync
+func syncWindow(now time.Time) (start, end time.Time) {
+	return now.AddDate(-1, 0, 0), now.AddDate(1, 0, 0)
+}
+
+// syncState is stored as last processed value of the calendar
+type syncState struct {
+	DeltaLink   string    `json:"delta_link"`
+	WindowStart time.Time `json:"window_start"`
+	WindowEnd   time.Time `json:"window_end"`
+	// Events are exported events in the sync window by id. Delta response only contains id of deleted events, stored event is sent again with cancelled status.
+	Events map[string]calendarViewResponse `json:"events"`
+}
+
+// parseSyncState returns empty state if full sync is required. Delta link without window saved by previous version also requires full sync.
+func parseSyncState(str string) (res syncState) {
+	if str == "" || !strings.HasPrefix(str, "{") {
+		return
+	}
+	if err := json.Unmarshal([]byte(str), &res); err != nil {
+		return syncState{}
+	}
+	return
+}
+
+// needsFullSync returns true if there is no delta link or the sync window drifted
+func (s syncState) needsFullSync(now time.Time) bool {
+	return s.DeltaLink == "" || s.WindowEnd.Sub(now) < syncWindowMinAhead
+}
+
+func (s syncState) String() string {
+	b, err := json.Marshal(s)
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
 }
 
-func (s *api) GetEventsAndUsers(calid string) (newEvents []*calendar.Event, allUsers map[string]*calendar.User, _ error) {
+// isSyncStateExpired returns true if the delta link is no longer valid and full sync is required
+func isSyncStateExpired(err error) bool {
+	var e *apiError
+	if !errors.As(err, &e) {
+		return false
+	}
+	if e.StatusCode == http.StatusGone {
+		return true
+	}
+	switch strings.ToLower(e.Code) {
+	case "syncstatenotfound", "syncstateinvalid", "resyncrequired":
+		return true
+	}
+	return false
+}
 
-	fields := []string{
-		"subject", "body", "location", "organizer", "end", "start",
-		"responseStatus", "attendees", "showAs", "onlineMeetingUrl",
+// fetchDelta returns changed events since the delta link in state, or all events in a new sync window if full sync is required or delta link expired
+func (s *api) fetchDelta(calid string, state syncState) (res []calendarViewDeltaResponse, newState syncState, _ error) {
+	now := time.Now()
+	if !state.needsFullSync(now) {
+		err := s.getURL(state.DeltaLink, &res)
+		if err == nil {
+			return res, state, nil
+		}
+		if !isSyncStateExpired(err) {
+			return nil, state, err
+		}
+		s.logger.Info("delta link expired, doing full sync of calendar", "calendar", calid, "err", err)
+		res = nil
+	} else if state.DeltaLink != "" {
+		s.logger.Info("sync window drifted, doing full sync of calendar", "calendar", calid, "window_end", state.WindowEnd)
 	}
+	newState.WindowStart, newState.WindowEnd = syncWindow(now)
 	params := queryParams{
-		"startDateTime": time.Now().AddDate(-1, 0, 0).Format(time.RFC3339Nano),
-		"endDateTime":   time.Now().AddDate(1, 0, 0).Format(time.RFC3339Nano),
-		"$select":       strings.Join(fields, ","),
+		"startDateTime": newState.WindowStart.Format(time.RFC3339Nano),
+		"endDateTime":   newState.WindowEnd.Format(time.RFC3339Nano),
 	}
-	var res []struct {
-		Value []calendarViewResponse `json:"value"`
+	err := s.get("me/calendars/"+calid+"/calendarView/delta", params, &res)
+	if err != nil {
+		return nil, state, err
 	}
-	err := s.get("me/calendars/"+calid+"/calendarview", params, &res)
+	return res, newState, nil
+}
+
+// GetEventsAndUsers returns events changed since lastSyncState and the new sync state. Returns all events in sync window if lastSyncState is empty, expired or the window drifted. Deleted events are returned with cancelled status, see readme.
+func (s *api) GetEventsAndUsers(calid string, lastSyncState string) (newEvents []*calendar.Event, allUsers map[string]*calendar.User, newSyncState string, _ error) {
+	res, state, err := s.fetchDelta(calid, parseSyncState(lastSyncState))
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, "", err
+	}
+	if state.Events == nil {
+		state.Events = map[string]calendarViewResponse{}
 	}
 	allUsers = map[string]*calendar.User{}
 	for _, r := range res {
+		if r.DeltaLink != "" {
+			state.DeltaLink = r.DeltaLink
+		}
 		for _, evt := range r.Value {
-			newEvent := &calendar.Event{}
-			newEvent.CustomerID = s.customerID
-			newEvent.Name = evt.Subject
-			newEvent.Description = strings.TrimSpace(strings.Replace(evt.Body.Content, "\r\n", "\n", -1))
-			newEvent.RefType = s.refType
-			newEvent.RefID = evt.ID
-			newEvent.CalendarID = s.ids.CalendarEvent(calid)
-			newEvent.Location.URL = evt.OnlineMeetingURL
-			newEvent.Location.Name = evt.Location.DisplayName
-			newEvent.Location.Details = pjson.Stringify(evt.Location.Address)
-			newEvent.Busy = evt.ShowAs == "busy"
-			newEvent.OwnerRefID = s.ids.CalendarUserRefID(evt.Organizer.EmailAddress.Address)
-			switch strings.ToLower(evt.ResponseStatus.Response) {
-			case "accepted", "organizer":
-				newEvent.Status = calendar.EventStatusConfirmed
-			case "tentativelyaccepted":
-				newEvent.Status = calendar.EventStatusTentative
-			case "declined":
-				newEvent.Status = calendar.EventStatusCancelled
-			default:
-				newEvent.Status = calendar.EventStatusTentative
-			}
-			for _, att := range evt.Attendees {
-				var user calendar.EventParticipants
-				switch strings.ToLower(att.Status.Response) {
-				case "accepted", "organizer":
-					user.Status = calendar.EventParticipantsStatusGoing
-				case "tentativelyaccepted":
-					user.Status = calendar.EventParticipantsStatusMaybe
-				case "declined":
-					user.Status = calendar.EventParticipantsStatusNotGoing
+			if evt.Removed != nil {
+				// only id is returned for removed events
+				switch evt.Removed.Reason {
+				case "changed":
+					// moved out of the sync window, the event itself is unchanged and keeps its exported data
+					delete(state.Events, evt.ID)
+					continue
+				case "deleted":
+					stored, ok := state.Events[evt.ID]
+					if !ok {
+						s.logger.Debug("deleted event was not exported, skipping", "calendar", calid, "event", evt.ID)
+						continue
+					}
+					delete(state.Events, evt.ID)
+					evt = stored
+					evt.IsCancelled = true
 				default:
-					user.Status = calendar.EventParticipantsStatusUnknown
-				}
-				refid := s.ids.CalendarUserRefID(att.EmailAddress.Address)
-				user.UserRefID = refid
-				newEvent.Participants = append(newEvent.Participants, user)
-
-				allUsers[refid] = &calendar.User{
-					CustomerID: s.customerID,
-					Email:      att.EmailAddress.Address,
-					Name:       att.EmailAddress.Name,
-					RefID:      refid,
-					RefType:    s.refType,
+					s.logger.Warn("unknown reason for removed event, skipping", "calendar", calid, "event", evt.ID, "reason", evt.Removed.Reason)
+					continue
 				}
+			} else {
+				state.Events[evt.ID] = evt
 			}
-			var parsed time.Time
-			var err error
-			if parsed, err = convertDate(evt.Start.DateTime, evt.Start.TimeZone); err != nil {
-				s.logger.Error("could not figure our start time", "err", err)
-				continue
-			}
-			date.ConvertToModel(parsed, &newEvent.StartDate)
-
-			if parsed, err = convertDate(evt.End.DateTime, evt.End.TimeZone); err != nil {
-				s.logger.Error("could not figure our end time", "err", err)
+			newEvent, err := s.convertEvent(calid, evt, allUsers)
+			if err != nil {
+				s.logger.Error("could not convert event", "event", evt.ID, "err", err)
 				continue
 			}
-			date.ConvertToModel(parsed, &newEvent.EndDate)
 			newEvents = append(newEvents, newEvent)
 		}
 	}
+	newSyncState = state.String()
 	return
 }
 
+// convertEvent returns calendar event from api response, attendees are added to allUsers
+func (s *api) convertEvent(calid string, evt calendarViewResponse, allUsers map[string]*calendar.User) (*calendar.Event, error) {
+	newEvent := &calendar.Event{}
+	newEvent.CustomerID = s.customerID
+	newEvent.Name = evt.Subject
+	newEvent.Description = strings.TrimSpace(strings.Replace(evt.Body.Content, "\r\n", "\n", -1))
+	newEvent.RefType = s.refType
+	newEvent.RefID = evt.ID
+	newEvent.CalendarID = s.ids.CalendarEvent(calid)
+	newEvent.Location.URL = evt.OnlineMeetingURL
+	newEvent.Location.Name = evt.Location.DisplayName
+	newEvent.Location.Details = pjson.Stringify(evt.Location.Address)
+	newEvent.Busy = evt.ShowAs == "busy"
+	newEvent.OwnerRefID = s.ids.CalendarUserRefID(evt.Organizer.EmailAddress.Address)
+	switch strings.ToLower(evt.ResponseStatus.Response) {
+	case "accepted", "organizer":
+		newEvent.Status = calendar.EventStatusConfirmed
+	case "tentativelyaccepted":
+		newEvent.Status = calendar.EventStatusTentative
+	case "declined":
+		newEvent.Status = calendar.EventStatusCancelled
+	default:
+		newEvent.Status = calendar.EventStatusTentative
+	}
+	if evt.IsCancelled {
+		newEvent.Status = calendar.EventStatusCancelled
+	}
+	for _, att := range evt.Attendees {
+		var user calendar.EventParticipants
+		switch strings.ToLower(att.Status.Response) {
+		case "accepted", "organizer":
+			user.Status = calendar.EventParticipantsStatusGoing
+		case "tentativelyaccepted":
+			user.Status = calendar.EventParticipantsStatusMaybe
+		case "declined":
+			user.Status = calendar.EventParticipantsStatusNotGoing
+		default:
+			user.Status = calendar.EventParticipantsStatusUnknown
+		}
+		refid := s.ids.CalendarUserRefID(att.EmailAddress.Address)
+		user.UserRefID = refid
+		newEvent.Participants = append(newEvent.Participants, user)
+
+		allUsers[refid] = &calendar.User{
+			CustomerID: s.customerID,
+			Email:      att.EmailAddress.Address,
+			Name:       att.EmailAddress.Name,
+			RefID:      refid,
+			RefType:    s.refType,
+		}
+	}
+	parsed, err := convertDate(evt.Start.DateTime, evt.Start.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("could not figure our start time: %v", err)
+	}
+	date.ConvertToModel(parsed, &newEvent.StartDate)
+
+	parsed, err = convertDate(evt.End.DateTime, evt.End.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("could not figure our end time: %v", err)
+	}
+	date.ConvertToModel(parsed, &newEvent.EndDate)
+	return newEvent, nil
+}
+
 func convertDate(str string, tz string) (time.Time, error) {
 	parsed, err := time.Parse(time.RFC3339Nano, str+"Z")
 	if err != nil {
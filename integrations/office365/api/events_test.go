@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/pkg/ids2"
+	"github.com/pinpt/httpclient"
+	"github.com/pinpt/integration-sdk/calendar"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAPI(serverURL string) *api {
+	return &api{
+		client:           httpclient.NewHTTPClient(context.Background(), &httpclient.Config{Paginator: paginator{}}, http.DefaultClient),
+		logger:           hclog.New(&hclog.LoggerOptions{Name: "test"}),
+		customerID:       "c1",
+		refType:          "office365",
+		ids:              ids2.New("c1", "office365"),
+		accessToken:      "token",
+		refreshTokenFunc: func() (string, error) { return "token", nil },
+		baseURL:          serverURL,
+	}
+}
+
+func TestGetEventsAndUsersDelta(t *testing.T) {
+	assert := assert.New(t)
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("/me/calendars/cal1/calendarView/delta", r.URL.Path)
+		switch r.URL.Query().Get("$deltatoken") {
+		case "":
+			assert.NotEmpty(r.URL.Query().Get("startDateTime"))
+			assert.NotEmpty(r.URL.Query().Get("endDateTime"))
+			w.Write([]byte(`{"value":[{"id":"e1","subject":"standup","isCancelled":false,"responseStatus":{"response":"organizer"},"start":{"dateTime":"2020-05-01T10:00:00.0000000","timeZone":"UTC"},"end":{"dateTime":"2020-05-01T10:15:00.0000000","timeZone":"UTC"}},{"id":"e2","subject":"planning","body":{"content":"agenda"},"responseStatus":{"response":"accepted"},"start":{"dateTime":"2020-05-02T10:00:00.0000000","timeZone":"UTC"},"end":{"dateTime":"2020-05-02T11:00:00.0000000","timeZone":"UTC"}}],"@odata.deltaLink":"` + server.URL + `/me/calendars/cal1/calendarView/delta?$deltatoken=t1"}`))
+		case "t1":
+			w.Write([]byte(`{"value":[{"id":"e1","subject":"standup","isCancelled":true,"responseStatus":{"response":"organizer"},"start":{"dateTime":"2020-05-01T10:00:00.0000000","timeZone":"UTC"},"end":{"dateTime":"2020-05-01T10:15:00.0000000","timeZone":"UTC"}},{"id":"e2","@removed":{"reason":"deleted"}},{"id":"e3","@removed":{"reason":"changed"}},{"id":"e4","@removed":{"reason":"deleted"}}],"@odata.deltaLink":"` + server.URL + `/me/calendars/cal1/calendarView/delta?$deltatoken=t2"}`))
+		default:
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte(`{"error":{"code":"syncStateNotFound","message":"sync state expired"}}`))
+		}
+	}))
+	defer server.Close()
+
+	s := newTestAPI(server.URL)
+	deltaLink := func(state string) string {
+		return parseSyncState(state).DeltaLink
+	}
+
+	// full sync
+	events, _, state, err := s.GetEventsAndUsers("cal1", "")
+	assert.NoError(err)
+	assert.Equal(server.URL+"/me/calendars/cal1/calendarView/delta?$deltatoken=t1", deltaLink(state))
+	assert.Equal(2, len(events))
+	assert.Equal("e1", events[0].RefID)
+	assert.Equal(calendar.EventStatusConfirmed, events[0].Status)
+
+	// changes only, deleted event is sent with stored data and cancelled status, events moved out of the window and deleted events that were not exported are skipped
+	events, _, state, err = s.GetEventsAndUsers("cal1", state)
+	assert.NoError(err)
+	assert.Equal(server.URL+"/me/calendars/cal1/calendarView/delta?$deltatoken=t2", deltaLink(state))
+	if assert.Equal(2, len(events)) {
+		assert.Equal("e1", events[0].RefID)
+		assert.Equal(calendar.EventStatusCancelled, events[0].Status)
+		assert.Equal("e2", events[1].RefID)
+		assert.Equal(calendar.EventStatusCancelled, events[1].Status)
+		assert.Equal("planning", events[1].Name)
+		assert.Equal("agenda", events[1].Description)
+	}
+	_, ok := parseSyncState(state).Events["e2"]
+	assert.False(ok, "deleted event is removed from state")
+
+	// expired delta link results in full sync
+	expired := parseSyncState(state)
+	expired.DeltaLink = server.URL + "/me/calendars/cal1/calendarView/delta?$deltatoken=expired"
+	events, _, state, err = s.GetEventsAndUsers("cal1", expired.String())
+	assert.NoError(err)
+	assert.Equal(server.URL+"/me/calendars/cal1/calendarView/delta?$deltatoken=t1", deltaLink(state))
+	assert.Equal(2, len(events))
+
+	// delta link saved by previous version without window results in full sync
+	_, _, state, err = s.GetEventsAndUsers("cal1", server.URL+"/me/calendars/cal1/calendarView/delta?$deltatoken=t1")
+	assert.NoError(err)
+	assert.Equal(server.URL+"/me/calendars/cal1/calendarView/delta?$deltatoken=t1", deltaLink(state))
+}
+
+func TestSyncStateWindowDrift(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now()
+	state := syncState{DeltaLink: "link1"}
+	state.WindowStart, state.WindowEnd = syncWindow(now)
+	assert.False(state.needsFullSync(now))
+	assert.False(state.needsFullSync(now.AddDate(0, 0, 7)))
+	assert.True(state.needsFullSync(now.AddDate(0, 2, 0)))
+	assert.True(syncState{}.needsFullSync(now))
+
+	assert.Equal(state.DeltaLink, parseSyncState(state.String()).DeltaLink)
+	assert.True(state.WindowEnd.Equal(parseSyncState(state.String()).WindowEnd))
+}
@@ -74,23 +74,24 @@ func (s *Integration) export(ctx context.Context, conf rpcdef.ExportConfig) (res
 
 	processOpts := repoprojects.ProcessOpts{}
 	processOpts.Logger = s.logger
-	processOpts.ProjectFn = func(ctx *repoprojects.ProjectCtx) error {
+	processOpts.ProjectLastProcessFn = func(ctx *repoprojects.ProjectCtx) (string, error) {
 		proj := ctx.Project.(Calendar)
 		eventSender, err := ctx.Session(calendar.EventModelName)
 		if err != nil {
-			return err
+			return "", err
 		}
-		events, users, err := proj.API.GetEventsAndUsers(proj.GetID())
+		// last processed is the delta link and sync window from the previous export
+		events, users, syncState, err := proj.API.GetEventsAndUsers(proj.GetID(), eventSender.LastProcessed())
 		if err != nil {
-			return err
+			return "", err
 		}
 		for _, evt := range events {
 			if err := eventSender.Send(evt); err != nil {
-				return err
+				return "", err
 			}
 		}
 		userchan <- users
-		return nil
+		return syncState, nil
 	}
 	processOpts.Concurrency = 10
 	processOpts.Projects = projectsIface
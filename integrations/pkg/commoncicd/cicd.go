@@ -0,0 +1,88 @@
+// Package commoncicd contains helpers shared by integrations exporting builds and deployments.
+package commoncicd
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pinpt/integration-sdk/cicd"
+)
+
+// InitialLookback limits the history exported on the first run. Builds are fetched per commit or per pipeline, exporting all history would take too long for large repos.
+const InitialLookback = 90 * 24 * time.Hour
+
+// CompletionWindow is how long after the commit or deployment creation the build or deployment is expected to complete. Apis that can only filter by creation time fetch objects created this much earlier than the last export, and skip the ones completed before it.
+const CompletionWindow = 24 * time.Hour
+
+// StartTime returns the time from which builds and deployments should be exported
+func StartTime(lastProcessed time.Time) time.Time {
+	if !lastProcessed.IsZero() {
+		return lastProcessed
+	}
+	return time.Now().Add(-InitialLookback)
+}
+
+type environment int
+
+const (
+	envOther environment = iota
+	envProduction
+	envDevelopment
+	envBeta
+	envRelease
+)
+
+// environmentFromName classifies the environment using common naming conventions, since neither GitHub nor Azure have a fixed set of environments
+func environmentFromName(name string) environment {
+	name = strings.ToLower(name)
+	has := func(parts ...string) bool {
+		for _, p := range parts {
+			if strings.Contains(name, p) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	// check before production, so that preprod is not matched as production
+	case has("stag", "beta", "qa", "test", "uat", "preprod", "pre-prod"):
+		return envBeta
+	case has("prod", "live"):
+		return envProduction
+	case has("dev"):
+		return envDevelopment
+	case has("release"):
+		return envRelease
+	}
+	return envOther
+}
+
+// BuildEnvironment returns the build environment for environment or branch name
+func BuildEnvironment(name string) cicd.BuildEnvironment {
+	switch environmentFromName(name) {
+	case envProduction:
+		return cicd.BuildEnvironmentProduction
+	case envBeta:
+		return cicd.BuildEnvironmentBeta
+	case envDevelopment:
+		return cicd.BuildEnvironmentDevelopment
+	case envRelease:
+		return cicd.BuildEnvironmentRelease
+	}
+	return cicd.BuildEnvironmentOther
+}
+
+// DeploymentEnvironment returns the deployment environment for environment name
+func DeploymentEnvironment(name string) cicd.DeploymentEnvironment {
+	switch environmentFromName(name) {
+	case envProduction:
+		return cicd.DeploymentEnvironmentProduction
+	case envBeta:
+		return cicd.DeploymentEnvironmentBeta
+	case envDevelopment:
+		return cicd.DeploymentEnvironmentDevelopment
+	case envRelease:
+		return cicd.DeploymentEnvironmentRelease
+	}
+	return cicd.DeploymentEnvironmentOther
+}
@@ -0,0 +1,34 @@
+package commoncicd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pinpt/integration-sdk/cicd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeploymentEnvironment(t *testing.T) {
+	cases := map[string]cicd.DeploymentEnvironment{
+		"production":   cicd.DeploymentEnvironmentProduction,
+		"Prod-EU":      cicd.DeploymentEnvironmentProduction,
+		"preprod":      cicd.DeploymentEnvironmentBeta,
+		"staging":      cicd.DeploymentEnvironmentBeta,
+		"qa":           cicd.DeploymentEnvironmentBeta,
+		"dev":          cicd.DeploymentEnvironmentDevelopment,
+		"release/1.2":  cicd.DeploymentEnvironmentRelease,
+		"review/fix-1": cicd.DeploymentEnvironmentOther,
+		"":             cicd.DeploymentEnvironmentOther,
+	}
+	for name, want := range cases {
+		assert.Equal(t, want, DeploymentEnvironment(name), name)
+	}
+}
+
+func TestStartTime(t *testing.T) {
+	assert := assert.New(t)
+	lp := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	assert.Equal(lp, StartTime(lp))
+	st := StartTime(time.Time{})
+	assert.WithinDuration(time.Now().Add(-InitialLookback), st, time.Minute)
+}
@@ -1,10 +1,13 @@
 package ibase
 
 import (
+	"context"
 	"os"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-plugin"
+	"github.com/pinpt/agent/pkg/metrics"
 	"github.com/pinpt/agent/rpcdef"
 )
 
@@ -16,6 +19,13 @@ func MainFunc(construct func(logger hclog.Logger) rpcdef.Integration) {
 		JSONFormat: true,
 	})
 	impl := construct(logger)
+
+	// set by the agent, see iloader
+	if dir := os.Getenv(metrics.DirEnv); dir != "" {
+		metrics.StartWriter(context.Background(), logger, dir, 10*time.Second)
+		impl = metricsWriter{Integration: impl, logger: logger, dir: dir}
+	}
+
 	var pluginMap = map[string]plugin.Plugin{
 		"integration": &rpcdef.IntegrationPlugin{Impl: impl},
 	}
@@ -25,3 +35,18 @@ func MainFunc(construct func(logger hclog.Logger) rpcdef.Integration) {
 		GRPCServer:      plugin.DefaultGRPCServer,
 	})
 }
+
+// metricsWriter writes metrics after export, since the plugin is killed right after it returns
+type metricsWriter struct {
+	rpcdef.Integration
+	logger hclog.Logger
+	dir    string
+}
+
+func (s metricsWriter) Export(ctx context.Context, config rpcdef.ExportConfig) (rpcdef.ExportResult, error) {
+	res, err := s.Integration.Export(ctx, config)
+	if err := metrics.WriteFile(s.dir); err != nil {
+		s.logger.Warn("could not write metrics", "err", err)
+	}
+	return res, err
+}
@@ -26,13 +26,41 @@ type AllowedValue struct {
 	Name string `json:"name"`
 }
 
+// Pull request actions which are not yet defined in agent.IntegrationMutationRequestAction
+const (
+	ActionPrAddReviewers    = "PR_ADD_REVIEWERS"
+	ActionPrAddLabels       = "PR_ADD_LABELS"
+	ActionPrRemoveLabels    = "PR_REMOVE_LABELS"
+	ActionPrAddAssignees    = "PR_ADD_ASSIGNEES"
+	ActionPrRemoveAssignees = "PR_REMOVE_ASSIGNEES"
+	ActionPrAddComment      = "PR_ADD_COMMENT"
+	ActionPrMerge           = "PR_MERGE"
+	ActionPrClose           = "PR_CLOSE"
+	ActionPrReopen          = "PR_REOPEN"
+	ActionPrSetDraft        = "PR_SET_DRAFT"
+	ActionPrSetReady        = "PR_SET_READY"
+)
+
 const ErrNotFound = "not_found"
 
+// NotFoundError is used when api does not return 404 status code for missing objects, for example github graphql api
+type NotFoundError struct {
+	Message string
+}
+
+func (s NotFoundError) Error() string {
+	return "not found: " + s.Message
+}
+
 func ResultFromError(err error) (res rpcdef.MutateResult) {
 	var e requests.StatusCodeError
 	if errors.As(err, &e) && e.Got == http.StatusNotFound {
 		res.ErrorCode = ErrNotFound
 	}
+	var e2 NotFoundError
+	if errors.As(err, &e2) {
+		res.ErrorCode = ErrNotFound
+	}
 	res.Error = err.Error()
 	return res
 }
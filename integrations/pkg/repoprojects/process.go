@@ -95,6 +95,34 @@ func (s *Process) Run() (allRes []rpcdef.ExportProject, rerr error) {
 				logger := s.opts.Logger.With("project_name", p.GetReadableID(), "project_ref_id", p.GetID())
 				ctx := newProjectCtx(logger, p, s.opts.Sender)
 
+				p2 := rpcdef.ExportProject{}
+				p2.ID = s.projectID(p)
+				p2.RefID = p.GetID()
+				p2.ReadableID = p.GetReadableID()
+
+				checkpoint, err := s.opts.Sender.SessionTracking(rpcdef.CheckpointSessionName, p.GetID(), p.GetReadableID())
+				if err != nil {
+					rerr(err)
+					return
+				}
+				if checkpoint.LastProcessed() != "" {
+					logger.Info("skipping repo/project, it was completed before export was interrupted")
+					err := checkpoint.Rollback()
+					if err != nil {
+						rerr(err)
+						return
+					}
+					err = s.opts.Sender.IncProgress()
+					if err != nil {
+						rerr(err)
+						return
+					}
+					mu.Lock()
+					allRes = append(allRes, p2)
+					mu.Unlock()
+					continue
+				}
+
 				logger.Info("starting processing repo/project")
 				var lastProcess string
 				var projectErr error
@@ -105,16 +133,12 @@ func (s *Process) Run() (allRes []rpcdef.ExportProject, rerr error) {
 				}
 				logger.Info("completed processing repo/project", "err", projectErr)
 
-				err := s.opts.Sender.IncProgress()
+				err = s.opts.Sender.IncProgress()
 				if err != nil {
 					rerr(err)
 					return
 				}
 
-				p2 := rpcdef.ExportProject{}
-				p2.ID = s.projectID(p)
-				p2.RefID = p.GetID()
-				p2.ReadableID = p.GetReadableID()
 				if projectErr != nil {
 					p2.Error = projectErr.Error()
 				}
@@ -132,6 +156,11 @@ func (s *Process) Run() (allRes []rpcdef.ExportProject, rerr error) {
 						rerr(err)
 						return
 					}
+					err = checkpoint.Rollback()
+					if err != nil {
+						rerr(err)
+						return
+					}
 					return
 				}
 				if lastProcess != "" {
@@ -143,6 +172,12 @@ func (s *Process) Run() (allRes []rpcdef.ExportProject, rerr error) {
 					rerr(err)
 					return
 				}
+				// marks the project as completed, so it is skipped if export of the same job is restarted. Git repos queued by the project are kept in the agent checkpoint until processed.
+				err = checkpoint.Done()
+				if err != nil {
+					rerr(err)
+					return
+				}
 			}
 		}()
 	}
@@ -206,6 +241,33 @@ func (s *ProjectCtx) Session(modelName datamodel.ModelNameType) (_ *objsender.Se
 	return sender, nil
 }
 
+// Rollback rolls back sessions of passed models, so that last processed is not updated for optional data that failed to export. Other sessions of the project are completed as usual.
+func (s *ProjectCtx) Rollback(modelNames ...datamodel.ModelNameType) error {
+	s.sendersMu.Lock()
+	defer s.sendersMu.Unlock()
+
+	rollback := map[string]bool{}
+	for _, m := range modelNames {
+		rollback[m.String()] = true
+	}
+	var senders []*objsender.Session
+	var senderModel []string
+	for i, sender := range s.senders {
+		if !rollback[s.senderModel[i]] {
+			senders = append(senders, sender)
+			senderModel = append(senderModel, s.senderModel[i])
+			continue
+		}
+		err := sender.Rollback()
+		if err != nil {
+			return fmt.Errorf("failed Rollback on sender model=%v %v", s.senderModel[i], err)
+		}
+	}
+	s.senders = senders
+	s.senderModel = senderModel
+	return nil
+}
+
 func (s *ProjectCtx) done() error {
 	for i, sender := range s.senders {
 		err := sender.Done()
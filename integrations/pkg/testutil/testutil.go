@@ -0,0 +1,66 @@
+// Package testutil contains helpers for testing integrations against mock apis.
+package testutil
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/pinpt/agent/rpcdef"
+)
+
+// Agent records git repo fetches requested by the integration. Other agent calls are not implemented.
+type Agent struct {
+	rpcdef.Agent
+	Fetches []rpcdef.GitRepoFetch
+}
+
+func (s *Agent) ExportGitRepo(fetch rpcdef.GitRepoFetch) error {
+	s.Fetches = append(s.Fetches, fetch)
+	return nil
+}
+
+// ServerOpts are options for NewServer
+type ServerOpts struct {
+	// Responses are response bodies by request path
+	Responses map[string]string
+	// Check is called for every request, for example to check auth headers
+	Check func(req *http.Request)
+	// Handle is called before looking up Responses, returns true if the request was handled
+	Handle func(rw http.ResponseWriter, req *http.Request) bool
+	// NotFound is the response body for paths missing in Responses. If empty, these requests fail the test.
+	NotFound string
+}
+
+// NewServer starts the mock api server returning Responses by request path. Call Close when done.
+func NewServer(t *testing.T, opts ServerOpts) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if opts.Check != nil {
+			opts.Check(req)
+		}
+		if opts.Handle != nil && opts.Handle(rw, req) {
+			return
+		}
+		res, ok := opts.Responses[req.URL.Path]
+		if !ok {
+			if opts.NotFound == "" {
+				t.Errorf("unexpected request %v", req.URL.Path)
+			}
+			rw.WriteHeader(http.StatusNotFound)
+			rw.Write([]byte(opts.NotFound))
+			return
+		}
+		rw.Write([]byte(res))
+	}))
+}
+
+// Payload returns the content of the file in testdata dir
+func Payload(t *testing.T, name string) string {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
@@ -0,0 +1,322 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pinpt/go-common/hash"
+	"github.com/pinpt/integration-sdk/codequality"
+)
+
+// AnalysisModelName is the model for analyses of main branch, branches and pull requests. Depends on codequality.Analysis being added to integration-sdk.
+const AnalysisModelName = "codequality.Analysis"
+
+// Analysis is an analysis of the main branch from project history, or the last analysis of a branch or pull request
+type Analysis struct {
+	CustomerID string
+	// RefID is the analysis key for main branch history, for branches and pull requests it is a hash of project, branch or pull request and analysis date
+	RefID     string
+	ProjectID string
+	Date      time.Time
+	// Revision is the analyzed commit sha
+	Revision       string
+	ProjectVersion string
+
+	// Branch is set for analyses of branches other than main
+	Branch string
+	// PullRequestKey is set for pull request analyses. It is the pull request number in the code host, the same as the number in sourcecode.PullRequest identifier (org/repo#123).
+	PullRequestKey    string
+	PullRequestTitle  string
+	PullRequestBranch string
+	PullRequestBase   string
+	URL               string
+
+	// QualityGateStatus is one of OK, WARN, ERROR or NONE if no quality gate is associated
+	QualityGateStatus     string
+	QualityGateConditions []QualityGateCondition
+
+	// Bugs, Vulnerabilities and CodeSmells are set for branches and pull requests
+	Bugs            *int
+	Vulnerabilities *int
+	CodeSmells      *int
+}
+
+// QualityGateCondition is the result of a quality gate condition for the analysis
+type QualityGateCondition struct {
+	Metric         string
+	Comparator     string
+	ErrorThreshold string
+	ActualValue    string
+	Status         string
+}
+
+func (s Analysis) ToMap() map[string]interface{} {
+	res := map[string]interface{}{}
+	res["customer_id"] = s.CustomerID
+	res["ref_id"] = s.RefID
+	res["ref_type"] = "sonarqube"
+	res["project_id"] = s.ProjectID
+	res["date"] = dateMap(s.Date)
+	res["revision"] = s.Revision
+	res["project_version"] = s.ProjectVersion
+	res["branch"] = s.Branch
+	res["pull_request_key"] = s.PullRequestKey
+	res["pull_request_title"] = s.PullRequestTitle
+	res["pull_request_branch"] = s.PullRequestBranch
+	res["pull_request_base"] = s.PullRequestBase
+	res["url"] = s.URL
+	res["quality_gate_status"] = s.QualityGateStatus
+	conditions := []map[string]interface{}{}
+	for _, c := range s.QualityGateConditions {
+		conditions = append(conditions, map[string]interface{}{
+			"metric":          c.Metric,
+			"comparator":      c.Comparator,
+			"error_threshold": c.ErrorThreshold,
+			"actual_value":    c.ActualValue,
+			"status":          c.Status,
+		})
+	}
+	res["quality_gate_conditions"] = conditions
+	res["bugs"] = s.Bugs
+	res["vulnerabilities"] = s.Vulnerabilities
+	res["code_smells"] = s.CodeSmells
+	return res
+}
+
+// FetchAnalyses returns main branch analyses after since and the last analyses of other branches and pull requests if analysed after since. Branches and pull requests are skipped if not supported by sonarqube edition.
+func (a *SonarqubeAPI) FetchAnalyses(project *codequality.Project, since time.Time) (res []*Analysis, rerr error) {
+	project.ToMap() // need to call setDefaults so that ID is set
+
+	res, err := a.fetchMainAnalyses(project, since)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	branches, err := a.fetchBranchAnalyses(project, since)
+	if err != nil {
+		if !isBranchesNotSupported(err) {
+			rerr = err
+			return
+		}
+		a.logger.Debug("branch analysis not supported, skipping", "project", project.Identifier, "err", err)
+	}
+	res = append(res, branches...)
+
+	prs, err := a.fetchPullRequestAnalyses(project, since)
+	if err != nil {
+		if !isBranchesNotSupported(err) {
+			rerr = err
+			return
+		}
+		a.logger.Debug("pull request analysis not supported, skipping", "project", project.Identifier, "err", err)
+	}
+	res = append(res, prs...)
+	return
+}
+
+// isBranchesNotSupported returns true for errors returned by branch and pull request apis in community edition
+func isBranchesNotSupported(err error) bool {
+	return isStatusCode(err, http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)
+}
+
+func (a *SonarqubeAPI) fetchMainAnalyses(project *codequality.Project, since time.Time) (res []*Analysis, rerr error) {
+	_, rerr = paginate(0, func(params url.Values) (paging, error) {
+		params.Set("project", project.Identifier)
+		if !since.IsZero() {
+			params.Set("from", formatDate(since))
+		}
+		var val struct {
+			Paging   paging `json:"paging"`
+			Analyses []struct {
+				Key            string `json:"key"`
+				Date           string `json:"date"`
+				ProjectVersion string `json:"projectVersion"`
+				Revision       string `json:"revision"`
+			} `json:"analyses"`
+		}
+		err := a.get("/project_analyses/search", params, &val)
+		if err != nil {
+			return paging{}, err
+		}
+		for _, data := range val.Analyses {
+			item := &Analysis{}
+			item.RefID = data.Key
+			item.ProjectID = project.ID
+			item.ProjectVersion = data.ProjectVersion
+			item.Revision = data.Revision
+			item.URL = a.ProjectURL(project.Identifier)
+			item.Date, err = parseDate(data.Date)
+			if err != nil {
+				return paging{}, err
+			}
+			qp := url.Values{}
+			qp.Set("analysisId", data.Key)
+			err = a.setQualityGateStatus(item, qp)
+			if err != nil {
+				return paging{}, err
+			}
+			res = append(res, item)
+		}
+		return val.Paging, nil
+	})
+	return
+}
+
+type branchStatus struct {
+	QualityGateStatus string `json:"qualityGateStatus"`
+	Bugs              *int   `json:"bugs"`
+	Vulnerabilities   *int   `json:"vulnerabilities"`
+	CodeSmells        *int   `json:"codeSmells"`
+}
+
+func (s branchStatus) set(item *Analysis) {
+	item.QualityGateStatus = s.QualityGateStatus
+	item.Bugs = s.Bugs
+	item.Vulnerabilities = s.Vulnerabilities
+	item.CodeSmells = s.CodeSmells
+}
+
+type branchCommit struct {
+	SHA string `json:"sha"`
+}
+
+func (a *SonarqubeAPI) fetchBranchAnalyses(project *codequality.Project, since time.Time) (res []*Analysis, _ error) {
+	params := url.Values{}
+	params.Set("project", project.Identifier)
+	var val struct {
+		Branches []struct {
+			Name         string       `json:"name"`
+			IsMain       bool         `json:"isMain"`
+			Status       branchStatus `json:"status"`
+			AnalysisDate string       `json:"analysisDate"`
+			Commit       branchCommit `json:"commit"`
+		} `json:"branches"`
+	}
+	err := a.get("/project_branches/list", params, &val)
+	if err != nil {
+		return nil, err
+	}
+	for _, data := range val.Branches {
+		// main branch is exported from project history
+		if data.IsMain || data.AnalysisDate == "" {
+			continue
+		}
+		date, err := parseDate(data.AnalysisDate)
+		if err != nil {
+			return nil, err
+		}
+		if !since.IsZero() && date.Before(since) {
+			continue
+		}
+		item := &Analysis{}
+		item.RefID = hash.Values(project.ID, "branch", data.Name, data.AnalysisDate)
+		item.ProjectID = project.ID
+		item.Date = date
+		item.Revision = data.Commit.SHA
+		item.Branch = data.Name
+		item.URL = a.ProjectURL(project.Identifier) + "&branch=" + url.QueryEscape(data.Name)
+		data.Status.set(item)
+		qp := url.Values{}
+		qp.Set("projectKey", project.Identifier)
+		qp.Set("branch", data.Name)
+		err = a.setQualityGateStatus(item, qp)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, item)
+	}
+	return res, nil
+}
+
+func (a *SonarqubeAPI) fetchPullRequestAnalyses(project *codequality.Project, since time.Time) (res []*Analysis, _ error) {
+	params := url.Values{}
+	params.Set("project", project.Identifier)
+	var val struct {
+		PullRequests []struct {
+			Key          string       `json:"key"`
+			Title        string       `json:"title"`
+			Branch       string       `json:"branch"`
+			Base         string       `json:"base"`
+			Status       branchStatus `json:"status"`
+			AnalysisDate string       `json:"analysisDate"`
+			URL          string       `json:"url"`
+			Commit       branchCommit `json:"commit"`
+		} `json:"pullRequests"`
+	}
+	err := a.get("/project_pull_requests/list", params, &val)
+	if err != nil {
+		return nil, err
+	}
+	for _, data := range val.PullRequests {
+		if data.AnalysisDate == "" {
+			continue
+		}
+		date, err := parseDate(data.AnalysisDate)
+		if err != nil {
+			return nil, err
+		}
+		if !since.IsZero() && date.Before(since) {
+			continue
+		}
+		item := &Analysis{}
+		item.RefID = hash.Values(project.ID, "pull_request", data.Key, data.AnalysisDate)
+		item.ProjectID = project.ID
+		item.Date = date
+		item.Revision = data.Commit.SHA
+		item.PullRequestKey = data.Key
+		item.PullRequestTitle = data.Title
+		item.PullRequestBranch = data.Branch
+		item.PullRequestBase = data.Base
+		item.URL = a.ProjectURL(project.Identifier) + "&pullRequest=" + url.QueryEscape(data.Key)
+		data.Status.set(item)
+		qp := url.Values{}
+		qp.Set("projectKey", project.Identifier)
+		qp.Set("pullRequest", data.Key)
+		err = a.setQualityGateStatus(item, qp)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, item)
+	}
+	return res, nil
+}
+
+// setQualityGateStatus sets quality gate status and conditions for analysis, branch or pull request selected by params
+func (a *SonarqubeAPI) setQualityGateStatus(item *Analysis, params url.Values) error {
+	var val struct {
+		ProjectStatus struct {
+			Status     string `json:"status"`
+			Conditions []struct {
+				Status         string `json:"status"`
+				MetricKey      string `json:"metricKey"`
+				Comparator     string `json:"comparator"`
+				ErrorThreshold string `json:"errorThreshold"`
+				ActualValue    string `json:"actualValue"`
+			} `json:"conditions"`
+		} `json:"projectStatus"`
+	}
+	err := a.get("/qualitygates/project_status", params, &val)
+	if err != nil {
+		if isStatusCode(err, http.StatusNotFound) {
+			// analysis was removed by housekeeping
+			if item.QualityGateStatus == "" {
+				item.QualityGateStatus = "NONE"
+			}
+			return nil
+		}
+		return err
+	}
+	item.QualityGateStatus = val.ProjectStatus.Status
+	for _, c := range val.ProjectStatus.Conditions {
+		item.QualityGateConditions = append(item.QualityGateConditions, QualityGateCondition{
+			Metric:         c.MetricKey,
+			Comparator:     c.Comparator,
+			ErrorThreshold: c.ErrorThreshold,
+			ActualValue:    c.ActualValue,
+			Status:         c.Status,
+		})
+	}
+	return nil
+}
@@ -5,14 +5,19 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
 	hclog "github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/pkg/requests"
+	"github.com/pinpt/go-common/datetime"
 	"github.com/pinpt/go-common/httpdefaults"
 	pstring "github.com/pinpt/go-common/strings"
 	"github.com/pinpt/httpclient"
@@ -26,9 +31,12 @@ type SonarqubeAPI struct {
 	client    *httpclient.HTTPClient
 	logger    hclog.Logger
 	context   context.Context
+
+	// httpClient is used for paginated requests, which are done explicitly instead of using httpclient paginator
+	httpClient *http.Client
 }
 
-func newClient(ctx context.Context, url string, retryable bool) *httpclient.HTTPClient {
+func newTransport(url string) *http.Transport {
 	transport := httpdefaults.DefaultTransport()
 	if !strings.Contains(url, "sonarcloud.io") {
 		// if a self-service installation allow self-signed certificates
@@ -36,6 +44,11 @@ func newClient(ctx context.Context, url string, retryable bool) *httpclient.HTTP
 		transport.TLSClientConfig = &tls.Config{}
 		transport.TLSClientConfig.InsecureSkipVerify = true
 	}
+	return transport
+}
+
+func newClient(ctx context.Context, url string, retryable bool) *httpclient.HTTPClient {
+	transport := newTransport(url)
 	hcConfig := &httpclient.Config{
 		Paginator: httpclient.InBodyPaginator(),
 	}
@@ -58,10 +71,103 @@ func NewSonarqubeAPI(ctx context.Context, logger hclog.Logger, url string, authT
 		logger:    logger,
 		context:   ctx,
 		client:    newClient(ctx, url, true),
+		httpClient: &http.Client{
+			Transport: newTransport(url),
+			Timeout:   1 * time.Minute,
+		},
 	}
 	return a
 }
 
+// dateFormat is the format of dates in api responses and params
+const dateFormat = "2006-01-02T15:04:05-0700"
+
+func parseDate(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(dateFormat, v)
+}
+
+func formatDate(ts time.Time) string {
+	return ts.Format(dateFormat)
+}
+
+func dateMap(ts time.Time) map[string]interface{} {
+	res := map[string]interface{}{}
+	if ts.IsZero() {
+		return res
+	}
+	d, _ := datetime.NewDateWithTime(ts)
+	res["epoch"] = d.Epoch
+	res["offset"] = d.Offset
+	res["rfc3339"] = d.Rfc3339
+	return res
+}
+
+// webURL returns the url of webapp from api url
+func (a *SonarqubeAPI) webURL() string {
+	return strings.TrimSuffix(strings.TrimSuffix(a.url, "/"), "/api")
+}
+
+// get makes a GET request and unmarshals the json response. Returns requests.StatusCodeError for non 2xx responses.
+func (a *SonarqubeAPI) get(endPoint string, params url.Values, res interface{}) error {
+	req := requests.NewRequest()
+	req.URL = pstring.JoinURL(a.url, endPoint)
+	if params != nil {
+		req.Query = params
+	}
+	req.BasicAuthUser = a.authToken
+	reqs := requests.New(a.logger, a.httpClient)
+	_, err := reqs.JSON(req, res)
+	return err
+}
+
+// isStatusCode returns true if err is returned for a response with one of the codes
+func isStatusCode(err error, codes ...int) bool {
+	var statusErr requests.StatusCodeError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	for _, code := range codes {
+		if statusErr.Got == code {
+			return true
+		}
+	}
+	return false
+}
+
+type paging struct {
+	PageIndex int `json:"pageIndex"`
+	PageSize  int `json:"pageSize"`
+	Total     int `json:"total"`
+}
+
+// maxPageSize is the maximum page size of search endpoints
+const maxPageSize = 500
+
+// maxSearchResults is the maximum number of results returned for a search query across all pages, issues/search returns error when requesting past it
+const maxSearchResults = 10000
+
+// paginate calls fn with p and ps params for every page until all results are fetched. Stops after maxResults if not 0 and returns truncated = true if there were more results.
+func paginate(maxResults int, fn func(params url.Values) (paging, error)) (truncated bool, _ error) {
+	for page := 1; ; page++ {
+		params := url.Values{}
+		params.Set("p", strconv.Itoa(page))
+		params.Set("ps", strconv.Itoa(maxPageSize))
+		pi, err := fn(params)
+		if err != nil {
+			return false, err
+		}
+		if pi.PageSize == 0 || pi.PageIndex*pi.PageSize >= pi.Total {
+			return false, nil
+		}
+		if maxResults != 0 && pi.PageIndex*pi.PageSize >= maxResults {
+			return true, nil
+		}
+	}
+}
+
 // Validate ...
 func (a *SonarqubeAPI) Validate() (bool, error) {
 
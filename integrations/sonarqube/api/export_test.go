@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/pinpt/integration-sdk/codequality"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchMetricsPaginated(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("/api/measures/search_history", r.URL.Path)
+		p, _ := strconv.Atoi(r.URL.Query().Get("p"))
+		fmt.Fprintf(w, `{"paging":{"pageIndex":%v,"pageSize":500,"total":501},"measures":[{"metric":"coverage","history":[{"date":"2020-05-0%vT10:00:00+0000","value":"%v"}]}]}`, p, p, p)
+	}))
+	defer server.Close()
+
+	sonarapi := NewSonarqubeAPI(context.Background(), hclog.New(&hclog.LoggerOptions{Name: "test"}), server.URL+"/api", "token", []string{"coverage"})
+	metrics, err := sonarapi.FetchMetrics(&codequality.Project{Identifier: "p1", RefID: "1"}, time.Time{})
+	assert.NoError(err)
+	assert.Equal(2, len(metrics))
+	assert.Equal("2", metrics[1].Value)
+}
+
+func TestFetchIssuesHotspotsFallback(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/api/hotspots/search":
+			// before 8.2
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[{"msg":"Unknown url"}]}`))
+		case "/api/issues/search":
+			assert.Equal("p1", q.Get("componentKeys"))
+			if q.Get("types") != "BUG" && q.Get("types") != IssueTypeSecurityHotspot {
+				w.Write([]byte(`{"paging":{"pageIndex":1,"pageSize":500,"total":0},"issues":[]}`))
+				return
+			}
+			// incremental export sorts by update date descending
+			assert.Equal("UPDATE_DATE", q.Get("s"))
+			assert.Equal("false", q.Get("asc"))
+			w.Write([]byte(`{"paging":{"pageIndex":1,"pageSize":500,"total":2},"issues":[
+				{"key":"` + q.Get("types") + `-2","type":"` + q.Get("types") + `","severity":"MINOR","status":"RESOLVED","creationDate":"2020-05-01T10:00:00+0000","updateDate":"2020-05-03T10:00:00+0000"},
+				{"key":"` + q.Get("types") + `-1","type":"` + q.Get("types") + `","severity":"MAJOR","status":"OPEN","creationDate":"2020-05-01T10:00:00+0000","updateDate":"2020-05-01T10:00:00+0000"}
+			]}`))
+		case "/api/issues/changelog":
+			w.Write([]byte(`{"changelog":[{"user":"u1","creationDate":"2020-05-03T10:00:00+0000","diffs":[{"key":"status","oldValue":"OPEN","newValue":"RESOLVED"}]}]}`))
+		default:
+			t.Errorf("unexpected request %v", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	sonarapi := NewSonarqubeAPI(context.Background(), hclog.New(&hclog.LoggerOptions{Name: "test"}), server.URL+"/api", "token", []string{"coverage"})
+	since := time.Date(2020, 5, 2, 0, 0, 0, 0, time.UTC)
+	issues, err := sonarapi.FetchIssues(&codequality.Project{Identifier: "p1", RefID: "1"}, since)
+	assert.NoError(err)
+	// only issues updated after since
+	assert.Equal(2, len(issues))
+	for _, issue := range issues {
+		assert.Equal("RESOLVED", issue.Status)
+		assert.Equal(1, len(issue.Changes))
+		ch := issue.Changes[0]
+		assert.True(ch.CreatedDate.Equal(since.Add(34 * time.Hour)))
+		assert.Equal("status", ch.Field)
+		assert.Equal("OPEN", ch.From)
+		assert.Equal("RESOLVED", ch.To)
+	}
+	assert.Equal(IssueTypeSecurityHotspot, issues[1].Type)
+}
+
+func TestFetchIssuesUpdatedStopsAtSince(t *testing.T) {
+	assert := assert.New(t)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/api/hotspots/search":
+			w.Write([]byte(`{"paging":{"pageIndex":1,"pageSize":500,"total":0},"hotspots":[]}`))
+		case "/api/issues/search":
+			if q.Get("types") != "BUG" {
+				w.Write([]byte(`{"paging":{"pageIndex":1,"pageSize":500,"total":0},"issues":[]}`))
+				return
+			}
+			requests++
+			assert.Equal("1", q.Get("p"))
+			// more pages are available, but the first one already contains issues updated before since
+			w.Write([]byte(`{"paging":{"pageIndex":1,"pageSize":500,"total":5000},"issues":[
+				{"key":"i2","type":"BUG","creationDate":"2020-05-03T10:00:00+0000","updateDate":"2020-05-03T10:00:00+0000"},
+				{"key":"i1","type":"BUG","creationDate":"2020-05-01T10:00:00+0000","updateDate":"2020-05-01T10:00:00+0000"}
+			]}`))
+		default:
+			t.Errorf("unexpected request %v", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	sonarapi := NewSonarqubeAPI(context.Background(), hclog.New(&hclog.LoggerOptions{Name: "test"}), server.URL+"/api", "token", []string{"coverage"})
+	issues, err := sonarapi.FetchIssues(&codequality.Project{Identifier: "p1", RefID: "1"}, time.Date(2020, 5, 2, 0, 0, 0, 0, time.UTC))
+	assert.NoError(err)
+	assert.Equal(1, requests)
+	if assert.Equal(1, len(issues)) {
+		assert.Equal("i2", issues[0].RefID)
+	}
+}
+
+func TestFetchAnalysesWithoutBranchSupport(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/api/project_analyses/search":
+			w.Write([]byte(`{"paging":{"pageIndex":1,"pageSize":500,"total":1},"analyses":[{"key":"a1","date":"2020-05-01T10:00:00+0000","revision":"sha1"}]}`))
+		case "/api/qualitygates/project_status":
+			assert.Equal("a1", q.Get("analysisId"))
+			w.Write([]byte(`{"projectStatus":{"status":"ERROR","conditions":[{"status":"ERROR","metricKey":"new_coverage","comparator":"LT","errorThreshold":"80","actualValue":"50"}]}}`))
+		case "/api/project_branches/list", "/api/project_pull_requests/list":
+			// community edition
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors":[{"msg":"not supported"}]}`))
+		default:
+			t.Errorf("unexpected request %v", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	sonarapi := NewSonarqubeAPI(context.Background(), hclog.New(&hclog.LoggerOptions{Name: "test"}), server.URL+"/api", "token", []string{"coverage"})
+	analyses, err := sonarapi.FetchAnalyses(&codequality.Project{Identifier: "p1", RefID: "1"}, time.Time{})
+	assert.NoError(err)
+	assert.Equal(1, len(analyses))
+	a := analyses[0]
+	assert.Equal("a1", a.RefID)
+	assert.Equal("sha1", a.Revision)
+	assert.Equal("ERROR", a.QualityGateStatus)
+	assert.Equal([]QualityGateCondition{{Metric: "new_coverage", Comparator: "LT", ErrorThreshold: "80", ActualValue: "50", Status: "ERROR"}}, a.QualityGateConditions)
+}
@@ -0,0 +1,385 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pinpt/integration-sdk/codequality"
+)
+
+// IssueModelName is the model for issues and security hotspots. Requires codequality.Issue in integration-sdk, Issue.ToMap matches its fields until the sdk model is released.
+const IssueModelName = "codequality.Issue"
+
+// IssueTypeSecurityHotspot is the type of security hotspots, which are returned by a separate api since sonarqube 8.2
+const IssueTypeSecurityHotspot = "SECURITY_HOTSPOT"
+
+// Issue is a bug, vulnerability, code smell or security hotspot
+type Issue struct {
+	CustomerID string
+	// RefID is the issue key
+	RefID     string
+	ProjectID string
+	// Type is one of BUG, VULNERABILITY, CODE_SMELL, SECURITY_HOTSPOT
+	Type string
+	// Severity is one of BLOCKER, CRITICAL, MAJOR, MINOR, INFO. For security hotspots it is vulnerability probability HIGH, MEDIUM or LOW.
+	Severity   string
+	Status     string
+	Resolution string
+	Rule       string
+	Message    string
+	Component  string
+	Line       int
+	Author     string
+	Tags       []string
+	Effort     string
+	URL        string
+
+	CreatedDate time.Time
+	UpdatedDate time.Time
+	ClosedDate  time.Time
+
+	// Changes contains status, severity, type and other field changes. Only fetched for issues updated after creation.
+	Changes []IssueChange
+
+	// hotspot is true when returned by hotspots api, changelog is available from a different endpoint
+	hotspot bool
+}
+
+// IssueChange is a change of one field of the issue
+type IssueChange struct {
+	CreatedDate time.Time
+	User        string
+	Field       string
+	From        string
+	To          string
+}
+
+func (s Issue) ToMap() map[string]interface{} {
+	res := map[string]interface{}{}
+	res["customer_id"] = s.CustomerID
+	res["ref_id"] = s.RefID
+	res["ref_type"] = "sonarqube"
+	res["project_id"] = s.ProjectID
+	res["type"] = s.Type
+	res["severity"] = s.Severity
+	res["status"] = s.Status
+	res["resolution"] = s.Resolution
+	res["rule"] = s.Rule
+	res["message"] = s.Message
+	res["component"] = s.Component
+	res["line"] = s.Line
+	res["author"] = s.Author
+	res["tags"] = s.Tags
+	res["effort"] = s.Effort
+	res["url"] = s.URL
+	res["created_date"] = dateMap(s.CreatedDate)
+	res["updated_date"] = dateMap(s.UpdatedDate)
+	res["closed_date"] = dateMap(s.ClosedDate)
+	changes := []map[string]interface{}{}
+	for _, ch := range s.Changes {
+		changes = append(changes, map[string]interface{}{
+			"created_date": dateMap(ch.CreatedDate),
+			"user":         ch.User,
+			"field":        ch.Field,
+			"from":         ch.From,
+			"to":           ch.To,
+		})
+	}
+	res["changes"] = changes
+	return res
+}
+
+type issueResponse struct {
+	Key          string   `json:"key"`
+	Rule         string   `json:"rule"`
+	Severity     string   `json:"severity"`
+	Component    string   `json:"component"`
+	Line         int      `json:"line"`
+	Status       string   `json:"status"`
+	Resolution   string   `json:"resolution"`
+	Message      string   `json:"message"`
+	Effort       string   `json:"effort"`
+	Author       string   `json:"author"`
+	Tags         []string `json:"tags"`
+	Type         string   `json:"type"`
+	CreationDate string   `json:"creationDate"`
+	UpdateDate   string   `json:"updateDate"`
+	CloseDate    string   `json:"closeDate"`
+}
+
+type hotspotResponse struct {
+	Key                      string `json:"key"`
+	Component                string `json:"component"`
+	RuleKey                  string `json:"ruleKey"`
+	VulnerabilityProbability string `json:"vulnerabilityProbability"`
+	Status                   string `json:"status"`
+	Resolution               string `json:"resolution"`
+	Line                     int    `json:"line"`
+	Message                  string `json:"message"`
+	Author                   string `json:"author"`
+	CreationDate             string `json:"creationDate"`
+	UpdateDate               string `json:"updateDate"`
+}
+
+// issueTypes are types fetched from issues/search, hotspots are fetched separately
+var issueTypes = []string{"BUG", "VULNERABILITY", "CODE_SMELL"}
+
+// FetchIssues returns issues and security hotspots of the project updated after since, all of them if since is zero. Changes are fetched for returned issues updated after creation.
+func (a *SonarqubeAPI) FetchIssues(project *codequality.Project, since time.Time) (res []*Issue, rerr error) {
+	project.ToMap() // need to call setDefaults so that ID is set
+
+	types := issueTypes
+	all, err := a.fetchHotspots(project)
+	if err != nil {
+		if !isStatusCode(err, http.StatusNotFound) {
+			rerr = err
+			return
+		}
+		// before sonarqube 8.2 hotspots are returned as issues
+		types = append(types, IssueTypeSecurityHotspot)
+	}
+	for _, issueType := range types {
+		var sub []*Issue
+		if since.IsZero() {
+			sub, err = a.fetchIssuesOfType(project, issueType)
+		} else {
+			sub, err = a.fetchIssuesOfTypeUpdated(project, issueType, since)
+		}
+		if err != nil {
+			rerr = err
+			return
+		}
+		all = append(all, sub...)
+	}
+
+	for _, issue := range all {
+		// hotspots api does not support sorting or filtering by date, issues could be returned by fallback to fetchIssuesOfType
+		if !since.IsZero() && issue.UpdatedDate.Before(since) {
+			continue
+		}
+		if issue.UpdatedDate.After(issue.CreatedDate) {
+			issue.Changes, err = a.fetchIssueChanges(issue)
+			if err != nil {
+				rerr = err
+				return
+			}
+		}
+		res = append(res, issue)
+	}
+	return
+}
+
+// fetchIssuesOfType returns all issues of the type. issues/search returns at most 10000 results for a query, so results are sorted by creation date and fetched in windows using createdAfter.
+func (a *SonarqubeAPI) fetchIssuesOfType(project *codequality.Project, issueType string) (res []*Issue, _ error) {
+	seen := map[string]bool{}
+	createdAfter := ""
+	for {
+		last := ""
+		truncated, err := paginate(maxSearchResults, func(params url.Values) (paging, error) {
+			params.Set("componentKeys", project.Identifier)
+			params.Set("types", issueType)
+			params.Set("s", "CREATION_DATE")
+			params.Set("asc", "true")
+			if createdAfter != "" {
+				// inclusive, duplicates are skipped below
+				params.Set("createdAfter", createdAfter)
+			}
+			var val struct {
+				Paging paging           `json:"paging"`
+				Issues []*issueResponse `json:"issues"`
+			}
+			err := a.get("/issues/search", params, &val)
+			if err != nil {
+				return paging{}, err
+			}
+			for _, data := range val.Issues {
+				last = data.CreationDate
+				if seen[data.Key] {
+					continue
+				}
+				seen[data.Key] = true
+				issue, err := a.convertIssue(project, data)
+				if err != nil {
+					return paging{}, err
+				}
+				res = append(res, issue)
+			}
+			return val.Paging, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !truncated {
+			return res, nil
+		}
+		if last == createdAfter {
+			a.logger.Warn("more than 10000 issues created at the same time, skipping the rest", "project", project.Identifier, "type", issueType, "created", last)
+			return res, nil
+		}
+		createdAfter = last
+	}
+}
+
+// fetchIssuesOfTypeUpdated returns issues of the type updated after since. issues/search does not have a filter for update date, so results are sorted by update date descending and fetched until the first issue updated before since. Falls back to fetching all issues if more than 10000 were updated.
+func (a *SonarqubeAPI) fetchIssuesOfTypeUpdated(project *codequality.Project, issueType string, since time.Time) (res []*Issue, _ error) {
+	truncated, err := paginate(maxSearchResults, func(params url.Values) (paging, error) {
+		params.Set("componentKeys", project.Identifier)
+		params.Set("types", issueType)
+		params.Set("s", "UPDATE_DATE")
+		params.Set("asc", "false")
+		var val struct {
+			Paging paging           `json:"paging"`
+			Issues []*issueResponse `json:"issues"`
+		}
+		err := a.get("/issues/search", params, &val)
+		if err != nil {
+			return paging{}, err
+		}
+		for _, data := range val.Issues {
+			issue, err := a.convertIssue(project, data)
+			if err != nil {
+				return paging{}, err
+			}
+			if issue.UpdatedDate.Before(since) {
+				// empty paging stops pagination
+				return paging{}, nil
+			}
+			res = append(res, issue)
+		}
+		return val.Paging, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if truncated {
+		a.logger.Info("more than 10000 issues updated since last export, fetching all issues", "project", project.Identifier, "type", issueType)
+		return a.fetchIssuesOfType(project, issueType)
+	}
+	return res, nil
+}
+
+func (a *SonarqubeAPI) convertIssue(project *codequality.Project, data *issueResponse) (*Issue, error) {
+	issue := &Issue{}
+	issue.RefID = data.Key
+	issue.ProjectID = project.ID
+	issue.Type = data.Type
+	issue.Severity = data.Severity
+	issue.Status = data.Status
+	issue.Resolution = data.Resolution
+	issue.Rule = data.Rule
+	issue.Message = data.Message
+	issue.Component = data.Component
+	issue.Line = data.Line
+	issue.Author = data.Author
+	issue.Tags = data.Tags
+	issue.Effort = data.Effort
+	issue.URL = a.webURL() + "/project/issues?id=" + url.QueryEscape(project.Identifier) + "&open=" + url.QueryEscape(data.Key)
+	var err error
+	issue.CreatedDate, err = parseDate(data.CreationDate)
+	if err != nil {
+		return nil, err
+	}
+	issue.UpdatedDate, err = parseDate(data.UpdateDate)
+	if err != nil {
+		return nil, err
+	}
+	issue.ClosedDate, err = parseDate(data.CloseDate)
+	if err != nil {
+		return nil, err
+	}
+	return issue, nil
+}
+
+// fetchHotspots returns security hotspots using api available since sonarqube 8.2. Returns 404 error for older versions.
+func (a *SonarqubeAPI) fetchHotspots(project *codequality.Project) (res []*Issue, rerr error) {
+	truncated, err := paginate(maxSearchResults, func(params url.Values) (paging, error) {
+		params.Set("projectKey", project.Identifier)
+		var val struct {
+			Paging   paging             `json:"paging"`
+			Hotspots []*hotspotResponse `json:"hotspots"`
+		}
+		err := a.get("/hotspots/search", params, &val)
+		if err != nil {
+			return paging{}, err
+		}
+		for _, data := range val.Hotspots {
+			issue := &Issue{}
+			issue.RefID = data.Key
+			issue.ProjectID = project.ID
+			issue.Type = IssueTypeSecurityHotspot
+			issue.Severity = data.VulnerabilityProbability
+			issue.Status = data.Status
+			issue.Resolution = data.Resolution
+			issue.Rule = data.RuleKey
+			issue.Message = data.Message
+			issue.Component = data.Component
+			issue.Line = data.Line
+			issue.Author = data.Author
+			issue.URL = a.webURL() + "/security_hotspots?id=" + url.QueryEscape(project.Identifier) + "&hotspots=" + url.QueryEscape(data.Key)
+			issue.hotspot = true
+			issue.CreatedDate, err = parseDate(data.CreationDate)
+			if err != nil {
+				return paging{}, err
+			}
+			issue.UpdatedDate, err = parseDate(data.UpdateDate)
+			if err != nil {
+				return paging{}, err
+			}
+			res = append(res, issue)
+		}
+		return val.Paging, nil
+	})
+	if err != nil {
+		rerr = err
+		return
+	}
+	if truncated {
+		a.logger.Warn("more than 10000 security hotspots, skipping the rest", "project", project.Identifier)
+	}
+	return
+}
+
+type changelogResponse struct {
+	Changelog []struct {
+		User         string `json:"user"`
+		CreationDate string `json:"creationDate"`
+		Diffs        []struct {
+			Key      string `json:"key"`
+			NewValue string `json:"newValue"`
+			OldValue string `json:"oldValue"`
+		} `json:"diffs"`
+	} `json:"changelog"`
+}
+
+func (a *SonarqubeAPI) fetchIssueChanges(issue *Issue) (res []IssueChange, _ error) {
+	var val changelogResponse
+	params := url.Values{}
+	var err error
+	if issue.hotspot {
+		params.Set("hotspot", issue.RefID)
+		err = a.get("/hotspots/show", params, &val)
+	} else {
+		params.Set("issue", issue.RefID)
+		err = a.get("/issues/changelog", params, &val)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range val.Changelog {
+		created, err := parseDate(entry.CreationDate)
+		if err != nil {
+			return nil, err
+		}
+		for _, diff := range entry.Diffs {
+			res = append(res, IssueChange{
+				CreatedDate: created,
+				User:        entry.User,
+				Field:       diff.Key,
+				From:        diff.OldValue,
+				To:          diff.NewValue,
+			})
+		}
+	}
+	return res, nil
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"net/url"
 	"strings"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 )
 
 type metricsResponse struct {
+	Paging   paging `json:"paging"`
 	Measures []*struct {
 		Metric  string `json:"metric"`
 		History []*struct {
@@ -22,10 +24,22 @@ type metricsResponse struct {
 // FetchMetrics _
 func (a *SonarqubeAPI) FetchMetrics(project *codequality.Project, fromDate time.Time) ([]*codequality.Metric, error) {
 	project.ToMap() // need to call setDefaults so that ID is set
-	metricKeys := strings.Join(a.metrics, ",")
-	ur := "/measures/search_history?p=1&ps=500&component=" + project.Identifier + "&metrics=" + metricKeys
-	val := []metricsResponse{}
-	err := a.doRequest("GET", ur, fromDate, &val)
+	var val []metricsResponse
+	// paging is applied to history of every metric
+	_, err := paginate(0, func(params url.Values) (paging, error) {
+		params.Set("component", project.Identifier)
+		params.Set("metrics", strings.Join(a.metrics, ","))
+		if !fromDate.IsZero() {
+			params.Set("from", formatDate(fromDate))
+		}
+		var page metricsResponse
+		err := a.get("/measures/search_history", params, &page)
+		if err != nil {
+			return paging{}, err
+		}
+		val = append(val, page)
+		return page.Paging, nil
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -35,7 +49,7 @@ func (a *SonarqubeAPI) FetchMetrics(project *codequality.Project, fromDate time.
 		for _, measure := range each.Measures {
 			for _, metric := range measure.History {
 				if metric.Value != "" {
-					created, err := time.Parse("2006-01-02T15:04:05-0700", metric.Date)
+					created, err := parseDate(metric.Date)
 					if err != nil {
 						return nil, err
 					}
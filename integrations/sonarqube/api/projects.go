@@ -1,12 +1,13 @@
 package api
 
 import (
-	"time"
+	"net/url"
 
 	"github.com/pinpt/integration-sdk/codequality"
 )
 
 type projectsResponse struct {
+	Paging     paging `json:"paging"`
 	Components []*struct {
 		ID           string `json:"id"`
 		Key          string `json:"key"`
@@ -20,20 +21,32 @@ type projectsResponse struct {
 // FetchProjects ...
 func (a *SonarqubeAPI) FetchProjects() ([]*codequality.Project, error) {
 
-	val := projectsResponse{}
-	err := a.doRequest("GET", "/components/search?p=1&ps=500&qualifiers=TRK", time.Time{}, &val)
+	var projects []*codequality.Project
+	_, err := paginate(0, func(params url.Values) (paging, error) {
+		params.Set("qualifiers", "TRK")
+		val := projectsResponse{}
+		err := a.get("/components/search", params, &val)
+		if err != nil {
+			return paging{}, err
+		}
+		for _, proj := range val.Components {
+			projects = append(projects, &codequality.Project{
+				Identifier: proj.Key,
+				Name:       proj.Name,
+				RefID:      proj.ID,
+				RefType:    "sonarqube",
+			})
+		}
+		return val.Paging, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	var projects []*codequality.Project
-	for _, proj := range val.Components {
-		projects = append(projects, &codequality.Project{
-			Identifier: proj.Key,
-			Name:       proj.Name,
-			RefID:      proj.ID,
-			RefType:    "sonarqube",
-		})
-	}
 	return projects, nil
 
 }
+
+// ProjectURL returns the link to project dashboard in webapp
+func (a *SonarqubeAPI) ProjectURL(key string) string {
+	return a.webURL() + "/dashboard?id=" + url.QueryEscape(key)
+}
@@ -11,7 +11,7 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-var url = ""
+var apiURL = ""
 var authToken = ""
 
 var metricsArray = []string{
@@ -19,8 +19,8 @@ var metricsArray = []string{
 }
 
 func init() {
-	if url == "" {
-		url = os.Getenv("PP_TEST_SONARQUBE_URL")
+	if apiURL == "" {
+		apiURL = os.Getenv("PP_TEST_SONARQUBE_URL")
 	}
 	if authToken == "" {
 		authToken = os.Getenv("PP_TEST_SONARQUBE_APIKEY")
@@ -37,7 +37,7 @@ func TestFetchProjects(t *testing.T) {
 	if skipTests(t) {
 		return
 	}
-	sonarapi := NewSonarqubeAPI(context.Background(), hclog.NewNullLogger(), url, authToken, metricsArray)
+	sonarapi := NewSonarqubeAPI(context.Background(), hclog.NewNullLogger(), apiURL, authToken, metricsArray)
 	projects, err := sonarapi.FetchProjects()
 	assert.NoError(t, err)
 	assert.NotEmpty(t, projects)
@@ -46,7 +46,7 @@ func TestValidate(t *testing.T) {
 	if skipTests(t) {
 		return
 	}
-	sonarapi := NewSonarqubeAPI(context.Background(), hclog.NewNullLogger(), url, authToken, metricsArray)
+	sonarapi := NewSonarqubeAPI(context.Background(), hclog.NewNullLogger(), apiURL, authToken, metricsArray)
 	valid, err := sonarapi.Validate()
 	assert.NoError(t, err)
 	assert.True(t, valid)
@@ -56,7 +56,7 @@ func TestFetchMetrics(t *testing.T) {
 	if skipTests(t) {
 		return
 	}
-	sonarapi := NewSonarqubeAPI(context.Background(), hclog.NewNullLogger(), url, authToken, metricsArray)
+	sonarapi := NewSonarqubeAPI(context.Background(), hclog.NewNullLogger(), apiURL, authToken, metricsArray)
 	proj := &codequality.Project{
 		Identifier: "key-2",
 	}
@@ -2,15 +2,45 @@ package main
 
 import (
 	"github.com/pinpt/agent/integrations/pkg/objsender"
+	"github.com/pinpt/agent/integrations/pkg/repoprojects"
+	"github.com/pinpt/agent/integrations/sonarqube/api"
 	"github.com/pinpt/integration-sdk/codequality"
 )
 
+type exportProject struct {
+	*codequality.Project
+}
+
+func (s exportProject) GetID() string {
+	return s.Project.RefID
+}
+
+func (s exportProject) GetReadableID() string {
+	return s.Project.Identifier
+}
+
+func (s *Integration) filterProjects(projects []*codequality.Project) (res []*codequality.Project) {
+	var all []repoprojects.RepoProject
+	for _, p := range projects {
+		all = append(all, exportProject{p})
+	}
+	filtered := repoprojects.Filter(s.logger, all, repoprojects.FilterConfig{
+		IncludedIDs: s.inclusions,
+		ExcludedIDs: s.exclusions,
+	})
+	for _, p := range filtered {
+		res = append(res, p.(exportProject).Project)
+	}
+	return
+}
+
 func (s *Integration) exportAll() error {
 	projects, err := s.api.FetchProjects()
 	if err != nil {
 		s.logger.Error("error fetching projects", "err", err)
 		return err
 	}
+	projects = s.filterProjects(projects)
 	session, err := objsender.Root(s.agent, codequality.ProjectModelName.String())
 	if err != nil {
 		s.logger.Error("error creating project session", "err", err)
@@ -46,6 +76,60 @@ func (s *Integration) exportAll() error {
 		if err := metricsession.Done(); err != nil {
 			return err
 		}
+		if err := s.exportIssues(session, project); err != nil {
+			return err
+		}
+		if err := s.exportAnalyses(session, project); err != nil {
+			return err
+		}
 	}
 	return session.Done()
 }
+
+func (s *Integration) exportIssues(parent *objsender.Session, project *codequality.Project) error {
+	issuesession, err := parent.Session(api.IssueModelName, project.RefID, project.Name)
+	if err != nil {
+		s.logger.Error("error creating issue session", "err", err)
+		return err
+	}
+	issues, err := s.api.FetchIssues(project, issuesession.LastProcessedTime())
+	if err != nil {
+		s.logger.Error("error fetching issues", "err", err)
+		return err
+	}
+	if err := issuesession.SetTotal(len(issues)); err != nil {
+		return err
+	}
+	for _, issue := range issues {
+		issue.CustomerID = s.customerID
+		if err := issuesession.Send(issue); err != nil {
+			s.logger.Error("error sending issue to agent", "err", err, "id", issue.RefID)
+			return err
+		}
+	}
+	return issuesession.Done()
+}
+
+func (s *Integration) exportAnalyses(parent *objsender.Session, project *codequality.Project) error {
+	analysissession, err := parent.Session(api.AnalysisModelName, project.RefID, project.Name)
+	if err != nil {
+		s.logger.Error("error creating analysis session", "err", err)
+		return err
+	}
+	analyses, err := s.api.FetchAnalyses(project, analysissession.LastProcessedTime())
+	if err != nil {
+		s.logger.Error("error fetching analyses", "err", err)
+		return err
+	}
+	if err := analysissession.SetTotal(len(analyses)); err != nil {
+		return err
+	}
+	for _, analysis := range analyses {
+		analysis.CustomerID = s.customerID
+		if err := analysissession.Send(analysis); err != nil {
+			s.logger.Error("error sending analysis to agent", "err", err, "id", analysis.RefID)
+			return err
+		}
+	}
+	return analysissession.Done()
+}
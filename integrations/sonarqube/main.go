@@ -26,6 +26,10 @@ type Integration struct {
 	agent      rpcdef.Agent
 	customerID string
 	api        *api.SonarqubeAPI
+
+	// inclusions and exclusions contain project ref ids selected in onboarding
+	inclusions []string
+	exclusions []string
 }
 
 func (s *Integration) Init(agent rpcdef.Agent) error {
@@ -69,17 +73,14 @@ func (s *Integration) ValidateConfig(ctx context.Context, config rpcdef.ExportCo
 	return res, nil
 }
 
-func (s *Integration) OnboardExport(ctx context.Context, objectType rpcdef.OnboardExportType, config rpcdef.ExportConfig) (res rpcdef.OnboardExportResult, _ error) {
-	res.Error = rpcdef.ErrOnboardExportNotSupported
-	return
-}
-
 func (s *Integration) initConfig(ctx context.Context, config rpcdef.ExportConfig) error {
 
 	var defConfig struct {
-		URL     string   `json:"url"`
-		APIKey  string   `json:"api_key"`
-		Metrics []string `json:"metrics"`
+		URL        string   `json:"url"`
+		APIKey     string   `json:"api_key"`
+		Metrics    []string `json:"metrics"`
+		Inclusions []string `json:"inclusions"`
+		Exclusions []string `json:"exclusions"`
 	}
 
 	err := structmarshal.MapToStruct(config.Integration.Config, &defConfig)
@@ -106,6 +107,8 @@ func (s *Integration) initConfig(ctx context.Context, config rpcdef.ExportConfig
 	}
 	s.api = api.NewSonarqubeAPI(ctx, s.logger, purl, apikey, metrics)
 	s.customerID = config.Pinpoint.CustomerID
+	s.inclusions = defConfig.Inclusions
+	s.exclusions = defConfig.Exclusions
 	return nil
 }
 
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+
+	"github.com/pinpt/agent/rpcdef"
+	"github.com/pinpt/integration-sdk/agent"
+)
+
+func (s *Integration) OnboardExport(ctx context.Context, objectType rpcdef.OnboardExportType, config rpcdef.ExportConfig) (res rpcdef.OnboardExportResult, _ error) {
+	switch objectType {
+	case rpcdef.OnboardExportTypeProjects:
+		return s.onboardExportProjects(ctx, config)
+	default:
+		res.Error = rpcdef.ErrOnboardExportNotSupported
+		return
+	}
+}
+
+func (s *Integration) onboardExportProjects(ctx context.Context, config rpcdef.ExportConfig) (res rpcdef.OnboardExportResult, rerr error) {
+	err := s.initConfig(ctx, config)
+	if err != nil {
+		rerr = err
+		return
+	}
+	projects, err := s.api.FetchProjects()
+	if err != nil {
+		rerr = err
+		return
+	}
+	var records []map[string]interface{}
+	for _, project := range projects {
+		item := &agent.ProjectResponseProjects{}
+		item.RefID = project.RefID
+		item.RefType = "sonarqube"
+		item.Name = project.Name
+		item.Identifier = project.Identifier
+		item.Active = true
+		item.URL = s.api.ProjectURL(project.Identifier)
+		records = append(records, item.ToMap())
+	}
+	res.Data = records
+	return res, nil
+}
@@ -3,12 +3,14 @@ package agentconf
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 
 	"github.com/pinpt/agent/cmd/cmdrunnorestarts/inconfig"
 	"github.com/pinpt/agent/pkg/fs"
+	"github.com/pinpt/agent/pkg/secrets"
 )
 
 type Config struct {
@@ -25,10 +27,82 @@ type Config struct {
 
 	// ExtraIntegrations defines additional integrations that will run on every export trigger in run command. This is needed to run a custom integration for one of our customers. You need to add these custom integrations to config manually after enroll.
 	ExtraIntegrations []inconfig.IntegrationAgent `json:"extra_integrations"`
+
+	// Output defines where exported data is sent. Uploads to pinpoint by default. Add it to config manually after enroll to keep exported data on your own infrastructure.
+	Output Output `json:"output"`
+
+	// Schedules defines exports started by the agent itself, without export requests from pinpoint backend. Requires local or s3 output.
+	Schedules []Schedule `json:"schedules"`
+
+	// MaxConcurrentExports is the maximum number of integrations exported at the same time. Exports of the same integration always run one at a time. When 0, the limit is based on number of CPUs and memory. Values higher than that are lowered as well.
+	MaxConcurrentExports int `json:"max_concurrent_exports"`
+
+	// MetricsAddr is the address to serve prometheus metrics on at /metrics, for example "localhost:9100". Disabled when empty.
+	MetricsAddr string `json:"metrics_addr"`
+
+	// StatusAddr is the localhost address to serve status and control api on, for example "localhost:9101". Disabled when empty.
+	StatusAddr string `json:"status_addr"`
+}
+
+type Schedule struct {
+	// IntegrationID is the id of the integration in ExtraIntegrations to export
+	IntegrationID string `json:"integration_id"`
+	// Cron is a standard 5 field cron expression, for example "0 */6 * * *". Evaluated in local time.
+	Cron string `json:"cron"`
+	// MaxRuntime is the maximum duration of the export, for example "2h". Export is cancelled when exceeded. Defaults to 12h.
+	MaxRuntime string `json:"max_runtime"`
+}
+
+// Output types
+const (
+	OutputTypePinpoint = "pinpoint"
+	OutputTypeLocal    = "local"
+	OutputTypeS3       = "s3"
+)
+
+type Output struct {
+	// Type is one of pinpoint, local or s3. Empty is the same as pinpoint.
+	Type string `json:"type"`
+	// Dir is the directory for local output. Every export is written into a separate subdirectory.
+	Dir string `json:"dir"`
+	// S3 is the config for s3 output
+	S3 OutputS3 `json:"s3"`
+}
+
+// IsPinpoint returns true if exported data is uploaded to pinpoint
+func (s Output) IsPinpoint() bool {
+	return s.Type == "" || s.Type == OutputTypePinpoint
+}
+
+type OutputS3 struct {
+	// Endpoint of s3 compatible storage, for example http://localhost:9000 for local MinIO. Uses AWS S3 if empty. Path-style urls are used when set.
+	Endpoint string `json:"endpoint"`
+	// Region defaults to us-east-1
+	Region          string `json:"region"`
+	Bucket          string `json:"bucket"`
+	Prefix          string `json:"prefix"`
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+}
+
+// secrets returns pointers to fields with credentials, these are sealed in saved config
+func (s *Config) secrets() []*string {
+	res := []*string{&s.APIKey, &s.PPEncryptionKey, &s.Output.S3.SecretAccessKey}
+	for i := range s.ExtraIntegrations {
+		res = append(res, s.ExtraIntegrations[i].Config.Secrets()...)
+	}
+	return res
 }
 
-func Save(c Config, loc string) error {
-	err := os.MkdirAll(filepath.Dir(loc), 0777)
+// Save writes config to loc with credentials sealed using ring
+func Save(c Config, loc string, ring *secrets.Keyring) error {
+	// do not modify integrations of the caller
+	c.ExtraIntegrations = append([]inconfig.IntegrationAgent(nil), c.ExtraIntegrations...)
+	err := ring.SealAll(c.secrets()...)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(loc), 0777)
 	if err != nil {
 		return err
 	}
@@ -39,7 +113,39 @@ func Save(c Config, loc string) error {
 	return fs.WriteToTempAndRename(bytes.NewReader(b), loc)
 }
 
-func Load(loc string) (res Config, _ error) {
+// Load reads config from loc and unseals credentials using ring. Credentials that are not sealed are returned as is.
+func Load(loc string, ring *secrets.Keyring) (res Config, _ error) {
+	res, err := read(loc)
+	if err != nil {
+		return res, err
+	}
+	err = ring.UnsealAll(res.secrets()...)
+	if err != nil {
+		return res, fmt.Errorf("could not unseal secrets in config: %v", err)
+	}
+	return
+}
+
+// SealPlaintext seals credentials that were added to config manually or saved by previous versions. Returns true if config was changed.
+func SealPlaintext(loc string, ring *secrets.Keyring) (bool, error) {
+	c, err := read(loc)
+	if err != nil {
+		return false, err
+	}
+	plaintext := false
+	for _, v := range c.secrets() {
+		if *v != "" && !secrets.IsSealed(*v) {
+			plaintext = true
+		}
+	}
+	if !plaintext {
+		return false, nil
+	}
+	// Save seals all values, already sealed values are kept
+	return true, Save(c, loc, ring)
+}
+
+func read(loc string) (res Config, _ error) {
 	b, err := ioutil.ReadFile(loc)
 	if err != nil {
 		return res, err
@@ -0,0 +1,89 @@
+package agentconf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pinpt/agent/cmd/cmdrunnorestarts/inconfig"
+	"github.com/pinpt/agent/pkg/fsconf"
+	"github.com/pinpt/agent/pkg/secrets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveLoadSealsSecrets(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "agentconf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("PP_AGENT_ID", "host1")
+	defer os.Unsetenv("PP_AGENT_ID")
+
+	ring, err := secrets.LoadKeyring(fsconf.New(dir))
+	assert.NoError(err)
+	loc := filepath.Join(dir, "config.json")
+
+	c := Config{}
+	c.APIKey = "apikey1"
+	c.CustomerID = "c1"
+	in := inconfig.IntegrationAgent{}
+	in.Name = "github"
+	in.Config.APIKey = "token1"
+	c.ExtraIntegrations = []inconfig.IntegrationAgent{in}
+	assert.NoError(Save(c, loc, ring))
+	// caller config is not modified
+	assert.Equal("token1", c.ExtraIntegrations[0].Config.APIKey)
+
+	b, err := ioutil.ReadFile(loc)
+	assert.NoError(err)
+	assert.NotContains(string(b), "apikey1")
+	assert.NotContains(string(b), "token1")
+	assert.Contains(string(b), "c1")
+
+	res, err := Load(loc, ring)
+	assert.NoError(err)
+	assert.Equal("apikey1", res.APIKey)
+	assert.Equal("token1", res.ExtraIntegrations[0].Config.APIKey)
+}
+
+func TestSealPlaintext(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "agentconf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("PP_AGENT_ID", "host1")
+	defer os.Unsetenv("PP_AGENT_ID")
+
+	ring, err := secrets.LoadKeyring(fsconf.New(dir))
+	assert.NoError(err)
+	loc := filepath.Join(dir, "config.json")
+
+	// config saved by previous version with integration added manually
+	err = ioutil.WriteFile(loc, []byte(`{"api_key":"apikey1","extra_integrations":[{"name":"github","config":{"api_key":"token1"}}]}`), 0600)
+	assert.NoError(err)
+
+	res, err := Load(loc, ring)
+	assert.NoError(err)
+	assert.Equal("token1", res.ExtraIntegrations[0].Config.APIKey)
+
+	sealed, err := SealPlaintext(loc, ring)
+	assert.NoError(err)
+	assert.True(sealed)
+	b, err := ioutil.ReadFile(loc)
+	assert.NoError(err)
+	assert.NotContains(string(b), "token1")
+
+	sealed, err = SealPlaintext(loc, ring)
+	assert.NoError(err)
+	assert.False(sealed)
+
+	res, err = Load(loc, ring)
+	assert.NoError(err)
+	assert.Equal("apikey1", res.APIKey)
+	assert.Equal("token1", res.ExtraIntegrations[0].Config.APIKey)
+}
@@ -0,0 +1,165 @@
+// Package cronexpr parses standard 5 field cron expressions and calculates next activation time.
+//
+// Supported syntax for each field is *, single values, ranges (1-5), lists (1,3,5) and steps (*/15, 0-30/10). Macros @hourly, @daily, @weekly and @monthly are also supported. Day of week is 0-6, where 0 is Sunday, 7 is also accepted as Sunday.
+//
+// As in standard cron, when both day of month and day of week are restricted, the expression matches if either of them matches.
+package cronexpr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expr is a parsed cron expression
+type Expr struct {
+	minute   uint64
+	hour     uint64
+	dom      uint64
+	month    uint64
+	dow      uint64
+	domStar  bool
+	dowStar  bool
+	original string
+}
+
+var macros = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+type fieldDef struct {
+	name string
+	min  int
+	max  int
+}
+
+var fieldDefs = []fieldDef{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// Parse parses cron expression
+func Parse(expr string) (*Expr, error) {
+	s := strings.TrimSpace(expr)
+	if v, ok := macros[s]; ok {
+		s = v
+	}
+	fields := strings.Fields(s)
+	if len(fields) != len(fieldDefs) {
+		return nil, fmt.Errorf("invalid cron expression %q, expecting %v fields, got %v", expr, len(fieldDefs), len(fields))
+	}
+	res := &Expr{original: expr}
+	var bits [5]uint64
+	for i, f := range fields {
+		v, err := parseField(f, fieldDefs[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %v", expr, err)
+		}
+		bits[i] = v
+	}
+	res.minute = bits[0]
+	res.hour = bits[1]
+	res.dom = bits[2]
+	res.month = bits[3]
+	res.dow = bits[4]
+	// 7 is sunday as well
+	if res.dow&(1<<7) != 0 {
+		res.dow |= 1
+	}
+	res.domStar = fields[2] == "*"
+	res.dowStar = fields[4] == "*"
+	return res, nil
+}
+
+func parseField(field string, def fieldDef) (res uint64, _ error) {
+	for _, part := range strings.Split(field, ",") {
+		rng := part
+		step := 1
+		if i := strings.Index(part, "/"); i != -1 {
+			rng = part[:i]
+			v, err := strconv.Atoi(part[i+1:])
+			if err != nil || v <= 0 {
+				return 0, fmt.Errorf("invalid step in %v field: %q", def.name, part)
+			}
+			step = v
+		}
+		from, to := def.min, def.max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			v, err := strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, fmt.Errorf("invalid value in %v field: %q", def.name, part)
+			}
+			from = v
+			to = v
+			if len(bounds) == 2 {
+				v, err := strconv.Atoi(bounds[1])
+				if err != nil {
+					return 0, fmt.Errorf("invalid value in %v field: %q", def.name, part)
+				}
+				to = v
+			} else if step != 1 {
+				// 5/15 means from 5 to max with step 15
+				to = def.max
+			}
+		}
+		if from < def.min || to > def.max || from > to {
+			return 0, fmt.Errorf("value out of range in %v field: %q, allowed %v-%v", def.name, part, def.min, def.max)
+		}
+		for v := from; v <= to; v += step {
+			res |= 1 << uint(v)
+		}
+	}
+	return res, nil
+}
+
+func (s *Expr) String() string {
+	return s.original
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
+
+func (s *Expr) dayMatches(t time.Time) bool {
+	dom := has(s.dom, t.Day())
+	dow := has(s.dow, int(t.Weekday()))
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first activation time strictly after t, in the location of t. Returns zero time if there is no activation in the next 5 years, which happens for expressions such as 0 0 31 2 *.
+func (s *Expr) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		if !has(s.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !has(s.hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if !has(s.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,71 @@
+package cronexpr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestNext(t *testing.T) {
+	cases := []struct {
+		expr string
+		from string
+		want string
+	}{
+		{"* * * * *", "2020-01-01 10:00", "2020-01-01 10:01"},
+		{"*/15 * * * *", "2020-01-01 10:07", "2020-01-01 10:15"},
+		{"0 * * * *", "2020-01-01 10:00", "2020-01-01 11:00"},
+		{"30 2 * * *", "2020-01-01 10:00", "2020-01-02 02:30"},
+		{"0 0 1 * *", "2020-01-15 00:00", "2020-02-01 00:00"},
+		{"0 0 * * 1-5", "2020-01-03 12:00", "2020-01-06 00:00"},
+		{"0 0 * * 7", "2020-01-01 00:00", "2020-01-05 00:00"},
+		{"0 9,17 * * *", "2020-01-01 10:00", "2020-01-01 17:00"},
+		{"5/20 * * * *", "2020-01-01 10:30", "2020-01-01 10:45"},
+		{"0 0 29 2 *", "2020-03-01 00:00", "2024-02-29 00:00"},
+		// day of month or day of week
+		{"0 0 15 * 1", "2020-01-01 00:00", "2020-01-06 00:00"},
+		{"@daily", "2020-12-31 23:59", "2021-01-01 00:00"},
+		{"@weekly", "2020-01-01 00:00", "2020-01-05 00:00"},
+	}
+	for _, c := range cases {
+		expr, err := Parse(c.expr)
+		if !assert.NoError(t, err, c.expr) {
+			continue
+		}
+		assert.Equal(t, date(c.want), expr.Next(date(c.from)), c.expr)
+	}
+}
+
+func TestNextNever(t *testing.T) {
+	expr, err := Parse("0 0 31 2 *")
+	assert.NoError(t, err)
+	assert.True(t, expr.Next(date("2020-01-01 00:00")).IsZero())
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, v := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@yearly",
+	} {
+		_, err := Parse(v)
+		assert.Error(t, err, v)
+	}
+}
@@ -17,6 +17,10 @@ type Opts struct {
 
 	SendProgress     SendProgressFunc
 	SendProgressDone SendProgressDoneFunc
+
+	// Checkpoints stores last processed for tracking sessions named CheckpointName instead of LastProcessed. Optional.
+	Checkpoints    LastProcessedStore
+	CheckpointName string
 }
 
 type SendProgressFunc func(pp ProgressPath, current, total int)
@@ -85,14 +89,21 @@ func (s *Manager) SessionFlex(export expin.Export, isTracking bool, name string,
 	sess := newSession(export, isTracking, name, id, s.opts.NewWriter, s.opts.SendProgress, parent, parentObjectID, parentObjectName)
 	s.sessions[id] = sess
 
-	if s.opts.LastProcessed != nil {
-		lastProcessed = s.opts.LastProcessed.Get(sess.LastProcessedKey())
+	if store := s.lastProcessedStore(sess); store != nil {
+		lastProcessed = store.Get(sess.LastProcessedKey())
 	}
 
 	//s.logger.Info("create session", "type", modelType, "last_processed_old", lastProcessed)
 	return id, lastProcessed, nil
 }
 
+func (s *Manager) lastProcessedStore(sess *session) LastProcessedStore {
+	if sess.isTracking && sess.name == s.opts.CheckpointName && s.opts.Checkpoints != nil {
+		return s.opts.Checkpoints
+	}
+	return s.opts.LastProcessed
+}
+
 func (s *Manager) newID() ID {
 	s.lastID++
 	return s.lastID
@@ -160,8 +171,8 @@ func (s *Manager) Done(id ID, lastProcessed interface{}) error {
 	if err != nil {
 		return err
 	}
-	if s.opts.LastProcessed != nil {
-		err = s.opts.LastProcessed.Set(lastProcessed, sess.LastProcessedKey())
+	if store := s.lastProcessedStore(sess); store != nil {
+		err = store.Set(lastProcessed, sess.LastProcessedKey())
 		if err != nil {
 			return err
 		}
@@ -173,6 +173,45 @@ func TestExpSessionsLastProcessedNested(t *testing.T) {
 
 }
 
+func TestExpSessionsCheckpoints(t *testing.T) {
+	opts := Opts{}
+	opts.Logger = hclog.Default()
+
+	opts.NewWriter = func(modelType string, id ID) Writer {
+		return NewMockWriter()
+	}
+
+	lpm := lastProcessedMock{}
+	opts.LastProcessed = lpm
+	checkpoints := lastProcessedMock{}
+	opts.Checkpoints = checkpoints
+	opts.CheckpointName = "checkpoint"
+	m := New(opts)
+
+	root, _, err := m.SessionRoot(testIn, "m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c1, lp, err := m.SessionFlex(expin.Export{}, true, "checkpoint", root, "p1", "p1n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, lp)
+	err = m.Done(c1, "done")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, lastProcessedMock{inPre + "m1/p1/checkpoint": "done"}, checkpoints)
+	assert.Len(t, lpm, 0)
+
+	_, lp, err = m.SessionFlex(expin.Export{}, true, "checkpoint", root, "p1", "p1n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "done", lp)
+}
+
 func TestExpSessionsProgress(t *testing.T) {
 	opts := Opts{}
 	opts.Logger = hclog.Default()
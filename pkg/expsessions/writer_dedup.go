@@ -1,15 +1,11 @@
 package expsessions
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
-	"io/ioutil"
-	"os"
 	"sync"
 
 	hclog "github.com/hashicorp/go-hclog"
-	"github.com/pinpt/agent/pkg/fs"
+	"github.com/pinpt/agent/pkg/kvstore"
 )
 
 type WriterDedup struct {
@@ -27,13 +23,13 @@ func NewWriterDedup(wr Writer, ds DedupStore, modelName string) *WriterDedup {
 }
 
 func (s *WriterDedup) Write(logger hclog.Logger, objs []map[string]interface{}) error {
+	wasAlreadySent, err := s.ds.MarkAsSent(objs, s.modelName)
+	if err != nil {
+		return err
+	}
 	var filtered []map[string]interface{}
-	for _, obj := range objs {
-		wasAlreadySent, err := s.ds.MarkAsSent(obj, s.modelName)
-		if err != nil {
-			return err
-		}
-		if !wasAlreadySent {
+	for i, obj := range objs {
+		if !wasAlreadySent[i] {
 			filtered = append(filtered, obj)
 		}
 	}
@@ -52,46 +48,37 @@ func (s *WriterDedup) Rollback() error {
 }
 
 type DedupStore interface {
-	// MarkAsSent marks the object as sent, if it wasn't already.
-	// And returns the bool if it was already sent before.
+	// MarkAsSent marks the objects as sent, if they weren't already.
+	// And returns for every object if it was already sent before.
 	// Safe for concurrent use.
-	MarkAsSent(obj map[string]interface{}, modelName string) (wasAlreadySent bool, _ error)
+	MarkAsSent(objs []map[string]interface{}, modelName string) (wasAlreadySent []bool, _ error)
 
+	// Save writes hashes of objects marked as sent into the store
 	Save() error
 
 	Stats() (new int, dups int)
 }
 
+// dedupStore keeps hashes in kvstore.BucketDedup. Only hashes of objects sent in the current export are kept in memory until Save.
 type dedupStore struct {
-	loc string
+	db *kvstore.Store
 
 	mu sync.Mutex
-	// map[ref_type][model_name][id][data_hashcode]
-	data map[string]map[string]map[string]string
+	// map[dedup_key]data_hashcode, see kvstore.DedupKey
+	pending map[string]string
 
 	dups int
 	new  int
 }
 
-func NewDedupStore(loc string) (DedupStore, error) {
-
+func NewDedupStore(db *kvstore.Store) DedupStore {
 	s := &dedupStore{}
-	s.loc = loc
-	s.data = map[string]map[string]map[string]string{}
-
-	b, err := ioutil.ReadFile(loc)
-	if err != nil {
-		if !os.IsNotExist(err) {
-			return nil, err
-		}
-		return s, nil
-	}
-
-	return s, json.Unmarshal(b, &s.data)
+	s.db = db
+	s.pending = map[string]string{}
+	return s
 }
 
-func (s *dedupStore) MarkAsSent(obj map[string]interface{}, modelName string) (wasAlreadySent bool, rerr error) {
-
+func dedupKey(obj map[string]interface{}, modelName string) (_ string, hashcode string, rerr error) {
 	refType, ok := obj["ref_type"].(string)
 	if !ok || refType == "" {
 		rerr = errors.New("dedupStore: passed object does not have ref_type")
@@ -102,29 +89,72 @@ func (s *dedupStore) MarkAsSent(obj map[string]interface{}, modelName string) (w
 		rerr = errors.New("dedupStore: passed object does not have id")
 		return
 	}
-	hashcode, ok := obj["hashcode"].(string)
+	hashcode, ok = obj["hashcode"].(string)
 	if !ok {
 		rerr = errors.New("dedupStore: passed object does not have hashcode")
 		return
 	}
+	return kvstore.DedupKey(refType, modelName, id), hashcode, nil
+}
+
+func (s *dedupStore) MarkAsSent(objs []map[string]interface{}, modelName string) (wasAlreadySent []bool, rerr error) {
+	keys := make([]string, len(objs))
+	hashcodes := make([]string, len(objs))
+	for i, obj := range objs {
+		var err error
+		keys[i], hashcodes[i], err = dedupKey(obj, modelName)
+		if err != nil {
+			rerr = err
+			return
+		}
+	}
+
 	s.mu.Lock()
-	if _, ok := s.data[refType]; !ok {
-		s.data[refType] = map[string]map[string]string{}
+	defer s.mu.Unlock()
+
+	prev := make([]string, len(objs))
+	var missing []int
+	for i, k := range keys {
+		v, ok := s.pending[k]
+		if ok {
+			prev[i] = v
+		} else {
+			missing = append(missing, i)
+		}
 	}
-	if _, ok := s.data[refType][modelName]; !ok {
-		s.data[refType][modelName] = map[string]string{}
+	if len(missing) != 0 {
+		err := s.db.View(func(tx *kvstore.Tx) error {
+			for _, i := range missing {
+				b, err := tx.Get(kvstore.BucketDedup, keys[i])
+				if err != nil {
+					return err
+				}
+				prev[i] = string(b)
+			}
+			return nil
+		})
+		if err != nil {
+			rerr = err
+			return
+		}
 	}
-	prev := s.data[refType][modelName][id]
-	s.data[refType][modelName][id] = hashcode
-	dup := prev == hashcode
-
-	if dup {
-		s.dups++
-	} else {
-		s.new++
+
+	wasAlreadySent = make([]bool, len(objs))
+	for i, k := range keys {
+		// same object could be passed more than once
+		if v, ok := s.pending[k]; ok {
+			prev[i] = v
+		}
+		s.pending[k] = hashcodes[i]
+		dup := prev[i] == hashcodes[i]
+		wasAlreadySent[i] = dup
+		if dup {
+			s.dups++
+		} else {
+			s.new++
+		}
 	}
-	s.mu.Unlock()
-	return dup, nil
+	return
 }
 
 func (s *dedupStore) Stats() (new int, dups int) {
@@ -132,9 +162,20 @@ func (s *dedupStore) Stats() (new int, dups int) {
 }
 
 func (s *dedupStore) Save() error {
-	b, err := json.Marshal(s.data)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.db.Update(func(tx *kvstore.Tx) error {
+		for k, v := range s.pending {
+			err := tx.Put(kvstore.BucketDedup, k, []byte(v))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	return fs.WriteToTempAndRename(bytes.NewReader(b), s.loc)
+	s.pending = map[string]string{}
+	return nil
 }
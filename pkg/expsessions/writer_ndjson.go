@@ -0,0 +1,98 @@
+package expsessions
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	hclog "github.com/hashicorp/go-hclog"
+)
+
+// NDJSONWriter writes objects as uncompressed newline delimited json, one file per session. Used for outputs other than pinpoint.
+type NDJSONWriter struct {
+	runID     string
+	id        ID
+	modelType string
+	outputDir string
+
+	f  *os.File
+	wr *bufio.Writer
+
+	loc string
+}
+
+// NewNDJSONWriter creates writer for session id. runID must be unique for each export process, since session ids start from 1 in every process and multiple exports can write to the same outputDir.
+func NewNDJSONWriter(modelType string, outputDir string, runID string, id ID) *NDJSONWriter {
+	s := &NDJSONWriter{}
+	s.runID = runID
+	s.id = id
+	s.modelType = modelType
+	s.outputDir = outputDir
+	return s
+}
+
+func (s *NDJSONWriter) Close() error {
+	if s.f == nil {
+		// there was no file, since no objects were sent
+		return nil
+	}
+	err := s.wr.Flush()
+	if err != nil {
+		return err
+	}
+	err = s.f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(s.loc+".temp", s.loc)
+}
+
+func (s *NDJSONWriter) Rollback() error {
+	if s.f == nil {
+		// there was no file, since no objects were sent
+		return nil
+	}
+	err := s.f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Remove(s.loc + ".temp")
+}
+
+func (s *NDJSONWriter) createFileIfNeeded() error {
+	if s.f != nil {
+		return nil
+	}
+	// session id is zero padded, so that files sort in the order sessions were created
+	base := fmt.Sprintf("%v_%06d.ndjson", s.runID, s.id)
+	s.loc = filepath.Join(s.outputDir, s.modelType, base)
+	err := os.MkdirAll(filepath.Dir(s.loc), 0777)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(s.loc + ".temp")
+	if err != nil {
+		return err
+	}
+	s.f = f
+	s.wr = bufio.NewWriter(f)
+	return nil
+}
+
+func (s *NDJSONWriter) Write(logger hclog.Logger, objs []map[string]interface{}) error {
+	err := s.createFileIfNeeded()
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(s.wr)
+	for _, obj := range objs {
+		// Encode adds a newline after each object
+		err := enc.Encode(obj)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package expsink
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/pinpt/agent/pkg/fs"
+)
+
+// localSink copies files to a local directory
+type localSink struct {
+	dir string
+}
+
+func newLocalSink(dir string) *localSink {
+	s := &localSink{}
+	s.dir = dir
+	return s
+}
+
+// Publish copies files to dir/exportName. Files are copied to temp location first and renamed, so partially written files are never visible.
+func (s *localSink) Publish(ctx context.Context, exportName string, manifest Manifest) error {
+	dir := filepath.Join(s.dir, exportName)
+	for _, file := range manifest.Files {
+		loc := filepath.Join(dir, filepath.FromSlash(file.Path))
+		err := os.MkdirAll(filepath.Dir(loc), 0777)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(file.loc)
+		if err != nil {
+			return err
+		}
+		err = fs.WriteToTempAndRename(f, loc)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	b, err := manifest.JSON()
+	if err != nil {
+		return err
+	}
+	return fs.WriteToTempAndRename(bytes.NewReader(b), filepath.Join(dir, ManifestFileName))
+}
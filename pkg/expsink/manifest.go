@@ -0,0 +1,115 @@
+package expsink
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/pinpt/go-common/fileutil"
+)
+
+// ManifestFileName is the name of the manifest in export directory
+const ManifestFileName = "manifest.json"
+
+// Manifest describes all files of one export
+type Manifest struct {
+	Name      string         `json:"name"`
+	CreatedAt time.Time      `json:"created_at"`
+	Files     []ManifestFile `json:"files"`
+}
+
+type ManifestFile struct {
+	// Path is relative to export directory, using / as separator. Data files are stored as model_name/file.ndjson.
+	Path string `json:"path"`
+	// Model is the model name of objects in the file, empty for export.log
+	Model string `json:"model,omitempty"`
+	// Objects is the number of objects (lines) in the file
+	Objects int    `json:"objects"`
+	Size    int64  `json:"size"`
+	SHA256  string `json:"sha256"`
+
+	// loc is the location of the file on local disk
+	loc string
+}
+
+// NewManifest creates manifest for all ndjson files in uploads dir. Files are sorted by path, to keep manifest stable.
+func NewManifest(uploadsDir string, name string, logFile string) (res Manifest, rerr error) {
+	res.Name = name
+	res.CreatedAt = time.Now().UTC()
+	res.Files = []ManifestFile{}
+
+	files, err := fileutil.FindFiles(uploadsDir, regexp.MustCompile(`\.ndjson$`))
+	if err != nil {
+		rerr = err
+		return
+	}
+	sort.Strings(files)
+	for _, loc := range files {
+		rel, err := filepath.Rel(uploadsDir, loc)
+		if err != nil {
+			rerr = err
+			return
+		}
+		file, err := newManifestFile(loc, filepath.ToSlash(rel))
+		if err != nil {
+			rerr = err
+			return
+		}
+		file.Model = filepath.Base(filepath.Dir(loc))
+		res.Files = append(res.Files, file)
+	}
+
+	if logFile != "" && len(res.Files) != 0 {
+		file, err := newManifestFile(logFile, "export.log")
+		if err != nil {
+			rerr = err
+			return
+		}
+		// not ndjson
+		file.Objects = 0
+		res.Files = append(res.Files, file)
+	}
+
+	return
+}
+
+func newManifestFile(loc string, path string) (res ManifestFile, rerr error) {
+	res.Path = path
+	res.loc = loc
+
+	f, err := os.Open(loc)
+	if err != nil {
+		rerr = err
+		return
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	r := io.TeeReader(f, h)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		res.Size += int64(n)
+		res.Objects += bytes.Count(buf[:n], []byte("\n"))
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			rerr = err
+			return
+		}
+	}
+	res.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return
+}
+
+func (s Manifest) JSON() ([]byte, error) {
+	return json.MarshalIndent(s, "", "  ")
+}
@@ -0,0 +1,331 @@
+package expsink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/pkg/agentconf"
+)
+
+// s3Sink uploads files to s3 bucket under prefix/exportName
+type s3Sink struct {
+	logger hclog.Logger
+	client *s3Client
+	prefix string
+}
+
+func newS3Sink(logger hclog.Logger, conf agentconf.OutputS3) *s3Sink {
+	s := &s3Sink{}
+	s.logger = logger
+	s.client = newS3Client(conf)
+	s.prefix = strings.Trim(conf.Prefix, "/")
+	return s
+}
+
+func (s *s3Sink) key(exportName string, path string) string {
+	if s.prefix == "" {
+		return exportName + "/" + path
+	}
+	return s.prefix + "/" + exportName + "/" + path
+}
+
+// Publish uploads files and then the manifest
+func (s *s3Sink) Publish(ctx context.Context, exportName string, manifest Manifest) error {
+	for _, file := range manifest.Files {
+		s.logger.Debug("uploading file to s3", "path", file.Path, "size", file.Size)
+		err := s.client.putFile(ctx, s.key(exportName, file.Path), file)
+		if err != nil {
+			return err
+		}
+	}
+	b, err := manifest.JSON()
+	if err != nil {
+		return err
+	}
+	return s.client.put(ctx, s.key(exportName, ManifestFileName), bytes.NewReader(b), int64(len(b)), sha256Hex(b), "application/json")
+}
+
+// defaultPartSize is the size of parts for files uploaded using multipart upload. Single PUT is limited to 5GB, s3 allows up to 10000 parts, so 64MB parts allow files up to 640GB.
+const defaultPartSize = 64 * 1024 * 1024
+
+// s3Client uploads objects using aws signature version 4. Supports PUT object and multipart upload, which is enough for exports and works with s3 compatible storage such as MinIO.
+type s3Client struct {
+	conf   agentconf.OutputS3
+	region string
+	client *http.Client
+	now    func() time.Time
+	// partSize is the size of multipart upload parts, files larger than partSize are uploaded in parts
+	partSize int64
+}
+
+func newS3Client(conf agentconf.OutputS3) *s3Client {
+	s := &s3Client{}
+	s.conf = conf
+	s.region = conf.Region
+	if s.region == "" {
+		s.region = "us-east-1"
+	}
+	s.client = http.DefaultClient
+	s.now = time.Now
+	s.partSize = defaultPartSize
+	return s
+}
+
+// objectURL returns path-style url when custom endpoint is set, virtual-hosted style url for aws otherwise
+func (s *s3Client) objectURL(key string) (*url.URL, error) {
+	if s.conf.Endpoint == "" {
+		return url.Parse("https://" + s.conf.Bucket + ".s3." + s.region + ".amazonaws.com/" + s3EscapePath(key))
+	}
+	return url.Parse(strings.TrimSuffix(s.conf.Endpoint, "/") + "/" + s3EscapePath(s.conf.Bucket) + "/" + s3EscapePath(key))
+}
+
+func (s *s3Client) putFile(ctx context.Context, key string, file ManifestFile) error {
+	f, err := os.Open(file.loc)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	contentType := "application/x-ndjson"
+	if file.Model == "" {
+		contentType = "text/plain"
+	}
+	if file.Size > s.partSize {
+		return s.putMultipart(ctx, key, f, file.Size, contentType)
+	}
+	return s.put(ctx, key, f, file.Size, file.SHA256, contentType)
+}
+
+func (s *s3Client) put(ctx context.Context, key string, body io.Reader, size int64, payloadHash string, contentType string) error {
+	_, _, err := s.do(ctx, http.MethodPut, key, nil, body, size, payloadHash, contentType)
+	return err
+}
+
+type s3Part struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// putMultipart uploads file in parts of partSize. Upload is aborted on error, so that s3 does not keep the uploaded parts.
+// https://docs.aws.amazon.com/AmazonS3/latest/dev/mpuoverview.html
+func (s *s3Client) putMultipart(ctx context.Context, key string, f io.ReaderAt, size int64, contentType string) (rerr error) {
+	_, b, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, 0, sha256Hex(nil), contentType)
+	if err != nil {
+		rerr = err
+		return
+	}
+	var created struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.Unmarshal(b, &created)
+	if err != nil {
+		rerr = fmt.Errorf("could not parse s3 create multipart upload response: %v", err)
+		return
+	}
+	if created.UploadID == "" {
+		rerr = fmt.Errorf("s3 create multipart upload returned empty upload id, key: %v", key)
+		return
+	}
+	uploadID := created.UploadID
+	defer func() {
+		if rerr == nil {
+			return
+		}
+		// use new context, since ctx could be cancelled
+		_, _, err := s.do(context.Background(), http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, 0, sha256Hex(nil), contentType)
+		if err != nil {
+			rerr = fmt.Errorf("%v, abort of multipart upload also failed: %v", rerr, err)
+		}
+	}()
+
+	var parts []s3Part
+	for offset := int64(0); offset < size; offset += s.partSize {
+		partSize := s.partSize
+		if offset+partSize > size {
+			partSize = size - offset
+		}
+		part := s3Part{PartNumber: len(parts) + 1}
+		h := sha256.New()
+		_, err := io.Copy(h, io.NewSectionReader(f, offset, partSize))
+		if err != nil {
+			rerr = err
+			return
+		}
+		query := url.Values{
+			"partNumber": {strconv.Itoa(part.PartNumber)},
+			"uploadId":   {uploadID},
+		}
+		header, _, err := s.do(ctx, http.MethodPut, key, query, io.NewSectionReader(f, offset, partSize), partSize, hex.EncodeToString(h.Sum(nil)), contentType)
+		if err != nil {
+			rerr = err
+			return
+		}
+		part.ETag = header.Get("ETag")
+		parts = append(parts, part)
+	}
+
+	complete := struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}{Parts: parts}
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		rerr = err
+		return
+	}
+	_, b, err = s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, bytes.NewReader(body), int64(len(body)), sha256Hex(body), "application/xml")
+	if err != nil {
+		rerr = err
+		return
+	}
+	// complete could fail after 200 OK is sent, in that case the body contains an error
+	var res struct {
+		XMLName xml.Name
+	}
+	err = xml.Unmarshal(b, &res)
+	if err != nil {
+		rerr = fmt.Errorf("could not parse s3 complete multipart upload response: %v", err)
+		return
+	}
+	if res.XMLName.Local == "Error" {
+		rerr = fmt.Errorf("s3 complete multipart upload failed, key: %v body: %s", key, b)
+		return
+	}
+	return
+}
+
+// do sends signed request and returns response headers and body. Non 2xx responses are returned as errors.
+func (s *s3Client) do(ctx context.Context, method string, key string, query url.Values, body io.Reader, size int64, payloadHash string, contentType string) (_ http.Header, _ []byte, rerr error) {
+	u, err := s.objectURL(key)
+	if err != nil {
+		rerr = err
+		return
+	}
+	u.RawQuery = s3CanonicalQuery(query)
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		rerr = err
+		return
+	}
+	req = req.WithContext(ctx)
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	req.Header.Set("Content-Type", contentType)
+	s.sign(req, payloadHash)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		rerr = err
+		return
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		rerr = fmt.Errorf("s3 request failed, method: %v key: %v status: %v body: %s", method, key, resp.StatusCode, b)
+		return
+	}
+	if err != nil {
+		rerr = err
+		return
+	}
+	return resp.Header, b, nil
+}
+
+// sign adds aws signature version 4 authorization header
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func (s *s3Client) sign(req *http.Request, payloadHash string) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders := "content-type;host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "content-type:" + req.Header.Get("Content-Type") + "\n" +
+		"host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + s.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.conf.SecretAccessKey), day)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.conf.AccessKeyID+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3CanonicalQuery returns query string sorted by key with keys and values escaped as required for canonical query string in signature. The same string is sent in the request url.
+func s3CanonicalQuery(query url.Values) string {
+	var keys []string
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var res []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			res = append(res, s3Escape(k, false)+"="+s3Escape(v, false))
+		}
+	}
+	return strings.Join(res, "&")
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// s3EscapePath escapes all characters except unreserved ones and the / separator, as required for canonical uri in signature
+func s3EscapePath(p string) string {
+	return s3Escape(p, true)
+}
+
+func s3Escape(p string, keepSlash bool) string {
+	var res strings.Builder
+	for _, b := range []byte(p) {
+		switch {
+		case 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z', '0' <= b && b <= '9', b == '-', b == '_', b == '.', b == '~', keepSlash && b == '/':
+			res.WriteByte(b)
+		default:
+			fmt.Fprintf(&res, "%%%02X", b)
+		}
+	}
+	return res.String()
+}
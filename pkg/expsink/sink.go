@@ -0,0 +1,139 @@
+// Package expsink contains outputs for exported data other than pinpoint backend.
+//
+// Export always writes session files into fsconf.Locs.Uploads. For pinpoint output these are gzip files, which are zipped and uploaded by cmdupload. For local and s3 outputs these are ndjson files, which are published together with a manifest by Publish.
+package expsink
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/pkg/agentconf"
+	"github.com/pinpt/agent/pkg/expsessions"
+)
+
+// ErrNoFilesFound is returned from Publish when export did not write any files
+var ErrNoFilesFound = errors.New("no files found to publish")
+
+// Validate checks that output config has all the required fields
+func Validate(output agentconf.Output) error {
+	switch output.Type {
+	case "", agentconf.OutputTypePinpoint:
+		return nil
+	case agentconf.OutputTypeLocal:
+		if output.Dir == "" {
+			return errors.New("output: dir is required for local output")
+		}
+		return nil
+	case agentconf.OutputTypeS3:
+		c := output.S3
+		if c.Bucket == "" {
+			return errors.New("output: s3 bucket is required")
+		}
+		if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+			return errors.New("output: s3 access_key_id and secret_access_key are required")
+		}
+		return nil
+	default:
+		return fmt.Errorf("output: invalid type %v, expecting pinpoint, local or s3", output.Type)
+	}
+}
+
+// NewWriterFunc returns writer for export sessions based on output type. Call once per export, ndjson file names are prefixed with random id of the export to keep them unique in uploads dir.
+func NewWriterFunc(output agentconf.Output, uploadsDir string) (expsessions.NewWriterFunc, error) {
+	if output.IsPinpoint() {
+		return func(modelName string, id expsessions.ID) expsessions.Writer {
+			return expsessions.NewFileWriter(modelName, uploadsDir, id)
+		}, nil
+	}
+	runID, err := newRunID()
+	if err != nil {
+		return nil, err
+	}
+	return func(modelName string, id expsessions.ID) expsessions.Writer {
+		return expsessions.NewNDJSONWriter(modelName, uploadsDir, runID, id)
+	}, nil
+}
+
+func newRunID() (string, error) {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("could not generate export run id: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ExportName returns the name used for export directory in local output and key prefix in s3
+func ExportName(ts time.Time, jobID string) string {
+	res := ts.UTC().Format("20060102T150405Z")
+	if jobID != "" {
+		res += "-" + jobID
+	}
+	return res
+}
+
+// Sink writes export files to one output type
+type Sink interface {
+	// Publish writes files and the manifest into exportName directory. Manifest must be written last.
+	Publish(ctx context.Context, exportName string, manifest Manifest) error
+}
+
+// NewSink returns sink for output. Pinpoint output has no sink, it is uploaded by cmdupload.
+func NewSink(logger hclog.Logger, output agentconf.Output) (Sink, error) {
+	err := Validate(output)
+	if err != nil {
+		return nil, err
+	}
+	switch output.Type {
+	case agentconf.OutputTypeLocal:
+		return newLocalSink(output.Dir), nil
+	case agentconf.OutputTypeS3:
+		return newS3Sink(logger, output.S3), nil
+	default:
+		return nil, errors.New("pinpoint output is uploaded by cmdupload")
+	}
+}
+
+type PublishOpts struct {
+	Logger hclog.Logger
+	Output agentconf.Output
+	// UploadsDir is the dir containing files written by export
+	UploadsDir string
+	// ExportName is the name of the export directory in output
+	ExportName string
+	// LogFile is included as export.log if set
+	LogFile string
+}
+
+// Publish writes the files from uploads dir and the manifest to configured output. Manifest is written last, so that consumers can rely on all files being available when manifest exists.
+func Publish(ctx context.Context, opts PublishOpts) (res Manifest, rerr error) {
+	sink, err := NewSink(opts.Logger, opts.Output)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	res, err = NewManifest(opts.UploadsDir, opts.ExportName, opts.LogFile)
+	if err != nil {
+		rerr = err
+		return
+	}
+	if len(res.Files) == 0 {
+		rerr = ErrNoFilesFound
+		return
+	}
+
+	err = sink.Publish(ctx, opts.ExportName, res)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	opts.Logger.Info("published export", "type", opts.Output.Type, "name", opts.ExportName, "files", len(res.Files))
+	return
+}
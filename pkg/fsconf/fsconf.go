@@ -24,6 +24,7 @@ type Locs struct {
 	UploadZips        string
 	RipsrcCheckpoints string
 
+	// RipsrcCheckpoints, Backup and files in backup are used by previous versions, migrated into StateDB
 	Backup                  string
 	RipsrcCheckpointsBackup string
 
@@ -34,18 +35,39 @@ type Locs struct {
 	// Special files
 	Config2 string // new config that is populated from enroll, not for manual editing
 
-	// LastProcessedFile stores timestamps or other data to mark last processed objects
+	// SecretsKeyFile contains keys used to seal secrets in config, see secrets.LoadKeyring
+	SecretsKeyFile string
+
+	// StateDB is the state store with last processed, dedup hashes, export queue and ripsrc checkpoints, see kvstore.OpenState
+	StateDB string
+
+	// LastProcessedFile stores timestamps or other data to mark last processed objects. Used by previous versions, migrated into StateDB.
 	LastProcessedFile       string
 	LastProcessedFileBackup string
 
-	// ExportQueueFile stores exports requests
+	// ExportQueueFile stores exports requests. Used by previous versions, migrated into StateDB.
 	ExportQueueFile string
 
-	// DedupFile contains hashes of all objects sent in incrementals to avoid sending the same objects multiple times
+	// DedupFile contains hashes of all objects sent in incrementals to avoid sending the same objects multiple times. Used by previous versions, migrated into StateDB.
 	DedupFile string
 
 	// CleanupDirs are directories that will be removed on every run
 	CleanupDirs []string
+
+	// ExportScheduleFile stores last run times of local export schedules
+	ExportScheduleFile string
+
+	// IntegrationsState contains state dirs of integrations, see ForIntegration
+	IntegrationsState string
+
+	// ExportCheckpointFile stores repos/projects completed in the current export job, used to resume interrupted export
+	ExportCheckpointFile string
+
+	// ExportProgressFile stores progress tree of the running export, served by run service status api
+	ExportProgressFile string
+
+	// Metrics contains metrics written by export and integration processes, served by run service
+	Metrics string
 }
 
 func j(parts ...string) string {
@@ -70,6 +92,7 @@ func New(pinpointRoot string) Locs {
 	s.Root = pinpointRoot
 	s.Temp = j(s.Root, "temp")
 	s.CleanupDirs = append(s.CleanupDirs, s.Temp)
+	s.Metrics = j(s.Temp, "metrics")
 
 	s.Cache = j(s.Root, "cache")
 	s.Logs = j(s.Root, "logs")
@@ -89,14 +112,42 @@ func New(pinpointRoot string) Locs {
 	s.RipsrcCheckpoints = j(s.State, "ripsrc_checkpoints/v3")
 	s.RipsrcCheckpointsBackup = j(s.Backup, "ripsrc_checkpoints/v3")
 
+	s.StateDB = j(s.State, "state.db")
+
 	s.ServiceRunCrashes = j(s.Logs, "service-run-crashes")
 
 	s.IntegrationsDefaultDir = j(s.Root, "integrations")
 
 	s.Config2 = j(s.Root, "config.json")
+	s.SecretsKeyFile = j(s.Root, "secrets.key")
 	s.LastProcessedFile = j(s.State, "last_processed.json")
 	s.LastProcessedFileBackup = j(s.Backup, "last_processed.json")
 	s.ExportQueueFile = j(s.State, "export_queue.json")
 	s.DedupFile = j(s.State, "dedup_v2.json")
+	s.ExportScheduleFile = j(s.State, "export_schedule.json")
+	s.IntegrationsState = j(s.State, "integrations")
+	s.ExportCheckpointFile = j(s.State, "export_checkpoint.json")
+	s.ExportProgressFile = j(s.State, "export_progress.json")
+	return s
+}
+
+// ForIntegration returns locations with separate uploads, state store, export checkpoint and export progress for one integration. State store of integration has separate last processed, dedup, backup and ripsrc checkpoints. Used to run exports of different integrations at the same time. Other locations, including export queue, are shared.
+func (s Locs) ForIntegration(key string) Locs {
+	s.State = j(s.IntegrationsState, key)
+
+	s.Uploads = j(s.State, "uploads")
+	s.UploadZips = j(s.State, "upload-zips")
+	s.Backup = j(s.State, "backup")
+
+	s.RipsrcCheckpoints = j(s.State, "ripsrc_checkpoints/v3")
+	s.RipsrcCheckpointsBackup = j(s.Backup, "ripsrc_checkpoints/v3")
+
+	s.StateDB = j(s.State, "state.db")
+
+	s.LastProcessedFile = j(s.State, "last_processed.json")
+	s.LastProcessedFileBackup = j(s.Backup, "last_processed.json")
+	s.DedupFile = j(s.State, "dedup_v2.json")
+	s.ExportCheckpointFile = j(s.State, "export_checkpoint.json")
+	s.ExportProgressFile = j(s.State, "export_progress.json")
 	return s
 }
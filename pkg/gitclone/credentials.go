@@ -0,0 +1,65 @@
+package gitclone
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Credentials from repo url are passed to git in environment of the command and returned by credentialHelper when git asks for them. This way they are not saved in remote url in repo cache config and are not visible in command arguments.
+const (
+	envGitUsername = "PP_GIT_USERNAME"
+	envGitPassword = "PP_GIT_PASSWORD"
+)
+
+// credentialHelper is a git credential helper printing credentials from environment, only responds to get operation
+const credentialHelper = `!f() { test "$1" = get && echo "username=${` + envGitUsername + `}" && echo "password=${` + envGitPassword + `}"; }; f`
+
+type remote struct {
+	// URL is the repo url without credentials
+	URL      string
+	Username string
+	Password string
+}
+
+func (s remote) hasCredentials() bool {
+	return s.Username != "" || s.Password != ""
+}
+
+// parseRemote splits credentials from http(s) repo url. Other remotes, such as scp-like git@host:org/repo.git, ssh urls or local paths, are returned unchanged, since the user is needed by ssh and credential helper is not used.
+func parseRemote(repoURL string) (res remote, _ error) {
+	lower := strings.ToLower(repoURL)
+	if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+		res.URL = repoURL
+		return
+	}
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return res, err
+	}
+	if u.User == nil {
+		res.URL = repoURL
+		return
+	}
+	res.Username = u.User.Username()
+	res.Password, _ = u.User.Password()
+	u.User = nil
+	res.URL = u.String()
+	return
+}
+
+// gitCommand creates git command with credential helper returning credentials of remote
+func gitCommand(ctx context.Context, r remote, dir string, args ...string) *exec.Cmd {
+	if r.hasCredentials() {
+		// empty helper resets helpers from global config, so credentials are not stored by them
+		args = append([]string{"-c", "credential.helper=", "-c", "credential.helper=" + credentialHelper}, args...)
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	if r.hasCredentials() {
+		cmd.Env = append(os.Environ(), envGitUsername+"="+r.Username, envGitPassword+"="+r.Password)
+	}
+	return cmd
+}
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/pkg/metrics"
 	"github.com/pinpt/go-common/fileutil"
 )
 
@@ -45,11 +46,14 @@ func CloneWithCache(ctx context.Context, logger hclog.Logger, access AccessDetai
 	started := time.Now()
 	logger.Debug("CloneWithCache")
 	defer func() {
-		logger = logger.With("duration", time.Since(started))
+		duration := time.Since(started)
+		logger = logger.With("duration", duration)
 		if rerr != nil {
+			metrics.Observe(metrics.GitCloneDuration, duration.Seconds(), "result", "error")
 			logger.Debug("CloneWithCache failed", "err", rerr)
 			return
 		}
+		metrics.Observe(metrics.GitCloneDuration, duration.Seconds(), "result", "success")
 		logger.Debug("CloneWithCache success")
 	}()
 
@@ -120,12 +124,16 @@ func cloneWithCacheNoRetries(ctx context.Context, logger hclog.Logger, access Ac
 	return
 }
 
+// updateCredentials sets remote url without credentials. Credentials are passed using credential helper on every fetch, see gitCommand. Also removes credentials saved in remote url by previous versions.
 func updateCredentials(ctx context.Context, logger hclog.Logger, access AccessDetails, dirs Dirs, cacheDirName string) error {
 	logger.Debug("updateCredentials")
+	r, err := parseRemote(access.URL)
+	if err != nil {
+		return err
+	}
 	cacheDir := filepath.Join(dirs.CacheRoot, cacheDirName)
-	cmd := exec.CommandContext(ctx, "git", "remote", "set-url", "origin", access.URL)
-	cmd.Dir = cacheDir
-	err := runGitCommand(ctx, logger, cmd)
+	cmd := gitCommand(ctx, remote{}, cacheDir, "remote", "set-url", "origin", r.URL)
+	err = runGitCommand(ctx, logger, cmd)
 	if err != nil {
 		return err
 	}
@@ -135,15 +143,19 @@ func updateCredentials(ctx context.Context, logger hclog.Logger, access AccessDe
 func cloneFreshIntoCache(ctx context.Context, logger hclog.Logger, access AccessDetails, dirs Dirs, cacheDirName string) error {
 	logger.Debug("cloneFreshIntoCache")
 	cloneStarted := time.Now()
+	r, err := parseRemote(access.URL)
+	if err != nil {
+		return err
+	}
 	tempDir := filepath.Join(dirs.CacheRoot, "tmp", cacheDirName)
-	err := os.RemoveAll(tempDir)
+	err = os.RemoveAll(tempDir)
 	if err != nil {
 		return err
 	}
-	args := []string{"clone", "-c", "core.longpaths=true", "--mirror", access.URL, tempDir}
+	args := []string{"clone", "-c", "core.longpaths=true", "--mirror", r.URL, tempDir}
 
-	args = append(args, cloneArgs(access.URL)...)
-	cmd := exec.CommandContext(ctx, "git", args...)
+	args = append(args, cloneArgs(r.URL)...)
+	cmd := gitCommand(ctx, r, "", args...)
 	err = runGitCommand(ctx, logger, cmd)
 	if err != nil {
 		output, err := RedactCredsInText(err.Error(), access.URL)
@@ -153,7 +165,7 @@ func cloneFreshIntoCache(ctx context.Context, logger hclog.Logger, access Access
 		return errors.New(output)
 	}
 	// set the git config, so the further updates would use the same config as initial clone
-	err = setRepoConfig(ctx, logger, access.URL, tempDir)
+	err = setRepoConfig(ctx, logger, r.URL, tempDir)
 	if err != nil {
 		return err
 	}
@@ -170,10 +182,13 @@ func cloneFreshIntoCache(ctx context.Context, logger hclog.Logger, access Access
 
 func updateClonedRepo(ctx context.Context, logger hclog.Logger, access AccessDetails, dirs Dirs, cacheDirName string) error {
 	logger.Debug("updateClonedRepo")
+	r, err := parseRemote(access.URL)
+	if err != nil {
+		return err
+	}
 	cacheDir := filepath.Join(dirs.CacheRoot, cacheDirName)
-	cmd := exec.CommandContext(ctx, "git", "remote", "update", "--prune")
-	cmd.Dir = cacheDir
-	err := runGitCommand(ctx, logger, cmd)
+	cmd := gitCommand(ctx, r, cacheDir, "remote", "update", "--prune")
+	err = runGitCommand(ctx, logger, cmd)
 	if err != nil {
 		return err
 	}
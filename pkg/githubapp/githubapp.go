@@ -0,0 +1,250 @@
+// Package githubapp authenticates as a github app installation. It mints JWTs signed with the app private key and exchanges them for installation access tokens, which are refreshed before expiry.
+package githubapp
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/pkg/requests"
+	pstrings "github.com/pinpt/go-common/strings"
+)
+
+// Config contains github app credentials from integration config
+type Config struct {
+	AppID          string
+	InstallationID string
+	// PrivateKey is the PEM encoded private key generated in github app settings
+	PrivateKey string
+}
+
+// ConfigFromMap returns app config from integration config. ok is false when app_id is not set, which means that the integration uses a personal or oauth token.
+func ConfigFromMap(m map[string]interface{}) (res Config, ok bool, _ error) {
+	res.AppID = configString(m["app_id"])
+	if res.AppID == "" {
+		return res, false, nil
+	}
+	res.InstallationID = configString(m["installation_id"])
+	if res.InstallationID == "" {
+		return res, false, errors.New("missing installation_id for github app")
+	}
+	res.PrivateKey, _ = m["private_key"].(string)
+	if res.PrivateKey == "" {
+		return res, false, errors.New("missing private_key for github app")
+	}
+	return res, true, nil
+}
+
+// configString accepts both strings and numbers, since app and installation ids are numeric
+func configString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	}
+	return ""
+}
+
+// APIURL returns the rest api url for github url from integration config. Same as the url used by github integration.
+func APIURL(githubURL string) (string, error) {
+	u, err := url.Parse(githubURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "github.com" || u.Host == "api.github.com" {
+		return "https://api.github.com", nil
+	}
+	return pstrings.JoinURL(u.String(), "api/v3"), nil
+}
+
+// CloneUser returns credentials for git clone urls using installation token
+func CloneUser(token string) *url.Userinfo {
+	return url.UserPassword("x-access-token", token)
+}
+
+type Opts struct {
+	Logger hclog.Logger
+	Client *http.Client
+	// APIURL is the rest api url, https://api.github.com or https://host/api/v3 for enterprise
+	APIURL string
+	Config Config
+}
+
+// Tokens returns installation access tokens for the app. Safe for concurrent use.
+type Tokens struct {
+	opts Opts
+	key  *rsa.PrivateKey
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+
+	now func() time.Time
+}
+
+// New creates token source for the app installation. Does not make any requests.
+func New(opts Opts) (*Tokens, error) {
+	if opts.Logger == nil || opts.Client == nil || opts.APIURL == "" {
+		panic("provide all opts")
+	}
+	s := &Tokens{}
+	s.opts = opts
+	var err error
+	s.key, err = parsePrivateKey(opts.Config.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid github app private_key: %v", err)
+	}
+	s.now = time.Now
+	return s, nil
+}
+
+func parsePrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("expected PEM encoded key")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err == nil {
+		return key, nil
+	}
+	key2, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	res, ok := key2.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("expected RSA key")
+	}
+	return res, nil
+}
+
+// jwtExpiry is the lifetime of app JWTs, github allows 10 minutes at most
+const jwtExpiry = 9 * time.Minute
+
+// JWT returns token to authenticate as the app itself, signed with RS256
+func (s *Tokens) JWT() (string, error) {
+	now := s.now()
+	header := map[string]string{"alg": "RS256", "typ": "JWT"}
+	claims := map[string]interface{}{
+		// issued in the past to allow for clock drift
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(jwtExpiry).Unix(),
+		"iss": s.opts.Config.AppID,
+	}
+	enc := func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return base64.RawURLEncoding.EncodeToString(b), nil
+	}
+	h, err := enc(header)
+	if err != nil {
+		return "", err
+	}
+	c, err := enc(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := h + "." + c
+	hash := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// refreshBefore is how long before expiry the installation token is replaced, tokens are valid for 1 hour
+const refreshBefore = 5 * time.Minute
+
+// Token returns installation access token, requesting a new one if the cached one expires soon
+func (s *Tokens) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && s.now().Add(refreshBefore).Before(s.expires) {
+		return s.token, nil
+	}
+	var res struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	err := s.appRequest("POST", "access_tokens", &res)
+	if err != nil {
+		return "", fmt.Errorf("could not get github app installation token: %v", err)
+	}
+	if res.Token == "" {
+		return "", errors.New("could not get github app installation token: empty token in response")
+	}
+	s.opts.Logger.Debug("got new github app installation token", "expires", res.ExpiresAt)
+	s.token = res.Token
+	s.expires = res.ExpiresAt
+	return s.token, nil
+}
+
+// Installation contains details of the app installation
+type Installation struct {
+	ID      int64 `json:"id"`
+	Account struct {
+		Login string `json:"login"`
+		// Type is Organization or User
+		Type string `json:"type"`
+	} `json:"account"`
+	// Permissions granted to the installation, for example "contents": "read"
+	Permissions map[string]string `json:"permissions"`
+	// RepositorySelection is all or selected
+	RepositorySelection string `json:"repository_selection"`
+}
+
+// Installation returns details of the installation including granted permissions
+func (s *Tokens) Installation() (res Installation, _ error) {
+	err := s.appRequest("GET", "", &res)
+	if err != nil {
+		return res, fmt.Errorf("could not get github app installation: %v", err)
+	}
+	return res, nil
+}
+
+func (s *Tokens) appRequest(method string, urlPath string, res interface{}) error {
+	token, err := s.JWT()
+	if err != nil {
+		return err
+	}
+	req := requests.NewRequest()
+	req.Method = method
+	req.URL = pstrings.JoinURL(s.opts.APIURL, "app/installations", s.opts.Config.InstallationID)
+	if urlPath != "" {
+		req.URL = pstrings.JoinURL(req.URL, urlPath)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	// required by github enterprise versions where apps api is in preview
+	req.Header.Set("Accept", "application/vnd.github.machine-man-preview+json")
+	_, err = requests.New(s.opts.Logger, s.opts.Client).JSON(req, res)
+	return err
+}
+
+// HasPermission returns true if permission is granted with level or higher. Levels are read, write and admin.
+func (s Installation) HasPermission(name string, level string) bool {
+	levels := map[string]int{"read": 1, "write": 2, "admin": 3}
+	got := levels[strings.ToLower(s.Permissions[name])]
+	return got != 0 && got >= levels[level]
+}
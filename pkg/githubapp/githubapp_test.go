@@ -0,0 +1,109 @@
+package githubapp
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigFromMap(t *testing.T) {
+	_, ok, err := ConfigFromMap(map[string]interface{}{"api_key": "x"})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	res, ok, err := ConfigFromMap(map[string]interface{}{"app_id": float64(12345), "installation_id": "678", "private_key": "key"})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, Config{AppID: "12345", InstallationID: "678", PrivateKey: "key"}, res)
+
+	_, _, err = ConfigFromMap(map[string]interface{}{"app_id": "12345", "installation_id": "678"})
+	assert.Error(t, err)
+}
+
+func TestTokens(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	now := time.Now()
+	issued := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), ".")
+		if len(parts) != 3 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		if rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hash[:], sig) != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		if !strings.Contains(string(claims), `"iss":"12345"`) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/app/installations/678/access_tokens":
+			issued++
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"token":      "tok" + strconv.Itoa(issued),
+				"expires_at": now.Add(time.Hour),
+			})
+		case r.Method == "GET" && r.URL.Path == "/app/installations/678":
+			w.Write([]byte(`{"id":678,"account":{"login":"org1","type":"Organization"},"permissions":{"contents":"read","pull_requests":"write"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tokens, err := New(Opts{
+		Logger: hclog.New(&hclog.LoggerOptions{Name: "test"}),
+		Client: server.Client(),
+		APIURL: server.URL,
+		Config: Config{AppID: "12345", InstallationID: "678", PrivateKey: string(keyPEM)},
+	})
+	assert.NoError(t, err)
+	tokens.now = func() time.Time { return now }
+
+	token, err := tokens.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "tok1", token)
+
+	// cached until shortly before expiry
+	tokens.now = func() time.Time { return now.Add(50 * time.Minute) }
+	token, err = tokens.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "tok1", token)
+
+	tokens.now = func() time.Time { return now.Add(56 * time.Minute) }
+	token, err = tokens.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "tok2", token)
+
+	inst, err := tokens.Installation()
+	assert.NoError(t, err)
+	assert.Equal(t, "org1", inst.Account.Login)
+	assert.True(t, inst.HasPermission("contents", "read"))
+	assert.True(t, inst.HasPermission("pull_requests", "read"))
+	assert.False(t, inst.HasPermission("contents", "write"))
+	assert.False(t, inst.HasPermission("members", "read"))
+}
@@ -1,6 +1,7 @@
 package iloader
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -18,6 +19,7 @@ import (
 	"github.com/pinpt/agent/pkg/expin"
 
 	"github.com/pinpt/agent/pkg/fsconf"
+	"github.com/pinpt/agent/pkg/metrics"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-plugin"
@@ -76,6 +78,17 @@ func (s *Integration) RPCClient() rpcdef.Integration {
 	return s.rpcClient
 }
 
+// Ping checks that the plugin process is still running and responds to rpc calls
+func (s *Integration) Ping() error {
+	if s.closed {
+		return errors.New("integration is closed")
+	}
+	if s.pluginClient.Exited() {
+		return errors.New("integration process exited")
+	}
+	return s.rpcClientGeneric.Ping()
+}
+
 func prodIntegrationCommand(integrationsDir string, integrationName string) (*exec.Cmd, error) {
 	binName := integrationName
 	if runtime.GOOS == "windows" {
@@ -175,6 +188,8 @@ func (s *Integration) setupRPC() error {
 			return err
 		}
 	}
+	// integration writes its metrics into this dir, see ibase.MainFunc
+	cmd.Env = append(os.Environ(), metrics.DirEnv+"="+s.opts.Locs.Metrics)
 
 	client := plugin.NewClient(&plugin.ClientConfig{
 		Stderr:          s.logFile,
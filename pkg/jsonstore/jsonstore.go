@@ -1,36 +1,44 @@
+// Package jsonstore stores last processed values in kvstore.BucketLastProcessed. Values are marshaled to json.
 package jsonstore
 
 import (
-	"bytes"
 	"encoding/json"
-	"io/ioutil"
-	"os"
 	"strings"
 	"sync"
 
-	"github.com/pinpt/agent/pkg/fs"
+	"github.com/pinpt/agent/pkg/kvstore"
 )
 
+// Store keeps last processed values in memory, Set only changes values in memory and Save writes the changes in one transaction
 type Store struct {
-	loc  string
-	data map[string]interface{}
-	mu   sync.RWMutex
+	db      *kvstore.Store
+	data    map[string]interface{}
+	changed map[string]bool
+	mu      sync.RWMutex
 }
 
-func New(loc string) (*Store, error) {
+// New loads last processed values from db
+func New(db *kvstore.Store) (*Store, error) {
 	s := &Store{}
-	s.loc = loc
+	s.db = db
 	s.data = map[string]interface{}{}
+	s.changed = map[string]bool{}
 
-	b, err := ioutil.ReadFile(loc)
+	err := db.View(func(tx *kvstore.Tx) error {
+		return tx.ForEach(kvstore.BucketLastProcessed, "", func(key string, value []byte) error {
+			var v interface{}
+			err := json.Unmarshal(value, &v)
+			if err != nil {
+				return err
+			}
+			s.data[key] = v
+			return nil
+		})
+	})
 	if err != nil {
-		if !os.IsNotExist(err) {
-			return nil, err
-		}
-		return s, nil
+		return nil, err
 	}
-
-	return s, json.Unmarshal(b, &s.data)
+	return s, nil
 }
 
 func keyStr(key ...string) string {
@@ -47,15 +55,29 @@ func (s *Store) Set(val interface{}, key ...string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.data[keyStr(key...)] = val
+	k := keyStr(key...)
+	s.data[k] = val
+	s.changed[k] = true
 	return nil
 }
 
+// Save writes values changed since the previous Save
 func (s *Store) Save() error {
-	b, err := json.Marshal(s.data)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.db.Update(func(tx *kvstore.Tx) error {
+		for k := range s.changed {
+			err := tx.PutJSON(kvstore.BucketLastProcessed, k, s.data[k])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-
-	return fs.WriteToTempAndRename(bytes.NewReader(b), s.loc)
+	s.changed = map[string]bool{}
+	return nil
 }
@@ -0,0 +1,126 @@
+package kvstore
+
+import (
+	"errors"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// metaBackupKey stores the list of buckets saved by Backup
+const metaBackupKey = "backup"
+
+func backupBucket(name string) string {
+	return "backup_" + name
+}
+
+// Backup saves copies of buckets, which can be restored by RestoreBackup if export does not finish. Replaces the previous backup.
+func (s *Store) Backup(buckets ...string) error {
+	return s.Update(func(tx *Tx) error {
+		err := tx.deleteBackup()
+		if err != nil {
+			return err
+		}
+		for _, name := range buckets {
+			err := tx.copyBucket(name, backupBucket(name))
+			if err != nil {
+				return err
+			}
+		}
+		return tx.PutJSON(bucketMeta, metaBackupKey, buckets)
+	})
+}
+
+// HasBackup returns true if backup was saved and not deleted after that
+func (s *Store) HasBackup() (res bool, _ error) {
+	err := s.View(func(tx *Tx) error {
+		b, err := tx.Get(bucketMeta, metaBackupKey)
+		res = b != nil
+		return err
+	})
+	return res, err
+}
+
+// RestoreBackup replaces buckets with copies saved by Backup. Backup is kept, so it could be restored again.
+func (s *Store) RestoreBackup() error {
+	return s.Update(func(tx *Tx) error {
+		var buckets []string
+		found, err := tx.GetJSON(bucketMeta, metaBackupKey, &buckets)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errors.New("no backup to restore")
+		}
+		for _, name := range buckets {
+			err := tx.copyBucket(backupBucket(name), name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteBackup removes the backup, does nothing if it does not exist
+func (s *Store) DeleteBackup() error {
+	return s.Update(func(tx *Tx) error {
+		return tx.deleteBackup()
+	})
+}
+
+func (s *Tx) deleteBackup() error {
+	var buckets []string
+	found, err := s.GetJSON(bucketMeta, metaBackupKey, &buckets)
+	if err != nil || !found {
+		return err
+	}
+	for _, name := range buckets {
+		err := s.tx.DeleteBucket([]byte(backupBucket(name)))
+		if err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+	}
+	return s.Delete(bucketMeta, metaBackupKey)
+}
+
+// copyBucket replaces all data in bucket to with data from bucket from. Bucket from could be missing, in that case to is cleared.
+func (s *Tx) copyBucket(from string, to string) error {
+	err := s.Clear(to)
+	if err != nil {
+		return err
+	}
+	src := s.tx.Bucket([]byte(from))
+	if src == nil {
+		return nil
+	}
+	dst := s.tx.Bucket([]byte(to))
+	err = dst.SetSequence(src.Sequence())
+	if err != nil {
+		return err
+	}
+	return src.ForEach(func(k, v []byte) error {
+		// values point to mmaped data, which could be remapped on commit
+		return dst.Put(append([]byte{}, k...), append([]byte{}, v...))
+	})
+}
+
+// CopyBuckets replaces buckets in dst with data from src
+func CopyBuckets(src *Store, dst *Store, buckets ...string) error {
+	return src.View(func(srcTx *Tx) error {
+		return dst.Update(func(dstTx *Tx) error {
+			for _, name := range buckets {
+				err := dstTx.Clear(name)
+				if err != nil {
+					return err
+				}
+				err = srcTx.ForEach(name, "", func(key string, value []byte) error {
+					return dstTx.Put(name, key, value)
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
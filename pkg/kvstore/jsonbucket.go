@@ -0,0 +1,31 @@
+package kvstore
+
+// JSONBucket saves and marshals larger objects into a bucket. Every Set is committed in a separate transaction.
+// Implements filestore.Store.
+type JSONBucket struct {
+	store  *Store
+	bucket string
+}
+
+// NewJSONBucket creates JSONBucket for bucket in store
+func NewJSONBucket(store *Store, bucket string) *JSONBucket {
+	return &JSONBucket{
+		store:  store,
+		bucket: bucket,
+	}
+}
+
+// Set marshals obj and saves it under key k
+func (s *JSONBucket) Set(k string, obj interface{}) error {
+	return s.store.Update(func(tx *Tx) error {
+		return tx.PutJSON(s.bucket, k, obj)
+	})
+}
+
+// Get unmarshals the value of key k into obj. Does not modify obj if key does not exist.
+func (s *JSONBucket) Get(k string, obj interface{}) error {
+	return s.store.View(func(tx *Tx) error {
+		_, err := tx.GetJSON(s.bucket, k, obj)
+		return err
+	})
+}
@@ -0,0 +1,327 @@
+// Package kvstore is the embedded key-value store for agent state, such as last processed values, dedup hashes, export queue and ripsrc checkpoints. Every kind of state is kept in a separate bucket. Updates are transactional.
+//
+// Run service and export run in separate processes and use the same state dir. The database file is locked while open, so it can't be kept open for the lifetime of the process. Instead it is kept open for lingerTime after the last transaction, so that transactions following each other, such as dedup lookups for every written batch, share the open file. Concurrent transactions in the same process share the open file as well.
+package kvstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Buckets of agent state
+const (
+	// BucketLastProcessed stores timestamps or other data to mark last processed objects, see jsonstore
+	BucketLastProcessed = "last_processed"
+	// BucketDedup stores hashes of all objects sent in incrementals to avoid sending the same objects multiple times
+	BucketDedup = "dedup"
+	// BucketExportQueue stores export requests
+	BucketExportQueue = "export_queue"
+	// BucketRipsrcCheckpoints stores git processing state of repos
+	BucketRipsrcCheckpoints = "ripsrc_checkpoints"
+
+	// bucketMeta stores migration and backup state of the store itself
+	bucketMeta = "meta"
+)
+
+var allBuckets = []string{BucketLastProcessed, BucketDedup, BucketExportQueue, BucketRipsrcCheckpoints, bucketMeta}
+
+// lockTimeout is the time to wait for the other process to finish a transaction
+const lockTimeout = 5 * time.Minute
+
+// lingerTime is the time the database is kept open after the last transaction
+const lingerTime = 500 * time.Millisecond
+
+// maxHoldTime is the time after which the database is closed when the last transaction finishes, even if transactions keep coming. Allows the other process to acquire the lock during long exports.
+const maxHoldTime = 5 * time.Second
+
+// Store is the embedded key-value store. Safe for concurrent use.
+type Store struct {
+	loc string
+
+	mu       sync.Mutex
+	db       *bolt.DB
+	refs     int
+	openedAt time.Time
+	// closeTimer closes db after lingerTime, stopped when a new transaction starts
+	closeTimer *time.Timer
+	// opens is the number of times the database file was opened, used in tests
+	opens int
+}
+
+var (
+	openedMu sync.Mutex
+	opened   = map[string]*Store{}
+)
+
+// Open creates the store at loc if it does not exist. Returns the same instance when called again with the same loc, since the file lock does not allow opening it twice in one process.
+func Open(loc string) (*Store, error) {
+	loc, err := filepath.Abs(loc)
+	if err != nil {
+		return nil, err
+	}
+	openedMu.Lock()
+	defer openedMu.Unlock()
+	if s, ok := opened[loc]; ok {
+		return s, nil
+	}
+	s := &Store{}
+	s.loc = loc
+	err = os.MkdirAll(filepath.Dir(loc), 0755)
+	if err != nil {
+		return nil, err
+	}
+	err = s.Update(func(tx *Tx) error {
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not open state store: %v", err)
+	}
+	opened[loc] = s
+	return s, nil
+}
+
+// Location returns the path of the database file
+func (s *Store) Location() string {
+	return s.loc
+}
+
+func (s *Store) acquire() (*bolt.DB, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closeTimer != nil {
+		s.closeTimer.Stop()
+		s.closeTimer = nil
+	}
+	if s.db == nil {
+		db, err := bolt.Open(s.loc, 0600, &bolt.Options{Timeout: lockTimeout})
+		if err != nil {
+			return nil, err
+		}
+		err = db.Update(func(tx *bolt.Tx) error {
+			for _, name := range allBuckets {
+				_, err := tx.CreateBucketIfNotExists([]byte(name))
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		s.db = db
+		s.openedAt = time.Now()
+		s.opens++
+	}
+	s.refs++
+	return s.db, nil
+}
+
+func (s *Store) release() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refs--
+	if s.refs != 0 {
+		return nil
+	}
+	if time.Since(s.openedAt) >= maxHoldTime {
+		return s.closeLocked()
+	}
+	s.closeTimer = time.AfterFunc(lingerTime, s.closeIdle)
+	return nil
+}
+
+// closeIdle closes the database if no transaction was started during lingerTime. There is no caller to return the error to, but close only fails if the file can't be unlocked, which would also fail the next open.
+func (s *Store) closeIdle() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.refs != 0 || s.db == nil {
+		return
+	}
+	s.closeTimer = nil
+	s.closeLocked()
+}
+
+func (s *Store) closeLocked() error {
+	db := s.db
+	s.db = nil
+	return db.Close()
+}
+
+// Update runs fn in a read-write transaction. Changes are committed if fn returns nil.
+func (s *Store) Update(fn func(tx *Tx) error) (rerr error) {
+	db, err := s.acquire()
+	if err != nil {
+		rerr = err
+		return
+	}
+	defer func() {
+		err := s.release()
+		if err != nil && rerr == nil {
+			rerr = err
+		}
+	}()
+	return db.Update(func(tx *bolt.Tx) error {
+		return fn(&Tx{tx: tx})
+	})
+}
+
+// View runs fn in a read-only transaction
+func (s *Store) View(fn func(tx *Tx) error) (rerr error) {
+	db, err := s.acquire()
+	if err != nil {
+		rerr = err
+		return
+	}
+	defer func() {
+		err := s.release()
+		if err != nil && rerr == nil {
+			rerr = err
+		}
+	}()
+	return db.View(func(tx *bolt.Tx) error {
+		return fn(&Tx{tx: tx})
+	})
+}
+
+// Tx is a transaction. Values returned by Tx are safe to use after the transaction.
+type Tx struct {
+	tx *bolt.Tx
+}
+
+func (s *Tx) bucket(name string) (*bolt.Bucket, error) {
+	b := s.tx.Bucket([]byte(name))
+	if b == nil {
+		return nil, fmt.Errorf("bucket does not exist: %v", name)
+	}
+	return b, nil
+}
+
+// Get returns the value of key or nil if it does not exist
+func (s *Tx) Get(bucket string, key string) ([]byte, error) {
+	b, err := s.bucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+	v := b.Get([]byte(key))
+	if v == nil {
+		return nil, nil
+	}
+	return append([]byte{}, v...), nil
+}
+
+// Put sets the value of key
+func (s *Tx) Put(bucket string, key string, value []byte) error {
+	b, err := s.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), value)
+}
+
+// Delete removes key, does nothing if it does not exist
+func (s *Tx) Delete(bucket string, key string) error {
+	b, err := s.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	return b.Delete([]byte(key))
+}
+
+// GetJSON unmarshals the value of key into obj. Returns false if key does not exist.
+func (s *Tx) GetJSON(bucket string, key string, obj interface{}) (found bool, _ error) {
+	b, err := s.Get(bucket, key)
+	if err != nil || b == nil {
+		return false, err
+	}
+	return true, json.Unmarshal(b, obj)
+}
+
+// PutJSON sets the value of key to marshaled obj
+func (s *Tx) PutJSON(bucket string, key string, obj interface{}) error {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return s.Put(bucket, key, b)
+}
+
+// ForEach calls fn for all keys in bucket in sorted order. Keys with prefix are returned if prefix is not empty.
+func (s *Tx) ForEach(bucket string, prefix string, fn func(key string, value []byte) error) error {
+	b, err := s.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	c := b.Cursor()
+	for k, v := c.Seek([]byte(prefix)); k != nil && hasPrefix(k, prefix); k, v = c.Next() {
+		err := fn(string(k), append([]byte{}, v...))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasPrefix(k []byte, prefix string) bool {
+	return len(k) >= len(prefix) && string(k[:len(prefix)]) == prefix
+}
+
+// DeletePrefix removes all keys with prefix, all keys in bucket if prefix is empty
+func (s *Tx) DeletePrefix(bucket string, prefix string) error {
+	if prefix == "" {
+		return s.Clear(bucket)
+	}
+	var keys []string
+	err := s.ForEach(bucket, prefix, func(key string, value []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		err := s.Delete(bucket, k)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Clear removes all keys in bucket
+func (s *Tx) Clear(bucket string) error {
+	err := s.tx.DeleteBucket([]byte(bucket))
+	if err != nil && err != bolt.ErrBucketNotFound {
+		return err
+	}
+	_, err = s.tx.CreateBucket([]byte(bucket))
+	return err
+}
+
+// NextSequence returns an autoincrementing integer for bucket
+func (s *Tx) NextSequence(bucket string) (uint64, error) {
+	b, err := s.bucket(bucket)
+	if err != nil {
+		return 0, err
+	}
+	return b.NextSequence()
+}
+
+// SetSequence updates the sequence number for bucket, used when importing keys created with NextSequence
+func (s *Tx) SetSequence(bucket string, v uint64) error {
+	b, err := s.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	if v <= b.Sequence() {
+		return nil
+	}
+	return b.SetSequence(v)
+}
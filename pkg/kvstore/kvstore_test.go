@@ -0,0 +1,200 @@
+package kvstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/pkg/fs"
+	"github.com/pinpt/agent/pkg/fsconf"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "kvstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func get(t *testing.T, s *Store, bucket string, key string) (res string) {
+	err := s.View(func(tx *Tx) error {
+		b, err := tx.Get(bucket, key)
+		res = string(b)
+		return err
+	})
+	assert.NoError(t, err)
+	return
+}
+
+func TestUpdateRollback(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	s, err := Open(filepath.Join(dir, "state.db"))
+	assert.NoError(err)
+	assert.NoError(s.Update(func(tx *Tx) error {
+		return tx.Put(BucketLastProcessed, "k1", []byte("v1"))
+	}))
+	err = s.Update(func(tx *Tx) error {
+		err := tx.Put(BucketLastProcessed, "k1", []byte("v2"))
+		if err != nil {
+			return err
+		}
+		return os.ErrInvalid
+	})
+	assert.Equal(os.ErrInvalid, err)
+	assert.Equal("v1", get(t, s, BucketLastProcessed, "k1"))
+
+	// same instance is returned for the same file
+	s2, err := Open(filepath.Join(dir, ".", "state.db"))
+	assert.NoError(err)
+	assert.True(s == s2)
+}
+
+func TestTransactionsShareOpenFile(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	loc := filepath.Join(dir, "state.db")
+	s, err := Open(loc)
+	assert.NoError(err)
+	opens := s.opens
+	for i := 0; i < 10; i++ {
+		assert.NoError(s.Update(func(tx *Tx) error {
+			return tx.Put(BucketDedup, "k1", []byte("v1"))
+		}))
+		assert.Equal("v1", get(t, s, BucketDedup, "k1"))
+	}
+	assert.Equal(opens, s.opens, "file is kept open between transactions")
+
+	// file is closed after lingerTime, so that other process can open it
+	time.Sleep(2 * lingerTime)
+	db, err := bolt.Open(loc, 0600, &bolt.Options{Timeout: 100 * time.Millisecond})
+	if assert.NoError(err) {
+		assert.NoError(db.Close())
+	}
+	assert.Equal("v1", get(t, s, BucketDedup, "k1"))
+	assert.Equal(opens+1, s.opens)
+}
+
+func TestDeletePrefix(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	s, err := Open(filepath.Join(dir, "state.db"))
+	assert.NoError(err)
+	assert.NoError(s.Update(func(tx *Tx) error {
+		for _, k := range []string{"a@1", "a@2", "ab@1", "b@1"} {
+			err := tx.Put(BucketDedup, k, []byte("h"))
+			if err != nil {
+				return err
+			}
+		}
+		return tx.DeletePrefix(BucketDedup, "a@")
+	}))
+	var keys []string
+	assert.NoError(s.View(func(tx *Tx) error {
+		return tx.ForEach(BucketDedup, "", func(key string, value []byte) error {
+			keys = append(keys, key)
+			return nil
+		})
+	}))
+	assert.Equal([]string{"ab@1", "b@1"}, keys)
+}
+
+func TestBackupRestore(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	s, err := Open(filepath.Join(dir, "state.db"))
+	assert.NoError(err)
+	put := func(v string) {
+		assert.NoError(s.Update(func(tx *Tx) error {
+			return tx.Put(BucketLastProcessed, "k1", []byte(v))
+		}))
+	}
+	put("v1")
+
+	ok, err := s.HasBackup()
+	assert.NoError(err)
+	assert.False(ok)
+
+	assert.NoError(s.Backup(BucketLastProcessed))
+	put("v2")
+	ok, err = s.HasBackup()
+	assert.NoError(err)
+	assert.True(ok)
+
+	assert.NoError(s.RestoreBackup())
+	assert.Equal("v1", get(t, s, BucketLastProcessed, "k1"))
+	// backup is kept after restore
+	put("v3")
+	assert.NoError(s.RestoreBackup())
+	assert.Equal("v1", get(t, s, BucketLastProcessed, "k1"))
+
+	assert.NoError(s.DeleteBackup())
+	ok, err = s.HasBackup()
+	assert.NoError(err)
+	assert.False(ok)
+}
+
+func TestOpenStateMigrateFiles(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	locs := fsconf.New(dir)
+	write := func(loc string, data string) {
+		assert.NoError(os.MkdirAll(filepath.Dir(loc), 0777))
+		assert.NoError(ioutil.WriteFile(loc, []byte(data), 0666))
+	}
+	write(locs.LastProcessedFile, `{"github@i1":"2020-01-01T00:00:00Z"}`)
+	write(locs.DedupFile, `{"github":{"sourcecode.Commit":{"id1":"h1"}}}`)
+	write(locs.ExportQueueFile, `{"3":{"job_id":"j3"}}`)
+	write(filepath.Join(locs.RipsrcCheckpoints, "r1"), `{"v":1}`)
+	write(locs.LastProcessedFileBackup, `{"github@i1":"2019-01-01T00:00:00Z"}`)
+
+	logger := hclog.New(&hclog.LoggerOptions{Name: "test"})
+	s, err := OpenState(logger, locs)
+	assert.NoError(err)
+
+	assert.Equal(`"2020-01-01T00:00:00Z"`, get(t, s, BucketLastProcessed, "github@i1"))
+	assert.Equal("h1", get(t, s, BucketDedup, DedupKey("github", "sourcecode.Commit", "id1")))
+	assert.Equal(`{"job_id":"j3"}`, get(t, s, BucketExportQueue, ExportQueueKey(3)))
+	assert.Equal(`{"v":1}`, get(t, s, BucketRipsrcCheckpoints, "r1"))
+
+	assert.NoError(s.Update(func(tx *Tx) error {
+		// ids of new requests continue after migrated ones
+		id, err := tx.NextSequence(BucketExportQueue)
+		assert.Equal(uint64(4), id)
+		return err
+	}))
+
+	for _, loc := range []string{locs.LastProcessedFile, locs.DedupFile, locs.ExportQueueFile, locs.RipsrcCheckpoints, locs.Backup} {
+		exists, err := fs.Exists(loc)
+		assert.NoError(err)
+		assert.False(exists, loc)
+	}
+
+	ok, err := s.HasBackup()
+	assert.NoError(err)
+	assert.True(ok)
+	assert.NoError(s.RestoreBackup())
+	assert.Equal(`"2019-01-01T00:00:00Z"`, get(t, s, BucketLastProcessed, "github@i1"))
+
+	// files written by previous version after migration are ignored
+	write(locs.LastProcessedFile, `{"github@i1":"2021-01-01T00:00:00Z"}`)
+	_, err = OpenState(logger, locs)
+	assert.NoError(err)
+	assert.Equal(`"2019-01-01T00:00:00Z"`, get(t, s, BucketLastProcessed, "github@i1"))
+}
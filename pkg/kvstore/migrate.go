@@ -0,0 +1,220 @@
+package kvstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/pkg/fs"
+	"github.com/pinpt/agent/pkg/fsconf"
+)
+
+// metaMigratedKey is set when state files of previous versions were imported
+const metaMigratedKey = "migrated_files"
+
+// OpenState opens the state store of locs. On first open, state saved in json files by previous versions is imported and the files are deleted.
+func OpenState(logger hclog.Logger, locs fsconf.Locs) (*Store, error) {
+	s, err := Open(locs.StateDB)
+	if err != nil {
+		return nil, err
+	}
+	err = s.migrateFiles(logger, locs)
+	if err != nil {
+		return nil, fmt.Errorf("could not migrate state files: %v", err)
+	}
+	return s, nil
+}
+
+// DedupKey returns the key of object hashcode in BucketDedup
+func DedupKey(refType string, modelName string, id string) string {
+	return refType + "@" + modelName + "@" + id
+}
+
+// ExportQueueKey returns the key of request in BucketExportQueue. Keys are padded so that they are sorted in the order requests were added.
+func ExportQueueKey(id uint64) string {
+	return fmt.Sprintf("%020d", id)
+}
+
+func (s *Store) migrateFiles(logger hclog.Logger, locs fsconf.Locs) error {
+	migrated := false
+	err := s.View(func(tx *Tx) error {
+		b, err := tx.Get(bucketMeta, metaMigratedKey)
+		migrated = b != nil
+		return err
+	})
+	if err != nil || migrated {
+		return err
+	}
+
+	var remove []string
+	err = s.Update(func(tx *Tx) error {
+		// checked again, other process could have migrated the files
+		b, err := tx.Get(bucketMeta, metaMigratedKey)
+		if err != nil || b != nil {
+			return err
+		}
+		remove = nil
+		importFile := func(loc string, fn func(b []byte) error) error {
+			b, err := ioutil.ReadFile(loc)
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			logger.Info("migrating state file into state store", "file", loc)
+			remove = append(remove, loc)
+			return fn(b)
+		}
+		importLastProcessed := func(loc string, bucket string) error {
+			return importFile(loc, func(b []byte) error {
+				var data map[string]json.RawMessage
+				err := json.Unmarshal(b, &data)
+				if err != nil {
+					return err
+				}
+				for k, v := range data {
+					err := tx.Put(bucket, k, v)
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		}
+		importRipsrcCheckpoints := func(dir string, bucket string) error {
+			return filepath.Walk(dir, func(loc string, info os.FileInfo, err error) error {
+				if err != nil {
+					if os.IsNotExist(err) && loc == dir {
+						return nil
+					}
+					return err
+				}
+				if loc == dir {
+					remove = append(remove, dir)
+				}
+				if info.IsDir() {
+					return nil
+				}
+				rel, err := filepath.Rel(dir, loc)
+				if err != nil {
+					return err
+				}
+				b, err := ioutil.ReadFile(loc)
+				if err != nil {
+					return err
+				}
+				return tx.Put(bucket, filepath.ToSlash(rel), b)
+			})
+		}
+
+		err = importLastProcessed(locs.LastProcessedFile, BucketLastProcessed)
+		if err != nil {
+			return err
+		}
+		err = importRipsrcCheckpoints(locs.RipsrcCheckpoints, BucketRipsrcCheckpoints)
+		if err != nil {
+			return err
+		}
+		err = importFile(locs.DedupFile, func(b []byte) error {
+			// map[ref_type][model_name][id][data_hashcode]
+			var data map[string]map[string]map[string]string
+			err := json.Unmarshal(b, &data)
+			if err != nil {
+				return err
+			}
+			for refType, models := range data {
+				for modelName, objs := range models {
+					for id, hashcode := range objs {
+						err := tx.Put(BucketDedup, DedupKey(refType, modelName, id), []byte(hashcode))
+						if err != nil {
+							return err
+						}
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// export queue is shared by integrations, only migrate it into the store of the main state dir, see fsconf.Locs.ForIntegration
+		if filepath.Dir(locs.ExportQueueFile) == locs.State {
+			err = importFile(locs.ExportQueueFile, func(b []byte) error {
+				var data map[string]json.RawMessage
+				err := json.Unmarshal(b, &data)
+				if err != nil {
+					return err
+				}
+				for k, v := range data {
+					id, err := strconv.ParseUint(k, 10, 64)
+					if err != nil {
+						return err
+					}
+					err = tx.Put(BucketExportQueue, ExportQueueKey(id), v)
+					if err != nil {
+						return err
+					}
+					err = tx.SetSequence(BucketExportQueue, id)
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		// backup of the export that did not finish
+		backupExists, err := fs.Exists(locs.Backup)
+		if err != nil {
+			return err
+		}
+		if backupExists {
+			buckets := []string{BucketLastProcessed, BucketRipsrcCheckpoints}
+			for _, name := range buckets {
+				err := tx.Clear(backupBucket(name))
+				if err != nil {
+					return err
+				}
+			}
+			err = importLastProcessed(locs.LastProcessedFileBackup, backupBucket(BucketLastProcessed))
+			if err != nil {
+				return err
+			}
+			err = importRipsrcCheckpoints(locs.RipsrcCheckpointsBackup, backupBucket(BucketRipsrcCheckpoints))
+			if err != nil {
+				return err
+			}
+			err = tx.PutJSON(bucketMeta, metaBackupKey, buckets)
+			if err != nil {
+				return err
+			}
+			remove = append(remove, locs.Backup)
+		}
+
+		return tx.Put(bucketMeta, metaMigratedKey, []byte("1"))
+	})
+	if err != nil {
+		return err
+	}
+
+	// files are only removed after import was committed
+	for _, loc := range remove {
+		err := os.RemoveAll(loc)
+		if err != nil {
+			return err
+		}
+	}
+	if len(remove) != 0 {
+		logger.Info("migrated state files into state store", "store", s.loc, "files", strings.Join(remove, ", "))
+	}
+	return nil
+}
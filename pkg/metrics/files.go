@@ -0,0 +1,176 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	ps "github.com/mitchellh/go-ps"
+	"github.com/pinpt/agent/pkg/fs"
+)
+
+// DirEnv is the environment variable with the metrics dir, set for integration plugins started by the agent
+const DirEnv = "PP_AGENT_METRICS_DIR"
+
+// WriteFile writes samples of Default registry into the file of the current process in dir
+func WriteFile(dir string) error {
+	err := os.MkdirAll(dir, 0777)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(Default.Samples())
+	if err != nil {
+		return err
+	}
+	loc := filepath.Join(dir, strconv.Itoa(os.Getpid())+".json")
+	return fs.WriteToTempAndRename(bytes.NewReader(b), loc)
+}
+
+// StartWriter periodically writes metrics of the current process into dir until ctx is cancelled. Call WriteFile before exiting to also write the last changes.
+func StartWriter(ctx context.Context, logger hclog.Logger, dir string, period time.Duration) {
+	ticker := time.NewTicker(period)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := WriteFile(dir)
+				if err != nil {
+					logger.Warn("could not write metrics", "err", err)
+				}
+			}
+		}
+	}()
+}
+
+// isProcessRunning is a var to allow replacing it in tests
+var isProcessRunning = func(pid int) bool {
+	p, err := ps.FindProcess(pid)
+	return err == nil && p != nil
+}
+
+// Collector merges metrics of the current process with metrics written by other processes into dir. Files of processes that exited are added to the registry and deleted, so that counters are kept without files piling up.
+type Collector struct {
+	logger   hclog.Logger
+	dir      string
+	registry *Registry
+
+	mu sync.Mutex
+}
+
+// NewCollector creates a collector for metrics of registry and processes writing into dir
+func NewCollector(logger hclog.Logger, dir string, registry *Registry) *Collector {
+	s := &Collector{}
+	s.logger = logger
+	s.dir = dir
+	s.registry = registry
+	return s
+}
+
+// Gather returns merged samples sorted by name and labels
+func (s *Collector) Gather() ([]Sample, error) {
+	running, err := s.mergeFiles()
+	if err != nil {
+		return nil, err
+	}
+	running.Merge(s.registry.Samples(), true)
+	return running.Samples(), nil
+}
+
+// MergeExited adds files of processes that exited to the registry and deletes them
+func (s *Collector) MergeExited() error {
+	_, err := s.mergeFiles()
+	return err
+}
+
+// StartMerger periodically calls MergeExited until ctx is cancelled, so that files of exited processes do not pile up when metrics are not requested.
+func (s *Collector) StartMerger(ctx context.Context, period time.Duration) {
+	ticker := time.NewTicker(period)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := s.MergeExited()
+				if err != nil {
+					s.logger.Warn("could not merge metrics files", "err", err)
+				}
+			}
+		}
+	}()
+}
+
+// mergeFiles merges files of exited processes into registry and returns samples of running processes
+func (s *Collector) mergeFiles() (*Registry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	running := NewRegistry()
+	for _, f := range files {
+		name := f.Name()
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		pid, err := strconv.Atoi(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			continue
+		}
+		loc := filepath.Join(s.dir, name)
+		samples, err := readFile(loc)
+		if err != nil {
+			s.logger.Warn("could not read metrics file", "file", loc, "err", err)
+			continue
+		}
+		if isProcessRunning(pid) {
+			running.Merge(samples, true)
+			continue
+		}
+		s.registry.Merge(samples, false)
+		err = os.Remove(loc)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return running, nil
+}
+
+func readFile(loc string) (res []Sample, _ error) {
+	b, err := ioutil.ReadFile(loc)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, &res)
+	return res, err
+}
+
+// ServeHTTP writes gathered metrics in prometheus text format
+func (s *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	samples, err := s.Gather()
+	if err != nil {
+		s.logger.Error("could not gather metrics", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	err = WriteText(w, samples)
+	if err != nil {
+		s.logger.Warn("could not write metrics response", "err", err)
+	}
+}
@@ -0,0 +1,182 @@
+// Package metrics collects operational metrics of the agent and serves them in prometheus text format.
+//
+// Exports and integrations run in separate processes. Every process records metrics into Default registry and periodically writes them into its own file in the metrics dir, see StartWriter. The run service merges these files with its own metrics when serving /metrics, see Collector.
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Type is the prometheus metric type
+type Type string
+
+// Metric types
+const (
+	TypeCounter Type = "counter"
+	TypeGauge   Type = "gauge"
+	// TypeSummary only exposes _sum and _count, without quantiles
+	TypeSummary Type = "summary"
+)
+
+// Desc describes a metric. All metrics are defined in this package, so that all processes use the same names and types.
+type Desc struct {
+	Name string
+	Help string
+	Type Type
+}
+
+// Metrics recorded by the agent
+var (
+	// ExportDuration is recorded by the run service for every integration export, labels: integration, result
+	ExportDuration = Desc{"pinpoint_agent_export_duration_seconds", "Duration of integration exports.", TypeSummary}
+	// ExportLastSuccess is the time of the last successful export, labels: integration
+	ExportLastSuccess = Desc{"pinpoint_agent_export_last_success_timestamp_seconds", "Unix time of the last successful integration export.", TypeGauge}
+	// ExportQueueDepth is the number of export requests that are queued or running
+	ExportQueueDepth = Desc{"pinpoint_agent_export_queue_depth", "Number of export requests queued or in progress.", TypeGauge}
+	// HTTPRequests is recorded by reqstats, labels: host, code
+	HTTPRequests = Desc{"pinpoint_agent_http_requests_total", "HTTP requests made by integrations. Code is error if request failed without response.", TypeCounter}
+	// HTTPRequestDuration is recorded by reqstats, labels: host
+	HTTPRequestDuration = Desc{"pinpoint_agent_http_request_duration_seconds", "Latency of HTTP requests made by integrations.", TypeSummary}
+	// RateLimitWaits is the number of times integration paused because of rate limits, labels: integration
+	RateLimitWaits = Desc{"pinpoint_agent_rate_limit_waits_total", "Number of pauses due to integration api rate limits.", TypeCounter}
+	// RateLimitWaitSeconds is the total requested pause duration, labels: integration
+	RateLimitWaitSeconds = Desc{"pinpoint_agent_rate_limit_wait_seconds_total", "Requested pause duration due to integration api rate limits.", TypeCounter}
+	// GitCloneDuration is recorded by gitclone, labels: result
+	GitCloneDuration = Desc{"pinpoint_agent_git_clone_duration_seconds", "Duration of git clone or update of cached repos, including retries.", TypeSummary}
+	// UploadBytes is the size of export data uploaded to pinpoint
+	UploadBytes = Desc{"pinpoint_agent_upload_bytes_total", "Bytes of export data uploaded to pinpoint.", TypeCounter}
+	// PluginCrashes is the number of integration panics, labels: integration
+	PluginCrashes = Desc{"pinpoint_agent_plugin_crashes_total", "Number of integration plugin crashes.", TypeCounter}
+)
+
+// Default is the registry used by package level functions
+var Default = NewRegistry()
+
+// Add increments counter or gauge by v. Labels are passed as key value pairs.
+func Add(d Desc, v float64, labels ...string) {
+	Default.Add(d, v, labels...)
+}
+
+// Set sets the value of a gauge
+func Set(d Desc, v float64, labels ...string) {
+	Default.Set(d, v, labels...)
+}
+
+// Observe adds v to summary
+func Observe(d Desc, v float64, labels ...string) {
+	Default.Observe(d, v, labels...)
+}
+
+// Sample is the current value of one metric with a specific set of labels
+type Sample struct {
+	Name   string            `json:"name"`
+	Help   string            `json:"help"`
+	Type   Type              `json:"type"`
+	Labels map[string]string `json:"labels"`
+	// Value of counter or gauge
+	Value float64 `json:"value"`
+	// Sum and Count of summary
+	Sum   float64 `json:"sum"`
+	Count float64 `json:"count"`
+}
+
+func (s Sample) key() string {
+	var keys []string
+	for k := range s.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	res := []string{s.Name}
+	for _, k := range keys {
+		res = append(res, k+"="+s.Labels[k])
+	}
+	return strings.Join(res, "\x00")
+}
+
+// Registry stores metric samples of one process
+type Registry struct {
+	mu      sync.Mutex
+	samples map[string]*Sample
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{samples: map[string]*Sample{}}
+}
+
+func (s *Registry) sample(d Desc, labels []string) *Sample {
+	if len(labels)%2 != 0 {
+		panic("metrics: labels must be key value pairs")
+	}
+	sample := Sample{Name: d.Name, Help: d.Help, Type: d.Type, Labels: map[string]string{}}
+	for i := 0; i < len(labels); i += 2 {
+		sample.Labels[labels[i]] = labels[i+1]
+	}
+	key := sample.key()
+	res := s.samples[key]
+	if res == nil {
+		res = &sample
+		s.samples[key] = res
+	}
+	return res
+}
+
+// Add increments counter or gauge by v
+func (s *Registry) Add(d Desc, v float64, labels ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sample(d, labels).Value += v
+}
+
+// Set sets the value of a gauge
+func (s *Registry) Set(d Desc, v float64, labels ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sample(d, labels).Value = v
+}
+
+// Observe adds v to summary
+func (s *Registry) Observe(d Desc, v float64, labels ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sample := s.sample(d, labels)
+	sample.Sum += v
+	sample.Count++
+}
+
+// Merge adds samples recorded by other process. Gauges are skipped unless withGauges is set, since they are not valid after the process exits.
+func (s *Registry) Merge(samples []Sample, withGauges bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sample := range samples {
+		if sample.Type == TypeGauge && !withGauges {
+			continue
+		}
+		key := sample.key()
+		res := s.samples[key]
+		if res == nil {
+			res = &Sample{Name: sample.Name, Help: sample.Help, Type: sample.Type, Labels: sample.Labels}
+			s.samples[key] = res
+		}
+		res.Value += sample.Value
+		res.Sum += sample.Sum
+		res.Count += sample.Count
+	}
+}
+
+// Samples returns a copy of all samples sorted by name and labels
+func (s *Registry) Samples() (res []Sample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for k := range s.samples {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		res = append(res, *s.samples[k])
+	}
+	return
+}
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+var testCounter = Desc{"test_requests_total", "Test requests.", TypeCounter}
+var testGauge = Desc{"test_depth", "Test depth.", TypeGauge}
+var testSummary = Desc{"test_duration_seconds", "Test duration.", TypeSummary}
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	r.Add(testCounter, 1, "host", "a", "code", "200")
+	r.Add(testCounter, 2, "host", "a", "code", "200")
+	r.Add(testCounter, 1, "host", `b"`, "code", "500")
+	r.Set(testGauge, 3)
+	r.Observe(testSummary, 1.5)
+	r.Observe(testSummary, 0.5)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, WriteText(buf, r.Samples()))
+	want := `# HELP test_depth Test depth.
+# TYPE test_depth gauge
+test_depth 3
+# HELP test_duration_seconds Test duration.
+# TYPE test_duration_seconds summary
+test_duration_seconds_sum 2
+test_duration_seconds_count 2
+# HELP test_requests_total Test requests.
+# TYPE test_requests_total counter
+test_requests_total{code="200",host="a"} 3
+test_requests_total{code="500",host="b\""} 1
+`
+	assert.Equal(t, want, buf.String())
+}
+
+func TestCollectorMergesProcessFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	running := map[int]bool{10: true}
+	prevIsProcessRunning := isProcessRunning
+	isProcessRunning = func(pid int) bool {
+		return running[pid]
+	}
+	defer func() {
+		isProcessRunning = prevIsProcessRunning
+	}()
+
+	writeSamples := func(pid int, r *Registry) {
+		b, err := json.Marshal(r.Samples())
+		assert.NoError(t, err)
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, strconv.Itoa(pid)+".json"), b, 0666))
+	}
+	p1 := NewRegistry()
+	p1.Add(testCounter, 1)
+	p1.Set(testGauge, 5)
+	writeSamples(10, p1)
+	p2 := NewRegistry()
+	p2.Add(testCounter, 2)
+	p2.Set(testGauge, 7)
+	writeSamples(11, p2)
+
+	service := NewRegistry()
+	service.Add(testCounter, 4)
+	c := NewCollector(hclog.New(&hclog.LoggerOptions{Name: "test"}), dir, service)
+
+	samples, err := c.Gather()
+	assert.NoError(t, err)
+	assert.Len(t, samples, 2)
+	assert.Equal(t, float64(5), samples[0].Value, "gauge of exited process is skipped")
+	assert.Equal(t, float64(7), samples[1].Value)
+
+	// file of exited process is merged into service registry
+	_, err = os.Stat(filepath.Join(dir, "11.json"))
+	assert.True(t, os.IsNotExist(err))
+	running[10] = false
+	samples, err = c.Gather()
+	assert.NoError(t, err)
+	assert.Len(t, samples, 1)
+	assert.Equal(t, float64(7), samples[0].Value)
+}
+
+func TestCollectorMergeExited(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	prevIsProcessRunning := isProcessRunning
+	isProcessRunning = func(pid int) bool {
+		return pid == 10
+	}
+	defer func() {
+		isProcessRunning = prevIsProcessRunning
+	}()
+
+	for _, pid := range []int{10, 11} {
+		r := NewRegistry()
+		r.Add(testCounter, 2)
+		b, err := json.Marshal(r.Samples())
+		assert.NoError(t, err)
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, strconv.Itoa(pid)+".json"), b, 0666))
+	}
+
+	service := NewRegistry()
+	c := NewCollector(hclog.New(&hclog.LoggerOptions{Name: "test"}), dir, service)
+	assert.NoError(t, c.MergeExited())
+
+	_, err = os.Stat(filepath.Join(dir, "10.json"))
+	assert.NoError(t, err, "file of running process is kept")
+	_, err = os.Stat(filepath.Join(dir, "11.json"))
+	assert.True(t, os.IsNotExist(err))
+	samples := service.Samples()
+	assert.Len(t, samples, 1)
+	assert.Equal(t, float64(2), samples[0].Value)
+}
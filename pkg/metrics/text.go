@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WriteText writes samples in prometheus text exposition format. Samples must be sorted by name.
+func WriteText(w io.Writer, samples []Sample) error {
+	bw := bufio.NewWriter(w)
+	prev := ""
+	for _, s := range samples {
+		if s.Name != prev {
+			prev = s.Name
+			bw.WriteString("# HELP " + s.Name + " " + escapeHelp(s.Help) + "\n")
+			bw.WriteString("# TYPE " + s.Name + " " + string(s.Type) + "\n")
+		}
+		labels := formatLabels(s.Labels)
+		if s.Type == TypeSummary {
+			bw.WriteString(s.Name + "_sum" + labels + " " + formatValue(s.Sum) + "\n")
+			bw.WriteString(s.Name + "_count" + labels + " " + formatValue(s.Count) + "\n")
+			continue
+		}
+		bw.WriteString(s.Name + labels + " " + formatValue(s.Value) + "\n")
+	}
+	return bw.Flush()
+}
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var keys []string
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var res []string
+	for _, k := range keys {
+		res = append(res, k+`="`+escapeLabel(labels[k])+`"`)
+	}
+	return "{" + strings.Join(res, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeHelp(v string) string {
+	return helpReplacer.Replace(v)
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabel(v string) string {
+	return labelReplacer.Replace(v)
+}
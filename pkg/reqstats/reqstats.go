@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/go-hclog"
+	"github.com/pinpt/agent/pkg/metrics"
 	"github.com/pinpt/go-common/httpdefaults"
 )
 
@@ -102,11 +104,15 @@ func (s *ClientManager) wrapRoundTripper(rt http.RoundTripper) http.RoundTripper
 		}
 		//l.Debug("req start")
 		res, err := rt.RoundTrip(req)
-		sec := fmt.Sprintf("%.1f", time.Since(start).Seconds())
+		duration := time.Since(start)
+		metrics.Observe(metrics.HTTPRequestDuration, duration.Seconds(), "host", req.URL.Host)
+		sec := fmt.Sprintf("%.1f", duration.Seconds())
 		if err != nil {
+			metrics.Add(metrics.HTTPRequests, 1, "host", req.URL.Host, "code", "error")
 			l.Debug("req end with err", "err", err, "sec", sec)
 			return res, err
 		}
+		metrics.Add(metrics.HTTPRequests, 1, "host", req.URL.Host, "code", strconv.Itoa(res.StatusCode))
 		//l.Debug("req end", "code", res.StatusCode, "sec", sec)
 		return res, err
 	}
@@ -253,7 +253,10 @@ func (opts Requests) JSON(
 	if req.Header == nil {
 		req.Header = http.Header{}
 	}
-	req.Header.Set("Accept", "application/json")
+	// keep accept header if set, some apis use it for versioning
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json")
+	}
 	req.Header.Set("Content-Type", "application/json")
 
 	var err error
@@ -0,0 +1,152 @@
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pinpt/agent/pkg/encrypt"
+	"github.com/pinpt/agent/pkg/fsconf"
+	"github.com/pinpt/agent/pkg/sysinfo"
+)
+
+// KeyFileEnv is the environment variable with the location of the operator supplied key file. Keys from that file are used as is, so config could be moved to another host together with the key file. When not set, fsconf.Locs.SecretsKeyFile is used, which is created on first use and bound to the host.
+const KeyFileEnv = "PP_AGENT_SECRETS_KEY_FILE"
+
+// Keyring contains keys loaded from the key file. The first key is used to seal values, all keys can be used to unseal.
+type Keyring struct {
+	loc       string
+	hostBound bool
+	// fileKeys are keys as stored in the file
+	fileKeys []string
+	keys     []key
+}
+
+// LoadKeyring loads keys from the operator supplied key file set in KeyFileEnv or from locs.SecretsKeyFile. Creates locs.SecretsKeyFile with a new key if it does not exist.
+func LoadKeyring(locs fsconf.Locs) (*Keyring, error) {
+	loc := os.Getenv(KeyFileEnv)
+	hostBound := loc == ""
+	if hostBound {
+		loc = locs.SecretsKeyFile
+	}
+	b, err := ioutil.ReadFile(loc)
+	if err != nil {
+		if !os.IsNotExist(err) || !hostBound {
+			return nil, fmt.Errorf("could not read secrets key file: %v", err)
+		}
+		k, err := encrypt.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		b = []byte(k)
+		err = writeKeyFile(loc, []string{k})
+		if err != nil {
+			return nil, fmt.Errorf("could not create secrets key file: %v", err)
+		}
+	}
+	var fileKeys []string
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fileKeys = append(fileKeys, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return newKeyring(loc, hostBound, fileKeys)
+}
+
+func newKeyring(loc string, hostBound bool, fileKeys []string) (*Keyring, error) {
+	if len(fileKeys) == 0 {
+		return nil, fmt.Errorf("no keys in secrets key file %v", loc)
+	}
+	s := &Keyring{}
+	s.loc = loc
+	s.hostBound = hostBound
+	s.fileKeys = fileKeys
+	var hostID string
+	if hostBound {
+		var err error
+		hostID, err = sysinfo.GetID2()
+		if err == nil && hostID == "" {
+			err = errors.New("empty host id")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not get host id for secrets key, set PP_AGENT_ID or provide key file in %v, err: %v", KeyFileEnv, err)
+		}
+	}
+	for _, k := range fileKeys {
+		b, err := hex.DecodeString(k)
+		if err != nil || len(b) != 32 {
+			return nil, fmt.Errorf("invalid key in secrets key file %v, want 64 hex characters", loc)
+		}
+		if hostBound {
+			k, err = hostBoundKey(k, hostID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		s.keys = append(s.keys, newKey(k))
+	}
+	return s, nil
+}
+
+// Location returns the location of the key file
+func (s *Keyring) Location() string {
+	return s.loc
+}
+
+// Rotate generates a new key and calls reseal to seal all values again with the new key. Previous keys are removed from the key file after reseal succeeds. Previous keys are kept in the file while reseal runs, so values could be unsealed even if it does not finish.
+func Rotate(locs fsconf.Locs, reseal func(ring *Keyring) error) error {
+	prev, err := LoadKeyring(locs)
+	if err != nil {
+		return err
+	}
+	k, err := encrypt.GenerateKey()
+	if err != nil {
+		return err
+	}
+	ring, err := newKeyring(prev.loc, prev.hostBound, append([]string{k}, prev.fileKeys...))
+	if err != nil {
+		return err
+	}
+	err = writeKeyFile(ring.loc, ring.fileKeys)
+	if err != nil {
+		return fmt.Errorf("could not write secrets key file: %v", err)
+	}
+	err = reseal(ring)
+	if err != nil {
+		return err
+	}
+	return writeKeyFile(ring.loc, ring.fileKeys[:1])
+}
+
+func writeKeyFile(loc string, keys []string) error {
+	if len(keys) == 0 {
+		return errors.New("no keys to write")
+	}
+	err := os.MkdirAll(filepath.Dir(loc), 0700)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("# keys used by pinpoint agent to seal secrets, the first one is current\n")
+	for _, k := range keys {
+		buf.WriteString(k + "\n")
+	}
+	temp := loc + ".tmp"
+	err = ioutil.WriteFile(temp, buf.Bytes(), 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp, loc)
+}
@@ -0,0 +1,103 @@
+// Package secrets seals credentials kept by the agent at rest, such as api keys in config. Values are encrypted using pkg/encrypt with the key from the key file, see LoadKeyring.
+package secrets
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pinpt/agent/pkg/encrypt"
+)
+
+// sealedPrefix marks sealed values, followed by the key id and encrypted value
+const sealedPrefix = "sealed:v1:"
+
+// IsSealed returns true if v was returned by Keyring.Seal
+func IsSealed(v string) bool {
+	return strings.HasPrefix(v, sealedPrefix)
+}
+
+type key struct {
+	id string
+	// hex is the key passed to encrypt
+	hex string
+}
+
+func newKey(keyHex string) key {
+	h := sha256.Sum256([]byte(keyHex))
+	return key{id: hex.EncodeToString(h[:4]), hex: keyHex}
+}
+
+// hostBoundKey returns the key derived from fileKey and host id, so that copying the key file to a different host is not enough to unseal secrets
+func hostBoundKey(fileKey string, hostID string) (string, error) {
+	b, err := hex.DecodeString(fileKey)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, b)
+	mac.Write([]byte(hostID))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Seal encrypts v with the current key. Empty and already sealed values are returned as is.
+func (s *Keyring) Seal(v string) (string, error) {
+	if v == "" || IsSealed(v) {
+		return v, nil
+	}
+	k := s.keys[0]
+	res, err := encrypt.EncryptString(v, k.hex)
+	if err != nil {
+		return "", err
+	}
+	return sealedPrefix + k.id + ":" + res, nil
+}
+
+// Unseal decrypts v sealed with any key in keyring. Values that are not sealed are returned as is, these are values saved by previous versions or added to config manually.
+func (s *Keyring) Unseal(v string) (string, error) {
+	if !IsSealed(v) {
+		return v, nil
+	}
+	parts := strings.SplitN(strings.TrimPrefix(v, sealedPrefix), ":", 2)
+	if len(parts) != 2 {
+		return "", errors.New("invalid sealed value")
+	}
+	id, data := parts[0], parts[1]
+	for _, k := range s.keys {
+		if k.id != id {
+			continue
+		}
+		res, err := encrypt.DecryptString(data, k.hex)
+		if err != nil {
+			return "", fmt.Errorf("could not unseal value: %v", err)
+		}
+		return res, nil
+	}
+	return "", fmt.Errorf("value was sealed with key %v which is not in key file %v", id, s.loc)
+}
+
+// SealAll seals all values in place
+func (s *Keyring) SealAll(values ...*string) error {
+	for _, v := range values {
+		res, err := s.Seal(*v)
+		if err != nil {
+			return err
+		}
+		*v = res
+	}
+	return nil
+}
+
+// UnsealAll unseals all values in place
+func (s *Keyring) UnsealAll(values ...*string) error {
+	for _, v := range values {
+		res, err := s.Unseal(*v)
+		if err != nil {
+			return err
+		}
+		*v = res
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package secrets
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pinpt/agent/pkg/encrypt"
+	"github.com/pinpt/agent/pkg/fsconf"
+	"github.com/stretchr/testify/assert"
+)
+
+func testLocs(t *testing.T) (_ fsconf.Locs, cleanup func()) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("PP_AGENT_ID", "host1")
+	os.Unsetenv(KeyFileEnv)
+	return fsconf.New(dir), func() {
+		os.RemoveAll(dir)
+		os.Unsetenv("PP_AGENT_ID")
+		os.Unsetenv(KeyFileEnv)
+	}
+}
+
+func TestSealUnseal(t *testing.T) {
+	assert := assert.New(t)
+	locs, cleanup := testLocs(t)
+	defer cleanup()
+
+	ring, err := LoadKeyring(locs)
+	assert.NoError(err)
+	assert.Equal(locs.SecretsKeyFile, ring.Location())
+
+	v, err := ring.Seal("secret1")
+	assert.NoError(err)
+	assert.True(IsSealed(v))
+	assert.NotContains(v, "secret1")
+
+	// same key is loaded from file
+	ring, err = LoadKeyring(locs)
+	assert.NoError(err)
+	res, err := ring.Unseal(v)
+	assert.NoError(err)
+	assert.Equal("secret1", res)
+
+	res, err = ring.Unseal("plain")
+	assert.NoError(err)
+	assert.Equal("plain", res)
+
+	res, err = ring.Seal("")
+	assert.NoError(err)
+	assert.Equal("", res)
+}
+
+func TestHostBoundKey(t *testing.T) {
+	assert := assert.New(t)
+	locs, cleanup := testLocs(t)
+	defer cleanup()
+
+	ring, err := LoadKeyring(locs)
+	assert.NoError(err)
+	v, err := ring.Seal("v1")
+	assert.NoError(err)
+
+	// key file copied to a different host
+	os.Setenv("PP_AGENT_ID", "host2")
+	ring, err = LoadKeyring(locs)
+	assert.NoError(err)
+	_, err = ring.Unseal(v)
+	assert.Error(err)
+}
+
+func TestOperatorKeyFile(t *testing.T) {
+	assert := assert.New(t)
+	locs, cleanup := testLocs(t)
+	defer cleanup()
+
+	loc := filepath.Join(locs.Root, "operator.key")
+	os.Setenv(KeyFileEnv, loc)
+	_, err := LoadKeyring(locs)
+	assert.Error(err, "operator key file is not created automatically")
+
+	k, err := encrypt.GenerateKey()
+	assert.NoError(err)
+	assert.NoError(ioutil.WriteFile(loc, []byte(k+"\n"), 0600))
+	ring, err := LoadKeyring(locs)
+	assert.NoError(err)
+	v, err := ring.Seal("v1")
+	assert.NoError(err)
+
+	// operator key is not bound to host
+	os.Setenv("PP_AGENT_ID", "host2")
+	ring, err = LoadKeyring(locs)
+	assert.NoError(err)
+	res, err := ring.Unseal(v)
+	assert.NoError(err)
+	assert.Equal("v1", res)
+}
+
+func TestRotate(t *testing.T) {
+	assert := assert.New(t)
+	locs, cleanup := testLocs(t)
+	defer cleanup()
+
+	ring, err := LoadKeyring(locs)
+	assert.NoError(err)
+	v1, err := ring.Seal("v1")
+	assert.NoError(err)
+
+	var v2 string
+	err = Rotate(locs, func(ring *Keyring) error {
+		// previous key is available during reseal
+		res, err := ring.Unseal(v1)
+		if err != nil {
+			return err
+		}
+		v2, err = ring.Seal(res)
+		return err
+	})
+	assert.NoError(err)
+	assert.NotEqual(v1, v2)
+
+	ring, err = LoadKeyring(locs)
+	assert.NoError(err)
+	res, err := ring.Unseal(v2)
+	assert.NoError(err)
+	assert.Equal("v1", res)
+	_, err = ring.Unseal(v1)
+	assert.Error(err, "previous key is removed after rotate")
+}
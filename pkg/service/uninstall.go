@@ -9,6 +9,7 @@ import (
 	"github.com/pinpt/agent/cmd/cmdrunnorestarts/subcommand"
 	"github.com/pinpt/agent/pkg/agentconf"
 	"github.com/pinpt/agent/pkg/fsconf"
+	"github.com/pinpt/agent/pkg/secrets"
 )
 
 type UninstallOpts struct {
@@ -21,7 +22,11 @@ func UninstallAndDelete(opts UninstallOpts, pinpointRoot string) error {
 
 	fsconf := fsconf.New(pinpointRoot)
 
-	conf, err := agentconf.Load(fsconf.Config2)
+	ring, err := secrets.LoadKeyring(fsconf)
+	if err != nil {
+		return err
+	}
+	conf, err := agentconf.Load(fsconf.Config2, ring)
 	if err != nil {
 		return err
 	}
@@ -75,6 +80,10 @@ func UninstallAndDelete(opts UninstallOpts, pinpointRoot string) error {
 			fsconf.Config2,
 			"config",
 		},
+		{
+			fsconf.SecretsKeyFile,
+			"secrets key",
+		},
 		{
 			fsconf.Temp,
 			"temp",
@@ -56,6 +56,9 @@ type Agent interface {
 	GetWebhookURL() (url string, _ error)
 }
 
+// CheckpointSessionName is the name of the tracking session used to mark a repo/project as completed in the current export job. SessionStart returns non-nil lastProcessed for this session if the project was completed before the export was interrupted and can be skipped. Done marks the project as completed.
+const CheckpointSessionName = "export_checkpoint"
+
 type ExportObj struct {
 	Data interface{}
 }
@@ -26,6 +26,7 @@ import (
 	"github.com/pinpt/agent/pkg/gitclone"
 	"github.com/pinpt/agent/pkg/ids"
 	"github.com/pinpt/agent/pkg/jsonstore"
+	"github.com/pinpt/agent/pkg/kvstore"
 	"github.com/pinpt/agent/pkg/structmarshal"
 
 	"github.com/hashicorp/go-hclog"
@@ -45,7 +46,9 @@ type Opts struct {
 	RefType string
 
 	LastProcessed *jsonstore.Store
-	RepoAccess    gitclone.AccessDetails
+	// State stores ripsrc checkpoints
+	State      *kvstore.Store
+	RepoAccess gitclone.AccessDetails
 
 	// LocalRepo is a path to local repo for easier testing with agent-dev export-repo
 	LocalRepo string
@@ -98,7 +101,7 @@ type Export struct {
 }
 
 func New(opts Opts, locs fsconf.Locs) *Export {
-	if opts.Logger == nil || opts.CustomerID == "" || opts.RepoID == "" || opts.RefType == "" || opts.Sessions == nil || opts.LastProcessed == nil || opts.CommitURLTemplate == "" || opts.BranchURLTemplate == "" || opts.CommitUsers == nil {
+	if opts.Logger == nil || opts.CustomerID == "" || opts.RepoID == "" || opts.RefType == "" || opts.Sessions == nil || opts.LastProcessed == nil || opts.State == nil || opts.CommitURLTemplate == "" || opts.BranchURLTemplate == "" || opts.CommitUsers == nil {
 		panic("provide all params")
 	}
 	s := &Export{}
@@ -158,7 +161,7 @@ func (s *Export) Run(ctx context.Context) (res Result) {
 }
 
 func (s *Export) loadState() error {
-	s.store = filestore.New(s.locs.RipsrcCheckpoints)
+	s.store = kvstore.NewJSONBucket(s.opts.State, kvstore.BucketRipsrcCheckpoints)
 	return s.store.Get(s.opts.RepoID, &s.state)
 }
 
@@ -446,12 +449,22 @@ func CommitIdentifier(repoUniqueName string, sha string) string {
 	return repoUniqueName + "#" + sha[0:7]
 }
 
+// commitStatsFields are the fields of sourcecode.Commit set from commit stats
+var commitStatsFields = []string{"additions", "deletions", "files_changed", "files"}
+
 func (s *Export) commit(commit slimrippy.Commit) error {
 	sessions := s.opts.Sessions
 
 	writeCommit := func(obj sourcecode.Commit) error {
+		data := obj.ToMap()
+		if commit.Stats.Failed {
+			// stats are left out instead of sending zeros, so the commit is not counted as having no changes
+			for _, k := range commitStatsFields {
+				delete(data, k)
+			}
+		}
 		return sessions.Write(s.sessions.Commit, []map[string]interface{}{
-			obj.ToMap(),
+			data,
 		})
 	}
 
@@ -490,6 +503,10 @@ func (s *Export) commit(commit slimrippy.Commit) error {
 		AuthorRefID:    ids.CodeCommitEmail(customerID, commit.Authored.Email),
 		CommitterRefID: ids.CodeCommitEmail(customerID, commit.Committed.Email),
 		Identifier:     CommitIdentifier(s.opts.UniqueName, commit.SHA),
+		Additions:      int64(commit.Stats.Additions),
+		Deletions:      int64(commit.Stats.Deletions),
+		FilesChanged:   int64(commit.Stats.FilesChanged()),
+		Files:          commitFiles(commit.Stats),
 	}
 
 	date.ConvertToModel(commit.Committed.Date, &c.CreatedDate)
@@ -524,6 +541,26 @@ func (s *Export) commit(commit slimrippy.Commit) error {
 	return nil
 }
 
+func commitFiles(stats slimrippy.CommitStats) (res []sourcecode.CommitFiles) {
+	for _, f := range stats.Files {
+		obj := sourcecode.CommitFiles{
+			Filename:  f.Filename,
+			Status:    string(f.Status),
+			Additions: int64(f.Additions),
+			Deletions: int64(f.Deletions),
+			Binary:    f.Binary,
+			Language:  f.Language,
+		}
+		if f.Status == slimrippy.FileStatusRenamed {
+			obj.Renamed = true
+			obj.RenamedFrom = f.RenamedFrom
+			obj.RenamedTo = f.Filename
+		}
+		res = append(res, obj)
+	}
+	return
+}
+
 func commitURL(commitURLTemplate, sha string) string {
 	return strings.ReplaceAll(commitURLTemplate, "@@@sha@@@", sha)
 }
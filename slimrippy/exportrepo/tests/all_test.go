@@ -50,6 +50,12 @@ func TestExportRepoBasic1(t *testing.T) {
 			Sha:            "33e223d1fd8393dc98596727d370e51e7b3b7fba",
 			URL:            "/commit/33e223d1fd8393dc98596727d370e51e7b3b7fba",
 			Identifier:     commitIdentifier("33e223d1fd8393dc98596727d370e51e7b3b7fba"),
+			Additions:      1,
+			Deletions:      0,
+			FilesChanged:   1,
+			Files: []sourcecode.CommitFiles{
+				{Filename: "a.txt", Status: "added", Additions: 1, Deletions: 0},
+			},
 		},
 		{
 			AuthorRefID:    "562d0daa5e0b4946",
@@ -63,6 +69,12 @@ func TestExportRepoBasic1(t *testing.T) {
 			Sha:            "9b39087654af70197f68d0b3d196a4a20d987cd6",
 			URL:            "/commit/9b39087654af70197f68d0b3d196a4a20d987cd6",
 			Identifier:     commitIdentifier("9b39087654af70197f68d0b3d196a4a20d987cd6"),
+			Additions:      1,
+			Deletions:      1,
+			FilesChanged:   1,
+			Files: []sourcecode.CommitFiles{
+				{Filename: "a.txt", Status: "modified", Additions: 1, Deletions: 1},
+			},
 		},
 	}
 
@@ -160,6 +172,12 @@ func TestExportRepoPullRequestBranches(t *testing.T) {
 			Sha:            "33e223d1fd8393dc98596727d370e51e7b3b7fba",
 			URL:            "/commit/33e223d1fd8393dc98596727d370e51e7b3b7fba",
 			Identifier:     commitIdentifier("33e223d1fd8393dc98596727d370e51e7b3b7fba"),
+			Additions:      1,
+			Deletions:      0,
+			FilesChanged:   1,
+			Files: []sourcecode.CommitFiles{
+				{Filename: "a.txt", Status: "added", Additions: 1, Deletions: 0},
+			},
 		},
 		{
 			AuthorRefID:    "562d0daa5e0b4946",
@@ -173,6 +191,12 @@ func TestExportRepoPullRequestBranches(t *testing.T) {
 			Sha:            "9b39087654af70197f68d0b3d196a4a20d987cd6",
 			URL:            "/commit/9b39087654af70197f68d0b3d196a4a20d987cd6",
 			Identifier:     commitIdentifier("9b39087654af70197f68d0b3d196a4a20d987cd6"),
+			Additions:      1,
+			Deletions:      1,
+			FilesChanged:   1,
+			Files: []sourcecode.CommitFiles{
+				{Filename: "a.txt", Status: "modified", Additions: 1, Deletions: 1},
+			},
 		},
 	}
 
@@ -284,6 +308,12 @@ func TestExportRemoteHasRemote(t *testing.T) {
 			Sha:            "63d8e58c077905aa51538184feb66852f02e2856",
 			URL:            "/commit/63d8e58c077905aa51538184feb66852f02e2856",
 			Identifier:     commitIdentifier("63d8e58c077905aa51538184feb66852f02e2856"),
+			Additions:      1,
+			Deletions:      0,
+			FilesChanged:   1,
+			Files: []sourcecode.CommitFiles{
+				{Filename: "f.txt", Status: "added", Additions: 1, Deletions: 0},
+			},
 		},
 		{
 			AuthorRefID:    "562d0daa5e0b4946",
@@ -297,6 +327,12 @@ func TestExportRemoteHasRemote(t *testing.T) {
 			Sha:            "0557506be087faa32994bf07ef7a559cf64123c9",
 			URL:            "/commit/0557506be087faa32994bf07ef7a559cf64123c9",
 			Identifier:     commitIdentifier("0557506be087faa32994bf07ef7a559cf64123c9"),
+			Additions:      1,
+			Deletions:      1,
+			FilesChanged:   1,
+			Files: []sourcecode.CommitFiles{
+				{Filename: "f.txt", Status: "modified", Additions: 1, Deletions: 1},
+			},
 		},
 	}
 
@@ -370,6 +406,12 @@ func TestExportRepoIncremental1(t *testing.T) {
 			Sha:            "63b0ac79015985fe248ba0ea3e34fa464fae1b7a",
 			URL:            "/commit/63b0ac79015985fe248ba0ea3e34fa464fae1b7a",
 			Identifier:     commitIdentifier("63b0ac79015985fe248ba0ea3e34fa464fae1b7a"),
+			Additions:      1,
+			Deletions:      1,
+			FilesChanged:   1,
+			Files: []sourcecode.CommitFiles{
+				{Filename: "a.txt", Status: "modified", Additions: 1, Deletions: 1},
+			},
 		},
 	}
 
@@ -481,6 +523,12 @@ func TestExportRepoIncrementalPullRequests1(t *testing.T) {
 			Sha:            "63b0ac79015985fe248ba0ea3e34fa464fae1b7a",
 			URL:            "/commit/63b0ac79015985fe248ba0ea3e34fa464fae1b7a",
 			Identifier:     commitIdentifier("63b0ac79015985fe248ba0ea3e34fa464fae1b7a"),
+			Additions:      1,
+			Deletions:      1,
+			FilesChanged:   1,
+			Files: []sourcecode.CommitFiles{
+				{Filename: "a.txt", Status: "modified", Additions: 1, Deletions: 1},
+			},
 		},
 	}
 
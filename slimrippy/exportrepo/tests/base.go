@@ -18,6 +18,7 @@ import (
 	"github.com/pinpt/agent/pkg/expsessions"
 	"github.com/pinpt/agent/pkg/fsconf"
 	"github.com/pinpt/agent/pkg/jsonstore"
+	"github.com/pinpt/agent/pkg/kvstore"
 	"github.com/pinpt/agent/slimrippy/exportrepo"
 	"github.com/pinpt/agent/slimrippy/testutil"
 	"github.com/pinpt/integration-sdk/sourcecode"
@@ -51,12 +52,17 @@ func Run(opts Opts) *TestDirs {
 
 	locs := fsconf.New(testDirs.PPRoot)
 
-	lastProcessed, err := jsonstore.New(locs.LastProcessedFile)
+	logger := hclog.New(hclog.DefaultOptions)
+
+	state, err := kvstore.OpenState(logger, locs)
+	if err != nil {
+		panic(err)
+	}
+	lastProcessed, err := jsonstore.New(state)
 	if err != nil {
 		panic(err)
 	}
 
-	logger := hclog.New(hclog.DefaultOptions)
 	ctx := context.Background()
 
 	mockWriters := expsessions.NewMockWriters()
@@ -81,6 +87,7 @@ func Run(opts Opts) *TestDirs {
 	}
 	eo.CustomerID = "c1"
 	eo.LastProcessed = lastProcessed
+	eo.State = state
 	eo.CommitURLTemplate = "/commit/@@@sha@@@"
 	eo.BranchURLTemplate = "/branch/@@@branch@@@"
 	eo.RefType = "git"
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/pinpt/agent/slimrippy/internal/commitstats"
 	"github.com/pinpt/agent/slimrippy/internal/repoutil"
 
 	"gopkg.in/src-d/go-git.v4"
@@ -65,6 +66,8 @@ type Commit struct {
 	Authored  UserAction
 	Committed UserAction
 	Message   string
+	// Stats are not set by Convert, calculated in separate commitstats stage
+	Stats commitstats.Stats
 }
 
 func Commits(ctx context.Context, opts Opts, res chan *object.Commit) (_ State, rerr error) {
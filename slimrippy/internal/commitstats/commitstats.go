@@ -0,0 +1,420 @@
+// Package commitstats calculates per file change statistics for commits.
+package commitstats
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	fdiff "gopkg.in/src-d/go-git.v4/plumbing/format/diff"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// maxDiffFileSize is the size of the file above which line stats are not calculated, the file is counted as binary. Diff loads both versions into memory and its time grows with the number of lines.
+const maxDiffFileSize = 1024 * 1024
+
+// renameMinSimilarity is the minimum percent of the content of removed file found in added file to detect a rename with modifications, same as git default
+const renameMinSimilarity = 50
+
+// maxRenameCandidates limits the number of removed and added files compared by content to detect renames with modifications, similar to git diff.renameLimit
+const maxRenameCandidates = 100
+
+// Status is the type of change for the file
+type Status string
+
+const (
+	StatusAdded    Status = "added"
+	StatusModified Status = "modified"
+	StatusRemoved  Status = "removed"
+	StatusRenamed  Status = "renamed"
+)
+
+// File contains stats for one changed file
+type File struct {
+	// Filename is the path of the file after the change, or before for removed files
+	Filename string
+	Status   Status
+	// RenamedFrom is the previous path of the renamed file
+	RenamedFrom string
+	Additions   int
+	Deletions   int
+	Binary      bool
+	// Language is detected using file extension, empty if unknown
+	Language string
+}
+
+// Stats contains change statistics for the commit
+type Stats struct {
+	Additions int
+	Deletions int
+	Files     []File
+	// Failed is set when stats could not be calculated, other fields are empty
+	Failed bool
+}
+
+// FilesChanged returns the number of changed files
+func (s Stats) FilesChanged() int {
+	return len(s.Files)
+}
+
+// Languages returns the number of changed lines per language
+func (s Stats) Languages() map[string]int {
+	res := map[string]int{}
+	for _, f := range s.Files {
+		if f.Language == "" {
+			continue
+		}
+		res[f.Language] += f.Additions + f.Deletions
+	}
+	return res
+}
+
+// Calculate returns stats for the commit compared to the first parent. Same as git show --stat --first-parent for merge commits.
+func Calculate(ctx context.Context, commit *object.Commit) (res Stats, rerr error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		rerr = err
+		return
+	}
+	parentTree := &object.Tree{}
+	if commit.NumParents() != 0 {
+		parent, err := commit.Parents().Next()
+		if err != nil {
+			rerr = err
+			return
+		}
+		parentTree, err = parent.Tree()
+		if err != nil {
+			rerr = err
+			return
+		}
+	}
+	changes, err := object.DiffTreeContext(ctx, parentTree, tree)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	fileChanges, err := detectRenames(changes)
+	if err != nil {
+		rerr = err
+		return
+	}
+
+	for _, change := range fileChanges {
+		f := File{}
+		switch {
+		case change.RenamedFrom != "":
+			f.Filename = change.To.Name
+			f.Status = StatusRenamed
+			f.RenamedFrom = change.RenamedFrom
+		case change.From.Name == "":
+			f.Filename = change.To.Name
+			f.Status = StatusAdded
+		case change.To.Name == "":
+			f.Filename = change.From.Name
+			f.Status = StatusRemoved
+		default:
+			f.Filename = change.To.Name
+			f.Status = StatusModified
+		}
+		err := fileStats(ctx, change.Change, &f)
+		if err != nil {
+			rerr = err
+			return
+		}
+		res.Files = append(res.Files, f)
+	}
+
+	for i := range res.Files {
+		f := &res.Files[i]
+		f.Language = language(f.Filename)
+		res.Additions += f.Additions
+		res.Deletions += f.Deletions
+	}
+	sort.Slice(res.Files, func(i, j int) bool {
+		return res.Files[i].Filename < res.Files[j].Filename
+	})
+	return
+}
+
+// fileStats sets additions, deletions and binary flag of the file. Binary and oversized files are detected before calculating the diff.
+func fileStats(ctx context.Context, change *object.Change, f *File) error {
+	if change.From.Name != "" && change.To.Name != "" && change.From.TreeEntry.Hash == change.To.TreeEntry.Hash {
+		// renamed without modifications
+		return nil
+	}
+	from, to, err := change.Files()
+	if err != nil {
+		return err
+	}
+	for _, file := range []*object.File{from, to} {
+		if file == nil {
+			continue
+		}
+		if file.Size > maxDiffFileSize {
+			f.Binary = true
+			return nil
+		}
+		binary, err := file.IsBinary()
+		if err != nil {
+			return err
+		}
+		if binary {
+			f.Binary = true
+			return nil
+		}
+	}
+	patch, err := change.PatchContext(ctx)
+	if err != nil {
+		return err
+	}
+	for _, fp := range patch.FilePatches() {
+		if fp.IsBinary() {
+			f.Binary = true
+			continue
+		}
+		for _, chunk := range fp.Chunks() {
+			switch chunk.Type() {
+			case fdiff.Add:
+				f.Additions += countLines(chunk.Content())
+			case fdiff.Delete:
+				f.Deletions += countLines(chunk.Content())
+			}
+		}
+	}
+	return nil
+}
+
+// fileChange is a change of one file. Renames are returned as a single change from removed to added file with RenamedFrom set.
+type fileChange struct {
+	*object.Change
+	RenamedFrom string
+}
+
+// detectRenames finds removed and added files with the same content first, then the ones with similar content. Similarity is only checked when there are at most maxRenameCandidates removed and added files.
+func detectRenames(changes object.Changes) (res []fileChange, _ error) {
+	var removed, added []*object.Change
+	for _, c := range changes {
+		switch {
+		case c.To.Name == "":
+			removed = append(removed, c)
+		case c.From.Name == "":
+			added = append(added, c)
+		default:
+			res = append(res, fileChange{Change: c})
+		}
+	}
+	matched := map[*object.Change]bool{}
+	rename := func(from, to *object.Change) {
+		matched[from] = true
+		matched[to] = true
+		res = append(res, fileChange{
+			Change:      &object.Change{From: from.From, To: to.To},
+			RenamedFrom: from.From.Name,
+		})
+	}
+
+	// exact renames
+	removedByHash := map[plumbing.Hash][]*object.Change{}
+	for _, c := range removed {
+		h := c.From.TreeEntry.Hash
+		removedByHash[h] = append(removedByHash[h], c)
+	}
+	for _, c := range added {
+		h := c.To.TreeEntry.Hash
+		candidates := removedByHash[h]
+		if len(candidates) == 0 {
+			continue
+		}
+		removedByHash[h] = candidates[1:]
+		rename(candidates[0], c)
+	}
+
+	// renames with modifications
+	var removedLeft, addedLeft []*object.Change
+	for _, c := range removed {
+		if !matched[c] {
+			removedLeft = append(removedLeft, c)
+		}
+	}
+	for _, c := range added {
+		if !matched[c] {
+			addedLeft = append(addedLeft, c)
+		}
+	}
+	if len(removedLeft) != 0 && len(addedLeft) != 0 && len(removedLeft) <= maxRenameCandidates && len(addedLeft) <= maxRenameCandidates {
+		pairs, err := similarFiles(removedLeft, addedLeft)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range pairs {
+			if matched[p.from] || matched[p.to] {
+				continue
+			}
+			rename(p.from, p.to)
+		}
+	}
+
+	for _, c := range removed {
+		if !matched[c] {
+			res = append(res, fileChange{Change: c})
+		}
+	}
+	for _, c := range added {
+		if !matched[c] {
+			res = append(res, fileChange{Change: c})
+		}
+	}
+	return
+}
+
+type similarPair struct {
+	from  *object.Change
+	to    *object.Change
+	score int
+}
+
+// similarFiles returns pairs of removed and added files with similarity of at least renameMinSimilarity, most similar first
+func similarFiles(removed, added []*object.Change) (res []similarPair, _ error) {
+	var removedContent, addedContent []*fileContent
+	for _, c := range removed {
+		from, _, err := c.Files()
+		if err != nil {
+			return nil, err
+		}
+		content, err := newFileContent(from)
+		if err != nil {
+			return nil, err
+		}
+		removedContent = append(removedContent, content)
+	}
+	for _, c := range added {
+		_, to, err := c.Files()
+		if err != nil {
+			return nil, err
+		}
+		content, err := newFileContent(to)
+		if err != nil {
+			return nil, err
+		}
+		addedContent = append(addedContent, content)
+	}
+	for i, from := range removedContent {
+		if from == nil {
+			continue
+		}
+		for j, to := range addedContent {
+			if to == nil {
+				continue
+			}
+			score := from.similarity(to)
+			if score >= renameMinSimilarity {
+				res = append(res, similarPair{from: removed[i], to: added[j], score: score})
+			}
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].score > res[j].score
+	})
+	return
+}
+
+// fileContent contains the number of occurrences of each line in the file
+type fileContent struct {
+	size  int
+	lines map[string]int
+}
+
+// newFileContent returns nil for binary and oversized files, these are not checked for similarity
+func newFileContent(f *object.File) (*fileContent, error) {
+	if f == nil || f.Size > maxDiffFileSize || f.Size == 0 {
+		return nil, nil
+	}
+	binary, err := f.IsBinary()
+	if err != nil || binary {
+		return nil, err
+	}
+	data, err := f.Contents()
+	if err != nil {
+		return nil, err
+	}
+	res := &fileContent{}
+	res.size = len(data)
+	res.lines = map[string]int{}
+	for _, line := range strings.SplitAfter(data, "\n") {
+		if line != "" {
+			res.lines[line]++
+		}
+	}
+	return res, nil
+}
+
+// similarity returns the percent of bytes in common lines compared to the larger file, similar to git rename score
+func (s *fileContent) similarity(other *fileContent) int {
+	common := 0
+	for line, n := range s.lines {
+		if m := other.lines[line]; m < n {
+			common += m * len(line)
+		} else {
+			common += n * len(line)
+		}
+	}
+	max := s.size
+	if other.size > max {
+		max = other.size
+	}
+	return common * 100 / max
+}
+
+// countLines counts lines in the diff chunk the same way as git, last line may not have newline
+func countLines(s string) int {
+	if len(s) == 0 {
+		return 0
+	}
+	res := strings.Count(s, "\n")
+	if s[len(s)-1] != '\n' {
+		res++
+	}
+	return res
+}
+
+var languages = map[string]string{
+	".c":     "C",
+	".h":     "C",
+	".cc":    "C++",
+	".cpp":   "C++",
+	".hpp":   "C++",
+	".cs":    "C#",
+	".css":   "CSS",
+	".scss":  "SCSS",
+	".go":    "Go",
+	".html":  "HTML",
+	".java":  "Java",
+	".js":    "JavaScript",
+	".jsx":   "JavaScript",
+	".json":  "JSON",
+	".kt":    "Kotlin",
+	".m":     "Objective-C",
+	".md":    "Markdown",
+	".php":   "PHP",
+	".pl":    "Perl",
+	".py":    "Python",
+	".rb":    "Ruby",
+	".rs":    "Rust",
+	".scala": "Scala",
+	".sh":    "Shell",
+	".sql":   "SQL",
+	".swift": "Swift",
+	".ts":    "TypeScript",
+	".tsx":   "TypeScript",
+	".xml":   "XML",
+	".yaml":  "YAML",
+	".yml":   "YAML",
+}
+
+func language(filename string) string {
+	return languages[strings.ToLower(filepath.Ext(filename))]
+}
@@ -0,0 +1,84 @@
+package commitstats
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pinpt/agent/slimrippy/testutil"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+func testStats(t *testing.T, sha string) Stats {
+	dirs := testutil.UnzipTestRepo("stats")
+	defer dirs.Remove()
+
+	repo, err := git.PlainOpen(dirs.RepoDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.CommitObject(plumbing.NewHash(sha))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Calculate(context.Background(), commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestFirstCommit(t *testing.T) {
+	got := testStats(t, "a3388821ada155999a4b1d061e72b44f092c4a96")
+	want := Stats{
+		Additions: 7,
+		Files: []File{
+			{Filename: "img.bin", Status: StatusAdded, Binary: true},
+			{Filename: "main.go", Status: StatusAdded, Additions: 4, Language: "Go"},
+			{Filename: "readme.md", Status: StatusAdded, Additions: 3, Language: "Markdown"},
+		},
+	}
+	assert.Equal(t, want, got)
+	assert.Equal(t, map[string]int{"Go": 4, "Markdown": 3}, got.Languages())
+}
+
+func TestRenameAndModify(t *testing.T) {
+	got := testStats(t, "1ef1a459e7fafd3d395f274454c2ac0905c39969")
+	want := Stats{
+		Additions: 2,
+		Deletions: 1,
+		Files: []File{
+			{Filename: "docs.md", Status: StatusRenamed, RenamedFrom: "readme.md", Language: "Markdown"},
+			{Filename: "img.bin", Status: StatusModified, Binary: true},
+			// last line without newline
+			{Filename: "main.go", Status: StatusModified, Additions: 2, Deletions: 1, Language: "Go"},
+		},
+	}
+	assert.Equal(t, want, got)
+	assert.Equal(t, 3, got.FilesChanged())
+}
+
+func TestRemove(t *testing.T) {
+	got := testStats(t, "a386adc559cfea56c7b3506b898855b81d928d24")
+	want := Stats{
+		Files: []File{
+			{Filename: "img.bin", Status: StatusRemoved, Binary: true},
+		},
+	}
+	assert.Equal(t, want, got)
+}
+
+func TestRenameWithModificationsAndLargeFile(t *testing.T) {
+	got := testStats(t, "7e758a39e4ce10c5fbe1b958eaacca4839e9892b")
+	want := Stats{
+		Additions: 1,
+		Deletions: 1,
+		Files: []File{
+			// larger than maxDiffFileSize, line stats are not calculated
+			{Filename: "big.txt", Status: StatusAdded, Binary: true},
+			{Filename: "cmd.go", Status: StatusRenamed, RenamedFrom: "main.go", Additions: 1, Deletions: 1, Language: "Go"},
+		},
+	}
+	assert.Equal(t, want, got)
+}
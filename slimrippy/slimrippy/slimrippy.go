@@ -11,12 +11,16 @@ import (
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/pinpt/agent/slimrippy/internal/commits"
+	"github.com/pinpt/agent/slimrippy/internal/commitstats"
 	"github.com/pinpt/agent/slimrippy/internal/parentsgraph"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
 )
 
 type Branch = branches.Branch
 type Commit = commits.Commit
+type CommitStats = commitstats.Stats
+
+const FileStatusRenamed = commitstats.StatusRenamed
 
 type BranchLastCommit = branchmeta.Branch
 
@@ -66,7 +70,16 @@ func CommitsAndBranches(ctx context.Context, opts Opts) (_ State, rerr error) {
 			for c := range commitsChan {
 				commitsForParents <- c
 				if opts.CommitCallback != nil {
-					err := opts.CommitCallback(commits.Convert(c))
+					commit := commits.Convert(c)
+					stats, err := commitstats.Calculate(ctx, c)
+					if err != nil {
+						// do not fail the export, commit is sent without stats
+						logger.Error("could not calculate commit stats", "sha", commit.SHA, "err", err)
+						commit.Stats.Failed = true
+					} else {
+						commit.Stats = stats
+					}
+					err = opts.CommitCallback(commit)
 					if err != nil {
 						panic(err)
 					}